@@ -0,0 +1,89 @@
+// Command migrate applies, reverts or lists the database migrations.
+//
+//	go run ./cmd/migrate up        apply every pending migration
+//	go run ./cmd/migrate down [n]  revert the last n migrations (default 1)
+//	go run ./cmd/migrate status    list migrations and when they were applied
+//
+// The database is configured as for the server, from the environment and
+// the file named by CONFIG_FILE.
+package main
+
+import (
+	"JobScoop/config"
+	"JobScoop/internal/db"
+	"JobScoop/internal/logging"
+	"JobScoop/internal/migrate"
+	"JobScoop/migrations"
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cfg, err := config.Load("")
+	if err == nil {
+		err = cfg.Database.Validate()
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	slog.SetDefault(logging.New(os.Stderr, cfg.Log))
+	if err := db.ConnectDB(cfg.Database); err != nil {
+		log.Fatal(err)
+	}
+	defer db.DB.Close()
+
+	migrator, err := migrate.New(db.DB, migrations.FS)
+	if err != nil {
+		log.Fatalf("Error loading migrations: %v", err)
+	}
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				usage()
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		fmt.Printf("Reverted %d migration(s)\n", len(reverted))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Error reading migration status: %v", err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-40s %s\n", status.Migration, applied)
+		}
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate up | down [n] | status")
+	os.Exit(2)
+}
@@ -0,0 +1,619 @@
+// Package config loads the server's settings from defaults, an optional
+// YAML or JSON file and the environment, in increasing order of precedence.
+//
+// Environment variables may also come from a .env file in the working
+// directory; variables already set in the environment win over it.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the server's configuration. Zero durations and limits mean the
+// default of the package that uses them.
+type Config struct {
+	Server    Server     `yaml:"server"`
+	Database  Database   `yaml:"database"`
+	Auth      Auth       `yaml:"auth"`
+	SMTP      SMTP       `yaml:"smtp"`
+	Jobs      Jobs       `yaml:"jobs"`
+	Crawler   Crawler    `yaml:"crawler"`
+	Digest    Digest     `yaml:"digest"`
+	Log       Log        `yaml:"log"`
+	RateLimit RateLimits `yaml:"rate_limit"`
+	OIDC      OIDC       `yaml:"oidc"`
+}
+
+// Server configures the HTTP listener.
+type Server struct {
+	Port          int           `yaml:"port"`           // SERVER_PORT
+	CORSOrigins   []string      `yaml:"cors_origins"`   // CORS_ORIGINS, comma separated; "*" allows any origin
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"` // SHUTDOWN_DELAY: how long /readyz fails before the listener closes
+	AppURL        string        `yaml:"app_url"`        // APP_URL: where the web app is served, for the links in emails
+	// TRUSTED_PROXIES, comma separated IPs or CIDR ranges of the proxies in
+	// front of the server, whose X-Forwarded-For and X-Real-IP are believed
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// Database locates the Postgres database.
+type Database struct {
+	Host     string `yaml:"host"`     // DB_HOST
+	Port     int    `yaml:"port"`     // DB_PORT
+	User     string `yaml:"user"`     // DB_USER
+	Password string `yaml:"password"` // DB_PASSWORD
+	Name     string `yaml:"name"`     // DB_NAME
+	SSLMode  string `yaml:"sslmode"`  // DB_SSLMODE
+}
+
+// DSN returns the lib/pq connection string for d.
+func (d Database) DSN() string {
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return fmt.Sprintf("host='%s' port=%d user='%s' password='%s' dbname='%s' sslmode='%s'",
+		quote.Replace(d.Host), d.Port, quote.Replace(d.User), quote.Replace(d.Password),
+		quote.Replace(d.Name), quote.Replace(d.SSLMode))
+}
+
+// Auth configures the tokens handed to signed-in users.
+type Auth struct {
+	JWTSecret        string        `yaml:"jwt_secret"`         // JWT_TOKEN
+	AccessTokenTTL   time.Duration `yaml:"access_token_ttl"`   // ACCESS_TOKEN_TTL: how long an access token is valid
+	RefreshTokenTTL  time.Duration `yaml:"refresh_token_ttl"`  // REFRESH_TOKEN_TTL: how long a login lasts before logging in again
+	MaxLoginFailures int           `yaml:"max_login_failures"` // MAX_LOGIN_FAILURES: failed logins in a row from one address that lock the account for it
+	LockoutDuration  time.Duration `yaml:"lockout_duration"`   // LOCKOUT_DURATION: how long a locked account stays locked
+	VerificationTTL  time.Duration `yaml:"verification_ttl"`   // VERIFICATION_TTL: how long an email verification link works
+}
+
+// SMTP configures outbound email. From defaults to User.
+type SMTP struct {
+	Host string `yaml:"host"` // SMTP_HOST
+	Port string `yaml:"port"` // SMTP_PORT
+	User string `yaml:"user"` // SMTP_USER
+	Pass string `yaml:"pass"` // SMTP_PASS
+	From string `yaml:"from"` // SMTP_FROM
+}
+
+// Jobs configures the job board searches.
+type Jobs struct {
+	ScrapingDogAPIKey string                   `yaml:"scraping_dog_api_key"` // SCRAPING_DOG_API_KEY
+	Sources           []string                 `yaml:"sources"`              // JOB_SOURCES; every source when empty
+	FetchConcurrency  int                      `yaml:"fetch_concurrency"`    // JOB_FETCH_CONCURRENCY
+	SourceTimeout     time.Duration            `yaml:"source_timeout"`       // JOB_SOURCE_TIMEOUT
+	SourceTimeouts    map[string]time.Duration `yaml:"source_timeouts"`      // JOB_SOURCE_TIMEOUT_<NAME>
+}
+
+// Crawler configures the background crawl.
+type Crawler struct {
+	Interval time.Duration `yaml:"interval"` // CRAWL_INTERVAL
+	MaxAge   time.Duration `yaml:"max_age"`  // CRAWL_MAX_AGE: /readyz fails when the last successful crawl is older; twice the interval when zero
+}
+
+// Digest configures the job digest emails.
+type Digest struct {
+	Interval time.Duration `yaml:"interval"` // DIGEST_INTERVAL
+}
+
+// Log configures the server's logs.
+type Log struct {
+	Level  string `yaml:"level"`  // LOG_LEVEL: debug, info, warn or error
+	Format string `yaml:"format"` // LOG_FORMAT: text or json
+}
+
+// OIDC configures signing in with accounts at OpenID Connect providers,
+// such as Google or a company's identity provider, and at GitHub.
+type OIDC struct {
+	// Providers by the name in their routes, such as google. OIDC_PROVIDERS
+	// lists more, comma separated; each one's settings are read from
+	// OIDC_<NAME>_<SETTING>, such as OIDC_GOOGLE_CLIENT_ID.
+	Providers map[string]OIDCProvider `yaml:"providers"`
+}
+
+// OIDCProvider is one provider users can sign in with.
+type OIDCProvider struct {
+	Type         string   `yaml:"type"`          // OIDC_<NAME>_TYPE: oidc, the default, or github
+	Issuer       string   `yaml:"issuer"`        // OIDC_<NAME>_ISSUER: whose /.well-known/openid-configuration locates the endpoints
+	ClientID     string   `yaml:"client_id"`     // OIDC_<NAME>_CLIENT_ID
+	ClientSecret string   `yaml:"client_secret"` // OIDC_<NAME>_CLIENT_SECRET
+	Scopes       []string `yaml:"scopes"`        // OIDC_<NAME>_SCOPES, comma separated; the type's usual scopes when empty
+
+	// GitHub has no discovery document; its endpoints default to
+	// github.com's.
+	AuthURL  string `yaml:"auth_url"`  // OIDC_<NAME>_AUTH_URL
+	TokenURL string `yaml:"token_url"` // OIDC_<NAME>_TOKEN_URL
+	APIURL   string `yaml:"api_url"`   // OIDC_<NAME>_API_URL
+}
+
+// RateLimits configures how often the routes open to anyone may be called,
+// per client address and per account (the email in the request, or the
+// signed-in user when resending a verification email). Unlike other
+// settings, a zero Rate turns its limit off.
+type RateLimits struct {
+	Store          string     `yaml:"store"` // RATE_LIMIT_STORE: memory, or postgres to share the limits between instances
+	Signup         RouteLimit `yaml:"signup"`
+	Login          RouteLimit `yaml:"login"`
+	LoginMFA       RouteLimit `yaml:"login_mfa"`
+	Refresh        RouteLimit `yaml:"refresh"`
+	ForgotPassword RouteLimit `yaml:"forgot_password"`
+	VerifyCode     RouteLimit `yaml:"verify_code"`
+	ResetPassword  RouteLimit `yaml:"reset_password"`
+	VerifyEmail    RouteLimit `yaml:"verify_email"`
+	OIDC           RouteLimit `yaml:"oidc"` // shared by starting and finishing a sign-in
+	// ResendVerification throttles the verification emails a user can
+	// have sent to their address.
+	ResendVerification RouteLimit `yaml:"resend_verification"`
+}
+
+// RouteLimit limits one route; RATE_LIMIT_<ROUTE>_IP and
+// RATE_LIMIT_<ROUTE>_ACCOUNT, such as RATE_LIMIT_LOGIN_IP=20/1m.
+type RouteLimit struct {
+	IP      Rate `yaml:"ip"`
+	Account Rate `yaml:"account"`
+}
+
+// Rate is a number of requests per period, written "10/15m". "off" is the
+// zero Rate.
+type Rate struct {
+	Count int
+	Per   time.Duration
+}
+
+// ParseRate parses a rate such as "10/15m", or "off".
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" {
+		return Rate{}, nil
+	}
+	count, per, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n < 0 {
+		return Rate{}, fmt.Errorf("rate must be a count per duration such as \"10/15m\", or \"off\", got %q", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("rate must be a count per duration such as \"10/15m\", or \"off\", got %q", s)
+	}
+	return Rate{Count: n, Per: d}, nil
+}
+
+// UnmarshalText reads a Rate written as ParseRate expects.
+func (r *Rate) UnmarshalText(text []byte) error {
+	rate, err := ParseRate(string(text))
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+// String writes r as ParseRate reads it.
+func (r Rate) String() string {
+	if r.Count == 0 {
+		return "off"
+	}
+	return strconv.Itoa(r.Count) + "/" + r.Per.String()
+}
+
+// Default returns the settings used for whatever the file and environment
+// leave unset.
+func Default() *Config {
+	return &Config{
+		Server:   Server{Port: 8080, CORSOrigins: []string{"http://localhost:3000"}, AppURL: "http://localhost:3000"},
+		Database: Database{Host: "localhost", Port: 5432, SSLMode: "disable"},
+		Log:      Log{Level: "info", Format: "text"},
+		RateLimit: RateLimits{
+			Store:          "memory",
+			Signup:         RouteLimit{IP: Rate{10, time.Hour}},
+			Login:          RouteLimit{IP: Rate{20, time.Minute}, Account: Rate{10, 5 * time.Minute}},
+			LoginMFA:       RouteLimit{IP: Rate{20, time.Minute}, Account: Rate{10, 5 * time.Minute}},
+			Refresh:        RouteLimit{IP: Rate{60, time.Minute}},
+			ForgotPassword: RouteLimit{IP: Rate{5, 15 * time.Minute}, Account: Rate{3, 15 * time.Minute}},
+			VerifyCode:     RouteLimit{IP: Rate{20, 15 * time.Minute}, Account: Rate{10, 15 * time.Minute}},
+			ResetPassword:  RouteLimit{IP: Rate{10, 15 * time.Minute}, Account: Rate{5, 15 * time.Minute}},
+			VerifyEmail:    RouteLimit{IP: Rate{20, 15 * time.Minute}},
+			OIDC:           RouteLimit{IP: Rate{30, time.Minute}},
+
+			ResendVerification: RouteLimit{IP: Rate{10, time.Hour}, Account: Rate{3, time.Hour}},
+		},
+	}
+}
+
+// routeLimits lists the rate limited routes by the name their environment
+// variables use.
+func (r *RateLimits) routeLimits() []struct {
+	name  string
+	limit *RouteLimit
+} {
+	return []struct {
+		name  string
+		limit *RouteLimit
+	}{
+		{"SIGNUP", &r.Signup},
+		{"LOGIN", &r.Login},
+		{"LOGIN_MFA", &r.LoginMFA},
+		{"REFRESH", &r.Refresh},
+		{"FORGOT_PASSWORD", &r.ForgotPassword},
+		{"VERIFY_CODE", &r.VerifyCode},
+		{"RESET_PASSWORD", &r.ResetPassword},
+		{"VERIFY_EMAIL", &r.VerifyEmail},
+		{"OIDC", &r.OIDC},
+		{"RESEND_VERIFICATION", &r.ResendVerification},
+	}
+}
+
+// Load reads the configuration. path names a YAML or JSON file; when empty,
+// CONFIG_FILE is used, and when that is unset too only the environment is
+// read. A missing .env file is not an error.
+func Load(path string) (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("config: reading .env: %w", err)
+	}
+
+	cfg := Default()
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(os.LookupEnv, os.Environ()); err != nil {
+		return nil, err
+	}
+	if cfg.SMTP.From == "" {
+		cfg.SMTP.From = cfg.SMTP.User
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the settings in the file at path. JSON is read by the
+// YAML decoder, which accepts it as is.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overlays the settings found by lookup. environ lists the
+// variables so per-source timeouts can be discovered.
+func (c *Config) loadEnv(lookup func(string) (string, bool), environ []string) error {
+	env := envReader{lookup: lookup}
+
+	env.int("SERVER_PORT", &c.Server.Port)
+	env.list("CORS_ORIGINS", &c.Server.CORSOrigins)
+	env.list("TRUSTED_PROXIES", &c.Server.TrustedProxies)
+	env.duration("SHUTDOWN_DELAY", &c.Server.ShutdownDelay)
+	env.string("APP_URL", &c.Server.AppURL)
+
+	env.string("DB_HOST", &c.Database.Host)
+	env.int("DB_PORT", &c.Database.Port)
+	env.string("DB_USER", &c.Database.User)
+	env.string("DB_PASSWORD", &c.Database.Password)
+	env.string("DB_NAME", &c.Database.Name)
+	env.string("DB_SSLMODE", &c.Database.SSLMode)
+
+	env.string("JWT_TOKEN", &c.Auth.JWTSecret)
+	env.duration("ACCESS_TOKEN_TTL", &c.Auth.AccessTokenTTL)
+	env.duration("REFRESH_TOKEN_TTL", &c.Auth.RefreshTokenTTL)
+	env.int("MAX_LOGIN_FAILURES", &c.Auth.MaxLoginFailures)
+	env.duration("LOCKOUT_DURATION", &c.Auth.LockoutDuration)
+	env.duration("VERIFICATION_TTL", &c.Auth.VerificationTTL)
+
+	env.string("SMTP_HOST", &c.SMTP.Host)
+	env.string("SMTP_PORT", &c.SMTP.Port)
+	env.string("SMTP_USER", &c.SMTP.User)
+	env.string("SMTP_PASS", &c.SMTP.Pass)
+	env.string("SMTP_FROM", &c.SMTP.From)
+
+	env.string("SCRAPING_DOG_API_KEY", &c.Jobs.ScrapingDogAPIKey)
+	env.list("JOB_SOURCES", &c.Jobs.Sources)
+	env.int("JOB_FETCH_CONCURRENCY", &c.Jobs.FetchConcurrency)
+	env.duration("JOB_SOURCE_TIMEOUT", &c.Jobs.SourceTimeout)
+	const sourceTimeoutPrefix = "JOB_SOURCE_TIMEOUT_"
+	for _, entry := range environ {
+		key, _, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(key, sourceTimeoutPrefix) || key == sourceTimeoutPrefix {
+			continue
+		}
+		var timeout time.Duration
+		if env.duration(key, &timeout) {
+			if c.Jobs.SourceTimeouts == nil {
+				c.Jobs.SourceTimeouts = make(map[string]time.Duration)
+			}
+			c.Jobs.SourceTimeouts[strings.ToLower(strings.TrimPrefix(key, sourceTimeoutPrefix))] = timeout
+		}
+	}
+
+	env.duration("CRAWL_INTERVAL", &c.Crawler.Interval)
+	env.duration("CRAWL_MAX_AGE", &c.Crawler.MaxAge)
+	env.duration("DIGEST_INTERVAL", &c.Digest.Interval)
+
+	env.string("LOG_LEVEL", &c.Log.Level)
+	env.string("LOG_FORMAT", &c.Log.Format)
+
+	env.string("RATE_LIMIT_STORE", &c.RateLimit.Store)
+	for _, route := range c.RateLimit.routeLimits() {
+		env.rate("RATE_LIMIT_"+route.name+"_IP", &route.limit.IP)
+		env.rate("RATE_LIMIT_"+route.name+"_ACCOUNT", &route.limit.Account)
+	}
+
+	var providers []string
+	env.list("OIDC_PROVIDERS", &providers)
+	for _, name := range providers {
+		name = strings.ToLower(name)
+		if _, ok := c.OIDC.Providers[name]; !ok {
+			if c.OIDC.Providers == nil {
+				c.OIDC.Providers = make(map[string]OIDCProvider)
+			}
+			c.OIDC.Providers[name] = OIDCProvider{}
+		}
+	}
+	for name, provider := range c.OIDC.Providers {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		env.string(prefix+"TYPE", &provider.Type)
+		env.string(prefix+"ISSUER", &provider.Issuer)
+		env.string(prefix+"CLIENT_ID", &provider.ClientID)
+		env.string(prefix+"CLIENT_SECRET", &provider.ClientSecret)
+		env.list(prefix+"SCOPES", &provider.Scopes)
+		env.string(prefix+"AUTH_URL", &provider.AuthURL)
+		env.string(prefix+"TOKEN_URL", &provider.TokenURL)
+		env.string(prefix+"API_URL", &provider.APIURL)
+		c.OIDC.Providers[name] = provider
+	}
+
+	return errors.Join(env.errs...)
+}
+
+// Validate reports every missing or out of range setting the server needs.
+func (c *Config) Validate() error {
+	errs := []error{c.Database.Validate()}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("SERVER_PORT (server.port) must be between 1 and 65535, got %d", c.Server.Port))
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		errs = append(errs, errors.New("CORS_ORIGINS (server.cors_origins) is required"))
+	}
+	if !httpURL(c.Server.AppURL) {
+		errs = append(errs, fmt.Errorf("APP_URL (server.app_url) must be an http or https URL, got %q", c.Server.AppURL))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if !validProxy(proxy) {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES (server.trusted_proxies) must be IP addresses or CIDR ranges, got %q", proxy))
+		}
+	}
+	if c.Auth.JWTSecret == "" {
+		errs = append(errs, errors.New("JWT_TOKEN (auth.jwt_secret) is required"))
+	}
+	if c.SMTP.Host != "" && c.SMTP.Port == "" {
+		errs = append(errs, errors.New("SMTP_PORT (smtp.port) is required when SMTP_HOST is set"))
+	}
+	if c.Auth.MaxLoginFailures < 0 {
+		errs = append(errs, errors.New("MAX_LOGIN_FAILURES (auth.max_login_failures) must not be negative"))
+	}
+	if c.Jobs.FetchConcurrency < 0 {
+		errs = append(errs, errors.New("JOB_FETCH_CONCURRENCY (jobs.fetch_concurrency) must not be negative"))
+	}
+	for _, setting := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"JOB_SOURCE_TIMEOUT (jobs.source_timeout)", c.Jobs.SourceTimeout},
+		{"SHUTDOWN_DELAY (server.shutdown_delay)", c.Server.ShutdownDelay},
+		{"ACCESS_TOKEN_TTL (auth.access_token_ttl)", c.Auth.AccessTokenTTL},
+		{"REFRESH_TOKEN_TTL (auth.refresh_token_ttl)", c.Auth.RefreshTokenTTL},
+		{"LOCKOUT_DURATION (auth.lockout_duration)", c.Auth.LockoutDuration},
+		{"VERIFICATION_TTL (auth.verification_ttl)", c.Auth.VerificationTTL},
+		{"CRAWL_INTERVAL (crawler.interval)", c.Crawler.Interval},
+		{"CRAWL_MAX_AGE (crawler.max_age)", c.Crawler.MaxAge},
+		{"DIGEST_INTERVAL (digest.interval)", c.Digest.Interval},
+	} {
+		if setting.d < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", setting.name))
+		}
+	}
+	sources := make([]string, 0, len(c.Jobs.SourceTimeouts))
+	for source := range c.Jobs.SourceTimeouts {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		if c.Jobs.SourceTimeouts[source] <= 0 {
+			errs = append(errs, fmt.Errorf("the timeout for source %q must be positive", source))
+		}
+	}
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_LEVEL (log.level) must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT (log.format) must be text or json, got %q", c.Log.Format))
+	}
+	if c.RateLimit.Store != "memory" && c.RateLimit.Store != "postgres" {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_STORE (rate_limit.store) must be memory or postgres, got %q", c.RateLimit.Store))
+	}
+	// Buckets unused for a day are forgotten, so they must refill sooner
+	for _, route := range c.RateLimit.routeLimits() {
+		for _, rate := range []struct {
+			kind string
+			rate Rate
+		}{{"IP", route.limit.IP}, {"ACCOUNT", route.limit.Account}} {
+			if rate.rate.Per > 24*time.Hour {
+				errs = append(errs, fmt.Errorf("RATE_LIMIT_%s_%s (rate_limit.%s.%s) must refill within 24h, got %s",
+					route.name, rate.kind, strings.ToLower(route.name), strings.ToLower(rate.kind), rate.rate))
+			}
+		}
+	}
+	errs = append(errs, c.OIDC.Validate())
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	return nil
+}
+
+// Validate reports every missing or malformed setting of the providers.
+func (o OIDC) Validate() error {
+	var errs []error
+	names := make([]string, 0, len(o.Providers))
+	for name := range o.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := o.Providers[name]
+		setting := func(key string) string {
+			return fmt.Sprintf("OIDC_%s_%s (oidc.providers.%s.%s)", strings.ToUpper(name), key, name, strings.ToLower(key))
+		}
+		if name == "" || strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+			errs = append(errs, fmt.Errorf("the OIDC provider name %q must be lowercase letters, digits and underscores", name))
+			continue
+		}
+		switch p.Type {
+		case "", "oidc":
+			if p.Issuer == "" {
+				errs = append(errs, fmt.Errorf("%s is required", setting("ISSUER")))
+			} else if !httpURL(p.Issuer) {
+				errs = append(errs, fmt.Errorf("%s must be an http or https URL, got %q", setting("ISSUER"), p.Issuer))
+			}
+		case "github":
+			for _, endpoint := range [][2]string{{"AUTH_URL", p.AuthURL}, {"TOKEN_URL", p.TokenURL}, {"API_URL", p.APIURL}} {
+				if endpoint[1] != "" && !httpURL(endpoint[1]) {
+					errs = append(errs, fmt.Errorf("%s must be an http or https URL, got %q", setting(endpoint[0]), endpoint[1]))
+				}
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s must be oidc or github, got %q", setting("TYPE"), p.Type))
+		}
+		if p.ClientID == "" {
+			errs = append(errs, fmt.Errorf("%s is required", setting("CLIENT_ID")))
+		}
+		if p.ClientSecret == "" {
+			errs = append(errs, fmt.Errorf("%s is required", setting("CLIENT_SECRET")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// httpURL reports whether s is an absolute http or https URL.
+func httpURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validProxy reports whether s is an IP address or a CIDR range.
+func validProxy(s string) bool {
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// Validate reports every missing setting needed to reach the database.
+func (d Database) Validate() error {
+	var errs []error
+	for _, setting := range [][2]string{
+		{"DB_HOST (database.host)", d.Host},
+		{"DB_USER (database.user)", d.User},
+		{"DB_NAME (database.name)", d.Name},
+	} {
+		if setting[1] == "" {
+			errs = append(errs, fmt.Errorf("%s is required", setting[0]))
+		}
+	}
+	if d.Port < 1 || d.Port > 65535 {
+		errs = append(errs, fmt.Errorf("DB_PORT (database.port) must be between 1 and 65535, got %d", d.Port))
+	}
+	return errors.Join(errs...)
+}
+
+// envReader parses environment variables into settings, collecting the
+// values it couldn't parse.
+type envReader struct {
+	lookup func(string) (string, bool)
+	errs   []error
+}
+
+func (e *envReader) value(key string) (string, bool) {
+	value, ok := e.lookup(key)
+	return strings.TrimSpace(value), ok && strings.TrimSpace(value) != ""
+}
+
+func (e *envReader) string(key string, dst *string) {
+	if value, ok := e.value(key); ok {
+		*dst = value
+	}
+}
+
+func (e *envReader) int(key string, dst *int) {
+	value, ok := e.value(key)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a whole number, got %q", key, value))
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) duration(key string, dst *time.Duration) bool {
+	value, ok := e.value(key)
+	if !ok {
+		return false
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a duration such as \"30s\" or \"6h\", got %q", key, value))
+		return false
+	}
+	*dst = d
+	return true
+}
+
+func (e *envReader) rate(key string, dst *Rate) {
+	value, ok := e.value(key)
+	if !ok {
+		return
+	}
+	rate, err := ParseRate(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %w", key, err))
+		return
+	}
+	*dst = rate
+}
+
+func (e *envReader) list(key string, dst *[]string) {
+	value, ok := e.value(key)
+	if !ok {
+		return
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*dst = items
+}
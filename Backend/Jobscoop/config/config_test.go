@@ -0,0 +1,278 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lookupIn returns a lookup function and environ list over vars.
+func lookupIn(vars map[string]string) (func(string) (string, bool), []string) {
+	var environ []string
+	for key, value := range vars {
+		environ = append(environ, key+"="+value)
+	}
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}, environ
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadEnv(t *testing.T) {
+	cfg := Default()
+	lookup, environ := lookupIn(map[string]string{
+		"SERVER_PORT":                "9090",
+		"CORS_ORIGINS":               "https://jobscoop.app, http://localhost:3000",
+		"DB_HOST":                    "db",
+		"DB_USER":                    "postgres",
+		"DB_NAME":                    "jobscoop",
+		"JWT_TOKEN":                  "secret",
+		"ACCESS_TOKEN_TTL":           "15m",
+		"JOB_SOURCES":                "linkedin,careers",
+		"JOB_SOURCE_TIMEOUT":         "5s",
+		"JOB_SOURCE_TIMEOUT_INDEED":  "20s",
+		"CRAWL_INTERVAL":             "30m",
+		"CRAWL_MAX_AGE":              "2h",
+		"SHUTDOWN_DELAY":             "5s",
+		"APP_URL":                    "https://jobscoop.app",
+		"TRUSTED_PROXIES":            "10.0.0.0/8, 192.0.2.1",
+		"VERIFICATION_TTL":           "24h",
+		"LOG_LEVEL":                  "debug",
+		"UNRELATED_SOURCE_TIMEOUT_X": "1s",
+	})
+	require.NoError(t, cfg.loadEnv(lookup, environ))
+
+	assert.Equal(t, Server{Port: 9090, CORSOrigins: []string{"https://jobscoop.app", "http://localhost:3000"}, ShutdownDelay: 5 * time.Second,
+		AppURL: "https://jobscoop.app", TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}}, cfg.Server)
+	assert.Equal(t, Database{Host: "db", Port: 5432, User: "postgres", Name: "jobscoop", SSLMode: "disable"}, cfg.Database)
+	assert.Equal(t, Auth{JWTSecret: "secret", AccessTokenTTL: 15 * time.Minute, VerificationTTL: 24 * time.Hour}, cfg.Auth)
+	assert.Equal(t, []string{"linkedin", "careers"}, cfg.Jobs.Sources)
+	assert.Equal(t, 5*time.Second, cfg.Jobs.SourceTimeout)
+	assert.Equal(t, map[string]time.Duration{"indeed": 20 * time.Second}, cfg.Jobs.SourceTimeouts)
+	assert.Equal(t, Crawler{Interval: 30 * time.Minute, MaxAge: 2 * time.Hour}, cfg.Crawler)
+	assert.Zero(t, cfg.Digest.Interval)
+	assert.Equal(t, Log{Level: "debug", Format: "text"}, cfg.Log)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoadEnvInvalidValues(t *testing.T) {
+	lookup, environ := lookupIn(map[string]string{
+		"SERVER_PORT":    "eighty",
+		"CRAWL_INTERVAL": "6",
+	})
+	err := Default().loadEnv(lookup, environ)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `SERVER_PORT must be a whole number, got "eighty"`)
+	assert.Contains(t, err.Error(), `CRAWL_INTERVAL must be a duration such as "30s" or "6h", got "6"`)
+}
+
+func TestLoadFile(t *testing.T) {
+	t.Run("YAML", func(t *testing.T) {
+		cfg := Default()
+		require.NoError(t, cfg.loadFile(writeFile(t, "config.yaml", `
+server:
+  port: 3001
+database:
+  user: app
+  name: jobs
+jobs:
+  source_timeouts:
+    indeed: 15s
+digest:
+  interval: 5m
+`)))
+		assert.Equal(t, 3001, cfg.Server.Port)
+		assert.Equal(t, []string{"http://localhost:3000"}, cfg.Server.CORSOrigins)
+		assert.Equal(t, Database{Host: "localhost", Port: 5432, User: "app", Name: "jobs", SSLMode: "disable"}, cfg.Database)
+		assert.Equal(t, map[string]time.Duration{"indeed": 15 * time.Second}, cfg.Jobs.SourceTimeouts)
+		assert.Equal(t, 5*time.Minute, cfg.Digest.Interval)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		cfg := Default()
+		require.NoError(t, cfg.loadFile(writeFile(t, "config.json",
+			`{"server": {"cors_origins": ["*"]}, "auth": {"jwt_secret": "from-file"}, "crawler": {"interval": "1h"}}`)))
+		assert.Equal(t, []string{"*"}, cfg.Server.CORSOrigins)
+		assert.Equal(t, "from-file", cfg.Auth.JWTSecret)
+		assert.Equal(t, time.Hour, cfg.Crawler.Interval)
+	})
+
+	t.Run("Unknown key", func(t *testing.T) {
+		err := Default().loadFile(writeFile(t, "config.yaml", "server:\n  prot: 3001\n"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "field prot not found")
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		assert.Error(t, Default().loadFile(filepath.Join(t.TempDir(), "missing.yaml")))
+	})
+}
+
+func TestLoad(t *testing.T) {
+	// The environment wins over the file, and no .env file is needed
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+	path := writeFile(t, "config.yaml", "server:\n  port: 3001\nauth:\n  jwt_secret: from-file\nsmtp:\n  user: alerts@example.com\n")
+	t.Setenv("SERVER_PORT", "4000")
+	t.Setenv("DB_USER", "postgres")
+	t.Setenv("DB_NAME", "jobscoop")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 4000, cfg.Server.Port)
+	assert.Equal(t, "from-file", cfg.Auth.JWTSecret)
+	assert.Equal(t, "alerts@example.com", cfg.SMTP.From)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Host = ""
+	cfg.Server.Port = 0
+	cfg.Server.AppURL = "jobscoop.app"
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "::1", "proxy.internal"}
+	cfg.SMTP.Host = "smtp.example.com"
+	cfg.Jobs.SourceTimeouts = map[string]time.Duration{"indeed": 0}
+	cfg.Log.Format = "xml"
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"config: DB_HOST (database.host) is required",
+		"DB_USER (database.user) is required",
+		"DB_NAME (database.name) is required",
+		"SERVER_PORT (server.port) must be between 1 and 65535, got 0",
+		`APP_URL (server.app_url) must be an http or https URL, got "jobscoop.app"`,
+		`TRUSTED_PROXIES (server.trusted_proxies) must be IP addresses or CIDR ranges, got "proxy.internal"`,
+		"JWT_TOKEN (auth.jwt_secret) is required",
+		"SMTP_PORT (smtp.port) is required when SMTP_HOST is set",
+		`the timeout for source "indeed" must be positive`,
+		`LOG_FORMAT (log.format) must be text or json, got "xml"`,
+	}, "\n"), err.Error())
+}
+
+func TestDSN(t *testing.T) {
+	d := Database{Host: "localhost", Port: 5432, User: "postgres", Password: `it's a\secret`, Name: "jobscoop", SSLMode: "disable"}
+	assert.Equal(t, `host='localhost' port=5432 user='postgres' password='it\'s a\\secret' dbname='jobscoop' sslmode='disable'`, d.DSN())
+}
+
+func TestRateLimits(t *testing.T) {
+	t.Run("File and environment", func(t *testing.T) {
+		cfg := Default()
+		require.NoError(t, cfg.loadFile(writeFile(t, "config.yaml", `
+rate_limit:
+  store: postgres
+  login:
+    ip: 5/30s
+`)))
+		lookup, environ := lookupIn(map[string]string{
+			"RATE_LIMIT_LOGIN_ACCOUNT": "off",
+			"RATE_LIMIT_SIGNUP_IP":     "3/1h",
+			"MAX_LOGIN_FAILURES":       "3",
+			"LOCKOUT_DURATION":         "1h",
+		})
+		require.NoError(t, cfg.loadEnv(lookup, environ))
+
+		assert.Equal(t, "postgres", cfg.RateLimit.Store)
+		assert.Equal(t, RouteLimit{IP: Rate{5, 30 * time.Second}}, cfg.RateLimit.Login)
+		assert.Equal(t, RouteLimit{IP: Rate{3, time.Hour}}, cfg.RateLimit.Signup)
+		// Routes left alone keep their defaults
+		assert.Equal(t, Default().RateLimit.VerifyCode, cfg.RateLimit.VerifyCode)
+		assert.Equal(t, 3, cfg.Auth.MaxLoginFailures)
+		assert.Equal(t, time.Hour, cfg.Auth.LockoutDuration)
+	})
+
+	t.Run("Invalid rates", func(t *testing.T) {
+		err := Default().loadFile(writeFile(t, "config.yaml", "rate_limit:\n  login:\n    ip: lots\n"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `got "lots"`)
+
+		lookup, environ := lookupIn(map[string]string{"RATE_LIMIT_REFRESH_IP": "10/0s"})
+		err = Default().loadEnv(lookup, environ)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `RATE_LIMIT_REFRESH_IP: rate must be a count per duration`)
+
+		cfg := Default()
+		cfg.Database = Database{Host: "db", Port: 5432, User: "postgres", Name: "jobscoop"}
+		cfg.Auth.JWTSecret = "secret"
+		cfg.RateLimit.Store = "redis"
+		cfg.RateLimit.ForgotPassword.Account = Rate{1, 48 * time.Hour}
+		err = cfg.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `RATE_LIMIT_STORE (rate_limit.store) must be memory or postgres, got "redis"`)
+		assert.Contains(t, err.Error(), "RATE_LIMIT_FORGOT_PASSWORD_ACCOUNT (rate_limit.forgot_password.account) must refill within 24h, got 1/48h0m0s")
+	})
+}
+
+func TestOIDC(t *testing.T) {
+	t.Run("File and environment", func(t *testing.T) {
+		cfg := Default()
+		require.NoError(t, cfg.loadFile(writeFile(t, "config.yaml", `
+oidc:
+  providers:
+    google:
+      issuer: https://accounts.google.com
+      client_id: from-file
+`)))
+		lookup, environ := lookupIn(map[string]string{
+			"OIDC_PROVIDERS":             "google, GitHub",
+			"OIDC_GOOGLE_CLIENT_SECRET":  "google-secret",
+			"OIDC_GITHUB_TYPE":           "github",
+			"OIDC_GITHUB_CLIENT_ID":      "github-id",
+			"OIDC_GITHUB_CLIENT_SECRET":  "github-secret",
+			"OIDC_GITHUB_SCOPES":         "read:user,user:email",
+			"OIDC_UNLISTED_CLIENT_ID":    "ignored",
+			"RATE_LIMIT_OIDC_IP":         "5/1m",
+			"OIDC_GITHUB_API_URL":        "http://localhost:9999",
+			"OIDC_GOOGLE_TOKEN_URL_TYPO": "ignored",
+		})
+		require.NoError(t, cfg.loadEnv(lookup, environ))
+
+		assert.Equal(t, map[string]OIDCProvider{
+			"google": {Issuer: "https://accounts.google.com", ClientID: "from-file", ClientSecret: "google-secret"},
+			"github": {Type: "github", ClientID: "github-id", ClientSecret: "github-secret",
+				Scopes: []string{"read:user", "user:email"}, APIURL: "http://localhost:9999"},
+		}, cfg.OIDC.Providers)
+		assert.Equal(t, Rate{5, time.Minute}, cfg.RateLimit.OIDC.IP)
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		err := OIDC{Providers: map[string]OIDCProvider{
+			"google":  {Issuer: "accounts.google.com", ClientID: "id", ClientSecret: "secret"},
+			"company": {ClientSecret: "secret"},
+			"github":  {Type: "github", ClientID: "id", ClientSecret: "secret", TokenURL: "github.com"},
+			"okta":    {Type: "saml", ClientID: "id", ClientSecret: "secret"},
+			"My IdP":  {Issuer: "https://idp.example.com", ClientID: "id", ClientSecret: "secret"},
+		}}.Validate()
+		require.Error(t, err)
+		assert.Equal(t, strings.Join([]string{
+			`the OIDC provider name "My IdP" must be lowercase letters, digits and underscores`,
+			"OIDC_COMPANY_ISSUER (oidc.providers.company.issuer) is required",
+			"OIDC_COMPANY_CLIENT_ID (oidc.providers.company.client_id) is required",
+			`OIDC_GITHUB_TOKEN_URL (oidc.providers.github.token_url) must be an http or https URL, got "github.com"`,
+			`OIDC_GOOGLE_ISSUER (oidc.providers.google.issuer) must be an http or https URL, got "accounts.google.com"`,
+			`OIDC_OKTA_TYPE (oidc.providers.okta.type) must be oidc or github, got "saml"`,
+		}, "\n"), err.Error())
+	})
+}
+
+func TestExampleFile(t *testing.T) {
+	cfg := Default()
+	require.NoError(t, cfg.loadFile("config.example.yaml"))
+	assert.Equal(t, Default().RateLimit, cfg.RateLimit)
+	assert.Empty(t, cfg.OIDC.Providers)
+}
@@ -0,0 +1,148 @@
+// Package apierror answers failed API requests with one JSON envelope:
+//
+//	{"error": {"code": "validation_failed", "message": "Request failed validation",
+//	  "fields": [{"field": "email", "message": "email is required"}], "requestId": "…"}}
+//
+// Clients branch on the code; the message is for people and may change. The
+// cause of an internal error is logged with the request ID and never sent.
+package apierror
+
+import (
+	"JobScoop/internal/logging"
+	"JobScoop/internal/requestid"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Codes identifying what went wrong.
+const (
+	CodeInvalidRequest       = "invalid_request"   // the body isn't the JSON expected
+	CodeValidationFailed     = "validation_failed" // some fields are missing or invalid; see Fields
+	CodeUnauthorized         = "unauthorized"      // no valid token, or a token for another user
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeAccountLocked        = "account_locked"        // too many failed logins; see Retry-After
+	CodeRateLimited          = "rate_limited"          // too many requests; see Retry-After
+	CodeInvalidRefreshToken  = "invalid_refresh_token" // unknown, expired, revoked or already used; log in again
+	CodeSessionNotFound      = "session_not_found"
+	CodeUserNotFound         = "user_not_found"
+	CodeUserExists           = "user_exists"
+	CodeResetNotRequested    = "reset_not_requested"
+	CodeResetCodeInvalid     = "reset_code_invalid"
+	CodeResetCodeExpired     = "reset_code_expired"
+	CodeResetLocked          = "reset_locked"         // too many wrong codes; request a new one
+	CodeResetGrantInvalid    = "reset_grant_invalid"  // no verified code, or its grant expired or was used
+	CodeVerificationInvalid  = "verification_invalid" // a forged verification link, or one for an email the user no longer has
+	CodeVerificationExpired  = "verification_expired" // request a new verification email
+	CodeAlreadyVerified      = "already_verified"
+	CodeMFACodeInvalid       = "mfa_code_invalid"
+	CodeMFAChallengeInvalid  = "mfa_challenge_invalid" // the challenge from the password expired; log in again
+	CodeMFAAlreadyEnabled    = "mfa_already_enabled"
+	CodeMFANotEnrolling      = "mfa_not_enrolling" // confirming before enrolling an app
+	CodeMFANotEnabled        = "mfa_not_enabled"
+	CodeOIDCProviderNotFound = "oidc_provider_not_found"
+	CodeOIDCStateInvalid     = "oidc_state_invalid"    // the sign-in expired or the redirect wasn't for it; start again
+	CodeOIDCFailed           = "oidc_failed"           // the provider refused the code or couldn't be reached
+	CodeOIDCEmailUnverified  = "oidc_email_unverified" // the provider doesn't vouch for the account's email
+	CodeOIDCAccountExists    = "oidc_account_exists"   // an unverified account with a password has the email; sign in with it and verify first
+	CodeCompanyNotFound      = "company_not_found"
+	CodeSubscriptionNotFound = "subscription_not_found"
+	CodeAlreadySubscribed    = "already_subscribed"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeInternal             = "internal_error"
+)
+
+// FieldError describes one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a failed request's answer. Err, the underlying cause, is only
+// logged.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns an error answered with status, code and message.
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Field describes the invalid field name.
+func Field(name, message string) FieldError {
+	return FieldError{Field: name, Message: message}
+}
+
+// Validation returns a validation_failed error listing the invalid fields.
+func Validation(fields ...FieldError) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeValidationFailed, Message: "Request failed validation", Fields: fields}
+}
+
+// InvalidRequest returns the error for a body that can't be decoded.
+func InvalidRequest() *Error {
+	return New(http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload")
+}
+
+// Internal returns an internal_error answered with message, logging err.
+func Internal(message string, err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: message, Err: err}
+}
+
+// Body is the JSON envelope an Error is sent in.
+type Body struct {
+	Error struct {
+		Code      string       `json:"code"`
+		Message   string       `json:"message"`
+		Fields    []FieldError `json:"fields,omitempty"`
+		RequestID string       `json:"requestId,omitempty"`
+	} `json:"error"`
+}
+
+// Write answers r with err, which is sent as an internal error unless it is
+// or wraps an *Error. Server errors are logged with their cause.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = Internal("Internal server error", err)
+	}
+
+	if apiErr.Status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Error("Request failed",
+			"method", r.Method, "path", r.URL.Path, "status", apiErr.Status, "err", apiErr)
+	}
+
+	var body Body
+	body.Error.Code = apiErr.Code
+	body.Error.Message = apiErr.Message
+	body.Error.Fields = apiErr.Fields
+	body.Error.RequestID = requestid.FromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Handler answers every request with err; it suits mux's NotFoundHandler
+// and MethodNotAllowedHandler.
+func Handler(err *Error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, err)
+	})
+}
@@ -0,0 +1,87 @@
+package apierror
+
+import (
+	"JobScoop/internal/requestid"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	cause := errors.New("pq: connection refused")
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedBody   string
+		logged         bool
+	}{
+		{
+			name:           "API error",
+			err:            New(http.StatusNotFound, CodeUserNotFound, "User not found"),
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":{"code":"user_not_found","message":"User not found","requestId":"req-1"}}`,
+		},
+		{
+			name:           "Validation error",
+			err:            Validation(Field("email", "email is required")),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":{"code":"validation_failed","message":"Request failed validation","fields":[{"field":"email","message":"email is required"}],"requestId":"req-1"}}`,
+		},
+		{
+			name:           "Wrapped API error",
+			err:            fmt.Errorf("saving: %w", Internal("Error saving subscriptions", cause)),
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":{"code":"internal_error","message":"Error saving subscriptions","requestId":"req-1"}}`,
+			logged:         true,
+		},
+		{
+			name:           "Other error",
+			err:            cause,
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `{"error":{"code":"internal_error","message":"Internal server error","requestId":"req-1"}}`,
+			logged:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			req := httptest.NewRequest(http.MethodPost, "/signup", nil)
+			req = req.WithContext(requestid.NewContext(req.Context(), "req-1"))
+			rr := httptest.NewRecorder()
+
+			Write(rr, req, tt.err)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Expected a JSON content type, got %q", got)
+			}
+			if got := strings.TrimSpace(rr.Body.String()); got != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, got)
+			}
+			var body Body
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Errorf("Body is not an envelope: %v", err)
+			}
+
+			// The cause is only logged, with the request ID
+			logged := strings.Contains(logs.String(), "req-1") && strings.Contains(logs.String(), cause.Error())
+			if logged != tt.logged {
+				t.Errorf("Expected logged %v, got logs %q", tt.logged, logs.String())
+			}
+		})
+	}
+}
@@ -1,47 +1,31 @@
 package db
 
 import (
+	"JobScoop/config"
 	"database/sql"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 var DB *sql.DB
 
-func ConnectDB() {
-	// Load environment variables from the .env file
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	// Retrieve database connection information from environment variables
-	dbHost := os.Getenv("DB_HOST")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-	dbPort := os.Getenv("DB_PORT")
-
-	// Build the connection string (Data Source Name)
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		dbHost, dbUser, dbPassword, dbName, dbPort,
-	)
-
+// ConnectDB opens the database described by cfg into DB and checks that it
+// can be reached.
+func ConnectDB(cfg config.Database) error {
 	// Open a connection to the database
 	var err error
-	DB, err = sql.Open("postgres", dsn)
+	DB, err = sql.Open("postgres", cfg.DSN())
 	if err != nil {
-		log.Fatal("Failed to open the database:", err)
+		return fmt.Errorf("failed to open the database: %w", err)
 	}
 
 	// Verify the connection
 	if err := DB.Ping(); err != nil {
-		log.Fatal("Failed to connect to the database:", err)
+		return fmt.Errorf("failed to connect to the database: %w", err)
 	}
 
-	fmt.Println("Database connected successfully!")
+	slog.Info("Database connected", "host", cfg.Host, "name", cfg.Name)
+	return nil
 }
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"errors"
+	"net/http"
+)
+
+// writeTxError answers a request whose transaction failed with err. An
+// *apierror.Error returned to end the transaction early is sent as is;
+// anything else is an internal error answered with message.
+func writeTxError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) {
+		err = apierror.Internal(message, err)
+	}
+	apierror.Write(w, r, err)
+}
+
+// missingFields takes pairs of field names and values and describes the
+// fields left empty.
+func missingFields(namesAndValues ...string) []apierror.FieldError {
+	var fields []apierror.FieldError
+	for i := 0; i+1 < len(namesAndValues); i += 2 {
+		if namesAndValues[i+1] == "" {
+			fields = append(fields, apierror.Field(namesAndValues[i], namesAndValues[i]+" is required"))
+		}
+	}
+	return fields
+}
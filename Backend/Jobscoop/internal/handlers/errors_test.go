@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/requestid"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// responseMessage returns the message of an error envelope or of a JSON
+// success response, or else the whole body.
+func responseMessage(rr *httptest.ResponseRecorder) string {
+	var body struct {
+		Message string `json:"message"`
+		Error   *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		return strings.TrimSpace(rr.Body.String())
+	}
+	if body.Error != nil {
+		return body.Error.Message
+	}
+	return body.Message
+}
+
+// assertError checks that rr is an error envelope with status and code,
+// returning it for further checks.
+func assertError(t *testing.T, rr *httptest.ResponseRecorder, status int, code string) apierror.Body {
+	t.Helper()
+	assert.Equal(t, status, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var body apierror.Body
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body), rr.Body.String())
+	assert.Equal(t, code, body.Error.Code)
+	return body
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	h, _, _ := newTestHandlers()
+
+	t.Run("Validation failures list the fields", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(`{"name": "John Doe"}`))
+		rr := httptest.NewRecorder()
+		h.Users.SignupHandler(rr, req)
+
+		body := assertError(t, rr, http.StatusBadRequest, apierror.CodeValidationFailed)
+		assert.Equal(t, []apierror.FieldError{
+			{Field: "email", Message: "email is required"},
+			{Field: "password", Message: "password is required"},
+		}, body.Error.Fields)
+	})
+
+	t.Run("Internal errors carry the request ID but not the cause", func(t *testing.T) {
+		handler := &UserHandler{Users: faultyUsers{UserRepository: h.Users.Users, lookupErr: errDB}}
+		req := httptest.NewRequest(http.MethodPut, "/reset-password",
+			strings.NewReader(`{"email": "john@example.com", "new_password": "secret", "reset_token": "token"}`))
+		req = req.WithContext(requestid.NewContext(req.Context(), "req-42"))
+		rr := httptest.NewRecorder()
+		handler.ResetPasswordHandler(rr, req)
+
+		body := assertError(t, rr, http.StatusInternalServerError, apierror.CodeInternal)
+		assert.Equal(t, "req-42", body.Error.RequestID)
+		assert.NotContains(t, rr.Body.String(), errDB.Error())
+	})
+
+	t.Run("Unexpected transaction errors are internal", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		writeTxError(rr, httptest.NewRequest(http.MethodPost, "/", nil), errDB, "Error saving subscriptions")
+
+		body := assertError(t, rr, http.StatusInternalServerError, apierror.CodeInternal)
+		assert.Equal(t, "Error saving subscriptions", body.Error.Message)
+	})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"JobScoop/config"
+	"JobScoop/internal/repository"
+	"JobScoop/internal/services/crawler"
+	"JobScoop/internal/services/mail"
+	"JobScoop/internal/services/oidc"
+)
+
+// Handlers groups the API's handlers, which share one set of repositories.
+type Handlers struct {
+	Users         *UserHandler
+	Sessions      *SessionHandler
+	Subscriptions *SubscriptionHandler
+	Jobs          *JobHandler
+	Tokens        *Tokens // also checks the sessions of authenticated requests
+}
+
+// New builds the handlers on repos, signing tokens with the secret and
+// lifetimes in cfg and signing users in through the providers it
+// configures. Password reset codes, lockout notices and verification links
+// are sent through mailer; jobCrawler may be nil, in which case pairs never
+// crawled wait for the next scheduled run.
+func New(cfg *config.Config, repos repository.Repositories, mailer mail.Sender, jobCrawler *crawler.Crawler) *Handlers {
+	providers := make(map[string]oidc.Provider, len(cfg.OIDC.Providers))
+	for name, provider := range cfg.OIDC.Providers {
+		providers[name] = oidc.New(provider, nil)
+	}
+	tokens := &Tokens{
+		Sessions:   repos.Sessions,
+		Secret:     cfg.Auth.JWTSecret,
+		AccessTTL:  cfg.Auth.AccessTokenTTL,
+		RefreshTTL: cfg.Auth.RefreshTokenTTL,
+	}
+	return &Handlers{
+		Users: &UserHandler{
+			Users:    repos.Users,
+			Sessions: repos.Sessions,
+			Mailer:   mailer,
+			Tokens:   tokens,
+			Tx:       repos,
+
+			MaxLoginFailures: cfg.Auth.MaxLoginFailures,
+			LockoutDuration:  cfg.Auth.LockoutDuration,
+
+			AppURL:          cfg.Server.AppURL,
+			VerificationTTL: cfg.Auth.VerificationTTL,
+
+			OIDCProviders: providers,
+		},
+		Sessions: &SessionHandler{Sessions: repos.Sessions, Tokens: tokens, Tx: repos},
+		Subscriptions: &SubscriptionHandler{
+			Users:         repos.Users,
+			Subscriptions: repos.Subscriptions,
+			Companies:     repos.Companies,
+			Roles:         repos.Roles,
+			CareerSites:   repos.CareerSites,
+			Tx:            repos,
+		},
+		Jobs:   &JobHandler{Users: repos.Users, Jobs: repos.Jobs, Crawler: jobCrawler},
+		Tokens: tokens,
+	}
+}
@@ -1,21 +1,22 @@
 package handlers
 
 import (
-	"JobScoop/internal/db"
+	"JobScoop/internal/middleware"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
 	"bytes"
-	"database/sql"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
-	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Add this to your test file
@@ -74,252 +75,152 @@ func (m *MockLinkedInAPI) RoundTrip(req *http.Request) (*http.Response, error) {
 	return nil, fmt.Errorf("unexpected request to %s", req.URL.String())
 }
 
-// Mock functions for testing
-func testGetUserIDByEmail(email string) (int, error) {
-	if email == "nonexistent@example.com" {
-		return 0, fmt.Errorf("user not found")
-	}
-	return 1, nil
+// authenticated attaches a user ID to the request as the auth middleware would
+func authenticated(req *http.Request, userID int) *http.Request {
+	return req.WithContext(middleware.WithUserID(req.Context(), userID))
 }
 
-func testGetCompanyNameByID(id int) (string, error) {
-	return "Mock Company", nil
+// faultyJobs is a JobRepository whose lookups fail with err.
+type faultyJobs struct {
+	repository.JobRepository
+	err error
 }
 
-func testGetRoleNameByID(id int) (string, error) {
-	if id == 1 {
-		return "Software Engineer", nil
-	} else {
-		return "Data Scientist", nil
-	}
-}
-
-func MockFetchJobs(company string, jobRole string, w http.ResponseWriter) ([]map[string]interface{}, error) {
-	// Define mock jobs directly without making a real HTTP request
-	mockJobs := []map[string]interface{}{
-		{
-			"job_position": "Software Engineer",
-			"company_name": "Mock Company",
-			"job_link":     "https://linkedin.com/jobs/1",
-			"location":     "San Francisco, CA",
-		},
-		{
-			"job_position": "Senior Software Engineer",
-			"company_name": "Mock Company",
-			"job_link":     "https://linkedin.com/jobs/2",
-			"location":     "New York, NY",
-		},
-		{
-			"job_position": "Data Scientist",
-			"company_name": "Mock Company",
-			"job_link":     "https://linkedin.com/jobs/3",
-			"location":     "Remote",
-		},
-		{
-			"job_position": "Mock Role Engineer",
-			"company_name": "Different Company",
-			"job_link":     "https://linkedin.com/jobs/4",
-			"location":     "Austin, TX",
-		},
-	}
-
-	// Filter jobs based on company and role
-	var filteredJobs []map[string]interface{}
-	for _, job := range mockJobs {
-		companyName := job["company_name"].(string)
-		jobPosition := job["job_position"].(string)
-
-		// Check if company matches
-		companyMatches := strings.EqualFold(companyName, company) ||
-			strings.Contains(strings.ToLower(companyName), strings.ToLower(company)) ||
-			strings.Contains(strings.ToLower(company), strings.ToLower(companyName))
-
-		// Check if job role matches
-		roleWords := strings.Fields(strings.ToLower(jobRole))
-		roleMatches := true
-
-		for _, word := range roleWords {
-			// Skip common words that might be too generic
-			if len(word) <= 2 || isCommonWord(word) {
-				continue
-			}
-
-			if !strings.Contains(strings.ToLower(jobPosition), word) {
-				roleMatches = false
-				break
-			}
-		}
-
-		// Add to filtered results if both company and role match
-		if companyMatches && roleMatches {
-			filteredJobs = append(filteredJobs, job)
-		}
-	}
-
-	return filteredJobs, nil
+func (f faultyJobs) CrawlStatuses(ctx context.Context, userID int) ([]models.CrawlStatus, error) {
+	return nil, f.err
 }
 
 func TestGetAllJobs(t *testing.T) {
-	// Create a new mock database
-	mockDB, mock, err := sqlmock.New()
-	assert.NoError(t, err)
-	defer mockDB.Close()
-
-	// Replace the actual DB with the mock
-	originalDB := db.DB
-	db.DB = mockDB
-	defer func() { db.DB = originalDB }()
-
-	// Save original functions to restore later
-	originalGetUserIDByEmailFunc := getUserIDByEmailFunc
-	originalGetCompanyNameByIDFunc := getCompanyNameByIDFunc
-	originalGetRoleNameByIDFunc := getRoleNameByIDFunc
-	originalFetchJobsFunc := fetchJobsFunc
-
-	// Override function pointers with mock functions
-	getUserIDByEmailFunc = testGetUserIDByEmail
-	getCompanyNameByIDFunc = testGetCompanyNameByID
-	getRoleNameByIDFunc = testGetRoleNameByID
-	fetchJobsFunc = MockFetchJobs
-
-	// Set environment variable for API key
-	os.Setenv("SCRAPING_DOG_API_KEY", "mock-api-key")
-
-	// Restore original functions after test
-	defer func() {
-		getUserIDByEmailFunc = originalGetUserIDByEmailFunc
-		getCompanyNameByIDFunc = originalGetCompanyNameByIDFunc
-		getRoleNameByIDFunc = originalGetRoleNameByIDFunc
-		fetchJobsFunc = originalFetchJobsFunc
-		os.Unsetenv("SCRAPING_DOG_API_KEY")
-	}()
-
-	t.Run("Valid request returns jobs", func(t *testing.T) {
-		// IMPORTANT: Clear any expectations from previous tests
-		mock.ExpectationsWereMet()
-
-		// Prepare request with valid email
-		reqBody, _ := json.Marshal(GetSubscriptionsRequest{
-			Email: "test@example.com",
-		})
-		req, _ := http.NewRequest("POST", "/subscriptions/jobs", bytes.NewBuffer(reqBody))
+	h, store, _ := newTestHandlers()
+	repos := store.Repositories()
+	user := addUser(t, repos.Users, "Test User", "test@example.com", "password")
+	ctx := context.Background()
+
+	refreshedAt := time.Date(2025, 4, 2, 6, 0, 0, 0, time.UTC)
+	firstSeen := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	companyID, err := repos.Companies.GetOrCreate(ctx, "Mock Company")
+	require.NoError(t, err)
+	scientistID, err := repos.Roles.GetOrCreate(ctx, "Data Scientist")
+	require.NoError(t, err)
+	engineerID, err := repos.Roles.GetOrCreate(ctx, "Software Engineer")
+	require.NoError(t, err)
+	require.NoError(t, repos.Subscriptions.Create(ctx, &models.Subscription{UserID: user.ID, CompanyID: companyID,
+		RoleIDs: []int{scientistID, engineerID}, Active: true, Frequency: models.DefaultFrequency, InterestTime: firstSeen}))
+
+	t.Run("Pair never crawled has no last refreshed time", func(t *testing.T) {
+		store.RecordCrawl(companyID, scientistID, &refreshedAt, "")
+
+		req := httptest.NewRequest("POST", "/subscriptions/jobs", nil)
+		req = authenticated(req, user.ID)
 		rr := httptest.NewRecorder()
 
-		// Setup expectations for this specific test
-		careerSiteIDs := pq.Int64Array{1, 2}
-		roleIDs := pq.Int64Array{1, 2}
+		// Call the handler
+		h.Jobs.GetAllJobs(rr, req)
 
-		rows := sqlmock.NewRows([]string{"id", "company_id", "career_site_ids", "role_ids"}).
-			AddRow(1, 1, careerSiteIDs, roleIDs)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"jobs": [], "last_refreshed": null, "crawls": [
+			{"company": "Mock Company", "role": "Data Scientist", "last_refreshed": "2025-04-02T06:00:00Z"},
+			{"company": "Mock Company", "role": "Software Engineer", "last_refreshed": null}
+		]}`, rr.Body.String())
+	})
 
-		mock.ExpectQuery("SELECT id, company_id, career_site_ids, role_ids FROM subscriptions WHERE user_id=\\$1 AND active=\\$2").
-			WithArgs(1, true).
-			WillReturnRows(rows)
+	t.Run("Valid request returns stored jobs", func(t *testing.T) {
+		scientistRefresh := refreshedAt.Add(-time.Hour)
+		store.RecordCrawl(companyID, scientistID, &scientistRefresh, "indeed: error")
+		store.RecordCrawl(companyID, engineerID, &refreshedAt, "")
+		store.AddJob(models.Job{Fingerprint: "abc", Title: "Software Engineer", Company: "Mock Company", Location: "Austin, TX",
+			Salary:   &models.SalaryRange{Min: 120000, Max: 150000, Currency: "USD", Period: "year"},
+			PostedAt: &firstSeen, EmploymentType: "Full-time", URL: "https://mock.com/jobs/7",
+			ApplyURLs: []string{"https://mock.com/jobs/7"}, Sources: []string{"Indeed", "LinkedIn"},
+			FirstSeen: firstSeen, LastSeen: refreshedAt}, companyID, engineerID)
+
+		// A posting that has stopped taking applications is left out
+		closed := firstSeen.Add(time.Hour)
+		store.AddJob(models.Job{Fingerprint: "def", Title: "Data Scientist", Company: "Mock Company",
+			ValidThrough: &closed, FirstSeen: firstSeen, LastSeen: firstSeen}, companyID, scientistID)
+
+		// Prepare request with valid email and last visit
+		reqBody := []byte(`{"email": "test@example.com", "since": "2025-03-31T00:00:00Z"}`)
+		req, _ := http.NewRequest("POST", "/subscriptions/jobs", bytes.NewBuffer(reqBody))
+		req = authenticated(req, user.ID)
+		rr := httptest.NewRecorder()
 
 		// Call the handler
-		GetAllJobs(rr, req)
+		h.Jobs.GetAllJobs(rr, req)
 
 		// Check status code
 		assert.Equal(t, http.StatusOK, rr.Code)
 
-		// Parse response
-		var response map[string]interface{}
-		err := json.Unmarshal(rr.Body.Bytes(), &response)
-		assert.NoError(t, err)
-
-		// Verify jobs array exists
-		jobs, ok := response["jobs"].([]interface{})
-		assert.True(t, ok, "Expected jobs array in response")
-
-		// We expect jobs to be non-empty, but we'll check its length safely
-		if ok {
-			t.Logf("Found %d jobs in response", len(jobs))
-			if len(jobs) > 0 {
-				job := jobs[0].(map[string]interface{})
-				assert.Contains(t, job, "company_name", "Job should have company_name field")
-			} else {
-				t.Log("No jobs returned, skipping job detail checks")
+		var response GetJobsResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+
+		if assert.Len(t, response.Jobs, 1) {
+			job := response.Jobs[0]
+			assert.Equal(t, "Mock Company", job.Company)
+			assert.Equal(t, []string{"Indeed", "LinkedIn"}, job.Sources)
+			assert.Equal(t, "Full-time", job.EmploymentType)
+			assert.Equal(t, &models.SalaryRange{Min: 120000, Max: 150000, Currency: "USD", Period: "year"}, job.Salary)
+			if assert.NotNil(t, job.IsNew) {
+				assert.True(t, *job.IsNew)
 			}
 		}
 
-		// Verify the mock expectations were met
-		err = mock.ExpectationsWereMet()
-		assert.NoError(t, err, "Not all database expectations were met")
+		// The oldest refresh across the user's pairs is reported
+		if assert.NotNil(t, response.LastRefreshed) {
+			assert.True(t, scientistRefresh.Equal(*response.LastRefreshed))
+		}
+		// Crawl errors are for operators and stay out of the response
+		assert.Len(t, response.Crawls, 2)
+		assert.NotContains(t, rr.Body.String(), "last_error")
 	})
 
-	t.Run("Invalid email returns 400", func(t *testing.T) {
-		// IMPORTANT: Clear any expectations from previous tests
-		mock.ExpectationsWereMet()
-
-		// Prepare request with empty email
+	t.Run("Missing token returns 401", func(t *testing.T) {
+		// Prepare request without an authenticated user
 		reqBody, _ := json.Marshal(GetSubscriptionsRequest{
-			Email: "",
+			Email: "test@example.com",
 		})
 		req, _ := http.NewRequest("POST", "/api/jobs", bytes.NewBuffer(reqBody))
 		rr := httptest.NewRecorder()
 
-		// No need to set expectations as we expect early return due to validation
-
 		// Call the handler
-		GetAllJobs(rr, req)
+		h.Jobs.GetAllJobs(rr, req)
 
 		// Check status code
-		assert.Equal(t, http.StatusBadRequest, rr.Code)
-
-		// No database queries should be executed
-		err = mock.ExpectationsWereMet()
-		assert.NoError(t, err, "Unexpected database queries were executed")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
 	})
 
-	t.Run("Non-existent user returns 404", func(t *testing.T) {
-		// IMPORTANT: Clear any expectations from previous tests
-		mock.ExpectationsWereMet()
-
-		// Prepare request with non-existent email
+	t.Run("Email of another user returns 401", func(t *testing.T) {
+		// Prepare request whose email does not belong to the token's user
 		reqBody, _ := json.Marshal(GetSubscriptionsRequest{
 			Email: "nonexistent@example.com",
 		})
 		req, _ := http.NewRequest("POST", "/api/jobs", bytes.NewBuffer(reqBody))
+		req = authenticated(req, user.ID)
 		rr := httptest.NewRecorder()
 
-		// No need to set expectations as mockGetUserIDByEmail will return an error
-
 		// Call the handler
-		GetAllJobs(rr, req)
+		h.Jobs.GetAllJobs(rr, req)
 
 		// Check status code
-		assert.Equal(t, http.StatusNotFound, rr.Code)
-
-		// No database queries should be executed
-		err = mock.ExpectationsWereMet()
-		assert.NoError(t, err, "Unexpected database queries were executed")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
 	})
 
 	t.Run("Database error returns 500", func(t *testing.T) {
-		// IMPORTANT: Clear any expectations from previous tests
-		mock.ExpectationsWereMet()
-
 		// Prepare request with valid email
 		reqBody, _ := json.Marshal(GetSubscriptionsRequest{
 			Email: "test@example.com",
 		})
 		req, _ := http.NewRequest("POST", "/api/jobs", bytes.NewBuffer(reqBody))
+		req = authenticated(req, user.ID)
 		rr := httptest.NewRecorder()
 
-		// Setup expectations for the database query to fail
-		mock.ExpectQuery("SELECT id, company_id, career_site_ids, role_ids FROM subscriptions WHERE user_id=\\$1 AND active=\\$2").
-			WithArgs(1, true).
-			WillReturnError(sql.ErrConnDone)
-
-		// Call the handler
-		GetAllJobs(rr, req)
+		// The crawl status lookup fails
+		failing := &JobHandler{Users: repos.Users, Jobs: faultyJobs{repos.Jobs, errDB}}
+		failing.GetAllJobs(rr, req)
 
 		// Check status code
 		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-
-		// Verify the mock expectations were met
-		err = mock.ExpectationsWereMet()
-		assert.NoError(t, err, "Not all database expectations were met")
 	})
 }
 
@@ -364,16 +265,3 @@ func TestGetAllJobs(t *testing.T) {
 //      assert.Contains(t, jobPositions, "Senior Software Engineer", "Missing expected job position")
 //  })
 // }
-
-func TestIsCommonWord(t *testing.T) {
-    commonWords := []string{"and", "or", "the", "for", "in", "at", "of", "to", "a", "an"}
-    nonCommonWords := []string{"job", "developer", "engineer", "senior", "software"}
-
-    for _, word := range commonWords {
-        assert.True(t, isCommonWord(word), "Expected %s to be identified as common word", word)
-    }
-
-    for _, word := range nonCommonWords {
-        assert.False(t, isCommonWord(word), "Expected %s to be identified as non-common word", word)
-    }
-}
\ No newline at end of file
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
+	"JobScoop/internal/totp"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Limits of two-factor login.
+const (
+	mfaChallengeTTL   = 5 * time.Minute // how long after the password the code can be given
+	totpSkew          = 1               // steps either side of now whose codes are accepted
+	recoveryCodeCount = 10
+	totpIssuer        = "JobScoop" // how authenticator apps list the account
+)
+
+// mfaChallengeAudience is the audience of the challenge tokens handed out
+// for the password.
+const mfaChallengeAudience = "mfa_challenge"
+
+// secondFactorAddress is the address wrong codes are counted and locked
+// under, whatever address they come from. A challenge works from anywhere
+// until it expires, so counting them per address would let a stolen
+// password buy a fresh round of guesses from every address.
+const secondFactorAddress = "*"
+
+var (
+	errMFAChallengeInvalid = apierror.New(http.StatusUnauthorized, apierror.CodeMFAChallengeInvalid, "Invalid or expired challenge. Please log in again.")
+	errMFAAlreadyEnabled   = apierror.New(http.StatusConflict, apierror.CodeMFAAlreadyEnabled, "Two-factor authentication is already enabled")
+	errMFANotEnabled       = apierror.New(http.StatusConflict, apierror.CodeMFANotEnabled, "Two-factor authentication is not enabled")
+)
+
+// recoveryEncoding writes recovery codes, lowercased and grouped by four.
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// mfaChallenge signs a token standing for the user's correct password, to
+// be exchanged with a code at /login/mfa.
+func (h *UserHandler) mfaChallenge(userID int, now time.Time) (string, error) {
+	claims := &jwt.RegisteredClaims{
+		Subject:   strconv.Itoa(userID),
+		Audience:  jwt.ClaimStrings{mfaChallengeAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(mfaChallengeTTL)),
+		Issuer:    "jobscoop",
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.Tokens.purposeKey(mfaChallengeAudience))
+}
+
+// ParseMFAChallenge returns the user a token from mfaChallenge was handed
+// out for. The routes rate limit /login/mfa per user with it.
+func (h *UserHandler) ParseMFAChallenge(token string) (int, bool) {
+	claims := &jwt.RegisteredClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return h.Tokens.purposeKey(mfaChallengeAudience), nil
+	})
+	if err != nil || !parsed.Valid || !claims.VerifyAudience(mfaChallengeAudience, true) {
+		return 0, false
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	return userID, err == nil
+}
+
+// newRecoveryCodes returns a set of recovery codes such as
+// "k3vq-7m2x-pa4d-9ryt" and the hashes they are stored by.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		codes = append(codes, raw[0:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:16])
+		hashes = append(hashes, hashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code however it was typed. The codes
+// are random, so like refresh tokens they need no salt or slow hash.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(code)
+}
+
+// secondFactor is the code proving a login or a change to two-factor
+// login: one from the authenticator app, or a recovery code.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+func (f secondFactor) missing() bool {
+	return f.Code == "" && f.RecoveryCode == ""
+}
+
+// checkSecondFactor reports whether f is a code of the user's app not used
+// before, or one of their unused recovery codes, using it up.
+func (h *UserHandler) checkSecondFactor(ctx context.Context, user models.User, f secondFactor, now time.Time) (bool, error) {
+	if f.RecoveryCode != "" {
+		err := h.Users.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(f.RecoveryCode), now)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	step, ok := totp.Validate(user.TOTPSecret, f.Code, now, totpSkew)
+	if !ok {
+		return false, nil
+	}
+	return h.Users.UseTOTPStep(ctx, user.ID, step)
+}
+
+// verifySecondFactor checks f like checkSecondFactor, answering the request
+// itself with failure, or a lock, unless it is valid. Wrong codes count
+// toward a lock for every address, and a right one starts the count over.
+func (h *UserHandler) verifySecondFactor(w http.ResponseWriter, r *http.Request, user models.User, f secondFactor, now time.Time, failure *apierror.Error) bool {
+	if h.lockedOut(w, r, user, secondFactorAddress, now) {
+		return false
+	}
+	valid, err := h.checkSecondFactor(r.Context(), user, f, now)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
+		return false
+	}
+	if !valid {
+		h.failLogin(w, r, user, secondFactorAddress, now, failure)
+		return false
+	}
+	if err := h.Users.ResetLoginFailures(r.Context(), user.ID, secondFactorAddress); err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
+		return false
+	}
+	return true
+}
+
+// LoginMFAHandler completes a login of a user with two-factor login on,
+// exchanging the challenge from LoginHandler and a code for a session.
+// Wrong codes count as failed logins of the account from every address.
+func (h *UserHandler) LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ChallengeToken string `json:"challengeToken"`
+		secondFactor
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, r, apierror.InvalidRequest())
+		return
+	}
+	var fields []apierror.FieldError
+	if request.ChallengeToken == "" {
+		fields = append(fields, apierror.Field("challengeToken", "challengeToken is required"))
+	}
+	if request.missing() {
+		fields = append(fields, apierror.Field("code", "code or recoveryCode is required"))
+	}
+	if len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
+		return
+	}
+
+	userID, ok := h.ParseMFAChallenge(request.ChallengeToken)
+	if !ok {
+		apierror.Write(w, r, errMFAChallengeInvalid)
+		return
+	}
+	user, err := h.Users.GetByID(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && !user.MFAEnabled()) {
+		apierror.Write(w, r, errMFAChallengeInvalid)
+		return
+	} else if err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
+		return
+	}
+
+	failure := apierror.New(http.StatusUnauthorized, apierror.CodeMFACodeInvalid, "Invalid authentication code")
+	if !h.verifySecondFactor(w, r, user, request.secondFactor, time.Now().UTC(), failure) {
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// EnrollTOTP starts turning on two-factor login, answering with a new
+// secret and its otpauth:// URI for the user's authenticator app. Nothing
+// changes at login until ConfirmTOTP.
+func (h *UserHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled() {
+		apierror.Write(w, r, errMFAAlreadyEnabled)
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error generating the secret", err))
+		return
+	}
+	if err := h.Users.SetTOTPSecret(r.Context(), user.ID, secret); err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"secret":     secret,
+		"otpauthUri": totp.URI(secret, totpIssuer, user.Email),
+	})
+}
+
+// ConfirmTOTP turns on two-factor login once the user shows a code from
+// the app they enrolled, answering with their recovery codes. Recovery
+// codes are only shown when generated.
+func (h *UserHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, r, apierror.InvalidRequest())
+		return
+	}
+	if fields := missingFields("code", request.Code); len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled() {
+		apierror.Write(w, r, errMFAAlreadyEnabled)
+		return
+	}
+	if user.TOTPSecret == "" {
+		apierror.Write(w, r, apierror.New(http.StatusConflict, apierror.CodeMFANotEnrolling, "Start enrolling an authenticator app first"))
+		return
+	}
+
+	now := time.Now().UTC()
+	step, ok := totp.Validate(user.TOTPSecret, request.Code, now, totpSkew)
+	if !ok {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeMFACodeInvalid, "Invalid authentication code"))
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error generating recovery codes", err))
+		return
+	}
+
+	// The code confirming the app can't be used again to log in
+	err = h.Tx.WithinTx(r.Context(), func(repos repository.Repositories) error {
+		if err := repos.Users.EnableTOTP(r.Context(), user.ID, now); err != nil {
+			return err
+		}
+		if _, err := repos.Users.UseTOTPStep(r.Context(), user.ID, step); err != nil {
+			return err
+		}
+		return repos.Users.ReplaceRecoveryCodes(r.Context(), user.ID, hashes)
+	})
+	if err != nil {
+		writeTxError(w, r, err, "Error enabling two-factor authentication")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+// requireSecondFactor decodes the code a change to two-factor login must
+// be proven with and checks it, answering the request itself unless it is
+// valid. Wrong codes count as failed logins, so a stolen session can't
+// guess its way to turning two-factor login off.
+func (h *UserHandler) requireSecondFactor(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	var f secondFactor
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil && err != io.EOF {
+		apierror.Write(w, r, apierror.InvalidRequest())
+		return models.User{}, false
+	}
+	if f.missing() {
+		apierror.Write(w, r, apierror.Validation(apierror.Field("code", "code or recoveryCode is required")))
+		return models.User{}, false
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return models.User{}, false
+	}
+	if !user.MFAEnabled() {
+		apierror.Write(w, r, errMFANotEnabled)
+		return models.User{}, false
+	}
+	failure := apierror.New(http.StatusBadRequest, apierror.CodeMFACodeInvalid, "Invalid authentication code")
+	if !h.verifySecondFactor(w, r, user, f, time.Now().UTC(), failure) {
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// DisableTOTP turns two-factor login off, given a current code.
+func (h *UserHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.requireSecondFactor(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Tx.WithinTx(r.Context(), func(repos repository.Repositories) error {
+		if err := repos.Users.DisableTOTP(r.Context(), user.ID); err != nil {
+			return err
+		}
+		return repos.Users.ReplaceRecoveryCodes(r.Context(), user.ID, nil)
+	})
+	if err != nil {
+		writeTxError(w, r, err, "Error disabling two-factor authentication")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, given a
+// current code, answering with the new ones.
+func (h *UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.requireSecondFactor(w, r)
+	if !ok {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error generating recovery codes", err))
+		return
+	}
+	if err := h.Users.ReplaceRecoveryCodes(r.Context(), user.ID, hashes); err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recoveryCodes": codes})
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/totp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mfaRequest calls handler as userID, or anonymously when userID is zero,
+// with body.
+func mfaRequest(handler http.HandlerFunc, method string, userID int, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/v1/me/mfa/totp", strings.NewReader(body))
+	if userID != 0 {
+		req = authenticated(req, userID)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+// totpCode returns the code of secret steps away from now.
+func totpCode(t *testing.T, secret string, steps int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now())+steps)
+	require.NoError(t, err)
+	return code
+}
+
+// enableMFA turns two-factor login on for the user, returning the secret
+// and recovery codes.
+func enableMFA(t *testing.T, h *Handlers, userID int) (string, []string) {
+	t.Helper()
+	rr := mfaRequest(h.Users.EnrollTOTP, http.MethodPost, userID, "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var enrollment struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauthUri"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &enrollment))
+	require.NotEmpty(t, enrollment.Secret)
+	assert.Contains(t, enrollment.OTPAuthURI, "otpauth://totp/JobScoop:")
+	assert.Contains(t, enrollment.OTPAuthURI, "secret="+enrollment.Secret)
+
+	rr = mfaRequest(h.Users.ConfirmTOTP, http.MethodPost, userID, `{"code":"`+totpCode(t, enrollment.Secret, 0)+`"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var confirmation struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &confirmation))
+	require.Len(t, confirmation.RecoveryCodes, recoveryCodeCount)
+	return enrollment.Secret, confirmation.RecoveryCodes
+}
+
+// mfaChallengeFor logs in with the password and returns the challenge.
+func mfaChallengeFor(t *testing.T, h *Handlers, email, password string) string {
+	t.Helper()
+	rr := loginAttempt(h, email, password)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var body struct {
+		Token          string `json:"token"`
+		MFARequired    bool   `json:"mfaRequired"`
+		ChallengeToken string `json:"challengeToken"`
+		ExpiresIn      int    `json:"expiresIn"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	require.True(t, body.MFARequired)
+	require.Empty(t, body.Token, "no session before the second factor")
+	assert.Equal(t, 300, body.ExpiresIn)
+	return body.ChallengeToken
+}
+
+func loginMFA(h *Handlers, body string) *httptest.ResponseRecorder {
+	return mfaRequest(h.Users.LoginMFAHandler, http.MethodPost, 0, body)
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	h, store, _ := newTestHandlers()
+	john := addUser(t, store.Repositories().Users, "John Doe", "john@example.com", "securepassword")
+
+	// Confirming needs an enrollment, then a code of the enrolled app
+	assertError(t, mfaRequest(h.Users.ConfirmTOTP, http.MethodPost, john.ID, `{"code":"123456"}`), http.StatusConflict, apierror.CodeMFANotEnrolling)
+	rr := mfaRequest(h.Users.EnrollTOTP, http.MethodPost, john.ID, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assertError(t, mfaRequest(h.Users.ConfirmTOTP, http.MethodPost, john.ID, `{"code":"000000"}`), http.StatusBadRequest, apierror.CodeMFACodeInvalid)
+
+	// An unconfirmed enrollment leaves login alone
+	login(t, h, "john@example.com", "securepassword", "test")
+
+	_, recoveryCodes := enableMFA(t, h, john.ID)
+	assertError(t, mfaRequest(h.Users.EnrollTOTP, http.MethodPost, john.ID, ""), http.StatusConflict, apierror.CodeMFAAlreadyEnabled)
+
+	// Turning it off takes a code
+	assertError(t, mfaRequest(h.Users.DisableTOTP, http.MethodDelete, john.ID, ""), http.StatusBadRequest, apierror.CodeValidationFailed)
+	assertError(t, mfaRequest(h.Users.DisableTOTP, http.MethodDelete, john.ID, `{"code":"000000"}`), http.StatusBadRequest, apierror.CodeMFACodeInvalid)
+
+	// New recovery codes replace the old ones
+	rr = mfaRequest(h.Users.RegenerateRecoveryCodes, http.MethodPost, john.ID, `{"recoveryCode":"`+recoveryCodes[0]+`"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var regenerated struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &regenerated))
+	require.Len(t, regenerated.RecoveryCodes, recoveryCodeCount)
+	assertError(t, mfaRequest(h.Users.DisableTOTP, http.MethodDelete, john.ID, `{"recoveryCode":"`+recoveryCodes[1]+`"}`), http.StatusBadRequest, apierror.CodeMFACodeInvalid)
+
+	rr = mfaRequest(h.Users.DisableTOTP, http.MethodDelete, john.ID, `{"recoveryCode":"`+strings.ToUpper(regenerated.RecoveryCodes[0])+`"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	user, err := store.Repositories().Users.GetByID(context.Background(), john.ID)
+	require.NoError(t, err)
+	assert.False(t, user.MFAEnabled())
+	assert.Empty(t, user.TOTPSecret)
+	assertError(t, mfaRequest(h.Users.DisableTOTP, http.MethodDelete, john.ID, `{"code":"123456"}`), http.StatusConflict, apierror.CodeMFANotEnabled)
+
+	login(t, h, "john@example.com", "securepassword", "test")
+}
+
+func TestLoginMFA(t *testing.T) {
+	h, store, _ := newTestHandlers()
+	john := addUser(t, store.Repositories().Users, "John Doe", "john@example.com", "securepassword")
+	secret, recoveryCodes := enableMFA(t, h, john.ID)
+
+	challenge := mfaChallengeFor(t, h, "john@example.com", "securepassword")
+
+	// The code that confirmed the app was used up
+	assertError(t, loginMFA(h, `{"challengeToken":"`+challenge+`","code":"`+totpCode(t, secret, 0)+`"}`),
+		http.StatusUnauthorized, apierror.CodeMFACodeInvalid)
+
+	next := totpCode(t, secret, 1)
+	rr := loginMFA(h, `{"challengeToken":"`+challenge+`","code":"`+next+`"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var tokens TokenResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokens))
+	assert.Equal(t, john.ID, tokenClaims(t, tokens.Token).UserID)
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	// Each code and recovery code works once
+	assertError(t, loginMFA(h, `{"challengeToken":"`+challenge+`","code":"`+next+`"}`), http.StatusUnauthorized, apierror.CodeMFACodeInvalid)
+	rr = loginMFA(h, `{"challengeToken":"`+challenge+`","recoveryCode":"`+recoveryCodes[3]+`"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assertError(t, loginMFA(h, `{"challengeToken":"`+challenge+`","recoveryCode":"`+recoveryCodes[3]+`"}`), http.StatusUnauthorized, apierror.CodeMFACodeInvalid)
+
+	// Only a challenge from the password will do
+	expired, err := h.Users.mfaChallenge(john.ID, time.Now().Add(-mfaChallengeTTL-time.Minute))
+	require.NoError(t, err)
+	for _, token := range []string{"garbage", expired, tokens.Token} {
+		assertError(t, loginMFA(h, `{"challengeToken":"`+token+`","recoveryCode":"`+recoveryCodes[4]+`"}`), http.StatusUnauthorized, apierror.CodeMFAChallengeInvalid)
+	}
+	assertError(t, loginMFA(h, `{"challengeToken":"`+challenge+`"}`), http.StatusBadRequest, apierror.CodeValidationFailed)
+}
+
+func TestLoginMFALockout(t *testing.T) {
+	h, store, mailer := newTestHandlers()
+	john := addUser(t, store.Repositories().Users, "John Doe", "john@example.com", "securepassword")
+	secret, _ := enableMFA(t, h, john.ID)
+
+	// A right password between wrong codes doesn't start the count over
+	for i := 0; i < DefaultMaxLoginFailures-1; i++ {
+		challenge := mfaChallengeFor(t, h, "john@example.com", "securepassword")
+		assertError(t, loginMFA(h, `{"challengeToken":"`+challenge+`","code":"000000"}`), http.StatusUnauthorized, apierror.CodeMFACodeInvalid)
+	}
+	challenge := mfaChallengeFor(t, h, "john@example.com", "securepassword")
+	assertError(t, loginMFA(h, `{"challengeToken":"`+challenge+`","code":"000000"}`), http.StatusLocked, apierror.CodeAccountLocked)
+	assert.Len(t, mailer.sent, 1)
+
+	assertError(t, loginMFA(h, `{"challengeToken":"`+challenge+`","code":"`+totpCode(t, secret, 1)+`"}`), http.StatusLocked, apierror.CodeAccountLocked)
+}
+
+func TestLoginMFALockoutAcrossAddresses(t *testing.T) {
+	h, store, mailer := newTestHandlers()
+	john := addUser(t, store.Repositories().Users, "John Doe", "john@example.com", "securepassword")
+	secret, _ := enableMFA(t, h, john.ID)
+	challenge := mfaChallengeFor(t, h, "john@example.com", "securepassword")
+
+	guess := func(addr, code string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login/mfa",
+			strings.NewReader(`{"challengeToken":"`+challenge+`","code":"`+code+`"}`))
+		req.RemoteAddr = addr
+		rr := httptest.NewRecorder()
+		h.Users.LoginMFAHandler(rr, req)
+		return rr
+	}
+
+	// The challenge works from anywhere, so wrong codes are counted for the
+	// account whichever address they come from
+	for i := 0; i < DefaultMaxLoginFailures-1; i++ {
+		assertError(t, guess(fmt.Sprintf("198.51.100.%d:1234", i+1), "000000"), http.StatusUnauthorized, apierror.CodeMFACodeInvalid)
+	}
+	assertError(t, guess("203.0.113.1:1234", "000000"), http.StatusLocked, apierror.CodeAccountLocked)
+	require.Len(t, mailer.sent, 1)
+	assert.Contains(t, mailer.sent[0].Text, "knew your password")
+
+	assertError(t, guess("203.0.113.2:1234", totpCode(t, secret, 1)), http.StatusLocked, apierror.CodeAccountLocked)
+}
+
+func TestLoginMFAResetsFailures(t *testing.T) {
+	h, store, _ := newTestHandlers()
+	john := addUser(t, store.Repositories().Users, "John Doe", "john@example.com", "securepassword")
+	secret, _ := enableMFA(t, h, john.ID)
+	challenge := mfaChallengeFor(t, h, "john@example.com", "securepassword")
+
+	// A right code starts the count of wrong ones over
+	for i := 0; i < DefaultMaxLoginFailures-1; i++ {
+		assertError(t, loginMFA(h, `{"challengeToken":"`+challenge+`","code":"000000"}`), http.StatusUnauthorized, apierror.CodeMFACodeInvalid)
+	}
+	rr := loginMFA(h, `{"challengeToken":"`+challenge+`","code":"`+totpCode(t, secret, 1)+`"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assertError(t, loginMFA(h, `{"challengeToken":"`+challenge+`","code":"000000"}`), http.StatusUnauthorized, apierror.CodeMFACodeInvalid)
+}
+
+func TestGetUserMFAEnabled(t *testing.T) {
+	h, store, _ := newTestHandlers()
+	john := addUser(t, store.Repositories().Users, "John Doe", "john@example.com", "securepassword")
+	enableMFA(t, h, john.ID)
+
+	rr := mfaRequest(h.Users.GetUser, http.MethodPost, john.ID, "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var body GetUserResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.True(t, body.MFAEnabled)
+}
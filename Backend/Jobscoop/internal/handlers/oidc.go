@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/logging"
+	"JobScoop/internal/middleware"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
+	"JobScoop/internal/services/oidc"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+)
+
+// oidcStateTTL is how long a user has to sign in at the provider.
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateAudience is the audience of the tokens holding a sign-in's
+// secrets while the user is at the provider.
+const oidcStateAudience = "oidc_state"
+
+var (
+	errOIDCProviderNotFound = apierror.New(http.StatusNotFound, apierror.CodeOIDCProviderNotFound, "No such sign-in provider")
+	errOIDCStateInvalid     = apierror.New(http.StatusBadRequest, apierror.CodeOIDCStateInvalid, "Invalid or expired sign-in. Please try again.")
+	errOIDCAccountExists    = apierror.New(http.StatusConflict, apierror.CodeOIDCAccountExists,
+		"An account with this email already exists. Please sign in with its password and verify your email first.")
+)
+
+// oidcStateClaims hold the secrets of a sign-in at a provider, so the
+// server keeps no state between starting and finishing it. They are signed
+// but readable; the state they are checked against only reaches the
+// browser that started the sign-in.
+type oidcStateClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// oidcRedirectURI is where providers send users back to: the web app's
+// /oidc/callback page, which posts the code to OIDCCallbackHandler.
+func (h *UserHandler) oidcRedirectURI() string {
+	return strings.TrimRight(h.AppURL, "/") + "/oidc/callback"
+}
+
+// oidcProvider returns the provider named in the route, answering the
+// request itself if there is none.
+func (h *UserHandler) oidcProvider(w http.ResponseWriter, r *http.Request) (string, oidc.Provider, bool) {
+	name := mux.Vars(r)["provider"]
+	provider, ok := h.OIDCProviders[name]
+	if !ok {
+		apierror.Write(w, r, errOIDCProviderNotFound)
+	}
+	return name, provider, ok
+}
+
+// OIDCProvidersHandler lists the providers users can sign in with.
+func (h *UserHandler) OIDCProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(h.OIDCProviders))
+	for name := range h.OIDCProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"providers": names})
+}
+
+// OIDCStartHandler starts a sign-in at the provider, answering with the
+// URL to send the user to and a token the web app keeps until the provider
+// sends the user back.
+func (h *UserHandler) OIDCStartHandler(w http.ResponseWriter, r *http.Request) {
+	name, provider, ok := h.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	auth, err := oidc.NewAuth()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error starting the sign-in", err))
+		return
+	}
+	authURL, err := provider.AuthURL(r.Context(), auth, h.oidcRedirectURI())
+	if err != nil {
+		apierror.Write(w, r, &apierror.Error{Status: http.StatusBadGateway, Code: apierror.CodeOIDCFailed,
+			Message: "Could not reach the sign-in provider", Err: err})
+		return
+	}
+
+	now := time.Now()
+	claims := &oidcStateClaims{
+		Provider: name,
+		State:    auth.State,
+		Nonce:    auth.Nonce,
+		Verifier: auth.Verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{oidcStateAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(oidcStateTTL)),
+			Issuer:    "jobscoop",
+		},
+	}
+	stateToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.Tokens.purposeKey(oidcStateAudience))
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error starting the sign-in", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"authorizationUrl": authURL,
+		"stateToken":       stateToken,
+		"expiresIn":        int(oidcStateTTL.Seconds()),
+	})
+}
+
+// parseOIDCState returns the secrets of the sign-in a token from
+// OIDCStartHandler was handed out for, if it was started at the provider
+// and the provider sent back its state.
+func (h *UserHandler) parseOIDCState(token, provider, state string) (oidc.Auth, bool) {
+	claims := &oidcStateClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return h.Tokens.purposeKey(oidcStateAudience), nil
+	})
+	if err != nil || !parsed.Valid || !claims.VerifyAudience(oidcStateAudience, true) || claims.Provider != provider ||
+		subtle.ConstantTimeCompare([]byte(claims.State), []byte(state)) != 1 {
+		return oidc.Auth{}, false
+	}
+	return oidc.Auth{State: claims.State, Nonce: claims.Nonce, Verifier: claims.Verifier}, true
+}
+
+// OIDCCallbackHandler finishes a sign-in at the provider with the code and
+// state it sent the user back with, logging in the user the identity is
+// linked to. An identity signing in for the first time is linked to the
+// account with its email, or to a new account, provided the provider
+// vouches for the email. Users with two-factor login on are answered with
+// a challenge, as by LoginHandler.
+func (h *UserHandler) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Code       string `json:"code"`
+		State      string `json:"state"`
+		StateToken string `json:"stateToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, r, apierror.InvalidRequest())
+		return
+	}
+	if fields := missingFields("code", request.Code, "state", request.State, "stateToken", request.StateToken); len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
+		return
+	}
+
+	name, provider, ok := h.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+	auth, ok := h.parseOIDCState(request.StateToken, name, request.State)
+	if !ok {
+		apierror.Write(w, r, errOIDCStateInvalid)
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), request.Code, auth, h.oidcRedirectURI())
+	if err != nil {
+		apierror.Write(w, r, &apierror.Error{Status: http.StatusBadGateway, Code: apierror.CodeOIDCFailed,
+			Message: "Could not sign in with the provider", Err: err})
+		return
+	}
+
+	user, err := h.Users.GetByIdentity(r.Context(), name, identity.Subject)
+	if errors.Is(err, repository.ErrNotFound) {
+		user, err = h.linkIdentity(r, name, identity)
+	}
+	if err != nil {
+		writeTxError(w, r, err, "Error signing in")
+		return
+	}
+
+	now := time.Now().UTC()
+	if h.lockedOut(w, r, user, middleware.ClientIP(r), now) {
+		return
+	}
+	if user.MFAEnabled() {
+		challenge, err := h.mfaChallenge(user.ID, now)
+		if err != nil {
+			apierror.Write(w, r, apierror.Internal("Error starting the challenge", err))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message":        "Two-factor authentication required",
+			"mfaRequired":    true,
+			"challengeToken": challenge,
+			"expiresIn":      int(mfaChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// linkIdentity links an identity signing in for the first time to the
+// account with its email, creating one if there is none, and returns the
+// account.
+//
+// Anyone can sign up with an email they don't own, so an account with a
+// password that never verified its email isn't linked: whoever signs in
+// must first prove they hold the password, or reset it, and verify the
+// email.
+func (h *UserHandler) linkIdentity(r *http.Request, provider string, identity oidc.Identity) (models.User, error) {
+	if identity.Email == "" || !identity.EmailVerified {
+		return models.User{}, apierror.New(http.StatusForbidden, apierror.CodeOIDCEmailUnverified,
+			"Your account at the provider has no verified email. Please verify it there, or sign up with a password.")
+	}
+	ctx := r.Context()
+	now := time.Now().UTC()
+
+	var user models.User
+	err := h.Tx.WithinTx(ctx, func(repos repository.Repositories) error {
+		var err error
+		user, err = repos.Users.GetByEmail(ctx, identity.Email)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			user = models.User{Name: identity.Name, Email: identity.Email}
+			if user.Name == "" {
+				user.Name, _, _ = strings.Cut(identity.Email, "@")
+			}
+			if err := repos.Users.Create(ctx, &user); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case !user.Verified() && user.PasswordHash != "":
+			return errOIDCAccountExists
+		}
+
+		if err := repos.Users.MarkVerified(ctx, user.ID, user.Email, now); err != nil {
+			return err
+		}
+		if err := repos.Users.LinkIdentity(ctx, user.ID, provider, identity.Subject, identity.Email); err != nil {
+			return err
+		}
+		user, err = repos.Users.GetByID(ctx, user.ID)
+		return err
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	logging.FromContext(ctx).Info("Linked a sign-in identity", "user_id", user.ID, "provider", provider)
+	return user, nil
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/repository"
+	"JobScoop/internal/services/oidc"
+	"JobScoop/internal/services/oidc/oidctest"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOIDCHandlers returns handlers signing users in through a local
+// provider named "company".
+func newOIDCHandlers(t *testing.T) (*Handlers, *repository.Memory, *oidctest.Server) {
+	h, store, _ := newTestHandlers()
+	server := oidctest.NewServer(t)
+	h.Users.OIDCProviders = map[string]oidc.Provider{"company": oidc.New(server.Config(), nil)}
+	return h, store, server
+}
+
+// oidcRequest calls handler for the provider with body.
+func oidcRequest(handler http.HandlerFunc, provider, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/oidc/"+provider+"/callback", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler(rr, mux.SetURLVars(req, map[string]string{"provider": provider}))
+	return rr
+}
+
+// startOIDC starts a sign-in and follows it to the provider and back,
+// returning the callback's body.
+func startOIDC(t *testing.T, h *Handlers, server *oidctest.Server) map[string]string {
+	t.Helper()
+	rr := oidcRequest(h.Users.OIDCStartHandler, "company", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var start struct {
+		AuthorizationURL string `json:"authorizationUrl"`
+		StateToken       string `json:"stateToken"`
+		ExpiresIn        int    `json:"expiresIn"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &start))
+	assert.Equal(t, 600, start.ExpiresIn)
+	authURL, err := url.Parse(start.AuthorizationURL)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:3000/oidc/callback", authURL.Query().Get("redirect_uri"))
+
+	query := server.Authorize(t, start.AuthorizationURL)
+	require.Empty(t, query.Get("error"))
+	return map[string]string{"code": query.Get("code"), "state": query.Get("state"), "stateToken": start.StateToken}
+}
+
+// signInOIDC signs in as the identity through the provider.
+func signInOIDC(t *testing.T, h *Handlers, server *oidctest.Server, identity oidc.Identity) *httptest.ResponseRecorder {
+	t.Helper()
+	server.SignIn(identity)
+	body, err := json.Marshal(startOIDC(t, h, server))
+	require.NoError(t, err)
+	return oidcRequest(h.Users.OIDCCallbackHandler, "company", string(body))
+}
+
+// oidcLogin signs in as the identity, expecting a session, and returns the
+// user it is for.
+func oidcLogin(t *testing.T, h *Handlers, server *oidctest.Server, identity oidc.Identity) int {
+	t.Helper()
+	rr := signInOIDC(t, h, server, identity)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var body struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+		UserID       int    `json:"userid"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	require.NotEmpty(t, body.RefreshToken)
+	assert.Equal(t, body.UserID, tokenClaims(t, body.Token).UserID)
+	return body.UserID
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	h, store, server := newOIDCHandlers(t)
+	users := store.Repositories().Users
+	ctx := context.Background()
+
+	t.Run("New account", func(t *testing.T) {
+		userID := oidcLogin(t, h, server, oidc.Identity{Subject: "sub-1", Email: "new@example.com", EmailVerified: true, Name: "New User"})
+		user, err := users.GetByID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, "New User", user.Name)
+		assert.Equal(t, "new@example.com", user.Email)
+		assert.True(t, user.Verified(), "the provider vouched for the email")
+		assert.Empty(t, user.PasswordHash)
+
+		// No password logs in to an account made without one
+		assertError(t, loginAttempt(h, "new@example.com", "Secret1!"), http.StatusUnauthorized, apierror.CodeInvalidCredentials)
+
+		// The identity keeps signing in to the account when its email changes
+		again := oidcLogin(t, h, server, oidc.Identity{Subject: "sub-1", Email: "renamed@example.com", EmailVerified: true})
+		assert.Equal(t, userID, again)
+	})
+
+	t.Run("Existing account", func(t *testing.T) {
+		existing := addUser(t, users, "Test User", "test@example.com", "Secret1!")
+		require.NoError(t, users.MarkVerified(ctx, existing.ID, existing.Email, time.Now()))
+
+		userID := oidcLogin(t, h, server, oidc.Identity{Subject: "sub-2", Email: "test@example.com", EmailVerified: true, Name: "Someone Else"})
+		assert.Equal(t, existing.ID, userID)
+		user, err := users.GetByID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, "Test User", user.Name)
+
+		// The password still works alongside the provider
+		login(t, h, "test@example.com", "Secret1!", "")
+	})
+
+	t.Run("Name from the email", func(t *testing.T) {
+		userID := oidcLogin(t, h, server, oidc.Identity{Subject: "sub-3", Email: "jane.doe@example.com", EmailVerified: true})
+		user, err := users.GetByID(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, "jane.doe", user.Name)
+	})
+}
+
+func TestOIDCUnverifiedAccountWithPassword(t *testing.T) {
+	h, store, server := newOIDCHandlers(t)
+	users := store.Repositories().Users
+	ctx := context.Background()
+
+	// Whoever signed up with the email hasn't proven they own it
+	existing := addUser(t, users, "Test User", "owner@example.com", "Secret1!")
+	session := login(t, h, "owner@example.com", "Secret1!", "")
+	enableMFA(t, h, existing.ID)
+
+	rr := signInOIDC(t, h, server, oidc.Identity{Subject: "sub-1", Email: "owner@example.com", EmailVerified: true})
+	assertError(t, rr, http.StatusConflict, apierror.CodeOIDCAccountExists)
+	_, err := users.GetByIdentity(ctx, "company", "sub-1")
+	assert.ErrorIs(t, err, repository.ErrNotFound, "nothing is linked")
+
+	// The account is left as it was
+	user, err := users.GetByID(ctx, existing.ID)
+	require.NoError(t, err)
+	assert.False(t, user.Verified())
+	assert.True(t, user.MFAEnabled())
+	active, err := h.Tokens.SessionActive(ctx, existing.ID, tokenClaims(t, session.Token).SessionID)
+	require.NoError(t, err)
+	assert.True(t, active)
+
+	// Once the email is verified the identity links to the account
+	require.NoError(t, users.MarkVerified(ctx, existing.ID, existing.Email, time.Now()))
+	rr = signInOIDC(t, h, server, oidc.Identity{Subject: "sub-1", Email: "owner@example.com", EmailVerified: true})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	linked, err := users.GetByIdentity(ctx, "company", "sub-1")
+	require.NoError(t, err)
+	assert.Equal(t, existing.ID, linked.ID)
+}
+
+func TestOIDCUnverifiedEmail(t *testing.T) {
+	h, store, server := newOIDCHandlers(t)
+	addUser(t, store.Repositories().Users, "Test User", "test@example.com", "Secret1!")
+
+	rr := signInOIDC(t, h, server, oidc.Identity{Subject: "sub-1", Email: "test@example.com"})
+	assertError(t, rr, http.StatusForbidden, apierror.CodeOIDCEmailUnverified)
+	_, err := store.Repositories().Users.GetByIdentity(context.Background(), "company", "sub-1")
+	assert.ErrorIs(t, err, repository.ErrNotFound, "nothing is linked")
+
+	rr = signInOIDC(t, h, server, oidc.Identity{Subject: "sub-2", EmailVerified: true})
+	assertError(t, rr, http.StatusForbidden, apierror.CodeOIDCEmailUnverified)
+}
+
+func TestOIDCSignInMFA(t *testing.T) {
+	h, store, server := newOIDCHandlers(t)
+	users := store.Repositories().Users
+	user := addUser(t, users, "Test User", "test@example.com", "Secret1!")
+	require.NoError(t, users.MarkVerified(context.Background(), user.ID, user.Email, time.Now()))
+	secret, _ := enableMFA(t, h, user.ID)
+
+	// The provider stands in for the password, not for the second factor
+	rr := signInOIDC(t, h, server, oidc.Identity{Subject: "sub-1", Email: "test@example.com", EmailVerified: true})
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var body struct {
+		Token          string `json:"token"`
+		MFARequired    bool   `json:"mfaRequired"`
+		ChallengeToken string `json:"challengeToken"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.True(t, body.MFARequired)
+	assert.Empty(t, body.Token)
+
+	rr = loginMFA(h, `{"challengeToken":"`+body.ChallengeToken+`","code":"`+totpCode(t, secret, 1)+`"}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+}
+
+func TestOIDCCallbackInvalid(t *testing.T) {
+	h, _, server := newOIDCHandlers(t)
+	server.SignIn(oidc.Identity{Subject: "sub-1", Email: "test@example.com", EmailVerified: true})
+	callback := func(provider string, body map[string]string) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		return oidcRequest(h.Users.OIDCCallbackHandler, provider, string(data))
+	}
+
+	t.Run("Unknown provider", func(t *testing.T) {
+		assertError(t, oidcRequest(h.Users.OIDCStartHandler, "nope", ""), http.StatusNotFound, apierror.CodeOIDCProviderNotFound)
+		assertError(t, callback("nope", startOIDC(t, h, server)), http.StatusNotFound, apierror.CodeOIDCProviderNotFound)
+	})
+
+	t.Run("Missing fields", func(t *testing.T) {
+		body := assertError(t, callback("company", map[string]string{"code": "abc"}), http.StatusBadRequest, apierror.CodeValidationFailed)
+		assert.Len(t, body.Error.Fields, 2)
+	})
+
+	t.Run("Another sign-in's state", func(t *testing.T) {
+		body := startOIDC(t, h, server)
+		body["state"] = startOIDC(t, h, server)["state"]
+		assertError(t, callback("company", body), http.StatusBadRequest, apierror.CodeOIDCStateInvalid)
+	})
+
+	t.Run("Started at another provider", func(t *testing.T) {
+		h.Users.OIDCProviders["other"] = h.Users.OIDCProviders["company"]
+		defer delete(h.Users.OIDCProviders, "other")
+		assertError(t, callback("other", startOIDC(t, h, server)), http.StatusBadRequest, apierror.CodeOIDCStateInvalid)
+	})
+
+	t.Run("Not a state token", func(t *testing.T) {
+		body := startOIDC(t, h, server)
+		token, err := h.Users.mfaChallenge(1, time.Now())
+		require.NoError(t, err)
+		body["stateToken"] = token
+		assertError(t, callback("company", body), http.StatusBadRequest, apierror.CodeOIDCStateInvalid)
+	})
+
+	t.Run("Code refused", func(t *testing.T) {
+		body := startOIDC(t, h, server)
+		body["code"] = "forged"
+		assertError(t, callback("company", body), http.StatusBadGateway, apierror.CodeOIDCFailed)
+	})
+}
+
+func TestOIDCProvidersHandler(t *testing.T) {
+	h, _, _ := newOIDCHandlers(t)
+	h.Users.OIDCProviders["github"] = &oidc.GitHub{}
+	rr := httptest.NewRecorder()
+	h.Users.OIDCProvidersHandler(rr, httptest.NewRequest(http.MethodGet, "/oidc/providers", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"providers":["company","github"]}`, rr.Body.String())
+}
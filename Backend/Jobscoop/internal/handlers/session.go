@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/logging"
+	"JobScoop/internal/middleware"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+)
+
+// Defaults for how long the tokens handed out at login last.
+const (
+	DefaultAccessTokenTTL  = time.Hour
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// maxUserAgentLength bounds the user agent stored with a session.
+const maxUserAgentLength = 512
+
+var (
+	errInvalidRefreshToken = apierror.New(http.StatusUnauthorized, apierror.CodeInvalidRefreshToken, "Invalid or expired refresh token")
+	errSessionNotFound     = apierror.New(http.StatusNotFound, apierror.CodeSessionNotFound, "Session not found")
+)
+
+// Tokens starts users' login sessions and signs the access tokens of their
+// sessions.
+type Tokens struct {
+	Sessions   repository.SessionRepository
+	Secret     string        // signs access tokens
+	AccessTTL  time.Duration // DefaultAccessTokenTTL when zero
+	RefreshTTL time.Duration // how long a session lasts; DefaultRefreshTokenTTL when zero
+}
+
+// TokenResponse carries the tokens of a session. A refresh token is only
+// ever sent here and only its hash is stored.
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"` // seconds until Token expires
+}
+
+func (t *Tokens) accessTTL() time.Duration {
+	if t.AccessTTL > 0 {
+		return t.AccessTTL
+	}
+	return DefaultAccessTokenTTL
+}
+
+func (t *Tokens) refreshTTL() time.Duration {
+	if t.RefreshTTL > 0 {
+		return t.RefreshTTL
+	}
+	return DefaultRefreshTokenTTL
+}
+
+// Start opens a session for the user logging in with r and returns its
+// tokens.
+func (t *Tokens) Start(ctx context.Context, r *http.Request, userID int) (TokenResponse, error) {
+	refreshToken, tokenHash, err := newToken()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	now := time.Now().UTC()
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	session := models.Session{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         middleware.ClientIP(r),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(t.refreshTTL()),
+	}
+	if err := t.Sessions.Create(ctx, &session, tokenHash); err != nil {
+		return TokenResponse{}, err
+	}
+	return t.response(session, refreshToken, now)
+}
+
+// response signs an access token for session and pairs it with refreshToken.
+func (t *Tokens) response(session models.Session, refreshToken string, now time.Time) (TokenResponse, error) {
+	claims := &Claims{
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.accessTTL())),
+			Issuer:    "jobscoop",
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(t.Secret))
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{Token: signed, RefreshToken: refreshToken, ExpiresIn: int(t.accessTTL().Seconds())}, nil
+}
+
+// purposeKey derives the key that signs the tokens of purpose, such as
+// verification links, from the access token secret. A token signed for one
+// purpose never passes for an access token or for another purpose's.
+func (t *Tokens) purposeKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(t.Secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// SessionActive reports whether the user's session is still active; it is
+// the middleware.SessionChecker of the authenticated routes.
+func (t *Tokens) SessionActive(ctx context.Context, userID, sessionID int) (bool, error) {
+	session, err := t.Sessions.Get(ctx, sessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return session.UserID == userID && session.Active(time.Now()), nil
+}
+
+// newToken returns a random token, such as a refresh token, and the hash it
+// is stored by.
+func newToken() (token, tokenHash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the SHA-256 of a token from newToken in hex. The tokens
+// are random, so they need no salt or slow hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SessionHandler serves token refresh, logout and the user's list of
+// login sessions.
+type SessionHandler struct {
+	Sessions repository.SessionRepository
+	Tokens   *Tokens
+	Tx       repository.Transactor
+}
+
+// SessionResource is a login session as listed to its user.
+type SessionResource struct {
+	ID         int       `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"` // the session of the token listing the sessions
+}
+
+// RefreshHandler exchanges a refresh token for a new access token and a new
+// refresh token; each refresh token works once. Presenting one again means
+// it leaked, so the session is revoked for whoever holds its tokens.
+func (h *SessionHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, r, apierror.InvalidRequest())
+		return
+	}
+	if fields := missingFields("refreshToken", request.RefreshToken); len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
+		return
+	}
+
+	refreshToken, newHash, err := newToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error generating the refresh token", err))
+		return
+	}
+
+	now := time.Now().UTC()
+	var session models.Session
+	err = h.Tx.WithinTx(r.Context(), func(repos repository.Repositories) error {
+		var err error
+		session, err = repos.Sessions.Rotate(r.Context(), hashToken(request.RefreshToken), newHash, now)
+		if err != nil {
+			return err
+		}
+		if !session.Active(now) {
+			return errInvalidRefreshToken
+		}
+		return nil
+	})
+	if errors.Is(err, repository.ErrTokenReused) {
+		logging.FromContext(r.Context()).Warn("Refresh token reused, revoking its session",
+			"user_id", session.UserID, "session_id", session.ID)
+		if err := h.Sessions.Revoke(r.Context(), session.ID, now); err != nil {
+			apierror.Write(w, r, apierror.Internal("Error revoking the session", err))
+			return
+		}
+		apierror.Write(w, r, errInvalidRefreshToken)
+		return
+	} else if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, r, errInvalidRefreshToken)
+		return
+	} else if err != nil {
+		writeTxError(w, r, err, "Error refreshing the session")
+		return
+	}
+
+	tokens, err := h.Tokens.response(session, refreshToken, now)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error signing the token", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// LogoutHandler revokes the session of the caller's token; its refresh
+// token and access tokens stop working at once.
+func (h *SessionHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	// Tokens issued before sessions existed have nothing to revoke and
+	// simply expire
+	if sessionID, ok := middleware.SessionIDFromContext(r.Context()); ok {
+		err := h.Sessions.Revoke(r.Context(), sessionID, time.Now().UTC())
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			apierror.Write(w, r, apierror.Internal("Error revoking the session", err))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSessions answers GET /v1/me/sessions with the caller's active
+// sessions, most recently used first.
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizedUserID(w, r, nil, "")
+	if !ok {
+		return
+	}
+
+	sessions, err := h.Sessions.ListActive(r.Context(), userID, time.Now().UTC())
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error fetching sessions", err))
+		return
+	}
+
+	currentID, _ := middleware.SessionIDFromContext(r.Context())
+	resources := make([]SessionResource, len(sessions))
+	for i, session := range sessions {
+		resources[i] = SessionResource{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentID,
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": resources})
+}
+
+// RevokeSession answers DELETE /v1/me/sessions/{id}, signing the caller out
+// of one of their sessions.
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizedUserID(w, r, nil, "")
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, r, errSessionNotFound)
+		return
+	}
+	session, err := h.Sessions.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && session.UserID != userID) {
+		apierror.Write(w, r, errSessionNotFound)
+		return
+	} else if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error fetching the session", err))
+		return
+	}
+
+	if err := h.Sessions.Revoke(r.Context(), id, time.Now().UTC()); err != nil {
+		apierror.Write(w, r, apierror.Internal("Error revoking the session", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAllSessions answers DELETE /v1/me/sessions, signing the caller out
+// everywhere, this session included.
+func (h *SessionHandler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizedUserID(w, r, nil, "")
+	if !ok {
+		return
+	}
+
+	if err := h.Sessions.RevokeAll(r.Context(), userID, time.Now().UTC()); err != nil {
+		apierror.Write(w, r, apierror.Internal("Error revoking sessions", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
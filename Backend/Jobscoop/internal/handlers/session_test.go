@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/middleware"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// login logs the user in and returns the tokens of the new session.
+func login(t *testing.T, h *Handlers, email, password, userAgent string) TokenResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/login",
+		strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`))
+	req.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	h.Users.LoginHandler(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var tokens TokenResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&tokens))
+	require.NotEmpty(t, tokens.RefreshToken)
+	return tokens
+}
+
+// tokenClaims verifies a token handed out by the test handlers.
+func tokenClaims(t *testing.T, token string) *Claims {
+	t.Helper()
+	var claims *Claims
+	middleware.Authenticate("test_secret", nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims = &Claims{}
+		claims.UserID, _ = middleware.UserIDFromContext(r.Context())
+		claims.SessionID, _ = middleware.SessionIDFromContext(r.Context())
+	})).ServeHTTP(httptest.NewRecorder(), bearer(httptest.NewRequest(http.MethodGet, "/", nil), token))
+	require.NotNil(t, claims, "token rejected")
+	return claims
+}
+
+// bearer authorizes req with token.
+func bearer(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// refresh exchanges refreshToken at the refresh endpoint.
+func refresh(h *Handlers, refreshToken string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.Sessions.RefreshHandler(w, httptest.NewRequest(http.MethodPost, "/refresh",
+		strings.NewReader(`{"refreshToken":"`+refreshToken+`"}`)))
+	return w
+}
+
+// sessionRequest builds a request by the owner of a session.
+func sessionRequest(method, path string, userID, sessionID int) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	ctx := middleware.WithSessionID(middleware.WithUserID(req.Context(), userID), sessionID)
+	return req.WithContext(ctx)
+}
+
+func TestLoginStartsSession(t *testing.T) {
+	h, _, _ := newTestHandlers()
+	user := addUser(t, h.Users.Users, "John Doe", "john@example.com", "securepassword")
+
+	tokens := login(t, h, "john@example.com", "securepassword", "Firefox")
+	assert.Equal(t, int(DefaultAccessTokenTTL.Seconds()), tokens.ExpiresIn)
+
+	claims := tokenClaims(t, tokens.Token)
+	assert.Equal(t, user.ID, claims.UserID)
+	session, err := h.Sessions.Sessions.Get(context.Background(), claims.SessionID)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, session.UserID)
+	assert.Equal(t, "Firefox", session.UserAgent)
+	assert.Equal(t, "192.0.2.1", session.IP) // httptest's remote address
+	assert.WithinDuration(t, time.Now().Add(DefaultRefreshTokenTTL), session.ExpiresAt, time.Minute)
+}
+
+func TestRefreshHandler(t *testing.T) {
+	h, _, _ := newTestHandlers()
+	addUser(t, h.Users.Users, "John Doe", "john@example.com", "securepassword")
+	first := login(t, h, "john@example.com", "securepassword", "Firefox")
+	sessionID := tokenClaims(t, first.Token).SessionID
+
+	// Refreshing rotates the refresh token within the same session
+	w := refresh(h, first.RefreshToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var second TokenResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&second))
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.Equal(t, sessionID, tokenClaims(t, second.Token).SessionID)
+
+	w = refresh(h, second.RefreshToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var third TokenResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&third))
+
+	// Replaying a rotated token revokes the session, so the thief's and the
+	// owner's latest tokens both stop working
+	assertError(t, refresh(h, first.RefreshToken), http.StatusUnauthorized, apierror.CodeInvalidRefreshToken)
+
+	active, err := h.Tokens.SessionActive(context.Background(), tokenClaims(t, third.Token).UserID, sessionID)
+	require.NoError(t, err)
+	assert.False(t, active)
+	assert.Equal(t, http.StatusUnauthorized, refresh(h, third.RefreshToken).Code)
+
+	// Unknown and missing tokens are rejected
+	assert.Equal(t, http.StatusUnauthorized, refresh(h, "not-a-token").Code)
+	assert.Equal(t, http.StatusBadRequest, refresh(h, "").Code)
+}
+
+func TestLogoutHandler(t *testing.T) {
+	h, _, _ := newTestHandlers()
+	user := addUser(t, h.Users.Users, "John Doe", "john@example.com", "securepassword")
+	tokens := login(t, h, "john@example.com", "securepassword", "Firefox")
+	sessionID := tokenClaims(t, tokens.Token).SessionID
+
+	w := httptest.NewRecorder()
+	h.Sessions.LogoutHandler(w, sessionRequest(http.MethodPost, "/logout", user.ID, sessionID))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	active, err := h.Tokens.SessionActive(context.Background(), user.ID, sessionID)
+	require.NoError(t, err)
+	assert.False(t, active)
+	assert.Equal(t, http.StatusUnauthorized, refresh(h, tokens.RefreshToken).Code)
+
+	// The revoked session's access token is refused by the middleware
+	reached := false
+	w = httptest.NewRecorder()
+	middleware.Authenticate("test_secret", h.Tokens.SessionActive)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	})).ServeHTTP(w, bearer(httptest.NewRequest(http.MethodGet, "/v1/me/sessions", nil), tokens.Token))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, reached)
+}
+
+func TestSessionEndpoints(t *testing.T) {
+	h, _, _ := newTestHandlers()
+	user := addUser(t, h.Users.Users, "John Doe", "john@example.com", "securepassword")
+	other := addUser(t, h.Users.Users, "Other User", "other@example.com", "password")
+	laptop := tokenClaims(t, login(t, h, "john@example.com", "securepassword", "Firefox").Token).SessionID
+	phone := tokenClaims(t, login(t, h, "john@example.com", "securepassword", "Safari").Token).SessionID
+	othersSession := tokenClaims(t, login(t, h, "other@example.com", "password", "Chrome").Token).SessionID
+
+	list := func() []SessionResource {
+		w := httptest.NewRecorder()
+		h.Sessions.ListSessions(w, sessionRequest(http.MethodGet, "/v1/me/sessions", user.ID, laptop))
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Sessions []SessionResource `json:"sessions"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp.Sessions
+	}
+	revoke := func(id int) *httptest.ResponseRecorder {
+		req := sessionRequest(http.MethodDelete, "/v1/me/sessions/"+strconv.Itoa(id), user.ID, laptop)
+		w := httptest.NewRecorder()
+		h.Sessions.RevokeSession(w, mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(id)}))
+		return w
+	}
+
+	sessions := list()
+	require.Len(t, sessions, 2)
+	current := map[string]bool{}
+	for _, session := range sessions {
+		current[session.UserAgent] = session.Current
+	}
+	assert.Equal(t, map[string]bool{"Firefox": true, "Safari": false}, current)
+
+	// Other users' sessions can't be revoked
+	assertError(t, revoke(othersSession), http.StatusNotFound, apierror.CodeSessionNotFound)
+	assert.Equal(t, http.StatusNotFound, revoke(999).Code)
+
+	assert.Equal(t, http.StatusNoContent, revoke(phone).Code)
+	sessions = list()
+	require.Len(t, sessions, 1)
+	assert.Equal(t, laptop, sessions[0].ID)
+
+	// Signing out everywhere leaves other users signed in
+	w := httptest.NewRecorder()
+	h.Sessions.RevokeAllSessions(w, sessionRequest(http.MethodDelete, "/v1/me/sessions", user.ID, laptop))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, list())
+
+	active, err := h.Tokens.SessionActive(context.Background(), other.ID, othersSession)
+	require.NoError(t, err)
+	assert.True(t, active)
+}
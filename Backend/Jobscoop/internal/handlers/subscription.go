@@ -1,16 +1,29 @@
 package handlers
 
 import (
-	"JobScoop/internal/db"
-	"database/sql"
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
-
-	"github.com/lib/pq"
 )
 
+// SubscriptionHandler serves the user's subscriptions and the subscription
+// overviews.
+type SubscriptionHandler struct {
+	Users         repository.UserRepository
+	Subscriptions repository.SubscriptionRepository
+	Companies     repository.CompanyRepository
+	Roles         repository.RoleRepository
+	CareerSites   repository.CareerSiteRepository
+	Tx            repository.Transactor // runs each request's writes as one transaction
+}
+
 // SubscriptionRequest represents the incoming JSON request
 type SubscriptionRequest struct {
 	Email         string `json:"email"`
@@ -18,146 +31,125 @@ type SubscriptionRequest struct {
 		CompanyName string   `json:"companyName"`
 		CareerLinks []string `json:"careerLinks"`
 		RoleNames   []string `json:"roleNames"`
+		Frequency   string   `json:"frequency,omitempty"` // instant, daily, weekly or off; new subscriptions default to daily
 	} `json:"subscriptions"`
+	AlertSettings
 }
 
-var (
-	getUserIDByEmailFunc        = getUserIDByEmail
-	getOrCreateCompanyIDFunc    = getOrCreateCompanyID
-	getOrCreateCareerSiteIDFunc = getOrCreateCareerSiteID
-	getOrCreateRoleIDFunc       = getOrCreateRoleID
-	getCompanyNameByIDFunc      = getCompanyNameByID
-	getCareerSiteLinkByIDFunc   = getCareerSiteLinkByID
-	getRoleNameByIDFunc         = getRoleNameByID
-	getCompanyIDIfExistsFunc    = getCompanyIDIfExists
-)
+// AlertSettings are the user's optional timezone and hour of the day (0-23)
+// for daily and weekly job digests.
+type AlertSettings struct {
+	Timezone *string `json:"timezone,omitempty"`
+	SendHour *int    `json:"sendHour,omitempty"`
+}
 
-// SubscriptionHandler processes the subscription request
-func SaveSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+// SaveSubscriptionsHandler adds the companies, career links and roles in the
+// request to the user's subscriptions
+func (h *SubscriptionHandler) SaveSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
 	var req SubscriptionRequest
 
 	// Decode the request body
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidRequest())
 		return
 	}
 
-	// Check if email is provided
-	if req.Email == "" {
-		http.Error(w, `{"message": "Email is required"}`, http.StatusBadRequest)
+	// Resolve the caller from the token
+	userID, ok := authorizedUserID(w, r, h.Users, req.Email)
+	if !ok {
 		return
 	}
 
-	// Fetch the user ID based on email
-	userID, err := getUserIDByEmailFunc(req.Email)
-	if err != nil {
-		http.Error(w, `{"message": "User not found. Please sign up."}`, http.StatusNotFound)
+	// Validate frequencies and alert settings before writing anything
+	var fields []apierror.FieldError
+	for i, sub := range req.Subscriptions {
+		if sub.Frequency != "" && !models.ValidFrequency(sub.Frequency) {
+			fields = append(fields, apierror.Field(fmt.Sprintf("subscriptions[%d].frequency", i), invalidFrequencyMessage))
+		}
+	}
+	if fields = append(fields, alertSettingsErrors(req.AlertSettings)...); len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
 		return
 	}
 
-	// Process each subscription entry
-	for _, sub := range req.Subscriptions {
-		// Get or create company and its ID
-		companyID, err := getOrCreateCompanyIDFunc(sub.CompanyName)
-		if err != nil {
-			http.Error(w, `{"message": "Error processing company"}`, http.StatusInternalServerError)
-			return
+	// Apply the settings and every subscription, or nothing if any fails
+	err = h.Tx.WithinTx(r.Context(), func(repos repository.Repositories) error {
+		if err := saveAlertSettings(r.Context(), repos.Users, userID, req.AlertSettings); err != nil {
+			return err
 		}
 
-		// Process new career site links
-		var newCareerSiteIDs []int
-		for _, link := range sub.CareerLinks {
-			careerSiteID, err := getOrCreateCareerSiteIDFunc(link, companyID)
+		// Process each subscription entry
+		for _, sub := range req.Subscriptions {
+			// Get or create company and its ID
+			companyID, err := repos.Companies.GetOrCreate(r.Context(), sub.CompanyName)
 			if err != nil {
-				http.Error(w, `{"message": "Error processing career site"}`, http.StatusInternalServerError)
-				return
+				return apierror.Internal("Error processing company", err)
 			}
-			newCareerSiteIDs = append(newCareerSiteIDs, careerSiteID)
-		}
 
-		// Process new role names
-		var newRoleIDs []int
-		for _, roleName := range sub.RoleNames {
-			roleID, err := getOrCreateRoleIDFunc(roleName)
-			if err != nil {
-				http.Error(w, `{"message": "Error processing role"}`, http.StatusInternalServerError)
-				return
+			// Process new career site links
+			var newCareerSiteIDs []int
+			for _, link := range sub.CareerLinks {
+				careerSiteID, err := repos.CareerSites.GetOrCreate(r.Context(), companyID, link)
+				if err != nil {
+					return apierror.Internal("Error processing career site", err)
+				}
+				newCareerSiteIDs = append(newCareerSiteIDs, careerSiteID)
 			}
-			newRoleIDs = append(newRoleIDs, roleID)
-		}
-
-		// Convert newCareerSiteIDs and newRoleIDs from []int to []int64
-		newCareerSiteIDs64 := make([]int64, len(newCareerSiteIDs))
-		for i, id := range newCareerSiteIDs {
-			newCareerSiteIDs64[i] = int64(id)
-		}
-		newRoleIDs64 := make([]int64, len(newRoleIDs))
-		for i, id := range newRoleIDs {
-			newRoleIDs64[i] = int64(id)
-		}
 
-		// Check if a subscription already exists for this user and company
-		var existingCareerSiteIDs []int64
-		var existingRoleIDs []int64
-		query := "SELECT career_site_ids, role_ids FROM subscriptions WHERE user_id=$1 AND company_id=$2"
-		row := db.DB.QueryRow(query, userID, companyID)
-		err = row.Scan(pq.Array(&existingCareerSiteIDs), pq.Array(&existingRoleIDs))
-		if err != nil && err != sql.ErrNoRows {
-			http.Error(w, `{"message": "Database error while checking existing subscription"}`, http.StatusInternalServerError)
-			return
-		}
-
-		// If no existing record is found, insert a new record
-		if err == sql.ErrNoRows {
-			_, err = db.DB.Exec(`
-				INSERT INTO subscriptions (user_id, company_id, career_site_ids, role_ids, interest_time) 
-				VALUES ($1, $2, $3, $4, $5)`,
-				userID, companyID, pq.Array(newCareerSiteIDs64), pq.Array(newRoleIDs64), time.Now().UTC())
-			if err != nil {
-				http.Error(w, `{"message": "Error inserting subscription"}`, http.StatusInternalServerError)
-				return
-			}
-		} else {
-			// Merge new career site IDs with the existing ones using a hash set
-			careerSiteSet := make(map[int64]struct{})
-			for _, id := range existingCareerSiteIDs {
-				careerSiteSet[id] = struct{}{}
-			}
-			for _, id := range newCareerSiteIDs64 {
-				careerSiteSet[id] = struct{}{}
+			// Process new role names
+			var newRoleIDs []int
+			for _, roleName := range sub.RoleNames {
+				roleID, err := repos.Roles.GetOrCreate(r.Context(), roleName)
+				if err != nil {
+					return apierror.Internal("Error processing role", err)
+				}
+				newRoleIDs = append(newRoleIDs, roleID)
 			}
 
-			// Merge new role IDs with the existing ones using a hash set
-			roleSet := make(map[int64]struct{})
-			for _, id := range existingRoleIDs {
-				roleSet[id] = struct{}{}
+			// If the user doesn't follow the company yet, insert a new record
+			frequency := sub.Frequency
+			if frequency == "" {
+				frequency = models.DefaultFrequency
 			}
-			for _, id := range newRoleIDs64 {
-				roleSet[id] = struct{}{}
-			}
-
-			// Convert sets back to slices
-			mergedCareerSiteIDs := make([]int64, 0, len(careerSiteSet))
-			for id := range careerSiteSet {
-				mergedCareerSiteIDs = append(mergedCareerSiteIDs, id)
+			err = repos.Subscriptions.Create(r.Context(), &models.Subscription{
+				UserID:        userID,
+				CompanyID:     companyID,
+				CareerSiteIDs: newCareerSiteIDs,
+				RoleIDs:       newRoleIDs,
+				Active:        true,
+				Frequency:     frequency,
+				InterestTime:  time.Now().UTC(),
+			})
+			if err == nil {
+				continue
 			}
-			mergedRoleIDs := make([]int64, 0, len(roleSet))
-			for id := range roleSet {
-				mergedRoleIDs = append(mergedRoleIDs, id)
+			if !errors.Is(err, repository.ErrConflict) {
+				return apierror.Internal("Error inserting subscription", err)
 			}
 
-			// Update the existing subscription record with the merged arrays and a new interest_time
-			_, err = db.DB.Exec(`
-				UPDATE subscriptions 
-				SET career_site_ids=$1, role_ids=$2, interest_time=$3
-				WHERE user_id=$4 AND company_id=$5`,
-				pq.Array(mergedCareerSiteIDs), pq.Array(mergedRoleIDs), time.Now().UTC(), userID, companyID)
+			// Otherwise merge the new career sites and roles into the
+			// existing ones and bump the interest time, keeping the
+			// frequency unless a new one was given
+			existing, err := repos.Subscriptions.Get(r.Context(), userID, companyID)
 			if err != nil {
-				http.Error(w, `{"message": "Error updating subscription"}`, http.StatusInternalServerError)
-				return
+				return apierror.Internal("Database error while checking existing subscription", err)
+			}
+			existing.CareerSiteIDs = mergeIDs(existing.CareerSiteIDs, newCareerSiteIDs)
+			existing.RoleIDs = mergeIDs(existing.RoleIDs, newRoleIDs)
+			existing.InterestTime = time.Now().UTC()
+			if sub.Frequency != "" {
+				existing.Frequency = sub.Frequency
+			}
+			if err := repos.Subscriptions.Update(r.Context(), existing); err != nil {
+				return apierror.Internal("Error updating subscription", err)
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		writeTxError(w, r, err, "Error saving subscriptions")
+		return
 	}
 
 	// Respond with success message
@@ -169,61 +161,46 @@ func SaveSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// getUserIDByEmail fetches user ID based on email
-func getUserIDByEmail(email string) (int, error) {
-	var userID int
-	err := db.DB.QueryRow("SELECT id FROM users WHERE email = $1", email).Scan(&userID)
-	if err == sql.ErrNoRows {
-		return 0, fmt.Errorf("user not found")
-	} else if err != nil {
-		return 0, err
-	}
-	return userID, nil
-}
+// invalidFrequencyMessage describes a frequency other than the models.Frequency* values
+const invalidFrequencyMessage = "Frequency must be one of instant, daily, weekly or off"
 
-// getOrCreateCompanyID fetches or inserts a company
-func getOrCreateCompanyID(companyName string) (int, error) {
-	var companyID int
-	err := db.DB.QueryRow("SELECT id FROM companies WHERE name = $1", companyName).Scan(&companyID)
-	if err == sql.ErrNoRows {
-		err = db.DB.QueryRow("INSERT INTO companies (name) VALUES ($1) RETURNING id", companyName).Scan(&companyID)
-		if err != nil {
-			return 0, err
+// mergeIDs appends the IDs in added that aren't in ids yet.
+func mergeIDs(ids, added []int) []int {
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for _, id := range added {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
 		}
-	} else if err != nil {
-		return 0, err
 	}
-	return companyID, nil
+	return ids
 }
 
-// getOrCreateCareerSiteID fetches or inserts a career site
-func getOrCreateCareerSiteID(url string, companyID int) (int, error) {
-	var careerSiteID int
-	err := db.DB.QueryRow("SELECT id FROM career_sites WHERE link = $1", url).Scan(&careerSiteID)
-	if err == sql.ErrNoRows {
-		err = db.DB.QueryRow("INSERT INTO career_sites (company_id,link) VALUES ($1,$2) RETURNING id", companyID, url).Scan(&careerSiteID)
-		if err != nil {
-			return 0, err
-		}
-	} else if err != nil {
-		return 0, err
+// alertSettingsErrors checks the timezone and send hour given, describing
+// the invalid ones.
+func alertSettingsErrors(settings AlertSettings) []apierror.FieldError {
+	var fields []apierror.FieldError
+	if settings.Timezone != nil && !models.ValidTimezone(*settings.Timezone) {
+		fields = append(fields, apierror.Field("timezone", "Timezone must be an IANA timezone such as Europe/Berlin"))
+	}
+	if settings.SendHour != nil && !models.ValidSendHour(*settings.SendHour) {
+		fields = append(fields, apierror.Field("sendHour", "Send hour must be between 0 and 23"))
 	}
-	return careerSiteID, nil
+	return fields
 }
 
-// getOrCreateRoleID fetches or inserts a role
-func getOrCreateRoleID(roleName string) (int, error) {
-	var roleID int
-	err := db.DB.QueryRow("SELECT id FROM roles WHERE name = $1", roleName).Scan(&roleID)
-	if err == sql.ErrNoRows {
-		err = db.DB.QueryRow("INSERT INTO roles (name) VALUES ($1) RETURNING id", roleName).Scan(&roleID)
-		if err != nil {
-			return 0, err
-		}
-	} else if err != nil {
-		return 0, err
+// saveAlertSettings stores the timezone and send hour given, if any.
+func saveAlertSettings(ctx context.Context, users repository.UserRepository, userID int, settings AlertSettings) error {
+	if settings.Timezone == nil && settings.SendHour == nil {
+		return nil
+	}
+	if err := users.UpdateAlertSettings(ctx, userID, settings.Timezone, settings.SendHour); err != nil {
+		return apierror.Internal("Error updating alert settings", err)
 	}
-	return roleID, nil
+	return nil
 }
 
 // SubscriptionResponse represents the JSON object for each subscription row.
@@ -232,6 +209,7 @@ type SubscriptionResponse struct {
 	CareerLinks []string `json:"careerLinks"`
 	RoleNames   []string `json:"roleNames"`
 	Active      bool     `json:"active"`
+	Frequency   string   `json:"frequency"`
 }
 
 // Request struct to get email
@@ -240,93 +218,75 @@ type GetSubscriptionsRequest struct {
 }
 
 // FetchUserSubscriptionsHandler retrieves subscriptions based on the provided email.
-func FetchUserSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
-	// Decode request to get email
+func (h *SubscriptionHandler) FetchUserSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Decode the optional email; the caller comes from the token
 	var req GetSubscriptionsRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
-		return
-	}
-	if req.Email == "" {
-		http.Error(w, `{"message": "Email is required"}`, http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierror.Write(w, r, apierror.InvalidRequest())
 		return
 	}
 
-	// Get user ID from email
-	userID, err := getUserIDByEmailFunc(req.Email)
-	if err != nil {
-		http.Error(w, `{"message": "User not found"}`, http.StatusNotFound)
+	userID, ok := authorizedUserID(w, r, h.Users, req.Email)
+	if !ok {
 		return
 	}
 
 	// Query subscriptions for the user
-	rows, err := db.DB.Query(`
-		SELECT id, company_id, career_site_ids, role_ids, active
-		FROM subscriptions 
-		WHERE user_id=$1`, userID)
+	subs, err := h.Subscriptions.ListByUser(r.Context(), userID)
 	if err != nil {
-		http.Error(w, `{"message": "Database error fetching subscriptions"}`, http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Database error fetching subscriptions", err))
 		return
 	}
-	defer rows.Close()
 
 	// Array to hold subscription responses
 	var subscriptions []SubscriptionResponse
 
-	// Loop through each subscription row
-	for rows.Next() {
-		var id int
-		var companyID int
-		var careerSiteIDs []int64
-		var roleIDs []int64
-		var active bool
-
-		if err := rows.Scan(&id, &companyID, pq.Array(&careerSiteIDs), pq.Array(&roleIDs), &active); err != nil {
-			http.Error(w, `{"message": "Error scanning subscription row"}`, http.StatusInternalServerError)
-			return
-		}
-
+	// Resolve the names of each subscription's company, career sites and roles
+	for _, sub := range subs {
 		// Get the company name
-		companyName, err := getCompanyNameByIDFunc(companyID)
+		company, err := h.Companies.GetByID(r.Context(), sub.CompanyID)
 		if err != nil {
-			http.Error(w, `{"message": "Error fetching company name"}`, http.StatusInternalServerError)
+			apierror.Write(w, r, apierror.Internal("Error fetching company name", err))
 			return
 		}
 
 		// Fetch career site links
 		var careerLinks []string
-		for _, csid := range careerSiteIDs {
-			link, err := getCareerSiteLinkByIDFunc(int(csid))
+		for _, csid := range sub.CareerSiteIDs {
+			site, err := h.CareerSites.GetByID(r.Context(), csid)
 			if err != nil {
-				http.Error(w, `{"message": "Error fetching career site link"}`, http.StatusInternalServerError)
+				apierror.Write(w, r, apierror.Internal("Error fetching career site link", err))
 				return
 			}
-			careerLinks = append(careerLinks, link)
+			careerLinks = append(careerLinks, site.Link)
 		}
 
 		// Fetch role names
 		var roleNames []string
-		for _, rid := range roleIDs {
-			roleName, err := getRoleNameByIDFunc(int(rid))
+		for _, rid := range sub.RoleIDs {
+			role, err := h.Roles.GetByID(r.Context(), rid)
 			if err != nil {
-				http.Error(w, `{"message": "Error fetching role name"}`, http.StatusInternalServerError)
+				apierror.Write(w, r, apierror.Internal("Error fetching role name", err))
 				return
 			}
-			roleNames = append(roleNames, roleName)
+			roleNames = append(roleNames, role.Name)
 		}
 
 		// Create a subscription response object
 		subResp := SubscriptionResponse{
-			CompanyName: companyName,
+			CompanyName: company.Name,
 			CareerLinks: careerLinks,
 			RoleNames:   roleNames,
-			Active:      active,
+			Active:      sub.Active,
+			Frequency:   sub.Frequency,
 		}
 		subscriptions = append(subscriptions, subResp)
 	}
 
-	if err := rows.Err(); err != nil {
-		http.Error(w, `{"message": "Error iterating subscription rows"}`, http.StatusInternalServerError)
+	// Fetch when the user's digests are sent
+	user, err := h.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error fetching alert settings", err))
 		return
 	}
 
@@ -335,39 +295,11 @@ func FetchUserSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":        "success",
 		"subscriptions": subscriptions,
+		"timezone":      user.Timezone,
+		"sendHour":      user.SendHour,
 	})
 }
 
-// Helper: getCompanyNameByID fetches company name from companies table.
-func getCompanyNameByID(companyID int) (string, error) {
-	var name string
-	err := db.DB.QueryRow("SELECT name FROM companies WHERE id=$1", companyID).Scan(&name)
-	if err != nil {
-		return "", err
-	}
-	return name, nil
-}
-
-// Helper: getCareerSiteLinkByID fetches career site link from career_sites table.
-func getCareerSiteLinkByID(careerSiteID int) (string, error) {
-	var link string
-	err := db.DB.QueryRow("SELECT link FROM career_sites WHERE id=$1", careerSiteID).Scan(&link)
-	if err != nil {
-		return "", err
-	}
-	return link, nil
-}
-
-// Helper: getRoleNameByID fetches role name from roles table.
-func getRoleNameByID(roleID int) (string, error) {
-	var roleName string
-	err := db.DB.QueryRow("SELECT name FROM roles WHERE id=$1", roleID).Scan(&roleName)
-	if err != nil {
-		return "", err
-	}
-	return roleName, nil
-}
-
 // UpdateSubscriptionsRequest represents the incoming JSON payload.
 type UpdateSubscriptionsRequest struct {
 	Email         string `json:"email"`
@@ -376,7 +308,9 @@ type UpdateSubscriptionsRequest struct {
 		CareerLinks []string `json:"careerLinks,omitempty"`
 		RoleNames   []string `json:"roleNames,omitempty"`
 		Active      *bool    `json:"active,omitempty"`
+		Frequency   string   `json:"frequency,omitempty"`
 	} `json:"subscriptions"`
+	AlertSettings
 }
 
 // UpdateSubscriptionsHandler updates subscription records based on the provided payload.
@@ -519,155 +453,90 @@ type UpdateSubscriptionsRequest struct {
 // }
 
 // UpdateSubscriptionsHandler updates subscription records based on the provided payload.
-func UpdateSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *SubscriptionHandler) UpdateSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
 	var req UpdateSubscriptionsRequest
 
 	// Decode the request body.
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidRequest())
 		return
 	}
 
-	// Validate that an email is provided.
-	if req.Email == "" {
-		http.Error(w, `{"message": "Email is required"}`, http.StatusBadRequest)
+	// Resolve the caller from the token.
+	userID, ok := authorizedUserID(w, r, h.Users, req.Email)
+	if !ok {
 		return
 	}
 
-	// Get the user ID for the given email.
-	userID, err := getUserIDByEmailFunc(req.Email)
-	if err != nil {
-		http.Error(w, `{"message": "User not found. Please sign up."}`, http.StatusNotFound)
+	// Validate frequencies and alert settings before writing anything.
+	var fields []apierror.FieldError
+	for i, sub := range req.Subscriptions {
+		if sub.Frequency != "" && !models.ValidFrequency(sub.Frequency) {
+			fields = append(fields, apierror.Field(fmt.Sprintf("subscriptions[%d].frequency", i), invalidFrequencyMessage))
+		}
+	}
+	if fields = append(fields, alertSettingsErrors(req.AlertSettings)...); len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
 		return
 	}
 
-	// Process each subscription in the payload.
-	for _, sub := range req.Subscriptions {
-		// CompanyName is mandatory.
-		if sub.CompanyName == "" {
-			http.Error(w, `{"message": "CompanyName is required for each subscription"}`, http.StatusBadRequest)
-			return
-		}
-
-		// Get company ID without auto-creation.
-		companyID, err := getCompanyIDIfExistsFunc(sub.CompanyName)
-		if err != nil {
-			http.Error(w, fmt.Sprintf(`{"message": "Company '%s' does not exist"}`, sub.CompanyName), http.StatusBadRequest)
-			return
+	// Apply the settings and every update, or nothing if any fails.
+	err := h.Tx.WithinTx(r.Context(), func(repos repository.Repositories) error {
+		if err := saveAlertSettings(r.Context(), repos.Users, userID, req.AlertSettings); err != nil {
+			return err
 		}
 
-		// Check if a subscription record exists for this user and company.
-		var subID int
-		query := "SELECT id FROM subscriptions WHERE user_id=$1 AND company_id=$2"
-		row := db.DB.QueryRow(query, userID, companyID)
-		err = row.Scan(&subID)
-		if err == sql.ErrNoRows {
-			http.Error(w, fmt.Sprintf(`{"message": "Subscription for the company %s does not exist"}`, sub.CompanyName), http.StatusBadRequest)
-			return
-		} else if err != nil {
-			http.Error(w, `{"message": "Database error while fetching subscription"}`, http.StatusInternalServerError)
-			return
-		}
-
-		// Flags for which fields to update.
-		updateCareerLinks := len(sub.CareerLinks) > 0
-		updateRoleNames := len(sub.RoleNames) > 0
-		updateActive := sub.Active != nil
-
-		// If no update fields are provided, return error.
-		if !updateCareerLinks && !updateRoleNames && !updateActive {
-			http.Error(w, `{"message": "No update fields provided"}`, http.StatusBadRequest)
-			return
-		}
+		// Process each subscription in the payload.
+		for i, sub := range req.Subscriptions {
+			// CompanyName is mandatory.
+			if sub.CompanyName == "" {
+				return apierror.Validation(apierror.Field(fmt.Sprintf("subscriptions[%d].companyName", i), "CompanyName is required for each subscription"))
+			}
 
-		// Prepare new arrays.
-		var newCareerSiteIDs []int
-		if updateCareerLinks {
-			for _, link := range sub.CareerLinks {
-				careerSiteID, err := getOrCreateCareerSiteIDFunc(link, companyID)
-				if err != nil {
-					http.Error(w, `{"message": "Error processing career site link"}`, http.StatusInternalServerError)
-					return
-				}
-				newCareerSiteIDs = append(newCareerSiteIDs, careerSiteID)
+			// Get company ID without auto-creation.
+			company, err := repos.Companies.GetByName(r.Context(), sub.CompanyName)
+			if err != nil {
+				return apierror.New(http.StatusBadRequest, apierror.CodeCompanyNotFound, fmt.Sprintf("Company '%s' does not exist", sub.CompanyName))
 			}
-		}
 
-		var newRoleIDs []int
-		if updateRoleNames {
-			for _, roleName := range sub.RoleNames {
-				roleID, err := getOrCreateRoleIDFunc(roleName)
-				if err != nil {
-					http.Error(w, `{"message": "Error processing role name"}`, http.StatusInternalServerError)
-					return
-				}
-				newRoleIDs = append(newRoleIDs, roleID)
+			// Check if a subscription record exists for this user and company.
+			existing, err := repos.Subscriptions.Get(r.Context(), userID, company.ID)
+			if errors.Is(err, repository.ErrNotFound) {
+				return apierror.New(http.StatusBadRequest, apierror.CodeSubscriptionNotFound, fmt.Sprintf("Subscription for the company %s does not exist", sub.CompanyName))
+			} else if err != nil {
+				return apierror.Internal("Database error while fetching subscription", err)
 			}
-		}
 
-		// Convert newCareerSiteIDs and newRoleIDs from []int to []int64.
-		newCareerSiteIDs64 := make([]int64, len(newCareerSiteIDs))
-		for i, id := range newCareerSiteIDs {
-			newCareerSiteIDs64[i] = int64(id)
-		}
-		newRoleIDs64 := make([]int64, len(newRoleIDs))
-		for i, id := range newRoleIDs {
-			newRoleIDs64[i] = int64(id)
-		}
+			// Turn the fields given into a merge patch; empty lists leave the
+			// current ones alone.
+			patch := map[string]interface{}{}
+			if len(sub.CareerLinks) > 0 {
+				patch["careerLinks"] = sub.CareerLinks
+			}
+			if len(sub.RoleNames) > 0 {
+				patch["roleNames"] = sub.RoleNames
+			}
+			if sub.Active != nil {
+				patch["active"] = *sub.Active
+			}
+			if sub.Frequency != "" {
+				patch["frequency"] = sub.Frequency
+			}
 
-		now := time.Now().UTC()
-
-		// Build and execute the UPDATE query based on which fields to update.
-		var execErr error
-		switch {
-		case updateCareerLinks && updateRoleNames && updateActive:
-			_, execErr = db.DB.Exec(`
-				UPDATE subscriptions 
-				SET career_site_ids=$1, role_ids=$2, active=$3, interest_time=$4 
-				WHERE user_id=$5 AND company_id=$6`,
-				pq.Array(newCareerSiteIDs64), pq.Array(newRoleIDs64), *sub.Active, now, userID, companyID)
-		case updateCareerLinks && updateRoleNames:
-			_, execErr = db.DB.Exec(`
-				UPDATE subscriptions 
-				SET career_site_ids=$1, role_ids=$2, interest_time=$3 
-				WHERE user_id=$4 AND company_id=$5`,
-				pq.Array(newCareerSiteIDs64), pq.Array(newRoleIDs64), now, userID, companyID)
-		case updateCareerLinks && updateActive:
-			_, execErr = db.DB.Exec(`
-				UPDATE subscriptions 
-				SET career_site_ids=$1, active=$2, interest_time=$3 
-				WHERE user_id=$4 AND company_id=$5`,
-				pq.Array(newCareerSiteIDs64), *sub.Active, now, userID, companyID)
-		case updateRoleNames && updateActive:
-			_, execErr = db.DB.Exec(`
-				UPDATE subscriptions 
-				SET role_ids=$1, active=$2, interest_time=$3 
-				WHERE user_id=$4 AND company_id=$5`,
-				pq.Array(newRoleIDs64), *sub.Active, now, userID, companyID)
-		case updateCareerLinks:
-			_, execErr = db.DB.Exec(`
-				UPDATE subscriptions 
-				SET career_site_ids=$1, interest_time=$2 
-				WHERE user_id=$3 AND company_id=$4`,
-				pq.Array(newCareerSiteIDs64), now, userID, companyID)
-		case updateRoleNames:
-			_, execErr = db.DB.Exec(`
-				UPDATE subscriptions 
-				SET role_ids=$1, interest_time=$2 
-				WHERE user_id=$3 AND company_id=$4`,
-				pq.Array(newRoleIDs64), now, userID, companyID)
-		case updateActive:
-			_, execErr = db.DB.Exec(`
-				UPDATE subscriptions 
-				SET active=$1, interest_time=$2 
-				WHERE user_id=$3 AND company_id=$4`,
-				*sub.Active, now, userID, companyID)
-		}
+			// If no update fields are provided, return error.
+			if len(patch) == 0 {
+				return apierror.Validation(apierror.Field(fmt.Sprintf("subscriptions[%d]", i), "No update fields provided"))
+			}
 
-		if execErr != nil {
-			http.Error(w, `{"message": "Error updating subscription"}`, http.StatusInternalServerError)
-			return
+			if _, err := patchSubscription(r.Context(), repos, existing, patch); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		writeTxError(w, r, err, "Error updating subscriptions")
+		return
 	}
 
 	// Return a success response.
@@ -679,16 +548,6 @@ func UpdateSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// getCompanyIDIfExists retrieves the company id for a given company name without creating a new entry.
-func getCompanyIDIfExists(companyName string) (int, error) {
-	var companyID int
-	err := db.DB.QueryRow("SELECT id FROM companies WHERE name=$1", companyName).Scan(&companyID)
-	if err != nil {
-		return 0, err
-	}
-	return companyID, nil
-}
-
 // DeleteSubscriptionsRequest represents the expected payload.
 type DeleteSubscriptionsRequest struct {
 	Email         string   `json:"email"`
@@ -696,67 +555,64 @@ type DeleteSubscriptionsRequest struct {
 }
 
 // DeleteSubscriptionsHandler deletes subscriptions for the given email and companies.
-func DeleteSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *SubscriptionHandler) DeleteSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
 	var req DeleteSubscriptionsRequest
 
 	// Decode the request body.
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
-		return
-	}
-
-	// Validate that an email is provided.
-	if req.Email == "" {
-		http.Error(w, `{"message": "Email is required"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidRequest())
 		return
 	}
 
 	// Validate that there is at least one subscription to delete.
 	if len(req.Subscriptions) == 0 {
-		http.Error(w, `{"message": "No subscriptions provided to delete"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.Validation(apierror.Field("subscriptions", "No subscriptions provided to delete")))
 		return
 	}
 
-	// Get the user ID corresponding to the email.
-	userID, err := getUserIDByEmailFunc(req.Email)
-	if err != nil {
-		http.Error(w, `{"message": "User not found"}`, http.StatusNotFound)
+	// Resolve the caller from the token.
+	userID, ok := authorizedUserID(w, r, h.Users, req.Email)
+	if !ok {
 		return
 	}
 
-	foundSubscription := false
-	userSubscriptions := false
+	// Delete every subscription given, or none if any delete fails.
+	err := h.Tx.WithinTx(r.Context(), func(repos repository.Repositories) error {
+		foundSubscription := false
+		userSubscriptions := false
 
-	// Loop through each subscription (company name) in the payload.
-	for _, companyName := range req.Subscriptions {
-		// Get the company ID corresponding to the company name.
-		companyID, err := getCompanyIDIfExistsFunc(companyName)
-		if err != nil {
-			// If the company doesn't exist, skip it.
-			continue
-		}
-		foundSubscription = true
+		// Loop through each subscription (company name) in the payload.
+		for _, companyName := range req.Subscriptions {
+			// Get the company ID corresponding to the company name.
+			company, err := repos.Companies.GetByName(r.Context(), companyName)
+			if err != nil {
+				// If the company doesn't exist, skip it.
+				continue
+			}
+			foundSubscription = true
 
-		// Delete the subscription row where user_id and company_id match.
-		res, err := db.DB.Exec("DELETE FROM subscriptions WHERE user_id=$1 AND company_id=$2", userID, companyID)
-		if err != nil {
-			http.Error(w, `{"message": "Database error while deleting subscription"}`, http.StatusInternalServerError)
-			return
-		}
-		count, err := res.RowsAffected()
-		if err == nil && count > 0 {
-			userSubscriptions = true
+			// Delete the user's subscription to the company.
+			deleted, err := repos.Subscriptions.Delete(r.Context(), userID, company.ID)
+			if err != nil {
+				return apierror.Internal("Database error while deleting subscription", err)
+			}
+			if deleted {
+				userSubscriptions = true
+			}
 		}
-	}
 
-	// If none of the given company names existed in the companies table.
-	if !foundSubscription {
-		http.Error(w, `{"message": "None of the given subscriptions exist"}`, http.StatusBadRequest)
-		return
-	}
+		// If none of the given company names existed in the companies table.
+		if !foundSubscription {
+			return apierror.New(http.StatusBadRequest, apierror.CodeCompanyNotFound, "None of the given subscriptions exist")
+		}
 
-	if !userSubscriptions {
-		http.Error(w, `{"message": "User is not subscribed to any of given subscriptions"}`, http.StatusBadRequest)
+		if !userSubscriptions {
+			return apierror.New(http.StatusBadRequest, apierror.CodeSubscriptionNotFound, "User is not subscribed to any of given subscriptions")
+		}
+		return nil
+	})
+	if err != nil {
+		writeTxError(w, r, err, "Error deleting subscriptions")
 		return
 	}
 
@@ -776,75 +632,38 @@ type FetchAllSubscriptionsResponse struct {
 }
 
 // FetchAllSubscriptionsHandler fetches all companies with their career links and all roles.
-func FetchAllSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
-	// 1. Query companies table to fetch all company IDs and names.
-	companyRows, err := db.DB.Query("SELECT id, name FROM companies")
+func (h *SubscriptionHandler) FetchAllSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	// 1. Fetch all companies.
+	companies, err := h.Companies.List(r.Context())
 	if err != nil {
-		http.Error(w, `{"message": "Error fetching companies"}`, http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Error fetching companies", err))
 		return
 	}
-	defer companyRows.Close()
 
-	// Build a mapping from company id to company name,
-	// and initialize a result map to hold company name -> career links.
-	companies := make(map[int]string)
+	// 2. For each company, fetch all its career site links.
 	companiesMap := make(map[string][]string)
-	for companyRows.Next() {
-		var id int
-		var name string
-		if err := companyRows.Scan(&id, &name); err != nil {
-			http.Error(w, `{"message": "Error scanning companies"}`, http.StatusInternalServerError)
-			return
-		}
-		companies[id] = name
-		companiesMap[name] = []string{} // initialize slice for career links
-	}
-	if err := companyRows.Err(); err != nil {
-		http.Error(w, `{"message": "Error iterating companies"}`, http.StatusInternalServerError)
-		return
-	}
-
-	// 2. For each company, query the career_sites table to fetch all links.
-	for companyID, companyName := range companies {
-		csRows, err := db.DB.Query("SELECT link FROM career_sites WHERE company_id = $1", companyID)
+	for _, company := range companies {
+		sites, err := h.CareerSites.ListByCompany(r.Context(), company.ID)
 		if err != nil {
-			http.Error(w, `{"message": "Error fetching career sites"}`, http.StatusInternalServerError)
+			apierror.Write(w, r, apierror.Internal("Error fetching career sites", err))
 			return
 		}
 		var links []string
-		for csRows.Next() {
-			var link string
-			if err := csRows.Scan(&link); err != nil {
-				csRows.Close()
-				http.Error(w, `{"message": "Error scanning career site"}`, http.StatusInternalServerError)
-				return
-			}
-			links = append(links, link)
+		for _, site := range sites {
+			links = append(links, site.Link)
 		}
-		csRows.Close()
-		companiesMap[companyName] = links
+		companiesMap[company.Name] = links
 	}
 
-	// 3. Query roles table to fetch all role names.
-	roleRows, err := db.DB.Query("SELECT name FROM roles")
+	// 3. Fetch all role names.
+	roleList, err := h.Roles.List(r.Context())
 	if err != nil {
-		http.Error(w, `{"message": "Error fetching roles"}`, http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Error fetching roles", err))
 		return
 	}
-	defer roleRows.Close()
-
 	var roles []string
-	for roleRows.Next() {
-		var roleName string
-		if err := roleRows.Scan(&roleName); err != nil {
-			http.Error(w, `{"message": "Error scanning roles"}`, http.StatusInternalServerError)
-			return
-		}
-		roles = append(roles, roleName)
-	}
-	if err := roleRows.Err(); err != nil {
-		http.Error(w, `{"message": "Error iterating roles"}`, http.StatusInternalServerError)
-		return
+	for _, role := range roleList {
+		roles = append(roles, role.Name)
 	}
 
 	// 4. Build and send the final JSON response.
@@ -867,96 +686,26 @@ type SubscriptionStat struct {
     Total     int     `json:"total"`
 }
 
-func FetchSubscriptionFrequenciesHandler(w http.ResponseWriter, r *http.Request) {
-	// 1. Fetch all distinct company IDs that appear in subscriptions
-	cidRows, err := db.DB.Query(`SELECT DISTINCT company_id FROM subscriptions`)
+// FetchSubscriptionFrequenciesHandler reports, per company, how often each
+// role appears in its subscriptions.
+func (h *SubscriptionHandler) FetchSubscriptionFrequenciesHandler(w http.ResponseWriter, r *http.Request) {
+	// 1. Count the subscriptions following each role of each company
+	counts, err := h.Subscriptions.RoleCounts(r.Context())
 	if err != nil {
-		http.Error(w, `{"message":"Error fetching company IDs"}`, http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Error fetching role counts", err))
 		return
 	}
-	defer cidRows.Close()
 
-	var companyIDs []int
-	for cidRows.Next() {
-		var cid int
-		if err := cidRows.Scan(&cid); err != nil {
-			http.Error(w, `{"message":"Error scanning company ID"}`, http.StatusInternalServerError)
-			return
-		}
-		companyIDs = append(companyIDs, cid)
-	}
-	if err := cidRows.Err(); err != nil {
-		http.Error(w, `{"message":"Error iterating company IDs"}`, http.StatusInternalServerError)
-		return
-	}
-
-	// 2. For each company, compute per-role counts (via unnest) and total subscriptions
+	// 2. Compute each role's share of the company's subscriptions
 	var stats []SubscriptionStat
-	for _, companyID := range companyIDs {
-		// 2a. Lookup company name
-		var companyName string
-		if err := db.DB.
-			QueryRow(`SELECT name FROM companies WHERE id = $1`, companyID).
-			Scan(&companyName); err != nil {
-			http.Error(w, `{"message":"Error fetching company name"}`, http.StatusInternalServerError)
-			return
-		}
-
-		// 2b. Total subscriptions rows for this company
-		var totalSubs int
-		if err := db.DB.
-			QueryRow(`SELECT COUNT(*) FROM subscriptions WHERE company_id = $1`, companyID).
-			Scan(&totalSubs); err != nil {
-			http.Error(w, `{"message":"Error fetching total subscriptions"}`, http.StatusInternalServerError)
-			return
-		}
-
-		// 2c. Unnest the roleids array and count how many rows reference each role
-		roleRows, err := db.DB.Query(`
-            SELECT
-              unnest(role_ids) AS roleid,
-              COUNT(*)       AS cnt
-            FROM subscriptions
-            WHERE company_id = $1
-            GROUP BY roleid
-        `, companyID)
-		if err != nil {
-			http.Error(w, `{"message":"Error fetching role counts"}`, http.StatusInternalServerError)
-			return
-		}
-
-		// 2d. For each roleid, lookup its name, compute frequency, and append
-		for roleRows.Next() {
-			var roleID, cnt int
-			if err := roleRows.Scan(&roleID, &cnt); err != nil {
-				roleRows.Close()
-				http.Error(w, `{"message":"Error scanning role count"}`, http.StatusInternalServerError)
-				return
-			}
-
-			var roleName string
-			if err := db.DB.
-				QueryRow(`SELECT name FROM roles WHERE id = $1`, roleID).
-				Scan(&roleName); err != nil {
-				roleRows.Close()
-				http.Error(w, `{"message":"Error fetching role name"}`, http.StatusInternalServerError)
-				return
-			}
-
-			freq := float64(cnt) / float64(totalSubs)
-			stats = append(stats, SubscriptionStat{
-				Company:   companyName,
-				Role:      roleName,
-				Frequency: freq,
-				Count:     cnt,
-                Total:     totalSubs,
-			})
-		}
-		roleRows.Close()
-		if err := roleRows.Err(); err != nil {
-			http.Error(w, `{"message":"Error iterating role rows"}`, http.StatusInternalServerError)
-			return
-		}
+	for _, count := range counts {
+		stats = append(stats, SubscriptionStat{
+			Company:   count.Company,
+			Role:      count.Role,
+			Frequency: float64(count.Count) / float64(count.Total),
+			Count:     count.Count,
+			Total:     count.Total,
+		})
 	}
 
 	// 3. Return the assembled JSON
@@ -967,68 +716,32 @@ func FetchSubscriptionFrequenciesHandler(w http.ResponseWriter, r *http.Request)
 
 
 // UserCompanySubscription is the shape of each JSON object in the response.
+// Whose subscription it is stays out, since any signed-in user can ask.
 type UserCompanySubscription struct {
-    User      string    `json:"user"`
     Company   string    `json:"company"`
     Date      time.Time `json:"date"`
     RoleNames []string  `json:"roleNames"`
 }
 
-func FetchAllUserSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
-    const query = `
-    SELECT
-      u.name            AS user_name,
-      c.name            AS company_name,
-      s.interest_time   AS date,
-      array_agg(r.name) AS role_names
-    FROM subscriptions s
-    JOIN users    u ON s.user_id    = u.id
-    JOIN companies c ON s.company_id = c.id
-    CROSS JOIN LATERAL unnest(s.role_ids) AS rid(roleid)
-    JOIN roles    r ON r.id         = rid.roleid
-    GROUP BY u.name, c.name, s.interest_time
-    ORDER BY u.name, s.interest_time DESC;
-    `
-
-    rows, err := db.DB.Query(query)
-    if err != nil {
-        http.Error(
-            w,
-            fmt.Sprintf(`{"message":"Error querying subscriptions: %v"}`, err),
-            http.StatusInternalServerError,
-        )
-        return
-    }
-    defer rows.Close()
-
-    var out []UserCompanySubscription
-    for rows.Next() {
-        var rec UserCompanySubscription
-        if err := rows.Scan(
-            &rec.User,
-            &rec.Company,
-            &rec.Date,
-            pq.Array(&rec.RoleNames),
-        ); err != nil {
-            http.Error(
-                w,
-                fmt.Sprintf(`{"message":"Error scanning row: %v"}`, err),
-                http.StatusInternalServerError,
-            )
-            return
-        }
-        out = append(out, rec)
-    }
-    if err := rows.Err(); err != nil {
-        http.Error(
-            w,
-            fmt.Sprintf(`{"message":"Error iterating rows: %v"}`, err),
-            http.StatusInternalServerError,
-        )
-        return
-    }
-
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(out)
-}
\ No newline at end of file
+// FetchAllUserSubscriptionsHandler lists every user's subscriptions with the
+// roles they follow.
+func (h *SubscriptionHandler) FetchAllUserSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	summaries, err := h.Subscriptions.Summaries(r.Context())
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error querying subscriptions", err))
+		return
+	}
+
+	var out []UserCompanySubscription
+	for _, summary := range summaries {
+		out = append(out, UserCompanySubscription{
+			Company:   summary.Company,
+			Date:      summary.InterestTime,
+			RoleNames: summary.RoleNames,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(out)
+}
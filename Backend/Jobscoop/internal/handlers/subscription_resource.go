@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SubscriptionResource is one of the caller's subscriptions as served by
+// /v1/me/subscriptions.
+type SubscriptionResource struct {
+	ID          int      `json:"id"`
+	CompanyName string   `json:"companyName"`
+	CareerLinks []string `json:"careerLinks"`
+	RoleNames   []string `json:"roleNames"`
+	Active      bool     `json:"active"`
+	Frequency   string   `json:"frequency"` // instant, daily, weekly or off
+}
+
+// CreateSubscriptionRequest is the body of POST /v1/me/subscriptions.
+// Active defaults to true and Frequency to daily.
+type CreateSubscriptionRequest struct {
+	CompanyName string   `json:"companyName"`
+	CareerLinks []string `json:"careerLinks"`
+	RoleNames   []string `json:"roleNames"`
+	Active      *bool    `json:"active"`
+	Frequency   string   `json:"frequency"`
+}
+
+// errSubscriptionNotFound answers requests for a subscription that doesn't
+// exist or belongs to another user.
+var errSubscriptionNotFound = apierror.New(http.StatusNotFound, apierror.CodeSubscriptionNotFound, "Subscription not found")
+
+// ListSubscriptions serves GET /v1/me/subscriptions.
+func (h *SubscriptionHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizedUserID(w, r, h.Users, "")
+	if !ok {
+		return
+	}
+
+	subs, err := h.Subscriptions.ListByUser(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error fetching subscriptions", err))
+		return
+	}
+	resources := make([]SubscriptionResource, 0, len(subs))
+	for _, sub := range subs {
+		resource, err := subscriptionResource(r.Context(), h.repositories(), sub)
+		if err != nil {
+			writeTxError(w, r, err, "Error fetching subscriptions")
+			return
+		}
+		resources = append(resources, resource)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"subscriptions": resources})
+}
+
+// CreateSubscription serves POST /v1/me/subscriptions, answering 409 if the
+// caller already follows the company.
+func (h *SubscriptionHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizedUserID(w, r, h.Users, "")
+	if !ok {
+		return
+	}
+
+	var req CreateSubscriptionRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		apierror.Write(w, r, apierror.InvalidRequest())
+		return
+	}
+	if req.Frequency == "" {
+		req.Frequency = models.DefaultFrequency
+	}
+	fields := missingFields("companyName", req.CompanyName)
+	if !models.ValidFrequency(req.Frequency) {
+		fields = append(fields, apierror.Field("frequency", invalidFrequencyMessage))
+	}
+	if len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	var resource SubscriptionResource
+	err := h.Tx.WithinTx(r.Context(), func(repos repository.Repositories) error {
+		companyID, err := repos.Companies.GetOrCreate(r.Context(), req.CompanyName)
+		if err != nil {
+			return apierror.Internal("Error processing company", err)
+		}
+		sub := models.Subscription{
+			UserID:       userID,
+			CompanyID:    companyID,
+			Active:       active,
+			Frequency:    req.Frequency,
+			InterestTime: time.Now().UTC(),
+		}
+		if sub.CareerSiteIDs, err = careerSiteIDs(r.Context(), repos, companyID, req.CareerLinks); err != nil {
+			return err
+		}
+		if sub.RoleIDs, err = roleIDs(r.Context(), repos, req.RoleNames); err != nil {
+			return err
+		}
+
+		err = repos.Subscriptions.Create(r.Context(), &sub)
+		if errors.Is(err, repository.ErrConflict) {
+			return apierror.New(http.StatusConflict, apierror.CodeAlreadySubscribed, fmt.Sprintf("Already subscribed to %s", req.CompanyName))
+		} else if err != nil {
+			return apierror.Internal("Error inserting subscription", err)
+		}
+
+		resource, err = subscriptionResource(r.Context(), repos, sub)
+		return err
+	})
+	if err != nil {
+		writeTxError(w, r, err, "Error saving subscription")
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/me/subscriptions/%d", resource.ID))
+	writeJSON(w, http.StatusCreated, resource)
+}
+
+// GetSubscription serves GET /v1/me/subscriptions/{id}.
+func (h *SubscriptionHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizedUserID(w, r, h.Users, "")
+	if !ok {
+		return
+	}
+
+	sub, err := ownedSubscription(r.Context(), h.repositories(), userID, mux.Vars(r)["id"])
+	if err != nil {
+		writeTxError(w, r, err, "Error fetching subscription")
+		return
+	}
+	resource, err := subscriptionResource(r.Context(), h.repositories(), sub)
+	if err != nil {
+		writeTxError(w, r, err, "Error fetching subscription")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resource)
+}
+
+// PatchSubscription serves PATCH /v1/me/subscriptions/{id}, applying a JSON
+// Merge Patch (RFC 7396) to the subscription: members given replace the
+// current ones and null clears a list. id and companyName can't change.
+func (h *SubscriptionHandler) PatchSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizedUserID(w, r, h.Users, "")
+	if !ok {
+		return
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil ||
+		(mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+		apierror.Write(w, r, apierror.New(http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType, "Content-Type must be application/merge-patch+json"))
+		return
+	}
+	var patch map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "Patch must be a JSON object"))
+		return
+	}
+
+	var resource SubscriptionResource
+	err := h.Tx.WithinTx(r.Context(), func(repos repository.Repositories) error {
+		sub, err := ownedSubscription(r.Context(), repos, userID, mux.Vars(r)["id"])
+		if err != nil {
+			return err
+		}
+		resource, err = patchSubscription(r.Context(), repos, sub, patch)
+		return err
+	})
+	if err != nil {
+		writeTxError(w, r, err, "Error updating subscription")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resource)
+}
+
+// DeleteSubscription serves DELETE /v1/me/subscriptions/{id}.
+func (h *SubscriptionHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := authorizedUserID(w, r, h.Users, "")
+	if !ok {
+		return
+	}
+
+	err := h.Tx.WithinTx(r.Context(), func(repos repository.Repositories) error {
+		sub, err := ownedSubscription(r.Context(), repos, userID, mux.Vars(r)["id"])
+		if err != nil {
+			return err
+		}
+		if err := repos.Subscriptions.DeleteByID(r.Context(), sub.ID); err != nil {
+			return apierror.Internal("Database error while deleting subscription", err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeTxError(w, r, err, "Error deleting subscription")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// repositories returns the handler's repositories for reads made outside a
+// transaction.
+func (h *SubscriptionHandler) repositories() repository.Repositories {
+	return repository.Repositories{
+		Users:         h.Users,
+		Subscriptions: h.Subscriptions,
+		Companies:     h.Companies,
+		Roles:         h.Roles,
+		CareerSites:   h.CareerSites,
+	}
+}
+
+// ownedSubscription returns the subscription with the ID in the URL if it
+// belongs to userID.
+func ownedSubscription(ctx context.Context, repos repository.Repositories, userID int, rawID string) (models.Subscription, error) {
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		return models.Subscription{}, errSubscriptionNotFound
+	}
+	sub, err := repos.Subscriptions.GetByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && sub.UserID != userID) {
+		return models.Subscription{}, errSubscriptionNotFound
+	} else if err != nil {
+		return models.Subscription{}, apierror.Internal("Database error while fetching subscription", err)
+	}
+	return sub, nil
+}
+
+// subscriptionResource resolves the names sub refers to.
+func subscriptionResource(ctx context.Context, repos repository.Repositories, sub models.Subscription) (SubscriptionResource, error) {
+	resource := SubscriptionResource{
+		ID:          sub.ID,
+		CareerLinks: []string{},
+		RoleNames:   []string{},
+		Active:      sub.Active,
+		Frequency:   sub.Frequency,
+	}
+
+	company, err := repos.Companies.GetByID(ctx, sub.CompanyID)
+	if err != nil {
+		return resource, apierror.Internal("Error fetching company name", err)
+	}
+	resource.CompanyName = company.Name
+	for _, id := range sub.CareerSiteIDs {
+		site, err := repos.CareerSites.GetByID(ctx, id)
+		if err != nil {
+			return resource, apierror.Internal("Error fetching career site link", err)
+		}
+		resource.CareerLinks = append(resource.CareerLinks, site.Link)
+	}
+	for _, id := range sub.RoleIDs {
+		role, err := repos.Roles.GetByID(ctx, id)
+		if err != nil {
+			return resource, apierror.Internal("Error fetching role name", err)
+		}
+		resource.RoleNames = append(resource.RoleNames, role.Name)
+	}
+	return resource, nil
+}
+
+// patchSubscription applies the merge patch to sub and stores the result,
+// bumping its interest time.
+func patchSubscription(ctx context.Context, repos repository.Repositories, sub models.Subscription, patch map[string]interface{}) (SubscriptionResource, error) {
+	current, err := subscriptionResource(ctx, repos, sub)
+	if err != nil {
+		return current, err
+	}
+
+	// Merge the patch into the current representation and read it back
+	var document interface{}
+	data, _ := json.Marshal(current)
+	json.Unmarshal(data, &document)
+	data, _ = json.Marshal(mergePatch(document, patch))
+
+	var patched struct {
+		ID          int      `json:"id"`
+		CompanyName string   `json:"companyName"`
+		CareerLinks []string `json:"careerLinks"`
+		RoleNames   []string `json:"roleNames"`
+		Active      *bool    `json:"active"`
+		Frequency   string   `json:"frequency"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return current, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "Patch has unknown members or values of the wrong type")
+	}
+	var fields []apierror.FieldError
+	if patched.ID != current.ID {
+		fields = append(fields, apierror.Field("id", "id can't be changed"))
+	}
+	if patched.CompanyName != current.CompanyName {
+		fields = append(fields, apierror.Field("companyName", "companyName can't be changed"))
+	}
+	if patched.Active == nil {
+		fields = append(fields, apierror.Field("active", "active can't be removed"))
+	}
+	if !models.ValidFrequency(patched.Frequency) {
+		fields = append(fields, apierror.Field("frequency", invalidFrequencyMessage))
+	}
+	if len(fields) > 0 {
+		return current, apierror.Validation(fields...)
+	}
+
+	if sub.CareerSiteIDs, err = careerSiteIDs(ctx, repos, sub.CompanyID, patched.CareerLinks); err != nil {
+		return current, err
+	}
+	if sub.RoleIDs, err = roleIDs(ctx, repos, patched.RoleNames); err != nil {
+		return current, err
+	}
+	sub.Active = *patched.Active
+	sub.Frequency = patched.Frequency
+	sub.InterestTime = time.Now().UTC()
+	if err := repos.Subscriptions.Update(ctx, sub); err != nil {
+		return current, apierror.Internal("Error updating subscription", err)
+	}
+
+	return SubscriptionResource{
+		ID:          sub.ID,
+		CompanyName: current.CompanyName,
+		CareerLinks: append([]string{}, patched.CareerLinks...),
+		RoleNames:   append([]string{}, patched.RoleNames...),
+		Active:      sub.Active,
+		Frequency:   sub.Frequency,
+	}, nil
+}
+
+// mergePatch applies the JSON Merge Patch (RFC 7396) patch to target, both
+// decoded from JSON into interface{} values.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// careerSiteIDs gets or creates the company's career sites with the links.
+func careerSiteIDs(ctx context.Context, repos repository.Repositories, companyID int, links []string) ([]int, error) {
+	var ids []int
+	for _, link := range links {
+		id, err := repos.CareerSites.GetOrCreate(ctx, companyID, link)
+		if err != nil {
+			return nil, apierror.Internal("Error processing career site link", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// roleIDs gets or creates the roles with the names.
+func roleIDs(ctx context.Context, repos repository.Repositories, names []string) ([]int, error) {
+	var ids []int
+	for _, name := range names {
+		id, err := repos.Roles.GetOrCreate(ctx, name)
+		if err != nil {
+			return nil, apierror.Internal("Error processing role name", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// writeJSON answers the request with status and v encoded as JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
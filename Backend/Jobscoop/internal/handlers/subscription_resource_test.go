@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subscriptionRequest builds an authenticated request for userID to the
+// subscription with id.
+func subscriptionRequest(method string, id, userID int, body string) *http.Request {
+	req := httptest.NewRequest(method, "/v1/me/subscriptions/"+strconv.Itoa(id), strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(id)})
+	return authenticated(req, userID)
+}
+
+func TestListSubscriptions(t *testing.T) {
+	f := newSubscriptionFixture(t)
+	sub := f.subscribe(t, f.user.ID, "Acme", []string{"https://acme.example.com/careers"}, nil, models.FrequencyWeekly)
+	other := addUser(t, f.repos.Users, "Other User", "other@example.com", "password")
+	f.subscribe(t, other.ID, "Initech", nil, nil, models.FrequencyDaily)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/me/subscriptions", nil)
+	w := httptest.NewRecorder()
+	f.h.ListSubscriptions(w, authenticated(req, f.user.ID))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Subscriptions []SubscriptionResource `json:"subscriptions"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, []SubscriptionResource{{
+		ID:          sub.ID,
+		CompanyName: "Acme",
+		CareerLinks: []string{"https://acme.example.com/careers"},
+		RoleNames:   []string{},
+		Active:      true,
+		Frequency:   models.FrequencyWeekly,
+	}}, resp.Subscriptions)
+}
+
+func TestCreateSubscription(t *testing.T) {
+	f := newSubscriptionFixture(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/me/subscriptions",
+		strings.NewReader(`{"companyName": "Acme", "roleNames": ["Engineer"]}`))
+	w := httptest.NewRecorder()
+	f.h.CreateSubscription(w, authenticated(req, f.user.ID))
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created SubscriptionResource
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, "/v1/me/subscriptions/"+strconv.Itoa(created.ID), w.Header().Get("Location"))
+	assert.Equal(t, SubscriptionResource{
+		ID:          created.ID,
+		CompanyName: "Acme",
+		CareerLinks: []string{},
+		RoleNames:   []string{"Engineer"},
+		Active:      true,
+		Frequency:   models.DefaultFrequency,
+	}, created)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		field  string
+	}{
+		{"Already subscribed", `{"companyName": "Acme"}`, http.StatusConflict, apierror.CodeAlreadySubscribed, ""},
+		{"Missing company", `{"roleNames": ["Engineer"]}`, http.StatusBadRequest, apierror.CodeValidationFailed, "companyName"},
+		{"Invalid frequency", `{"companyName": "Initech", "frequency": "hourly"}`, http.StatusBadRequest, apierror.CodeValidationFailed, "frequency"},
+		{"Unknown member", `{"companyName": "Initech", "email": "test@example.com"}`, http.StatusBadRequest, apierror.CodeInvalidRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/me/subscriptions", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			f.h.CreateSubscription(w, authenticated(req, f.user.ID))
+
+			body := assertError(t, w, tt.status, tt.code)
+			if tt.field != "" {
+				require.Len(t, body.Error.Fields, 1)
+				assert.Equal(t, tt.field, body.Error.Fields[0].Field)
+			}
+		})
+	}
+}
+
+func TestGetSubscription(t *testing.T) {
+	f := newSubscriptionFixture(t)
+	sub := f.subscribe(t, f.user.ID, "Acme", nil, []string{"Engineer"}, models.FrequencyDaily)
+	other := addUser(t, f.repos.Users, "Other User", "other@example.com", "password")
+
+	w := httptest.NewRecorder()
+	f.h.GetSubscription(w, subscriptionRequest(http.MethodGet, sub.ID, f.user.ID, ""))
+	require.Equal(t, http.StatusOK, w.Code)
+	var got SubscriptionResource
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, "Acme", got.CompanyName)
+	assert.Equal(t, []string{"Engineer"}, got.RoleNames)
+
+	// Other users' subscriptions look the same as missing ones
+	for _, req := range []*http.Request{
+		subscriptionRequest(http.MethodGet, sub.ID, other.ID, ""),
+		subscriptionRequest(http.MethodGet, sub.ID+100, f.user.ID, ""),
+	} {
+		w := httptest.NewRecorder()
+		f.h.GetSubscription(w, req)
+		assertError(t, w, http.StatusNotFound, apierror.CodeSubscriptionNotFound)
+	}
+}
+
+func TestPatchSubscription(t *testing.T) {
+	f := newSubscriptionFixture(t)
+	sub := f.subscribe(t, f.user.ID, "Acme", []string{"https://acme.example.com/careers"}, []string{"Engineer"}, models.FrequencyDaily)
+
+	patch := func(userID int, contentType, body string) *httptest.ResponseRecorder {
+		req := subscriptionRequest(http.MethodPatch, sub.ID, userID, body)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		f.h.PatchSubscription(w, req)
+		return w
+	}
+
+	// Members left out are kept and null clears a list
+	w := patch(f.user.ID, "application/merge-patch+json", `{"careerLinks": null, "frequency": "weekly", "active": false}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var patched SubscriptionResource
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&patched))
+	assert.Equal(t, SubscriptionResource{
+		ID:          sub.ID,
+		CompanyName: "Acme",
+		CareerLinks: []string{},
+		RoleNames:   []string{"Engineer"},
+		Active:      false,
+		Frequency:   models.FrequencyWeekly,
+	}, patched)
+	stored, links, roles := f.get(t, "Acme")
+	assert.Empty(t, links)
+	assert.Equal(t, []string{"Engineer"}, roles)
+	assert.False(t, stored.Active)
+	assert.Equal(t, models.FrequencyWeekly, stored.Frequency)
+
+	other := addUser(t, f.repos.Users, "Other User", "other@example.com", "password")
+	tests := []struct {
+		name        string
+		userID      int
+		contentType string
+		body        string
+		status      int
+		code        string
+		field       string
+	}{
+		{"Company is immutable", f.user.ID, "application/merge-patch+json", `{"companyName": "Initech"}`,
+			http.StatusBadRequest, apierror.CodeValidationFailed, "companyName"},
+		{"Active can't be removed", f.user.ID, "application/merge-patch+json", `{"active": null}`,
+			http.StatusBadRequest, apierror.CodeValidationFailed, "active"},
+		{"Invalid frequency", f.user.ID, "application/merge-patch+json", `{"frequency": "hourly"}`,
+			http.StatusBadRequest, apierror.CodeValidationFailed, "frequency"},
+		{"Unknown member", f.user.ID, "application/merge-patch+json", `{"email": "test@example.com"}`,
+			http.StatusBadRequest, apierror.CodeInvalidRequest, ""},
+		{"Not an object", f.user.ID, "application/merge-patch+json", `["active"]`,
+			http.StatusBadRequest, apierror.CodeInvalidRequest, ""},
+		{"Wrong media type", f.user.ID, "text/plain", `{"active": true}`,
+			http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType, ""},
+		{"Another user's subscription", other.ID, "application/json", `{"active": true}`,
+			http.StatusNotFound, apierror.CodeSubscriptionNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := patch(tt.userID, tt.contentType, tt.body)
+			body := assertError(t, w, tt.status, tt.code)
+			if tt.field != "" {
+				require.Len(t, body.Error.Fields, 1)
+				assert.Equal(t, tt.field, body.Error.Fields[0].Field)
+			}
+
+			// Nothing changes
+			stored, _, _ := f.get(t, "Acme")
+			assert.False(t, stored.Active)
+			assert.Equal(t, models.FrequencyWeekly, stored.Frequency)
+		})
+	}
+}
+
+func TestDeleteSubscription(t *testing.T) {
+	f := newSubscriptionFixture(t)
+	sub := f.subscribe(t, f.user.ID, "Acme", nil, nil, models.FrequencyDaily)
+	other := addUser(t, f.repos.Users, "Other User", "other@example.com", "password")
+
+	w := httptest.NewRecorder()
+	f.h.DeleteSubscription(w, subscriptionRequest(http.MethodDelete, sub.ID, other.ID, ""))
+	assertError(t, w, http.StatusNotFound, apierror.CodeSubscriptionNotFound)
+
+	w = httptest.NewRecorder()
+	f.h.DeleteSubscription(w, subscriptionRequest(http.MethodDelete, sub.ID, f.user.ID, ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = httptest.NewRecorder()
+	f.h.DeleteSubscription(w, subscriptionRequest(http.MethodDelete, sub.ID, f.user.ID, ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396, appendix A
+	tests := []struct{ target, patch, expected string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		var target, patch interface{}
+		require.NoError(t, json.Unmarshal([]byte(tt.target), &target))
+		require.NoError(t, json.Unmarshal([]byte(tt.patch), &patch))
+		got, err := json.Marshal(mergePatch(target, patch))
+		require.NoError(t, err)
+		assert.JSONEq(t, tt.expected, string(got), "%s + %s", tt.target, tt.patch)
+	}
+}
@@ -1,79 +1,91 @@
 package handlers
 
 import (
-	"JobScoop/internal/db"
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
 	"bytes"
-	"database/sql"
+	"context"
 	"encoding/json"
-	"errors"
 	"math"
-	"time"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
-	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-// Mock implementations of helper functions
-func mockGetUserIDByEmail(email string) (int, error) {
-	if email == "test@example.com" {
-		return 1, nil
-	}
-	return 0, errors.New("user not found")
-}
-
-func mockGetOrCreateCompanyID(companyName string) (int, error) {
-	return 1, nil
-}
-
-func mockGetOrCreateCareerSiteID(url string, companyID int) (int, error) {
-	return 1, nil
+// subscriptionFixture is a store with one user, test@example.com, and the
+// handlers on it.
+type subscriptionFixture struct {
+	h     *SubscriptionHandler
+	store *repository.Memory
+	repos repository.Repositories
+	user  models.User
 }
 
-func mockGetOrCreateRoleID(roleName string) (int, error) {
-	return 1, nil
-}
-
-func mockGetCompanyIDIfExists(companyName string) (int, error) {
-	if companyName == "TestCompany" {
-		return 1, nil
+func newSubscriptionFixture(t *testing.T) subscriptionFixture {
+	t.Helper()
+	h, store, _ := newTestHandlers()
+	repos := store.Repositories()
+	return subscriptionFixture{
+		h:     h.Subscriptions,
+		store: store,
+		repos: repos,
+		user:  addUser(t, repos.Users, "Test User", "test@example.com", "password"),
 	}
-	return 0, errors.New("company not found")
 }
 
-func mockGetCompanyNameByID(companyID int) (string, error) {
-	if companyID == 1 {
-		return "Mock Company", nil
-	}
-	return "", errors.New("company not found")
+// subscribe stores a subscription of userID to company following the career
+// links and roles, returning it.
+func (f subscriptionFixture) subscribe(t *testing.T, userID int, company string, links, roles []string, frequency string) models.Subscription {
+	t.Helper()
+	ctx := context.Background()
+	companyID, err := f.repos.Companies.GetOrCreate(ctx, company)
+	require.NoError(t, err)
+	sub := models.Subscription{UserID: userID, CompanyID: companyID, Active: true, Frequency: frequency, InterestTime: time.Now().UTC()}
+	for _, link := range links {
+		id, err := f.repos.CareerSites.GetOrCreate(ctx, companyID, link)
+		require.NoError(t, err)
+		sub.CareerSiteIDs = append(sub.CareerSiteIDs, id)
+	}
+	for _, role := range roles {
+		id, err := f.repos.Roles.GetOrCreate(ctx, role)
+		require.NoError(t, err)
+		sub.RoleIDs = append(sub.RoleIDs, id)
+	}
+	require.NoError(t, f.repos.Subscriptions.Create(ctx, &sub))
+	return sub
 }
 
-func mockGetCareerSiteLinkByID(careerSiteID int) (string, error) {
-	return "https://mock-career.com", nil
-}
-
-func mockGetRoleNameByID(roleID int) (string, error) {
-	return "Mock Role", nil
+// get returns the user's subscription to company with its career links and
+// roles.
+func (f subscriptionFixture) get(t *testing.T, company string) (models.Subscription, []string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	c, err := f.repos.Companies.GetByName(ctx, company)
+	require.NoError(t, err)
+	sub, err := f.repos.Subscriptions.Get(ctx, f.user.ID, c.ID)
+	require.NoError(t, err)
+	var links, roles []string
+	for _, id := range sub.CareerSiteIDs {
+		site, err := f.repos.CareerSites.GetByID(ctx, id)
+		require.NoError(t, err)
+		links = append(links, site.Link)
+	}
+	for _, id := range sub.RoleIDs {
+		role, err := f.repos.Roles.GetByID(ctx, id)
+		require.NoError(t, err)
+		roles = append(roles, role.Name)
+	}
+	return sub, links, roles
 }
 
 func TestSaveSubscriptionsHandler(t *testing.T) {
-	// Mock the database
-	mockDB, mock, err := sqlmock.New()
-	assert.NoError(t, err)
-	defer mockDB.Close()
-
-	// Replace the actual DB with the mock
-	db.DB = mockDB
-
-	// Override function pointers with mock functions
-	getUserIDByEmailFunc = mockGetUserIDByEmail
-	getOrCreateCompanyIDFunc = mockGetOrCreateCompanyID
-	getOrCreateCareerSiteIDFunc = mockGetOrCreateCareerSiteID
-	getOrCreateRoleIDFunc = mockGetOrCreateRoleID
+	f := newSubscriptionFixture(t)
 
 	// Construct request payload
 	reqBody := map[string]interface{}{
@@ -88,72 +100,126 @@ func TestSaveSubscriptionsHandler(t *testing.T) {
 	}
 	jsonData, _ := json.Marshal(reqBody)
 
-	// Expect query to check for existing subscription
-	mock.ExpectQuery("SELECT career_site_ids, role_ids FROM subscriptions").
-		WithArgs(1, 1).
-		WillReturnError(sql.ErrNoRows)
-
-	// Expect query to insert new subscription
-	mock.ExpectExec("INSERT INTO subscriptions").
-		WithArgs(1, 1, pq.Array([]int64{1}), pq.Array([]int64{1}), sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
 	// Create a request
 	r := httptest.NewRequest("POST", "/save-subscription", bytes.NewBuffer(jsonData))
 	r.Header.Set("Content-Type", "application/json")
+	r = authenticated(r, f.user.ID)
 
 	// Create a ResponseRecorder to capture the response
 	w := httptest.NewRecorder()
 
 	// Call the handler
-	SaveSubscriptionsHandler(w, r)
+	f.h.SaveSubscriptionsHandler(w, r)
 
 	// Validate response
 	assert.Equal(t, http.StatusOK, w.Code)
 
 	var resp map[string]interface{}
-	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
 	assert.NoError(t, err)
 	assert.Equal(t, "Subscription processed successfully", resp["message"])
 	assert.Equal(t, "success", resp["status"])
 
-	// Ensure all expectations were met
-	assert.NoError(t, mock.ExpectationsWereMet())
+	// The new subscription is active and mailed daily
+	sub, links, roles := f.get(t, "Test Company")
+	assert.True(t, sub.Active)
+	assert.Equal(t, models.FrequencyDaily, sub.Frequency)
+	assert.Equal(t, []string{"https://test.com/careers"}, links)
+	assert.Equal(t, []string{"Software Engineer"}, roles)
+
+	t.Run("Saving again merges into the subscription", func(t *testing.T) {
+		body := `{"subscriptions": [{"companyName": "Test Company", "careerLinks": ["https://test.com/careers", "https://jobs.test.com"],
+			"roleNames": ["Data Engineer", "Software Engineer"]}]}`
+		r := authenticated(httptest.NewRequest("POST", "/save-subscriptions", strings.NewReader(body)), f.user.ID)
+		w := httptest.NewRecorder()
+		f.h.SaveSubscriptionsHandler(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		sub, links, roles := f.get(t, "Test Company")
+		assert.Equal(t, []string{"https://test.com/careers", "https://jobs.test.com"}, links)
+		assert.Equal(t, []string{"Software Engineer", "Data Engineer"}, roles)
+		assert.Equal(t, models.FrequencyDaily, sub.Frequency)
+	})
 }
 
-func TestFetchUserSubscriptionsHandler(t *testing.T) {
-	// Initialize mock database
-	mockDB, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("error initializing mock db: %v", err)
+// faultyRoles fails to get or create the role named failOn
+type faultyRoles struct {
+	repository.RoleRepository
+	failOn string
+}
+
+func (r faultyRoles) GetOrCreate(ctx context.Context, name string) (int, error) {
+	if name == r.failOn {
+		return 0, errDB
 	}
-	defer mockDB.Close()
+	return r.RoleRepository.GetOrCreate(ctx, name)
+}
 
-	// Replace the db instance with mock
-	db.DB = mockDB
+// faultyRolesTx runs transactions whose roles repository fails on failOn
+type faultyRolesTx struct {
+	repository.Transactor
+	failOn string
+}
 
-	// Set mock function variables
-	getCompanyNameByIDFunc = mockGetCompanyNameByID
-	getCareerSiteLinkByIDFunc = mockGetCareerSiteLinkByID
-	getRoleNameByIDFunc = mockGetRoleNameByID
-	getUserIDByEmailFunc = mockGetUserIDByEmail
+func (f faultyRolesTx) WithinTx(ctx context.Context, fn func(repository.Repositories) error) error {
+	return f.Transactor.WithinTx(ctx, func(repos repository.Repositories) error {
+		repos.Roles = faultyRoles{repos.Roles, f.failOn}
+		return fn(repos)
+	})
+}
 
-	// Mock SQL query for subscriptions
-	rows := sqlmock.NewRows([]string{"id", "company_id", "career_site_ids", "role_ids", "active"}).
-		AddRow(1, 1, "{1,2}", "{1,2}", true)
+func TestSaveSubscriptionsRollback(t *testing.T) {
+	f := newSubscriptionFixture(t)
+	f.subscribe(t, f.user.ID, "Acme", nil, []string{"Engineer"}, models.FrequencyDaily)
+	f.h.Tx = faultyRolesTx{f.repos, "Analyst"}
+
+	// The second subscription fails, so neither the settings nor the first
+	// subscription are kept
+	body := `{"subscriptions": [
+		{"companyName": "Acme", "roleNames": ["Designer"], "frequency": "weekly"},
+		{"companyName": "Initech", "careerLinks": ["https://initech.com/jobs"], "roleNames": ["Analyst"]}
+	], "sendHour": 6}`
+	r := authenticated(httptest.NewRequest("POST", "/save-subscriptions", strings.NewReader(body)), f.user.ID)
+	w := httptest.NewRecorder()
+	f.h.SaveSubscriptionsHandler(w, r)
+
+	assertError(t, w, http.StatusInternalServerError, apierror.CodeInternal)
+	assert.Equal(t, "Error processing role", responseMessage(w))
+
+	sub, _, roles := f.get(t, "Acme")
+	assert.Equal(t, []string{"Engineer"}, roles)
+	assert.Equal(t, models.FrequencyDaily, sub.Frequency)
+	user, err := f.repos.Users.GetByID(context.Background(), f.user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultSendHour, user.SendHour)
+
+	// No orphan company, career site or role is left behind
+	_, err = f.repos.Companies.GetByName(context.Background(), "Initech")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	allRoles, err := f.repos.Roles.List(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, allRoles, 1)
+}
+
+func TestFetchUserSubscriptionsHandler(t *testing.T) {
+	f := newSubscriptionFixture(t)
+	f.subscribe(t, f.user.ID, "Mock Company", []string{"https://mock-career.com", "https://mock-career.com/jobs"},
+		[]string{"Mock Role", "Other Role"}, models.FrequencyWeekly)
+	require.NoError(t, f.repos.Users.UpdateAlertSettings(context.Background(), f.user.ID, stringPtr("Europe/Berlin"), intPtr(7)))
 
-	mock.ExpectQuery(`SELECT id, company_id, career_site_ids, role_ids, active FROM subscriptions WHERE user_id=\$1`).
-		WithArgs(1).
-		WillReturnRows(rows)
+	// Another user's subscriptions are not included
+	other := addUser(t, f.repos.Users, "Other", "other@example.com", "password")
+	f.subscribe(t, other.ID, "Other Company", nil, []string{"Mock Role"}, models.FrequencyDaily)
 
 	// Prepare test request
 	reqBody, _ := json.Marshal(map[string]string{"email": "test@example.com"})
 	req := httptest.NewRequest(http.MethodPost, "/subscriptions", bytes.NewReader(reqBody))
 	req.Header.Set("Content-Type", "application/json")
+	req = authenticated(req, f.user.ID)
 
 	// Capture response
 	respRecorder := httptest.NewRecorder()
-	FetchUserSubscriptionsHandler(respRecorder, req)
+	f.h.FetchUserSubscriptionsHandler(respRecorder, req)
 
 	// Validate response
 	if status := respRecorder.Code; status != http.StatusOK {
@@ -161,7 +227,7 @@ func TestFetchUserSubscriptionsHandler(t *testing.T) {
 	}
 
 	var response map[string]interface{}
-	err = json.Unmarshal(respRecorder.Body.Bytes(), &response)
+	err := json.Unmarshal(respRecorder.Body.Bytes(), &response)
 	if err != nil {
 		t.Fatalf("error decoding response JSON: %v", err)
 	}
@@ -175,21 +241,98 @@ func TestFetchUserSubscriptionsHandler(t *testing.T) {
 		t.Logf("Actual Response: %s", respRecorder.Body.String())
 	}
 
+	subscriptions, _ := response["subscriptions"].([]interface{})
+	if assert.Len(t, subscriptions, 1) {
+		sub := subscriptions[0].(map[string]interface{})
+		assert.Equal(t, "Mock Company", sub["companyName"])
+		assert.Equal(t, []interface{}{"https://mock-career.com", "https://mock-career.com/jobs"}, sub["careerLinks"])
+		assert.Equal(t, []interface{}{"Mock Role", "Other Role"}, sub["roleNames"])
+		assert.Equal(t, "weekly", sub["frequency"])
+	}
+	assert.Equal(t, "Europe/Berlin", response["timezone"])
+	assert.Equal(t, float64(7), response["sendHour"])
 }
 
-func TestUpdateSubscriptionsHandler(t *testing.T) {
-	// Create a mock DB
-	mockDB, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("error initializing mock db: %v", err)
+func TestSaveSubscriptionsAlertSettings(t *testing.T) {
+	f := newSubscriptionFixture(t)
+	f.subscribe(t, f.user.ID, "Acme", nil, []string{"Engineer"}, models.FrequencyDaily)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedField  string
+		expectTimezone string
+		expectSendHour int
+	}{
+		{
+			name:           "Unknown frequency",
+			body:           `{"subscriptions": [{"companyName": "Acme", "frequency": "hourly"}], "sendHour": 6}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedField:  "subscriptions[0].frequency",
+			expectTimezone: models.DefaultTimezone,
+			expectSendHour: models.DefaultSendHour,
+		},
+		{
+			name:           "Unknown timezone",
+			body:           `{"subscriptions": [], "timezone": "Mars/Olympus"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedField:  "timezone",
+			expectTimezone: models.DefaultTimezone,
+			expectSendHour: models.DefaultSendHour,
+		},
+		{
+			name:           "Send hour out of range",
+			body:           `{"subscriptions": [], "sendHour": 24}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedField:  "sendHour",
+			expectTimezone: models.DefaultTimezone,
+			expectSendHour: models.DefaultSendHour,
+		},
+		{
+			name: "Frequency and settings saved",
+			body: `{"subscriptions": [{"companyName": "Acme", "roleNames": ["Engineer"], "frequency": "instant"}],
+				"timezone": "America/Chicago", "sendHour": 18}`,
+			expectedStatus: http.StatusOK,
+			expectTimezone: "America/Chicago",
+			expectSendHour: 18,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/save-subscriptions", strings.NewReader(tt.body))
+			req = authenticated(req, f.user.ID)
+			w := httptest.NewRecorder()
+			f.h.SaveSubscriptionsHandler(w, req)
+
+			if tt.expectedField != "" {
+				body := assertError(t, w, tt.expectedStatus, apierror.CodeValidationFailed)
+				require.Len(t, body.Error.Fields, 1)
+				assert.Equal(t, tt.expectedField, body.Error.Fields[0].Field)
+			} else {
+				assert.Equal(t, tt.expectedStatus, w.Code)
+			}
+
+			user, err := f.repos.Users.GetByID(context.Background(), f.user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectTimezone, user.Timezone)
+			assert.Equal(t, tt.expectSendHour, user.SendHour)
+		})
 	}
-	defer mockDB.Close()
-	db.DB = mockDB
 
-	getUserIDByEmailFunc = mockGetUserIDByEmail
-	getCompanyIDIfExistsFunc = mockGetCompanyIDIfExists
-	getOrCreateCareerSiteIDFunc = mockGetOrCreateCareerSiteID
-	getOrCreateRoleIDFunc = mockGetOrCreateRoleID
+	sub, _, roles := f.get(t, "Acme")
+	assert.Equal(t, models.FrequencyInstant, sub.Frequency)
+	assert.Equal(t, []string{"Engineer"}, roles)
+}
+
+func stringPtr(s string) *string { return &s }
+
+func intPtr(i int) *int { return &i }
+
+func TestUpdateSubscriptionsHandler(t *testing.T) {
+	f := newSubscriptionFixture(t)
+	f.subscribe(t, f.user.ID, "TestCompany", []string{"https://old.example.com"}, []string{"Analyst"}, models.FrequencyDaily)
 
 	// Define request payload
 	reqBody := UpdateSubscriptionsRequest{
@@ -199,31 +342,26 @@ func TestUpdateSubscriptionsHandler(t *testing.T) {
 			CareerLinks []string `json:"careerLinks,omitempty"`
 			RoleNames   []string `json:"roleNames,omitempty"`
 			Active      *bool    `json:"active,omitempty"`
+			Frequency   string   `json:"frequency,omitempty"`
 		}{
 			{
 				CompanyName: "TestCompany",
 				CareerLinks: []string{"https://example.com/careers"},
 				RoleNames:   []string{"Software Engineer"},
+				Frequency:   "weekly",
 			},
 		},
 	}
 	body, _ := json.Marshal(reqBody)
 
-	mock.ExpectQuery("SELECT id FROM subscriptions WHERE user_id=\\$1 AND company_id=\\$2").
-		WithArgs(1, 1).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-
-	mock.ExpectExec("UPDATE subscriptions").
-		WithArgs(pq.Array([]int64{1}), pq.Array([]int64{1}), sqlmock.AnyArg(), 1, 1).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
 	// Create request
 	req := httptest.NewRequest(http.MethodPost, "/update-subscriptions", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
+	req = authenticated(req, f.user.ID)
 	w := httptest.NewRecorder()
 
 	// Call handler
-	UpdateSubscriptionsHandler(w, req)
+	f.h.UpdateSubscriptionsHandler(w, req)
 
 	// Validate response
 	res := w.Result()
@@ -242,93 +380,118 @@ func TestUpdateSubscriptionsHandler(t *testing.T) {
 		t.Errorf("expected success status; got %v", respBody["status"])
 	}
 
-	// Ensure expectations were met
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("unmet expectations: %v", err)
-		t.Logf("Actual Response: %v", respBody)
-	}
+	// The given fields replace the stored ones
+	sub, links, roles := f.get(t, "TestCompany")
+	assert.Equal(t, []string{"https://example.com/careers"}, links)
+	assert.Equal(t, []string{"Software Engineer"}, roles)
+	assert.Equal(t, models.FrequencyWeekly, sub.Frequency)
+	assert.True(t, sub.Active)
+
+	t.Run("Unknown company rolls back the batch", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/update-subscriptions", strings.NewReader(`{"subscriptions": [
+			{"companyName": "TestCompany", "active": false},
+			{"companyName": "Initech", "active": false}
+		]}`))
+		w := httptest.NewRecorder()
+		f.h.UpdateSubscriptionsHandler(w, authenticated(req, f.user.ID))
+
+		assertError(t, w, http.StatusBadRequest, apierror.CodeCompanyNotFound)
+		assert.Equal(t, "Company 'Initech' does not exist", responseMessage(w))
+		sub, _, _ := f.get(t, "TestCompany")
+		assert.True(t, sub.Active)
+	})
+
+	t.Run("Unknown company", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/update-subscriptions",
+			strings.NewReader(`{"subscriptions": [{"companyName": "Initech", "active": false}]}`))
+		w := httptest.NewRecorder()
+		f.h.UpdateSubscriptionsHandler(w, authenticated(req, f.user.ID))
+
+		assertError(t, w, http.StatusBadRequest, apierror.CodeCompanyNotFound)
+		assert.Equal(t, "Company 'Initech' does not exist", responseMessage(w))
+	})
 }
 
 func TestDeleteSubscriptionsHandler(t *testing.T) {
-	// Create a mock database
-	mockDB, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock database: %v", err)
-	}
-	defer mockDB.Close()
+	f := newSubscriptionFixture(t)
+	f.subscribe(t, f.user.ID, "TestCompany", nil, []string{"Engineer"}, models.FrequencyDaily)
 
-	db.DB = mockDB // Assign mockDB to the actual DB variable
-	getUserIDByEmailFunc = mockGetUserIDByEmail
-	getCompanyIDIfExistsFunc = mockGetCompanyIDIfExists
 	tests := []struct {
 		name           string
+		userID         int
 		requestBody    map[string]interface{}
-		expectDBCalls  bool
-		mockDBResponse func()
 		expectedStatus int
 		expectedBody   string
 	}{
 		{
-			name: "Valid request - subscription deleted",
+			name:   "Valid request - subscription deleted",
+			userID: f.user.ID,
 			requestBody: map[string]interface{}{
 				"email":         "test@example.com",
 				"subscriptions": []string{"TestCompany"},
 			},
-			expectDBCalls: true,
-			mockDBResponse: func() {
-				mock.ExpectExec("DELETE FROM subscriptions").
-					WithArgs(1, 1).
-					WillReturnResult(sqlmock.NewResult(0, 1)) // 1 row affected
-			},
 			expectedStatus: http.StatusOK,
-			expectedBody:   `{"message":"Deleted subscription(s) successfully","status":"success"}`,
+			expectedBody:   "Deleted subscription(s) successfully",
 		},
 		{
-			name: "Invalid request - missing email",
+			name:   "Valid request - already deleted",
+			userID: f.user.ID,
 			requestBody: map[string]interface{}{
 				"subscriptions": []string{"TestCompany"},
 			},
-			expectDBCalls:  false,
-			mockDBResponse: nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   `{"message": "Email is required"}`,
+			expectedBody:   "User is not subscribed to any of given subscriptions",
+		},
+		{
+			name: "Invalid request - missing token",
+			requestBody: map[string]interface{}{
+				"subscriptions": []string{"TestCompany"},
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Missing or malformed authorization token",
 		},
 		{
-			name: "Invalid request - user not found",
+			name:   "Invalid request - email of another user",
+			userID: f.user.ID,
 			requestBody: map[string]interface{}{
 				"email":         "unknown@example.com",
 				"subscriptions": []string{"TestCompany"},
 			},
-			expectDBCalls:  false,
-			mockDBResponse: nil,
-			expectedStatus: http.StatusNotFound,
-			expectedBody:   `{"message": "User not found"}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Token does not match the requested user",
 		},
 		{
-			name: "Invalid request - no subscriptions provided",
+			name:   "Invalid request - no subscriptions provided",
+			userID: f.user.ID,
 			requestBody: map[string]interface{}{
 				"email":         "test@example.com",
 				"subscriptions": []string{},
 			},
-			expectDBCalls:  false,
-			mockDBResponse: nil,
 			expectedStatus: http.StatusBadRequest,
-			expectedBody:   `{"message": "No subscriptions provided to delete"}`,
+			expectedBody:   "Request failed validation",
+		},
+		{
+			name:   "Invalid request - unknown companies",
+			userID: f.user.ID,
+			requestBody: map[string]interface{}{
+				"subscriptions": []string{"Initech"},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "None of the given subscriptions exist",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.expectDBCalls && tt.mockDBResponse != nil {
-				tt.mockDBResponse()
-			}
-
 			reqBody, _ := json.Marshal(tt.requestBody)
 			req := httptest.NewRequest("POST", "/delete-subscriptions", bytes.NewBuffer(reqBody))
 			req.Header.Set("Content-Type", "application/json")
+			if tt.userID != 0 {
+				req = authenticated(req, tt.userID)
+			}
 			w := httptest.NewRecorder()
 
-			DeleteSubscriptionsHandler(w, req)
+			f.h.DeleteSubscriptionsHandler(w, req)
 
 			res := w.Result()
 			defer res.Body.Close()
@@ -337,50 +500,22 @@ func TestDeleteSubscriptionsHandler(t *testing.T) {
 				t.Errorf("Expected status %d, got %d", tt.expectedStatus, res.StatusCode)
 			}
 
-			actualBody := strings.TrimSpace(w.Body.String())
-			if actualBody != tt.expectedBody {
-				t.Errorf("Expected response body %s, got %s", tt.expectedBody, actualBody)
+			if message := responseMessage(w); message != tt.expectedBody {
+				t.Errorf("Expected message %s, got %s", tt.expectedBody, message)
 			}
 		})
 	}
 }
 
 func TestFetchAllSubscriptionsHandler(t *testing.T) {
-	mockDB, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("Failed to create mock database: %v", err)
-	}
-	defer mockDB.Close()
-
-	db.DB = mockDB // Assign mockDB to the actual DB variable
-
-	// Mock companies query
-	mock.ExpectQuery("SELECT id, name FROM companies").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
-			AddRow(1, "Company A").
-			AddRow(2, "Company B"))
-
-	// Mock career_sites query
-	mock.ExpectQuery("SELECT link FROM career_sites WHERE company_id = \\$1").
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"link"}).
-			AddRow("https://companyA.com/careers"))
-
-	mock.ExpectQuery("SELECT link FROM career_sites WHERE company_id = \\$1").
-		WithArgs(2).
-		WillReturnRows(sqlmock.NewRows([]string{"link"}).
-			AddRow("https://companyB.com/careers"))
-
-	// Mock roles query
-	mock.ExpectQuery("SELECT name FROM roles").
-		WillReturnRows(sqlmock.NewRows([]string{"name"}).
-			AddRow("Software Engineer").
-			AddRow("Data Scientist"))
+	f := newSubscriptionFixture(t)
+	f.subscribe(t, f.user.ID, "Company A", []string{"https://companyA.com/careers"}, []string{"Software Engineer"}, models.FrequencyDaily)
+	f.subscribe(t, f.user.ID, "Company B", []string{"https://companyB.com/careers"}, []string{"Data Scientist"}, models.FrequencyDaily)
 
 	r := httptest.NewRequest("GET", "/subscriptions", nil)
 	w := httptest.NewRecorder()
 
-	FetchAllSubscriptionsHandler(w, r) // Call handler
+	f.h.FetchAllSubscriptionsHandler(w, r) // Call handler
 
 	// Assert response
 	resp := w.Result()
@@ -400,84 +535,47 @@ func TestFetchAllSubscriptionsHandler(t *testing.T) {
 		"Company A": {"https://companyA.com/careers"},
 		"Company B": {"https://companyB.com/careers"},
 	}
-	if len(response.Companies) != len(expectedCompanies) {
-		t.Errorf("expected %d companies, got %d", len(expectedCompanies), len(response.Companies))
-	}
+	assert.Equal(t, expectedCompanies, response.Companies)
 
 	expectedRoles := []string{"Software Engineer", "Data Scientist"}
-	if len(response.Roles) != len(expectedRoles) {
-		t.Errorf("expected %d roles, got %d", len(expectedRoles), len(response.Roles))
-	}
-
-	// Ensure all expectations were met
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("unmet expectations: %v", err)
-	}
+	assert.Equal(t, expectedRoles, response.Roles)
 }
 
 func TestFetchSubscriptionFrequenciesHandler(t *testing.T) {
-	// 1. Set up mock DB and replace global db.DB
-	mockDB, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("error initializing mock db: %v", err)
-	}
-	defer mockDB.Close()
-	db.DB = mockDB
-
-	// 2. Mock: DISTINCT company_id
-	mock.ExpectQuery(`SELECT DISTINCT company_id FROM subscriptions`).
-		WillReturnRows(sqlmock.NewRows([]string{"company_id"}).AddRow(100))
-
-	// 3. Mock: company name lookup
-	mock.ExpectQuery(`SELECT name FROM companies WHERE id = \$1`).
-		WithArgs(100).
-		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Adobe"))
-
-	// 4. Mock: total subscriptions count
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM subscriptions WHERE company_id = \$1`).
-		WithArgs(100).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
-
-	// 5. Mock: per-role counts via unnest
-	mock.ExpectQuery(`unnest\(role_ids\)`).
-		WithArgs(100).
-		WillReturnRows(sqlmock.NewRows([]string{"roleid", "cnt"}).
-			AddRow(5, 7).
-			AddRow(6, 3),
-		)
-
-	// 6. Mock: role name lookups
-	mock.ExpectQuery(`SELECT name FROM roles WHERE id = \$1`).
-		WithArgs(5).
-		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Engineer"))
-	mock.ExpectQuery(`SELECT name FROM roles WHERE id = \$1`).
-		WithArgs(6).
-		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Analyst"))
-
-	// 7. Perform the request
+	// 1. Ten subscriptions to Adobe: seven follow Engineer, three Analyst
+	f := newSubscriptionFixture(t)
+	for i := 0; i < 10; i++ {
+		user := addUser(t, f.repos.Users, "User", "user"+string(rune('a'+i))+"@example.com", "password")
+		role := "Engineer"
+		if i >= 7 {
+			role = "Analyst"
+		}
+		f.subscribe(t, user.ID, "Adobe", nil, []string{role}, models.FrequencyDaily)
+	}
+
+	// 2. Perform the request
 	req := httptest.NewRequest(http.MethodGet, "/subscriptions/frequencies", nil)
 	w := httptest.NewRecorder()
-	FetchSubscriptionFrequenciesHandler(w, req)
+	f.h.FetchSubscriptionFrequenciesHandler(w, req)
 
-	// 8. Verify HTTP response
+	// 3. Verify HTTP response
 	res := w.Result()
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
 		t.Fatalf("expected status 200, got %d", res.StatusCode)
 	}
 
-	// 9. Decode JSON
+	// 4. Decode JSON
 	var stats []SubscriptionStat
 	if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
 		t.Fatalf("error decoding response: %v", err)
 	}
 
-	// 10. Assertions
+	// 5. Assertions
 	if len(stats) != 2 {
 		t.Fatalf("expected 2 subscription stats, got %d", len(stats))
 	}
 
-	// Because SQL GROUP BY has no guaranteed ordering, find by role name
 	var gotEng, gotAnl *SubscriptionStat
 	for i := range stats {
 		switch stats[i].Role {
@@ -521,113 +619,50 @@ func TestFetchSubscriptionFrequenciesHandler(t *testing.T) {
 			t.Errorf("Analyst: expected frequency 0.3, got %f", gotAnl.Frequency)
 		}
 	}
+}
+
+func TestFetchAllUserSubscriptionsHandler(t *testing.T) {
+	// 1. Two subscriptions of one user, made at different times
+	f := newSubscriptionFixture(t)
+	abhinav := addUser(t, f.repos.Users, "Abhinav", "abhinav@example.com", "password")
+	t1 := time.Date(2025, 4, 18, 14, 30, 0, 0, time.UTC)
+	t2 := time.Date(2025, 4, 19, 9, 15, 0, 0, time.UTC)
+	for _, sub := range []struct {
+		company string
+		roles   []string
+		at      time.Time
+	}{
+		{"Google", []string{"software engineer", "data engineer"}, t1},
+		{"Tesla", []string{"AI engineer"}, t2},
+	} {
+		stored := f.subscribe(t, abhinav.ID, sub.company, nil, sub.roles, models.FrequencyDaily)
+		stored.InterestTime = sub.at
+		require.NoError(t, f.repos.Subscriptions.Update(context.Background(), stored))
+	}
+
+	// 2. Perform the HTTP request
+	req := httptest.NewRequest(http.MethodGet, "/api/user-subscriptions", nil)
+	w := httptest.NewRecorder()
+	f.h.FetchAllUserSubscriptionsHandler(w, req)
 
-	// 11. Ensure all expectations were met
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("unmet sqlmock expectations: %v", err)
+	// 3. Assert HTTP status
+	res := w.Result()
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", res.StatusCode)
 	}
-}
 
+	// 4. Decode response
+	var got []UserCompanySubscription
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("error decoding response JSON: %v", err)
+	}
 
-func TestFetchAllUserSubscriptionsHandler(t *testing.T) {
-    // 1. Initialize sqlmock and swap in mock DB
-    mockDB, mock, err := sqlmock.New()
-    if err != nil {
-        t.Fatalf("error initializing mock db: %v", err)
-    }
-    defer mockDB.Close()
-    db.DB = mockDB
-
-    // 2. Prepare test timestamps
-    t1 := time.Date(2025, 4, 18, 14, 30, 0, 0, time.UTC)
-    t2 := time.Date(2025, 4, 19, 9, 15, 0, 0, time.UTC)
-
-    // 3. Expect the query and return two rows
-    mock.ExpectQuery(`SELECT\s+u\.name\s+AS user_name,`).
-        WillReturnRows(sqlmock.NewRows([]string{
-            "user_name", "company_name", "date", "role_names",
-        }).
-            // Note: Postgres array literal syntax for the role_names column
-            AddRow("Abhinav", "Google", t1, "{software engineer,data engineer}").
-            AddRow("Abhinav", "Tesla", t2, "{AI engineer}"),
-        )
-
-    // 4. Perform the HTTP request
-    req := httptest.NewRequest(http.MethodGet, "/api/user-subscriptions", nil)
-    w := httptest.NewRecorder()
-    FetchAllUserSubscriptionsHandler(w, req)
-
-    // 5. Assert HTTP status
-    res := w.Result()
-    defer res.Body.Close()
-    if res.StatusCode != http.StatusOK {
-        t.Fatalf("expected status 200, got %d", res.StatusCode)
-    }
-
-    // 6. Decode response
-    var got []UserCompanySubscription
-    if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
-        t.Fatalf("error decoding response JSON: %v", err)
-    }
-
-    // 7. Expect two records
-    if len(got) != 2 {
-        t.Fatalf("expected 2 records, got %d", len(got))
-    }
-
-    // 8. Locate entries by company
-    var g1, g2 *UserCompanySubscription
-    for i := range got {
-        switch got[i].Company {
-        case "Google":
-            g1 = &got[i]
-        case "Tesla":
-            g2 = &got[i]
-        }
-    }
-
-    // 9. Assertions for Google entry
-    if g1 == nil {
-        t.Error("missing entry for company Google")
-    } else {
-        if g1.User != "Abhinav" {
-            t.Errorf("Google: expected user 'Abhinav', got %q", g1.User)
-        }
-        if !g1.Date.Equal(t1) {
-            t.Errorf("Google: expected date %v, got %v", t1, g1.Date)
-        }
-        // roleNames order isn't guaranteed by SQL; compare as a map
-        wantRoles1 := map[string]bool{
-            "software engineer": true,
-            "data engineer":     true,
-        }
-        if len(g1.RoleNames) != len(wantRoles1) {
-            t.Errorf("Google: expected %d roles, got %v", len(wantRoles1), g1.RoleNames)
-        }
-        for _, r := range g1.RoleNames {
-            if !wantRoles1[r] {
-                t.Errorf("Google: unexpected role %q", r)
-            }
-        }
-    }
-
-    // 10. Assertions for Tesla entry
-    if g2 == nil {
-        t.Error("missing entry for company Tesla")
-    } else {
-        if g2.User != "Abhinav" {
-            t.Errorf("Tesla: expected user 'Abhinav', got %q", g2.User)
-        }
-        if !g2.Date.Equal(t2) {
-            t.Errorf("Tesla: expected date %v, got %v", t2, g2.Date)
-        }
-        if len(g2.RoleNames) != 1 || g2.RoleNames[0] != "AI engineer" {
-            t.Errorf("Tesla: expected [\"AI engineer\"], got %v", g2.RoleNames)
-        }
-    }
-
-    // 11. Ensure all expectations were met
-    if err := mock.ExpectationsWereMet(); err != nil {
-        t.Errorf("unmet sqlmock expectations: %v", err)
-    }
-}
\ No newline at end of file
+	// 5. Expect two records, most recent first
+	if len(got) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(got))
+	}
+	assert.Equal(t, UserCompanySubscription{Company: "Tesla", Date: t2, RoleNames: []string{"AI engineer"}}, got[0])
+	assert.Equal(t, UserCompanySubscription{Company: "Google", Date: t1,
+		RoleNames: []string{"software engineer", "data engineer"}}, got[1])
+}
@@ -1,20 +1,25 @@
 package handlers
 
 import (
-	"JobScoop/internal/db"
-	"database/sql"
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/logging"
+	"JobScoop/internal/metrics"
+	"JobScoop/internal/middleware"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
+	"JobScoop/internal/services/mail"
+	"JobScoop/internal/services/oidc"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"math/big"
 	"net/http"
 
 	"crypto/rand"
-	"net/smtp"
-	"os"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -24,100 +29,174 @@ type User struct {
 	Password string `json:"password"`
 }
 
-type Claims struct {
-	UserID int `json:"user_id"`
-	jwt.RegisteredClaims
+// errUserExists answers a signup for an email already taken.
+var errUserExists = apierror.New(http.StatusConflict, apierror.CodeUserExists, "User already exists")
+
+// Claims are shared with the authentication middleware that verifies them.
+type Claims = middleware.Claims
+
+// Defaults for locking accounts after failed logins.
+const (
+	DefaultMaxLoginFailures = 5
+	DefaultLockoutDuration  = 15 * time.Minute
+)
+
+// Limits of the password reset flow.
+const (
+	resetCodeTTL     = 15 * time.Minute // how long a mailed code can be verified
+	resetGrantTTL    = 10 * time.Minute // how long a verified code allows setting the password
+	maxResetAttempts = 5                // codes tried before the reset must be requested again
+)
+
+var (
+	errResetNotRequested = apierror.New(http.StatusNotFound, apierror.CodeResetNotRequested, "No reset request found for this email")
+	errResetGrantInvalid = apierror.New(http.StatusUnauthorized, apierror.CodeResetGrantInvalid, "Invalid or expired reset token. Please verify your code again.")
+)
+
+// UserHandler serves signup, login, signing in through other providers,
+// password reset and the user's profile.
+type UserHandler struct {
+	Users    repository.UserRepository
+	Sessions repository.SessionRepository // revoked when the password is reset
+	Mailer   mail.Sender                  // sends password reset codes, lockout notices and verification links
+	Tokens   *Tokens                      // starts the session handed out at signup and login
+	Tx       repository.Transactor
+
+	MaxLoginFailures int           // wrong passwords in a row from one address, or wrong codes from any, that lock the account; DefaultMaxLoginFailures when zero
+	LockoutDuration  time.Duration // DefaultLockoutDuration when zero
+
+	AppURL          string        // the web app, whose pages verification links and sign-in providers send users to
+	VerificationTTL time.Duration // how long a verification link works; DefaultVerificationTTL when zero
+
+	OIDCProviders map[string]oidc.Provider // the providers users can sign in with, by name
+}
+
+func (h *UserHandler) maxLoginFailures() int {
+	if h.MaxLoginFailures > 0 {
+		return h.MaxLoginFailures
+	}
+	return DefaultMaxLoginFailures
 }
 
-func SetDB(database *sql.DB) {
-	db.DB = database
+func (h *UserHandler) lockoutDuration() time.Duration {
+	if h.LockoutDuration > 0 {
+		return h.LockoutDuration
+	}
+	return DefaultLockoutDuration
 }
 
-func GetDB() *sql.DB {
-	return db.DB
+// authorizedUserID returns the caller's user ID from the verified token. If the
+// request body still names a user by email, it must be the token's owner.
+func authorizedUserID(w http.ResponseWriter, r *http.Request, users repository.UserRepository, email string) (int, bool) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "Missing or malformed authorization token"))
+		return 0, false
+	}
+
+	if email != "" {
+		user, err := users.GetByEmail(r.Context(), email)
+		if err != nil || user.ID != userID {
+			apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "Token does not match the requested user"))
+			return 0, false
+		}
+	}
+
+	return userID, true
 }
 
-func SignupHandler(w http.ResponseWriter, r *http.Request) {
+// currentUser loads the authenticated caller, answering the request itself
+// if it can't.
+func (h *UserHandler) currentUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "Missing or malformed authorization token"))
+		return models.User{}, false
+	}
+	user, err := h.Users.GetByID(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, r, apierror.New(http.StatusNotFound, apierror.CodeUserNotFound, "User not found"))
+		return models.User{}, false
+	} else if err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
+		return models.User{}, false
+	}
+	return user, true
+}
+
+func (h *UserHandler) SignupHandler(w http.ResponseWriter, r *http.Request) {
 	var user User
 
 	// Decode the request payload
 	err := json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidRequest())
 		return
 	}
 
 	// Validate input fields
-	if user.Email == "" || user.Password == "" || user.Name == "" {
-		http.Error(w, "Missing fields", http.StatusBadRequest)
+	if fields := missingFields("name", user.Name, "email", user.Email, "password", user.Password); len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
 		return
 	}
 
 	// Check if the user already exists
-	var exists bool
-	err = db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE email=$1)", user.Email).Scan(&exists)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	_, err = h.Users.GetByEmail(r.Context(), user.Email)
+	if err == nil {
+		apierror.Write(w, r, errUserExists)
 		return
-	}
-
-	if exists {
-		http.Error(w, "User already exists", http.StatusConflict)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
 		return
 	}
 
 	// Hash the password before storing it
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, "Password hashing failed", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Password hashing failed", err))
 		return
 	}
 
-	// Insert the new user into the database
-	_, err = db.DB.Exec("INSERT INTO users (name, email, password) VALUES ($1, $2, $3)", user.Name, user.Email, string(hashedPassword))
-	if err != nil {
-		http.Error(w, "Error inserting user", http.StatusInternalServerError)
+	// Insert the new user; a signup racing this one for the same email loses here
+	created := models.User{Name: user.Name, Email: user.Email, PasswordHash: string(hashedPassword)}
+	err = h.Users.Create(r.Context(), &created)
+	if errors.Is(err, repository.ErrConflict) {
+		apierror.Write(w, r, errUserExists)
 		return
-	}
-
-	// Fetch the newly created user ID for JWT claims
-	var userID int
-	err = db.DB.QueryRow("SELECT id FROM users WHERE email = $1", user.Email).Scan(&userID)
-	if err != nil {
-		http.Error(w, "Error fetching user ID", http.StatusInternalServerError)
+	} else if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error inserting user", err))
 		return
 	}
+	userID := created.ID
 
-	// Generate JWT token
-	expirationTime := time.Now().Add(1 * time.Hour) // Token expires in 1 hour
-	claims := &Claims{
-		UserID: int(userID), // Store user ID in token claims
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			Issuer:    "jobscoop",
-		},
+	// Job alerts wait for the email to be verified; if this email is lost,
+	// the user can ask for another
+	if err := h.sendVerificationEmail(created); err != nil {
+		logging.FromContext(r.Context()).Error("Failed to send the verification email", "user_id", userID, "err", err)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(os.Getenv("JWT_TOKEN")))
+	// Start the new user's session
+	tokens, err := h.Tokens.Start(r.Context(), r, userID)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Error signing the token", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Error starting the session", err))
 		return
 	}
 
-	// Send the JWT token as the response
+	// Send the tokens as the response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "User created successfully",
-		"token":   signedToken,
-		"userid":  userID,
+		"message":      "User created successfully",
+		"token":        tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"userid":       userID,
+		"verified":     false,
 	})
 }
 
 // LoginHandler for authenticating user and issuing JWT token
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (h *UserHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var loginRequest struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -126,71 +205,155 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Decode the request payload
 	err := json.NewDecoder(r.Body).Decode(&loginRequest)
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidRequest())
 		return
 	}
 
 	// Check if email and password are provided
-	if loginRequest.Email == "" || loginRequest.Password == "" {
-		http.Error(w, "Email and password are required", http.StatusBadRequest)
+	if fields := missingFields("email", loginRequest.Email, "password", loginRequest.Password); len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
 		return
 	}
 
 	// Check if the user exists
-	var storedHashedPassword string
-	var userID int
-	err = db.DB.QueryRow("SELECT id, password FROM users WHERE email=$1", loginRequest.Email).Scan(&userID, &storedHashedPassword)
+	user, err := h.Users.GetByEmail(r.Context(), loginRequest.Email)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "User does not exist. Please sign up.", http.StatusNotFound)
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Write(w, r, apierror.New(http.StatusNotFound, apierror.CodeUserNotFound, "User does not exist. Please sign up."))
 		} else {
-			fmt.Println(err)
-			http.Error(w, "Database error", http.StatusInternalServerError)
+			apierror.Write(w, r, apierror.Internal("Database error", err))
 		}
 		return
 	}
 
+	// A locked account can't be logged into, even with the right password
+	now := time.Now().UTC()
+	if h.lockedOut(w, r, user, middleware.ClientIP(r), now) {
+		return
+	}
+
 	// Compare the hashed input password with the stored hashed password
-	err = bcrypt.CompareHashAndPassword([]byte(storedHashedPassword), []byte(loginRequest.Password))
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(loginRequest.Password))
 	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		h.failLogin(w, r, user, middleware.ClientIP(r), now, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid credentials"))
 		return
 	}
 
-	// Successfully authenticated, create the JWT token
-	expirationTime := time.Now().Add(1 * time.Hour) // Set expiration time for 24 hours
-	claims := &Claims{
-		UserID: userID, // Store the user ID in the token claims
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			Issuer:    "jobscoop", // You can customize this
-		},
+	// With two-factor login on, the password only earns a challenge to
+	// answer with a code. Failures from this address keep counting until
+	// the code is right; wrong codes are counted for the account as a whole.
+	if user.MFAEnabled() {
+		challenge, err := h.mfaChallenge(user.ID, now)
+		if err != nil {
+			apierror.Write(w, r, apierror.Internal("Error starting the challenge", err))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message":        "Two-factor authentication required",
+			"mfaRequired":    true,
+			"challengeToken": challenge,
+			"expiresIn":      int(mfaChallengeTTL.Seconds()),
+		})
+		return
 	}
 
-	// Create a new JWT token with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	h.completeLogin(w, r, user)
+}
+
+// lockedOut answers a login to the user's account from the address ip, if
+// it is locked for it, and reports true, or reports false.
+func (h *UserHandler) lockedOut(w http.ResponseWriter, r *http.Request, user models.User, ip string, now time.Time) bool {
+	lockedUntil, err := h.Users.LockedUntil(r.Context(), user.ID, ip)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
+		return true
+	}
+	if now.Before(lockedUntil) {
+		writeAccountLocked(w, r, lockedUntil.Sub(now))
+		return true
+	}
+	return false
+}
+
+// failLogin counts a failed login of the user from the address ip and
+// answers it with failure, unless that locks the account for the address.
+// Locking it for the address alone keeps anyone who knows the email from
+// locking its owner out.
+func (h *UserHandler) failLogin(w http.ResponseWriter, r *http.Request, user models.User, ip string, now time.Time, failure *apierror.Error) {
+	lockedUntil := now.Add(h.lockoutDuration())
+	locked, err := h.Users.RecordLoginFailure(r.Context(), user.ID, ip, h.maxLoginFailures(), lockedUntil)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
+		return
+	}
+	if locked {
+		logging.FromContext(r.Context()).Warn("Account locked after failed logins", "user_id", user.ID)
+		if err := h.sendLockoutEmail(user.Email, ip, lockedUntil); err != nil {
+			logging.FromContext(r.Context()).Error("Failed to send the lockout notice", "user_id", user.ID, "err", err)
+		}
+		writeAccountLocked(w, r, h.lockoutDuration())
+		return
+	}
+	apierror.Write(w, r, failure)
+}
+
+// completeLogin starts a session for the user, who proved who they are,
+// and answers with its tokens.
+func (h *UserHandler) completeLogin(w http.ResponseWriter, r *http.Request, user models.User) {
+	if err := h.Users.ResetLoginFailures(r.Context(), user.ID, middleware.ClientIP(r)); err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
+		return
+	}
 
-	// Sign the token with the secret key
-	signedToken, err := token.SignedString([]byte(os.Getenv("JWT_TOKEN")))
+	// Successfully authenticated, start a session
+	tokens, err := h.Tokens.Start(r.Context(), r, user.ID)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Error signing the token", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Error starting the session", err))
 		return
 	}
 
-	// Send the JWT token as the response
+	// Send the tokens as the response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Login successful",
-		"token":   signedToken,
-		"userid":  userID,
+		"message":      "Login successful",
+		"token":        tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"userid":       user.ID,
 	})
 }
 
-var sendResetEmailFunc = sendResetEmail // Assign function to a variable for mocking
+// writeAccountLocked answers a login to an account locked for retryAfter.
+func writeAccountLocked(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	middleware.SetRetryAfter(w, retryAfter)
+	apierror.Write(w, r, apierror.New(http.StatusLocked, apierror.CodeAccountLocked,
+		"Account temporarily locked after too many failed logins. Please try again later."))
+}
 
-func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+// sendLockoutEmail tells the owner of an account locked for the address ip,
+// who may not be the one failing to log in, when it can log in again.
+func (h *UserHandler) sendLockoutEmail(email, ip string, lockedUntil time.Time) error {
+	text := fmt.Sprintf("Logins to your account from %s were locked after %d failed attempts in a row. "+
+		"They can be tried again after %s; logins from elsewhere still work.\n\n"+
+		"If this wasn't you, someone may be guessing your password; consider resetting it.\n",
+		ip, h.maxLoginFailures(), lockedUntil.Format("15:04 MST on Jan 2"))
+	if ip == secondFactorAddress {
+		text = fmt.Sprintf("Two-factor logins to your account were locked after %d wrong codes in a row. "+
+			"They can be tried again after %s.\n\n"+
+			"Whoever entered the codes knew your password. If this wasn't you, reset it.\n",
+			h.maxLoginFailures(), lockedUntil.Format("15:04 MST on Jan 2"))
+	}
+	err := h.Mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Your JobScoop account was locked",
+		Text:    text,
+	})
+	metrics.ObserveEmail(metrics.EmailAccountLocked, err)
+	return err
+}
+
+func (h *UserHandler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	// Struct to decode the request payload
 	var request struct {
 		Email string `json:"email"`
@@ -199,48 +362,42 @@ func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	// Decode the request payload
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidRequest())
 		return
 	}
 
 	email := request.Email
 
-	// Check if the email exists in the users table
-	var exists bool
-	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)", email).Scan(&exists)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-
 	// If the email doesn't exist, inform the user to sign up first
-	if !exists {
-		http.Error(w, "User does not exist, can't reset password. Please sign up first.", http.StatusNotFound)
+	_, err = h.Users.GetByEmail(r.Context(), email)
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, r, apierror.New(http.StatusNotFound, apierror.CodeUserNotFound, "User does not exist, can't reset password. Please sign up first."))
+		return
+	} else if err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
 		return
 	}
 
-	// Generate token and expiration time
+	// Generate the code and its expiration time
 	token := generateResetToken()
-	expiration := time.Now().UTC().Add(15 * time.Minute) // Token expires in 15 min
-
-	// Store token in database (Insert or Update)
-	_, err = db.DB.Exec(
-		`INSERT INTO reset_tokens (email, token, expires_at) 
-		 VALUES ($1, $2, $3) 
-		 ON CONFLICT(email) 
-		 DO UPDATE SET token=$2, expires_at=$3`,
-		email, token, expiration,
-	)
+	expiration := time.Now().UTC().Add(resetCodeTTL)
+
+	// Store the code hashed, replacing any earlier reset
+	codeHash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Code hashing failed", err))
+		return
+	}
+	err = h.Users.SaveResetToken(r.Context(), models.ResetToken{Email: email, CodeHash: string(codeHash), ExpiresAt: expiration})
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Database error", err))
 		return
 	}
 
 	// Send reset email
-	err = sendResetEmailFunc(email, token)
+	err = h.sendResetEmail(r.Context(), email, token)
 	if err != nil {
-		http.Error(w, "Failed to send email", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Failed to send email", err))
 		return
 	}
 
@@ -265,28 +422,26 @@ func generateResetToken() string {
 	return fmt.Sprintf("%d", token)
 }
 
-func sendResetEmail(email, token string) error {
-	SMTP_HOST := os.Getenv("SMTP_HOST")
-	SMTP_PORT := os.Getenv("SMTP_PORT")
-	SMTP_USER := os.Getenv("SMTP_USER")
-	SMTP_PASS := os.Getenv("SMTP_PASS")
-	auth := smtp.PlainAuth("", SMTP_USER, SMTP_PASS, SMTP_HOST)
-
-	subject := "Subject: Password Reset Request\n"
-	body := "Copy this code to reset your password: " + token + "\n"
-	message := []byte(subject + "\n" + body)
-
-	err := smtp.SendMail(SMTP_HOST+":"+SMTP_PORT, auth, SMTP_USER, []string{email}, message)
+func (h *UserHandler) sendResetEmail(ctx context.Context, email, token string) error {
+	err := h.Mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Password Reset Request",
+		Text:    "Copy this code to reset your password: " + token + "\n",
+	})
+	metrics.ObserveEmail(metrics.EmailPasswordReset, err)
 	if err != nil {
-		log.Printf("Failed to send email: %v", err)
 		return err
 	}
 
-	log.Println("Password reset email sent successfully!")
+	logging.FromContext(ctx).Info("Password reset email sent")
 	return nil
 }
 
-func VerifyCodeHandler(w http.ResponseWriter, r *http.Request) {
+// VerifyCodeHandler checks the code mailed by ForgotPasswordHandler and
+// exchanges it for a reset token, which ResetPasswordHandler requires. A
+// code works once, and after maxResetAttempts tries a new one must be
+// requested.
+func (h *UserHandler) VerifyCodeHandler(w http.ResponseWriter, r *http.Request) {
 	// Struct to decode the request payload
 	var request struct {
 		Email string `json:"email"`
@@ -296,102 +451,148 @@ func VerifyCodeHandler(w http.ResponseWriter, r *http.Request) {
 	// Decode the request payload
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidRequest())
 		return
 	}
 
-	if request.Email == "" || request.Token == "" {
-		http.Error(w, "Email and token are required", http.StatusBadRequest)
+	if fields := missingFields("email", request.Email, "token", request.Token); len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
 		return
 	}
 
-	// Fetch stored token for the email from the database
-	var storedToken string
-	var expiresAt time.Time
-
-	err = db.DB.QueryRow(
-		"SELECT token, expires_at FROM reset_tokens WHERE email=$1",
-		request.Email,
-	).Scan(&storedToken, &expiresAt)
-
+	// Fetch stored code for the email
+	stored, err := h.Users.GetResetToken(r.Context(), request.Email)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "No reset request found for this email", http.StatusNotFound)
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Write(w, r, errResetNotRequested)
 			return
 		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Database error", err))
 		return
 	}
 
-	// Check if the token has expired
-	if time.Now().UTC().After(expiresAt) {
-		http.Error(w, "Token has expired", http.StatusUnauthorized)
+	// A verified code has been exchanged already
+	if stored.CodeHash == "" {
+		apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeResetCodeInvalid, "Verification code already used"))
 		return
 	}
 
-	// Check if the token matches
-	if storedToken != request.Token {
-		http.Error(w, "Invalid verification code", http.StatusUnauthorized)
+	// Check if the code has expired
+	if time.Now().UTC().After(stored.ExpiresAt) {
+		apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeResetCodeExpired, "Token has expired"))
+		return
+	}
+
+	// Count the attempt before comparing, so guesses stop at the limit
+	attempts, err := h.Users.CountResetAttempt(r.Context(), request.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, r, errResetNotRequested)
+		return
+	} else if err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
+		return
+	}
+	if attempts > maxResetAttempts {
+		apierror.Write(w, r, apierror.New(http.StatusTooManyRequests, apierror.CodeResetLocked, "Too many wrong codes. Please request a new one."))
+		return
+	}
+
+	// Check if the code matches
+	if bcrypt.CompareHashAndPassword([]byte(stored.CodeHash), []byte(request.Token)) != nil {
+		logging.FromContext(r.Context()).Warn("Wrong password reset code", "attempts", attempts)
+		apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeResetCodeInvalid, "Invalid verification code"))
+		return
+	}
+
+	// Exchange the code for a reset token
+	resetToken, grantHash, err := newToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Error generating the reset token", err))
+		return
+	}
+	err = h.Users.GrantReset(r.Context(), request.Email, grantHash, time.Now().UTC().Add(resetGrantTTL))
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, r, errResetNotRequested)
+		return
+	} else if err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
 		return
 	}
 
 	// Success response
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Verification successful"))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message":    "Verification successful",
+		"resetToken": resetToken,
+		"expiresIn":  int(resetGrantTTL.Seconds()),
+	})
 }
 
-func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+// ResetPasswordHandler sets a new password with the reset token from
+// VerifyCodeHandler, which it uses up, and signs the user out of every
+// session.
+func (h *UserHandler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	// Struct to decode the request payload
 	var request struct {
 		Email       string `json:"email"`
 		NewPassword string `json:"new_password"`
+		ResetToken  string `json:"reset_token"`
 	}
 
 	// Decode the request payload
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidRequest())
 		return
 	}
 
-	if request.Email == "" || request.NewPassword == "" {
-		http.Error(w, "Email and new password are required", http.StatusBadRequest)
+	if fields := missingFields("email", request.Email, "new_password", request.NewPassword, "reset_token", request.ResetToken); len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
 		return
 	}
 
 	// Check if the user exists
-	var existingEmail string
-	err = db.DB.QueryRow(
-		"SELECT email FROM users WHERE email=$1",
-		request.Email,
-	).Scan(&existingEmail)
-
+	user, err := h.Users.GetByEmail(r.Context(), request.Email)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusNotFound)
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Write(w, r, apierror.New(http.StatusNotFound, apierror.CodeUserNotFound, "User not found"))
 			return
 		}
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Database error", err))
 		return
 	}
 
 	// Hash the new password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Failed to hash password", err))
 		return
 	}
 
-	// Update the user's password in the database
-	_, err = db.DB.Exec(
-		"UPDATE users SET password=$1 WHERE email=$2",
-		hashedPassword, request.Email,
-	)
+	// Use up the reset token, update the password and end the user's
+	// sessions, or do nothing if any fails
+	err = h.Tx.WithinTx(r.Context(), func(repos repository.Repositories) error {
+		err := repos.Users.ConsumeResetGrant(r.Context(), request.Email, hashToken(request.ResetToken), time.Now().UTC())
+		if errors.Is(err, repository.ErrNotFound) {
+			return errResetGrantInvalid
+		} else if err != nil {
+			return apierror.Internal("Database error", err)
+		}
+
+		if err := repos.Users.UpdatePassword(r.Context(), request.Email, string(hashedPassword)); err != nil {
+			return apierror.Internal("Failed to update password", err)
+		}
+		if err := repos.Sessions.RevokeAll(r.Context(), user.ID, time.Now().UTC()); err != nil {
+			return apierror.Internal("Failed to end sessions", err)
+		}
+		return nil
+	})
 	if err != nil {
-		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		writeTxError(w, r, err, "Failed to update password")
 		return
 	}
 
+	logging.FromContext(r.Context()).Info("Password reset, sessions revoked", "user_id", user.ID)
+
 	// Success response
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Password reset successfully"))
@@ -403,41 +604,35 @@ type GetUserRequest struct {
 
 // GetUserResponse represents the response structure
 type GetUserResponse struct {
-	Name      string `json:"name"`
-	Email     string `json:"email"`
-	CreatedAt string `json:"created_at"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	CreatedAt  string `json:"created_at"`
+	Verified   bool   `json:"verified"` // job alerts are only sent to verified emails
+	MFAEnabled bool   `json:"mfaEnabled"`
 }
 
-func GetUser(w http.ResponseWriter, r *http.Request) {
-	// Parse the request body
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	// Parse the request body; the email is optional now that the caller comes from the token
 	var req GetUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierror.Write(w, r, apierror.InvalidRequest())
 		return
 	}
 	defer r.Body.Close()
 
-	// Validate required fields
-	if req.Email == "" {
-		http.Error(w, `{"message": "Email is required"}`, http.StatusBadRequest)
+	userID, ok := authorizedUserID(w, r, h.Users, req.Email)
+	if !ok {
 		return
 	}
 
-	// Query the database for the user
-	var user GetUserResponse
-	err := db.DB.QueryRow(
-		`SELECT name, email, created_at FROM users WHERE email = $1`,
-		req.Email,
-	).Scan(&user.Name, &user.Email, &user.CreatedAt)
-
+	// Look up the user
+	stored, err := h.Users.GetByID(r.Context(), userID)
 	if err != nil {
-		// Check if no rows were returned
-		if err.Error() == "sql: no rows in result set" {
-			http.Error(w, `{"message": "User not found"}`, http.StatusNotFound)
+		// Check if no user was found
+		if errors.Is(err, repository.ErrNotFound) {
+			apierror.Write(w, r, apierror.New(http.StatusNotFound, apierror.CodeUserNotFound, "User not found"))
 		} else {
-			// Log the actual error for debugging
-			// log.Printf("Database error: %v", err)
-			http.Error(w, `{"message": "Error retrieving user data"}`, http.StatusInternalServerError)
+			apierror.Write(w, r, apierror.Internal("Error retrieving user data", err))
 		}
 		return
 	}
@@ -447,36 +642,46 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Return the user data
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(GetUserResponse{
+		Name:       stored.Name,
+		Email:      stored.Email,
+		CreatedAt:  stored.CreatedAt.Format(time.RFC3339Nano),
+		Verified:   stored.Verified(),
+		MFAEnabled: stored.MFAEnabled(),
+	})
 }
 
-
 // UpdateUserRequest represents the expected JSON payload for updating a user.
 type UpdateUserRequest struct {
 	Email string `json:"email"`
 	Name  string `json:"name"`
 }
 
-// UpdateUser updates the name of a user identified by their email.
-func UpdateUser(w http.ResponseWriter, r *http.Request) {
+// UpdateUser updates the name of the authenticated user.
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	// Parse the request body.
 	var req UpdateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"message": "Invalid request payload"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.InvalidRequest())
 		return
 	}
 	defer r.Body.Close()
 
 	// Validate required fields.
-	if req.Email == "" || req.Name == "" {
-		http.Error(w, `{"message": "Email and Name are required"}`, http.StatusBadRequest)
+	if fields := missingFields("name", req.Name); len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
+		return
+	}
+
+	userID, ok := authorizedUserID(w, r, h.Users, req.Email)
+	if !ok {
 		return
 	}
 
-	// Update the user's name in the database.
-	_, err := db.DB.Exec(`UPDATE users SET name = $1 WHERE email = $2`, req.Name, req.Email)
+	// Update the user's name.
+	err := h.Users.UpdateName(r.Context(), userID, req.Name)
 	if err != nil {
-		http.Error(w, `{"message": "Error updating user"}`, http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.Internal("Error updating user", err))
 		return
 	}
 
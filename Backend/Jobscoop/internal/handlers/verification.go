@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/metrics"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
+	"JobScoop/internal/services/mail"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DefaultVerificationTTL is how long an email verification link works.
+const DefaultVerificationTTL = 48 * time.Hour
+
+// verificationAudience is the audience of the tokens in verification links.
+const verificationAudience = "verify_email"
+
+var (
+	errVerificationInvalid = apierror.New(http.StatusBadRequest, apierror.CodeVerificationInvalid, "Invalid verification link")
+	errVerificationExpired = apierror.New(http.StatusBadRequest, apierror.CodeVerificationExpired, "Verification link expired. Please request a new one.")
+)
+
+// verificationClaims are signed into a verification link: the user, as the
+// subject, and the address the link was mailed to.
+type verificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+func (h *UserHandler) verificationTTL() time.Duration {
+	if h.VerificationTTL > 0 {
+		return h.VerificationTTL
+	}
+	return DefaultVerificationTTL
+}
+
+// verificationToken signs a token verifying the user's current email.
+func (h *UserHandler) verificationToken(user models.User, now time.Time) (string, error) {
+	claims := &verificationClaims{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  jwt.ClaimStrings{verificationAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(h.verificationTTL())),
+			Issuer:    "jobscoop",
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.Tokens.purposeKey(verificationAudience))
+}
+
+// parseVerificationToken returns the user ID and email a token from
+// verificationToken verifies, or the API error to answer with.
+func (h *UserHandler) parseVerificationToken(token string) (int, string, *apierror.Error) {
+	claims := &verificationClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return h.Tokens.purposeKey(verificationAudience), nil
+	})
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return 0, "", errVerificationExpired
+	}
+	if err != nil || !parsed.Valid || !claims.VerifyAudience(verificationAudience, true) {
+		return 0, "", errVerificationInvalid
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || claims.Email == "" {
+		return 0, "", errVerificationInvalid
+	}
+	return userID, claims.Email, nil
+}
+
+// sendVerificationEmail mails the user a link to the web app's
+// /verify-email page, which posts the token in it back to /verify-email.
+func (h *UserHandler) sendVerificationEmail(user models.User) error {
+	token, err := h.verificationToken(user, time.Now())
+	if err != nil {
+		return err
+	}
+	link := strings.TrimRight(h.AppURL, "/") + "/verify-email?token=" + url.QueryEscape(token)
+
+	err = h.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your JobScoop email",
+		Text: fmt.Sprintf("Hi %s,\n\nPlease confirm this is your email by opening the link below. "+
+			"Job alerts are only sent once it is verified.\n\n%s\n\n"+
+			"The link works for %s. If you didn't sign up for JobScoop, you can ignore this email.\n",
+			user.Name, link, h.verificationTTL()),
+	})
+	metrics.ObserveEmail(metrics.EmailVerification, err)
+	return err
+}
+
+// VerifyEmailHandler marks the email in a verification link as verified.
+// Following a link twice is harmless.
+func (h *UserHandler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.Write(w, r, apierror.InvalidRequest())
+		return
+	}
+	if fields := missingFields("token", request.Token); len(fields) > 0 {
+		apierror.Write(w, r, apierror.Validation(fields...))
+		return
+	}
+
+	userID, email, apiErr := h.parseVerificationToken(request.Token)
+	if apiErr != nil {
+		apierror.Write(w, r, apiErr)
+		return
+	}
+
+	// The link was mailed to the user's email at the time; it no longer
+	// verifies anything if they have another
+	err := h.Users.MarkVerified(r.Context(), userID, email, time.Now().UTC())
+	if errors.Is(err, repository.ErrNotFound) {
+		apierror.Write(w, r, errVerificationInvalid)
+		return
+	} else if err != nil {
+		apierror.Write(w, r, apierror.Internal("Database error", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Email verified"})
+}
+
+// ResendVerificationHandler mails the caller a new verification link. How
+// often it may be called is limited by the route.
+func (h *UserHandler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.Verified() {
+		apierror.Write(w, r, apierror.New(http.StatusConflict, apierror.CodeAlreadyVerified, "Email already verified"))
+		return
+	}
+
+	if err := h.sendVerificationEmail(user); err != nil {
+		apierror.Write(w, r, apierror.Internal("Error sending verification email", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Verification email sent"})
+}
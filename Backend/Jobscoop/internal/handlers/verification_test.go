@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/middleware"
+	"JobScoop/internal/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var verificationLink = regexp.MustCompile(`http://localhost:3000/verify-email\?token=(\S+)`)
+
+// mailedVerificationToken returns the token in the verification link of the
+// last email sent.
+func mailedVerificationToken(t *testing.T, mailer *recordingMailer) string {
+	t.Helper()
+	require.NotEmpty(t, mailer.sent)
+	match := verificationLink.FindStringSubmatch(mailer.sent[len(mailer.sent)-1].Text)
+	require.NotNil(t, match, "no verification link in %q", mailer.sent[len(mailer.sent)-1].Text)
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+	return token
+}
+
+func verifyEmail(h *Handlers, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/verify-email", strings.NewReader(`{"token":"`+token+`"}`))
+	rr := httptest.NewRecorder()
+	h.Users.VerifyEmailHandler(rr, req)
+	return rr
+}
+
+func resendVerification(h *Handlers, userID int) *httptest.ResponseRecorder {
+	req := authenticated(httptest.NewRequest(http.MethodPost, "/v1/me/verification-email", nil), userID)
+	rr := httptest.NewRecorder()
+	h.Users.ResendVerificationHandler(rr, req)
+	return rr
+}
+
+func TestEmailVerification(t *testing.T) {
+	h, store, mailer := newTestHandlers()
+
+	req := httptest.NewRequest(http.MethodPost, "/signup",
+		strings.NewReader(`{"name":"John Doe","email":"john@example.com","password":"securepassword"}`))
+	rr := httptest.NewRecorder()
+	h.Users.SignupHandler(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	require.Len(t, mailer.sent, 1)
+	assert.Equal(t, "john@example.com", mailer.sent[0].To)
+	token := mailedVerificationToken(t, mailer)
+
+	john, err := store.Repositories().Users.GetByEmail(context.Background(), "john@example.com")
+	require.NoError(t, err)
+	assert.False(t, john.Verified())
+
+	// Resending mails a new link while unverified
+	rr = resendVerification(h, john.ID)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Len(t, mailer.sent, 2)
+
+	// Either link verifies the email, as often as it is followed
+	rr = verifyEmail(h, token)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	john, err = store.Repositories().Users.GetByID(context.Background(), john.ID)
+	require.NoError(t, err)
+	require.True(t, john.Verified())
+	verifiedAt := john.VerifiedAt
+
+	rr = verifyEmail(h, mailedVerificationToken(t, mailer))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	john, err = store.Repositories().Users.GetByID(context.Background(), john.ID)
+	require.NoError(t, err)
+	assert.Equal(t, verifiedAt, john.VerifiedAt)
+
+	// Verified users have nothing to resend
+	assertError(t, resendVerification(h, john.ID), http.StatusConflict, apierror.CodeAlreadyVerified)
+	assert.Len(t, mailer.sent, 2)
+
+	req = authenticated(httptest.NewRequest(http.MethodPost, "/get-user", nil), john.ID)
+	rr = httptest.NewRecorder()
+	h.Users.GetUser(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"verified":true`)
+}
+
+func TestVerifyEmailInvalid(t *testing.T) {
+	h, store, _ := newTestHandlers()
+	john := addUser(t, store.Repositories().Users, "John Doe", "john@example.com", "securepassword")
+	now := time.Now()
+
+	valid, err := h.Users.verificationToken(john, now)
+	require.NoError(t, err)
+	expired, err := h.Users.verificationToken(john, now.Add(-DefaultVerificationTTL-time.Minute))
+	require.NoError(t, err)
+	otherEmail, err := h.Users.verificationToken(models.User{ID: john.ID, Email: "old@example.com"}, now)
+	require.NoError(t, err)
+	accessToken := login(t, h, "john@example.com", "securepassword", "test").Token
+
+	tests := []struct {
+		name         string
+		token        string
+		expectedCode string
+	}{
+		{"Tampered", valid[:len(valid)-2] + "xx", apierror.CodeVerificationInvalid},
+		{"Expired", expired, apierror.CodeVerificationExpired},
+		{"Email No Longer The User's", otherEmail, apierror.CodeVerificationInvalid},
+		{"Access Token", accessToken, apierror.CodeVerificationInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertError(t, verifyEmail(h, tt.token), http.StatusBadRequest, tt.expectedCode)
+		})
+	}
+	assertError(t, verifyEmail(h, ""), http.StatusBadRequest, apierror.CodeValidationFailed)
+
+	john, err = store.Repositories().Users.GetByID(context.Background(), john.ID)
+	require.NoError(t, err)
+	assert.False(t, john.Verified())
+
+	// Nor does a verification token pass for an access token
+	authed := middleware.Authenticate("test_secret", nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected the verification token to be refused")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/v1/me/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+valid)
+	rr := httptest.NewRecorder()
+	authed.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,200 @@
+// Package health answers the deployment's probes: /healthz reports that the
+// process is up and /readyz that it can serve traffic, checking each
+// dependency and reporting its status as JSON:
+//
+//	{"status": "unavailable", "components": {
+//	  "database": {"status": "ok"},
+//	  "migrations": {"status": "failing", "error": "1 pending: 0007_add_sessions"}}}
+//
+// Readiness fails for good once Shutdown is called, so load balancers stop
+// sending requests before the listener closes.
+package health
+
+import (
+	"JobScoop/internal/migrate"
+	"JobScoop/internal/services/crawler"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout bounds how long the readiness checks may take together.
+const DefaultTimeout = 2 * time.Second
+
+// Statuses of the probes and of each component.
+const (
+	StatusOK           = "ok"
+	StatusFailing      = "failing"
+	StatusUnavailable  = "unavailable"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check reports why a component isn't ready, or nil when it is.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks of the server's components.
+type Checker struct {
+	Timeout time.Duration // DefaultTimeout when zero
+
+	checks       []namedCheck
+	shuttingDown atomic.Bool
+}
+
+// New returns a checker with no components, which is always ready.
+func New() *Checker {
+	return &Checker{}
+}
+
+// Add makes readiness depend on the component name passing check.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Shutdown fails every later readiness probe.
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Component is one component's readiness.
+type Component struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the body of a probe's answer.
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components,omitempty"`
+}
+
+// Check runs every check concurrently and reports each component. The
+// report is ok only when all of them pass.
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusShuttingDown}
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	components := make([]Component, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(component *Component, check Check) {
+			defer wg.Done()
+			if err := check(ctx); err != nil {
+				*component = Component{Status: StatusFailing, Error: err.Error()}
+				return
+			}
+			*component = Component{Status: StatusOK}
+		}(&components[i], check.check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Components: make(map[string]Component, len(c.checks))}
+	for i, check := range c.checks {
+		report.Components[check.name] = components[i]
+		if components[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+// Live answers the liveness probe: the process is up if it can answer.
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// Ready answers the readiness probe with 200 when every component is ready
+// and 503 otherwise.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeReport(w, status, report)
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// Database checks that db answers a ping.
+func Database(db *sql.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// Migrations checks that migrator has no migration left to apply.
+func Migrations(migrator *migrate.Migrator) Check {
+	return func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			names := make([]string, len(pending))
+			for i, migration := range pending {
+				names[i] = migration.String()
+			}
+			return fmt.Errorf("%d pending: %s", len(pending), strings.Join(names, ", "))
+		}
+		return nil
+	}
+}
+
+// Running checks that a background service reports itself running.
+func Running(running func() bool) Check {
+	return func(ctx context.Context) error {
+		if !running() {
+			return errors.New("not running")
+		}
+		return nil
+	}
+}
+
+// Crawl checks that the crawler reporting crawlStatus, such as
+// (*crawler.Crawler).Status, is running and has crawled successfully within
+// maxAge. Until its first crawl succeeds, the time since it started counts
+// instead, so a fresh instance isn't failed while the first crawl runs.
+func Crawl(crawlStatus func() crawler.Status, maxAge time.Duration) Check {
+	return func(ctx context.Context) error {
+		status := crawlStatus()
+		if !status.Running {
+			return errors.New("not running")
+		}
+		if status.LastSuccess.IsZero() {
+			if age := time.Since(status.StartedAt); age > maxAge {
+				return fmt.Errorf("no successful crawl since starting %s ago", age.Round(time.Second))
+			}
+			return nil
+		}
+		if age := time.Since(status.LastSuccess); age > maxAge {
+			return fmt.Errorf("last successful crawl was %s ago, over %s", age.Round(time.Second), maxAge)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+package health
+
+import (
+	"JobScoop/internal/migrate"
+	"JobScoop/internal/services/crawler"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, handler http.HandlerFunc, path string) (int, Report) {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var report Report
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	return w.Code, report
+}
+
+func TestReady(t *testing.T) {
+	checker := New()
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	failing := errors.New("connection refused")
+	checker.Add("search", func(ctx context.Context) error { return failing })
+
+	status, report := probe(t, checker.Ready, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, Report{Status: StatusUnavailable, Components: map[string]Component{
+		"database": {Status: StatusOK},
+		"search":   {Status: StatusFailing, Error: "connection refused"},
+	}}, report)
+
+	failing = nil
+	status, report = probe(t, checker.Ready, "/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, StatusOK, report.Status)
+
+	// Shutting down fails readiness but not liveness
+	checker.Shutdown()
+	status, report = probe(t, checker.Ready, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, Report{Status: StatusShuttingDown}, report)
+
+	status, report = probe(t, checker.Live, "/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, Report{Status: StatusOK}, report)
+}
+
+func TestReadyTimeout(t *testing.T) {
+	checker := &Checker{Timeout: 10 * time.Millisecond}
+	checker.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := checker.Check(context.Background())
+	assert.Equal(t, Component{Status: StatusFailing, Error: "context deadline exceeded"}, report.Components["slow"])
+}
+
+func TestMigrations(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	migrator := &migrate.Migrator{DB: mockDB, Migrations: []migrate.Migration{
+		{Version: 1, Name: "create_users"},
+		{Version: 2, Name: "add_sessions"},
+	}}
+
+	mock.ExpectQuery(`SELECT to_regclass`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(int64(1), time.Now()))
+
+	assert.EqualError(t, Migrations(migrator)(context.Background()), "1 pending: 0002_add_sessions")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCrawl(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		status   crawler.Status
+		expected string
+	}{
+		{"Fresh", crawler.Status{Running: true, StartedAt: now.Add(-48 * time.Hour), LastSuccess: now.Add(-time.Hour)}, ""},
+		{"Stale", crawler.Status{Running: true, StartedAt: now.Add(-48 * time.Hour), LastSuccess: now.Add(-13 * time.Hour)},
+			"last successful crawl was 13h0m0s ago, over 12h0m0s"},
+		{"First crawl running", crawler.Status{Running: true, StartedAt: now.Add(-time.Minute)}, ""},
+		{"First crawl never succeeded", crawler.Status{Running: true, StartedAt: now.Add(-13 * time.Hour)},
+			"no successful crawl since starting 13h0m0s ago"},
+		{"Stopped", crawler.Status{StartedAt: now.Add(-time.Hour), LastSuccess: now.Add(-time.Hour)}, "not running"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Crawl(func() crawler.Status { return tt.status }, 12*time.Hour)(context.Background())
+			if tt.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"JobScoop/config"
+	"JobScoop/internal/requestid"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name, in, expected string
+	}{
+		{"API key", "https://api.scrapingdog.com/linkedinjobs?api_key=abc123&field=Engineer",
+			"https://api.scrapingdog.com/linkedinjobs?api_key=[REDACTED]&field=Engineer"},
+		{"Token last", "/verify?email=a@b.c&token=123456", "/verify?email=a@b.c&token=[REDACTED]"},
+		{"URL password", "postgres://app:hunter2@db:5432/jobscoop", "postgres://app:[REDACTED]@db:5432/jobscoop"},
+		{"DSN password", `host='db' password='it\'s secret' dbname='jobscoop'`, "host='db' password=[REDACTED] dbname='jobscoop'"},
+		{"Nothing secret", "/subscriptions/jobs?since=2025-03-01", "/subscriptions/jobs?since=2025-03-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Redact(tt.in))
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, config.Log{Level: "warn", Format: "json"})
+
+	logger.Info("dropped below the level")
+	logger.Warn("job source failed",
+		"password", "hunter2",
+		"url", "https://api.scrapingdog.com/jobs?api_key=abc123",
+		"err", errors.New(`Get "https://api.scrapingdog.com/jobs?api_key=abc123": timeout`),
+		"link", &url.URL{Scheme: "https", Host: "example.com", RawQuery: "token=t0k"},
+		"company", "Acme")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, Redacted, entry["password"])
+	assert.Equal(t, "https://api.scrapingdog.com/jobs?api_key=[REDACTED]", entry["url"])
+	assert.Equal(t, `Get "https://api.scrapingdog.com/jobs?api_key=[REDACTED]": timeout`, entry["err"])
+	assert.Equal(t, "https://example.com?token=[REDACTED]", entry["link"])
+	assert.Equal(t, "Acme", entry["company"])
+	assert.NotContains(t, buf.String(), "abc123")
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(New(&buf, config.Log{Level: "info", Format: "text"}))
+
+	FromContext(requestid.NewContext(context.Background(), "req-7")).Info("handled")
+	FromContext(context.Background()).Info("background")
+
+	assert.Contains(t, buf.String(), "msg=handled request_id=req-7")
+	assert.NotContains(t, strings.Split(strings.TrimSpace(buf.String()), "\n")[1], "request_id")
+}
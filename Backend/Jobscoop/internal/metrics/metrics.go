@@ -0,0 +1,152 @@
+// Package metrics collects the app's Prometheus metrics: HTTP traffic per
+// route, the database pool, the upstream job sources, the jobs each crawl
+// stores, the email sent and the requests refused by rate limits. Handler
+// serves them in the Prometheus text format.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "jobscoop"
+
+// Email outcomes.
+const (
+	EmailSent   = "sent"
+	EmailFailed = "failed"
+)
+
+// Kinds of email, labelling the send outcomes.
+const (
+	EmailDigest        = "digest"
+	EmailPasswordReset = "password_reset"
+	EmailAccountLocked = "account_locked"
+	EmailVerification  = "email_verification"
+)
+
+// Registry holds every collector below, plus the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts answered requests by route template, method and
+	// status; requests matching no route are labelled "unmatched".
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests answered, by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	// HTTPDuration observes how long requests took to answer.
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to answer HTTP requests, by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// SourceFetches counts job source searches by outcome: ok, timeout or
+	// error.
+	SourceFetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "source_fetches_total",
+		Help:      "Job source searches, by source and status.",
+	}, []string{"source", "status"})
+
+	// SourceFetchDuration observes how long each source took to answer,
+	// failed searches included.
+	SourceFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "source_fetch_duration_seconds",
+		Help:      "Time taken by job source searches, by source.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"source"})
+
+	// SourceEmptyResults counts successful searches that found no jobs.
+	SourceEmptyResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "source_empty_results_total",
+		Help:      "Successful job source searches that returned no jobs, by source.",
+	}, []string{"source"})
+
+	// JobsStored counts postings crawls stored as new jobs.
+	JobsStored = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_stored_total",
+		Help:      "Postings stored as new jobs.",
+	})
+
+	// JobsDeduped counts postings crawls merged into a job already stored.
+	JobsDeduped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_deduped_total",
+		Help:      "Postings merged into an already stored job.",
+	})
+
+	// Emails counts email sends by kind and outcome.
+	Emails = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_total",
+		Help:      "Emails handed to the mail server, by kind and outcome.",
+	}, []string{"kind", "outcome"})
+
+	// RateLimited counts requests refused by a rate limit, such as
+	// "login:ip".
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests refused by a rate limit, by limit.",
+	}, []string{"limit"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		SourceFetches,
+		SourceFetchDuration,
+		SourceEmptyResults,
+		JobsStored,
+		JobsDeduped,
+		Emails,
+		RateLimited,
+	)
+}
+
+// RegisterDB exports the connection pool stats of db, as reported by
+// db.Stats, labelled with name.
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveFetch records one search of source that took elapsed and ended
+// with status, finding count jobs unless err is set.
+func ObserveFetch(source, status string, elapsed time.Duration, count int, err error) {
+	SourceFetches.WithLabelValues(source, status).Inc()
+	SourceFetchDuration.WithLabelValues(source).Observe(elapsed.Seconds())
+	if err == nil && count == 0 {
+		SourceEmptyResults.WithLabelValues(source).Inc()
+	}
+}
+
+// ObserveEmail records the outcome of sending an email of kind.
+func ObserveEmail(kind string, err error) {
+	outcome := EmailSent
+	if err != nil {
+		outcome = EmailFailed
+	}
+	Emails.WithLabelValues(kind, outcome).Inc()
+}
+
+// Handler serves the registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
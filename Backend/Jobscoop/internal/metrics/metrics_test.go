@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveFetch(t *testing.T) {
+	ObserveFetch("test-source", "ok", 300*time.Millisecond, 3, nil)
+	ObserveFetch("test-source", "ok", 200*time.Millisecond, 0, nil)
+	ObserveFetch("test-source", "timeout", 10*time.Second, 0, errors.New("context deadline exceeded"))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(SourceFetches.WithLabelValues("test-source", "ok")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(SourceFetches.WithLabelValues("test-source", "timeout")))
+	// Only the successful search without jobs is empty
+	assert.Equal(t, float64(1), testutil.ToFloat64(SourceEmptyResults.WithLabelValues("test-source")))
+}
+
+func TestObserveEmail(t *testing.T) {
+	sent := Emails.WithLabelValues(EmailDigest, EmailSent)
+	failed := Emails.WithLabelValues(EmailDigest, EmailFailed)
+	sentBefore, failedBefore := testutil.ToFloat64(sent), testutil.ToFloat64(failed)
+
+	ObserveEmail(EmailDigest, nil)
+	ObserveEmail(EmailDigest, errors.New("connection refused"))
+	ObserveEmail(EmailDigest, nil)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(sent)-sentBefore)
+	assert.Equal(t, float64(1), testutil.ToFloat64(failed)-failedBefore)
+}
+
+func TestHandler(t *testing.T) {
+	ObserveFetch("handler-source", "error", 1500*time.Millisecond, 0, errors.New("quota exceeded"))
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	body := w.Body.String()
+	assert.Contains(t, body, `jobscoop_source_fetches_total{source="handler-source",status="error"} 1`)
+	assert.Contains(t, body, `jobscoop_source_fetch_duration_seconds_bucket{source="handler-source",le="2.5"} 1`)
+	assert.Contains(t, body, "# TYPE jobscoop_jobs_stored_total counter")
+	assert.Contains(t, body, "go_goroutines")
+}
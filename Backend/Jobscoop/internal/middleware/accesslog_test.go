@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"JobScoop/config"
+	"JobScoop/internal/logging"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		expectedLevel string
+	}{
+		{"Success", http.StatusOK, "INFO"},
+		{"Client Error", http.StatusNotFound, "INFO"},
+		{"Server Error", http.StatusInternalServerError, "ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := logging.New(&logs, config.Log{Level: "info", Format: "json"})
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte("body"))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/reset?email=a@b.c&token=123456", nil)
+			req.Header.Set("X-Request-ID", "req-9")
+			RequestID(AccessLog(logger)(next)).ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("Expected one JSON log entry, got %q", logs.String())
+			}
+			if entry["level"] != tt.expectedLevel {
+				t.Errorf("Expected level %s, got %v", tt.expectedLevel, entry["level"])
+			}
+			if entry["status"] != float64(tt.status) || entry["bytes"] != float64(4) || entry["request_id"] != "req-9" {
+				t.Errorf("Unexpected entry %v", entry)
+			}
+			if _, ok := entry["latency"]; !ok {
+				t.Errorf("Expected a latency in %v", entry)
+			}
+			if strings.Contains(logs.String(), "123456") {
+				t.Errorf("Token leaked into the access log: %s", logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"JobScoop/internal/apierror"
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Claims are the JWT claims issued by the login and signup handlers.
+// SessionID names the login session the token belongs to; tokens issued
+// before sessions existed have none.
+type Claims struct {
+	UserID    int `json:"user_id"`
+	SessionID int `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type contextKey string
+
+const (
+	userIDKey    contextKey = "userID"
+	sessionIDKey contextKey = "sessionID"
+)
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID.
+func WithUserID(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the authenticated user's ID stored by Authenticate.
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userIDKey).(int)
+	return userID, ok
+}
+
+// WithSessionID returns a copy of ctx carrying the session of the
+// authenticated request's token.
+func WithSessionID(ctx context.Context, sessionID int) context.Context {
+	return context.WithValue(ctx, sessionIDKey, sessionID)
+}
+
+// SessionIDFromContext returns the session of the request's token stored
+// by Authenticate, if it has one.
+func SessionIDFromContext(ctx context.Context) (int, bool) {
+	sessionID, ok := ctx.Value(sessionIDKey).(int)
+	return sessionID, ok && sessionID != 0
+}
+
+// SessionChecker reports whether the user's session is still active.
+type SessionChecker func(ctx context.Context, userID, sessionID int) (bool, error)
+
+// Authenticate returns middleware that validates the "Authorization: Bearer
+// <token>" header against secret and stores the token's user and session
+// IDs in the request context. Tokens of sessions that sessions reports
+// ended are refused, so logging out takes effect at once; a nil sessions
+// checks tokens by signature and expiry alone.
+func Authenticate(secret string, sessions SessionChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return authenticate(secret, sessions, next)
+	}
+}
+
+func authenticate(secret string, sessions SessionChecker, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		tokenString := strings.TrimPrefix(header, "Bearer ")
+		if header == "" || tokenString == header {
+			apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "Missing or malformed authorization token"))
+			return
+		}
+
+		claims := &Claims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, jwt.ErrSignatureInvalid
+			}
+			return []byte(secret), nil
+		})
+		if err != nil || !token.Valid || claims.UserID == 0 {
+			apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid or expired token"))
+			return
+		}
+
+		if sessions != nil && claims.SessionID != 0 {
+			active, err := sessions(r.Context(), claims.UserID, claims.SessionID)
+			if err != nil {
+				apierror.Write(w, r, apierror.Internal("Error checking the session", err))
+				return
+			}
+			if !active {
+				apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "Session has ended"))
+				return
+			}
+		}
+
+		ctx := WithUserID(r.Context(), claims.UserID)
+		if claims.SessionID != 0 {
+			ctx = WithSessionID(ctx, claims.SessionID)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func signToken(t *testing.T, secret string, userID int, expiresAt time.Time) string {
+	return signSessionToken(t, secret, userID, 0, expiresAt)
+}
+
+func signSessionToken(t *testing.T, secret string, userID, sessionID int, expiresAt time.Time) string {
+	claims := &Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			Issuer:    "jobscoop",
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Could not sign token: %v", err)
+	}
+	return signed
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedCode   int
+		expectedUserID int
+	}{
+		{
+			name:           "Valid Token",
+			authorization:  "Bearer " + signToken(t, "test_secret", 42, time.Now().Add(time.Hour)),
+			expectedCode:   http.StatusOK,
+			expectedUserID: 42,
+		},
+		{
+			name:          "Missing Header",
+			authorization: "",
+			expectedCode:  http.StatusUnauthorized,
+		},
+		{
+			name:          "Not A Bearer Token",
+			authorization: "Basic dXNlcjpwYXNz",
+			expectedCode:  http.StatusUnauthorized,
+		},
+		{
+			name:          "Wrong Secret",
+			authorization: "Bearer " + signToken(t, "other_secret", 42, time.Now().Add(time.Hour)),
+			expectedCode:  http.StatusUnauthorized,
+		},
+		{
+			name:          "Expired Token",
+			authorization: "Bearer " + signToken(t, "test_secret", 42, time.Now().Add(-time.Minute)),
+			expectedCode:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUserID int
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUserID, _ = UserIDFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/fetch-user-subscriptions", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+
+			Authenticate("test_secret", nil)(next).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if gotUserID != tt.expectedUserID {
+				t.Errorf("Expected user ID %d in context, got %d", tt.expectedUserID, gotUserID)
+			}
+		})
+	}
+}
+
+func TestAuthenticateSession(t *testing.T) {
+	// Session 7 is active, 8 has ended and 9 can't be checked
+	sessions := func(ctx context.Context, userID, sessionID int) (bool, error) {
+		if sessionID == 9 {
+			return false, errors.New("DB error")
+		}
+		return userID == 42 && sessionID == 7, nil
+	}
+
+	tests := []struct {
+		name              string
+		token             string
+		expectedCode      int
+		expectedSessionID int
+	}{
+		{"Active Session", signSessionToken(t, "test_secret", 42, 7, time.Now().Add(time.Hour)), http.StatusOK, 7},
+		{"Ended Session", signSessionToken(t, "test_secret", 42, 8, time.Now().Add(time.Hour)), http.StatusUnauthorized, 0},
+		{"Another User's Session", signSessionToken(t, "test_secret", 43, 7, time.Now().Add(time.Hour)), http.StatusUnauthorized, 0},
+		{"Session Check Fails", signSessionToken(t, "test_secret", 42, 9, time.Now().Add(time.Hour)), http.StatusInternalServerError, 0},
+		{"Token Without Session", signToken(t, "test_secret", 42, time.Now().Add(time.Hour)), http.StatusOK, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotSessionID int
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotSessionID, _ = SessionIDFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/me/sessions", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+
+			Authenticate("test_secret", sessions)(next).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if gotSessionID != tt.expectedSessionID {
+				t.Errorf("Expected session ID %d in context, got %d", tt.expectedSessionID, gotSessionID)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const clientIPKey contextKey = "clientIP"
+
+// ClientIP returns the address r came from, without the port: the one
+// TrustedProxies found in the forwarding headers, or else the connection's.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// TrustedProxies returns middleware that takes the client's address from
+// the X-Forwarded-For or X-Real-IP header of requests whose connection comes
+// from one of proxies, IP addresses or CIDR ranges such as "10.0.0.0/8".
+// Anyone can send those headers, so requests from other addresses keep
+// their connection's. In X-Forwarded-For the rightmost address that isn't
+// a trusted proxy is the client, since the ones before it were sent by the
+// client itself. Malformed proxies are ignored; config.Validate rejects
+// them.
+func TrustedProxies(proxies []string) func(http.Handler) http.Handler {
+	var trusted []netip.Prefix
+	for _, proxy := range proxies {
+		if prefix, err := parseProxy(proxy); err == nil {
+			trusted = append(trusted, prefix)
+		}
+	}
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trusted {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(trusted) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, err := netip.ParseAddrPort(r.RemoteAddr)
+			if err != nil || !isTrusted(peer.Addr()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if ip, ok := forwardedFor(r, isTrusted); ok {
+				r = r.WithContext(context.WithValue(r.Context(), clientIPKey, ip.Unmap().String()))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedFor returns the client a trusted proxy forwarded r for: the
+// rightmost untrusted X-Forwarded-For address, or X-Real-IP when there is
+// no X-Forwarded-For.
+func forwardedFor(r *http.Request, isTrusted func(netip.Addr) bool) (netip.Addr, bool) {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) == 0 {
+		ip, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+		return ip, err == nil
+	}
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// Whatever comes before a malformed hop can't be trusted
+			break
+		}
+		client = ip
+		if !isTrusted(ip) {
+			break
+		}
+	}
+	return client, client.IsValid()
+}
+
+// parseProxy parses an IP address or CIDR range.
+func parseProxy(proxy string) (netip.Prefix, error) {
+	proxy = strings.TrimSpace(proxy)
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	var got string
+	handler := TrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "not a proxy"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientIP(r)
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{"direct", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"untrusted peer's headers are ignored", "203.0.113.7:1234",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Real-Ip": {"198.51.100.1"}}, "203.0.113.7"},
+		{"forwarded by a trusted proxy", "10.1.2.3:1234",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"addresses the client sent are skipped", "10.1.2.3:1234",
+			map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1, 10.0.0.5", "192.0.2.1"}}, "198.51.100.1"},
+		{"real IP", "[::ffff:192.0.2.1]:1234",
+			map[string][]string{"X-Real-Ip": {"198.51.100.1"}}, "198.51.100.1"},
+		{"malformed headers", "10.1.2.3:1234",
+			map[string][]string{"X-Forwarded-For": {"unknown"}, "X-Real-Ip": {"198.51.100.1"}}, "10.1.2.3"},
+		{"no headers", "10.1.2.3:1234", nil, "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.headers {
+				req.Header[name] = values
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("Expected client %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	// Without trusted proxies the headers are never read
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.1.2.3:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	TrustedProxies(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientIP(r)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	if got != "10.1.2.3" {
+		t.Errorf("Expected the connection's address, got %s", got)
+	}
+}
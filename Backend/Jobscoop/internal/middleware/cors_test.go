@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name           string
+		origins        []string
+		method         string
+		origin         string
+		expectedCode   int
+		expectedOrigin string
+	}{
+		{"Allowed Origin", []string{"http://localhost:3000", "https://jobscoop.app"}, http.MethodGet, "https://jobscoop.app", http.StatusNoContent, "https://jobscoop.app"},
+		{"Other Origin", []string{"http://localhost:3000"}, http.MethodGet, "https://evil.example", http.StatusNoContent, ""},
+		{"Any Origin", []string{"*"}, http.MethodGet, "https://evil.example", http.StatusNoContent, "*"},
+		{"Preflight", []string{"http://localhost:3000"}, http.MethodOptions, "http://localhost:3000", http.StatusOK, "http://localhost:3000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/login", nil)
+			req.Header.Set("Origin", tt.origin)
+			rr := httptest.NewRecorder()
+
+			CORS(tt.origins)(next).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("Expected allowed origin %q, got %q", tt.expectedOrigin, got)
+			}
+		})
+	}
+}
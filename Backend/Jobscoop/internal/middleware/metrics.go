@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"JobScoop/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// unmatchedRoute labels requests that matched no route, so scans for
+// random paths can't grow the number of series.
+const unmatchedRoute = "unmatched"
+
+// Metrics counts and times requests by the template of the mux route they
+// matched, e.g. /v1/me/subscriptions/{id:[0-9]+}. Wrap the router's
+// NotFoundHandler and MethodNotAllowedHandler too to count the requests
+// that match none.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := unmatchedRoute
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"JobScoop/internal/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	router := mux.NewRouter()
+	router.NotFoundHandler = Metrics(http.NotFoundHandler())
+	router.Use(Metrics)
+	router.HandleFunc("/things/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}).Methods(http.MethodGet)
+
+	thing := metrics.HTTPRequests.WithLabelValues("/things/{id:[0-9]+}", http.MethodGet, "418")
+	unmatched := metrics.HTTPRequests.WithLabelValues(unmatchedRoute, http.MethodGet, "404")
+	thingsBefore, unmatchedBefore := testutil.ToFloat64(thing), testutil.ToFloat64(unmatched)
+
+	// Requests for different IDs share the route's series
+	for _, path := range []string{"/things/1", "/things/2", "/random/path"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(thing) - thingsBefore; got != 2 {
+		t.Errorf("Expected 2 requests counted for the route, got %v", got)
+	}
+	if got := testutil.ToFloat64(unmatched) - unmatchedBefore; got != 1 {
+		t.Errorf("Expected 1 unmatched request counted, got %v", got)
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/logging"
+	"JobScoop/internal/metrics"
+	"JobScoop/internal/ratelimit"
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxKeyBodySize bounds how much of a body the key funcs read looking for
+// the field they key by.
+const maxKeyBodySize = 1 << 20
+
+// KeyFunc picks the bucket a request is counted in. An empty key leaves the
+// request unlimited.
+type KeyFunc func(r *http.Request) string
+
+// AccountKey keys requests by the "email" of their JSON body, so guesses
+// at one account are limited however many addresses they come from. The
+// body is left for the handler to read.
+func AccountKey(r *http.Request) string {
+	return strings.ToLower(strings.TrimSpace(bodyField(r, "email")))
+}
+
+// ChallengeKey keys requests by the user the "challengeToken" of their JSON
+// body was handed out to, as parse reads it, so guesses at one user's
+// second factor are limited however many addresses they come from. Requests
+// without a valid challenge are left to the other limits.
+func ChallengeKey(parse func(token string) (int, bool)) KeyFunc {
+	return func(r *http.Request) string {
+		userID, ok := parse(bodyField(r, "challengeToken"))
+		if !ok {
+			return ""
+		}
+		return strconv.Itoa(userID)
+	}
+}
+
+// bodyField returns the string field name of r's JSON body, or "" if there
+// is none, leaving the body for the handler to read.
+func bodyField(r *http.Request, name string) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxKeyBodySize))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var fields map[string]json.RawMessage
+	var value string
+	if json.Unmarshal(body, &fields) != nil || json.Unmarshal(fields[name], &value) != nil {
+		return ""
+	}
+	return value
+}
+
+// UserKey keys requests by the authenticated user; it only applies behind
+// Authenticate.
+func UserKey(r *http.Request) string {
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+	return strconv.Itoa(userID)
+}
+
+// RateLimit returns middleware that lets the requests sharing a key through
+// at most as often as limit allows, counting them in store under name. The
+// others are answered 429 with a Retry-After header. If store fails, the
+// request is let through rather than locking everyone out.
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !limit.Enabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, retryAfter, err := store.Take(r.Context(), name+":"+k, limit, time.Now())
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Rate limit unavailable", "limit", name, "err", err)
+			} else if !ok {
+				metrics.RateLimited.WithLabelValues(name).Inc()
+				SetRetryAfter(w, retryAfter)
+				apierror.Write(w, r, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "Too many requests. Please try again later."))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SetRetryAfter tells the client to wait d, in whole seconds, before trying
+// again.
+func SetRetryAfter(w http.ResponseWriter, d time.Duration) {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
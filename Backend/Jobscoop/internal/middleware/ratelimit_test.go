@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"JobScoop/internal/ratelimit"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingStore is a rate limit store whose database is down
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit, now time.Time) (bool, time.Duration, error) {
+	return false, 0, errors.New("DB error")
+}
+
+func TestRateLimit(t *testing.T) {
+	limit := ratelimit.Limit{Count: 2, Per: time.Minute}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func(handler http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	handler := RateLimit(ratelimit.NewMemory(), "login_ip", limit, ClientIP)(next)
+	for i := 0; i < 2; i++ {
+		if rr := serve(handler, "203.0.113.7:1234"); rr.Code != http.StatusOK {
+			t.Fatalf("Expected request %d through, got %d", i+1, rr.Code)
+		}
+	}
+	rr := serve(handler, "203.0.113.7:5678")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"rate_limited"`) {
+		t.Errorf("Expected a rate_limited error, got %s", rr.Body.String())
+	}
+	if rr.Header().Get("Retry-After") != "30" {
+		t.Errorf("Expected Retry-After 30, got %q", rr.Header().Get("Retry-After"))
+	}
+	if rr := serve(handler, "198.51.100.1:1234"); rr.Code != http.StatusOK {
+		t.Errorf("Expected another address through, got %d", rr.Code)
+	}
+
+	// Disabled limits and failing stores let everything through
+	off := RateLimit(ratelimit.NewMemory(), "login_ip", ratelimit.Limit{}, ClientIP)(next)
+	failing := RateLimit(failingStore{}, "login_ip", limit, ClientIP)(next)
+	for i := 0; i < 3; i++ {
+		if rr := serve(off, "203.0.113.7:1234"); rr.Code != http.StatusOK {
+			t.Errorf("Expected a disabled limit to let request %d through, got %d", i+1, rr.Code)
+		}
+		if rr := serve(failing, "203.0.113.7:1234"); rr.Code != http.StatusOK {
+			t.Errorf("Expected a failing store to let request %d through, got %d", i+1, rr.Code)
+		}
+	}
+}
+
+func TestAccountKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		expectedKey string
+	}{
+		{"Email", `{"email":" John@Example.com ","password":"secret"}`, "john@example.com"},
+		{"No Email", `{"password":"secret"}`, ""},
+		{"Not JSON", `email=john@example.com`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(tt.body))
+			if key := AccountKey(req); key != tt.expectedKey {
+				t.Errorf("Expected key %q, got %q", tt.expectedKey, key)
+			}
+			body, _ := io.ReadAll(req.Body)
+			if string(body) != tt.body {
+				t.Errorf("Expected the body left for the handler, got %q", body)
+			}
+		})
+	}
+}
+
+func TestChallengeKey(t *testing.T) {
+	parse := func(token string) (int, bool) {
+		return 42, token == "valid"
+	}
+	tests := []struct {
+		name        string
+		body        string
+		expectedKey string
+	}{
+		{"Valid Challenge", `{"challengeToken":"valid","code":"123456"}`, "42"},
+		{"Invalid Challenge", `{"challengeToken":"forged","code":"123456"}`, ""},
+		{"No Challenge", `{"code":"123456"}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/login/mfa", strings.NewReader(tt.body))
+			if key := ChallengeKey(parse)(req); key != tt.expectedKey {
+				t.Errorf("Expected key %q, got %q", tt.expectedKey, key)
+			}
+			body, _ := io.ReadAll(req.Body)
+			if string(body) != tt.body {
+				t.Errorf("Expected the body left for the handler, got %q", body)
+			}
+		})
+	}
+}
+
+func TestUserKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/v1/me/verification-email", nil)
+	if key := UserKey(req); key != "" {
+		t.Errorf("Expected no key without a user, got %q", key)
+	}
+	if key := UserKey(req.WithContext(WithUserID(req.Context(), 42))); key != "42" {
+		t.Errorf("Expected key 42, got %q", key)
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"JobScoop/internal/requestid"
+	"net/http"
+)
+
+// maxRequestIDLength bounds the IDs accepted from clients so they can't flood
+// the logs.
+const maxRequestIDLength = 128
+
+// RequestID tags each request with the ID sent by the client in X-Request-ID,
+// or a new one, storing it in the request context and echoing it in the
+// response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !validRequestID(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether id is a non-empty run of printable ASCII
+// without spaces.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"JobScoop/internal/requestid"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		sent     string
+		keepSent bool
+	}{
+		{"Generated", "", false},
+		{"Client ID", "client-abc.123", true},
+		{"Spaces", "two words", false},
+		{"Too Long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inContext string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inContext = requestid.FromContext(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/login", nil)
+			if tt.sent != "" {
+				req.Header.Set(requestid.Header, tt.sent)
+			}
+			rr := httptest.NewRecorder()
+			RequestID(next).ServeHTTP(rr, req)
+
+			echoed := rr.Header().Get(requestid.Header)
+			if echoed == "" || echoed != inContext {
+				t.Errorf("Expected the echoed ID %q to match the context's %q", echoed, inContext)
+			}
+			if (echoed == tt.sent) != tt.keepSent {
+				t.Errorf("Sent %q, got %q", tt.sent, echoed)
+			}
+		})
+	}
+}
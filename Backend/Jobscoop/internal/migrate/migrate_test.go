@@ -0,0 +1,187 @@
+package migrate
+
+import (
+	"JobScoop/migrations"
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMigrations = fstest.MapFS{
+	"0002_add_b.up.sql":        {Data: []byte("CREATE TABLE b (id INT)")},
+	"0002_add_b.down.sql":      {Data: []byte("DROP TABLE b")},
+	"0001_add_a.up.sql":        {Data: []byte("CREATE TABLE a (id INT)")},
+	"0001_add_a.down.sql":      {Data: []byte("DROP TABLE a")},
+	"0003_add_c.up.sql":        {Data: []byte("CREATE TABLE c (id INT)")},
+	"README.md":                {Data: []byte("not a migration")},
+	"0004_unfinished.txt":      {Data: []byte("ignored")},
+	"notes/0005_nested.up.sql": {Data: []byte("ignored")},
+}
+
+func TestLoad(t *testing.T) {
+	loaded, err := Load(testMigrations)
+	require.NoError(t, err)
+	require.Len(t, loaded, 3)
+
+	assert.Equal(t, Migration{Version: 1, Name: "add_a", Up: "CREATE TABLE a (id INT)", Down: "DROP TABLE a"}, loaded[0])
+	assert.Equal(t, "0002_add_b", loaded[1].String())
+	assert.Equal(t, "", loaded[2].Down)
+
+	_, err = Load(fstest.MapFS{"0001_a.down.sql": {Data: []byte("DROP TABLE a")}})
+	assert.EqualError(t, err, "migration 0001_a has no up file")
+
+	_, err = Load(fstest.MapFS{
+		"0001_a.up.sql": {Data: []byte("CREATE TABLE a (id INT)")},
+		"0001_b.up.sql": {Data: []byte("CREATE TABLE b (id INT)")},
+	})
+	assert.Error(t, err)
+}
+
+// TestMigrationFiles checks the shipped migrations are numbered 1..n with no
+// gaps and can all be reverted
+func TestMigrationFiles(t *testing.T) {
+	loaded, err := Load(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+	for i, migration := range loaded {
+		assert.Equal(t, int64(i+1), migration.Version, "migration %s", migration)
+		assert.NotEmpty(t, migration.Down, "migration %s has no down file", migration)
+	}
+}
+
+func newMockMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { mockDB.Close() })
+
+	loaded, err := Load(testMigrations)
+	require.NoError(t, err)
+	return &Migrator{DB: mockDB, Migrations: loaded}, mock
+}
+
+func expectLocked(mock sqlmock.Sqlmock, applied ...int64) {
+	mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WithArgs(lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, version := range applied {
+		rows.AddRow(version, time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC))
+	}
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).WillReturnRows(rows)
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WithArgs(lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestUp(t *testing.T) {
+	migrator, mock := newMockMigrator(t)
+
+	expectLocked(mock, 1)
+	for _, m := range []struct {
+		version int64
+		name    string
+		sql     string
+	}{{2, "add_b", "CREATE TABLE b (id INT)"}, {3, "add_c", "CREATE TABLE c (id INT)"}} {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(m.sql)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO schema_migrations`).
+			WithArgs(m.version, m.name, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	expectUnlock(mock)
+
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+	assert.Equal(t, int64(2), applied[0].Version)
+	assert.Equal(t, int64(3), applied[1].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpStopsAtFailure(t *testing.T) {
+	migrator, mock := newMockMigrator(t)
+
+	expectLocked(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE a (id INT)")).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+	expectUnlock(mock)
+
+	applied, err := migrator.Up(context.Background())
+	assert.EqualError(t, err, "applying migration 0001_add_a: syntax error")
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDown(t *testing.T) {
+	migrator, mock := newMockMigrator(t)
+
+	expectLocked(mock, 1, 2)
+	mock.ExpectBegin()
+	mock.ExpectExec(`DROP TABLE b`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM schema_migrations WHERE version = \$1`).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	reverted, err := migrator.Down(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.Equal(t, "0002_add_b", reverted[0].String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	t.Run("No down file", func(t *testing.T) {
+		expectLocked(mock, 1, 2, 3)
+		expectUnlock(mock)
+
+		_, err := migrator.Down(context.Background(), 1)
+		assert.EqualError(t, err, "migration 0003_add_c has no down file")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestStatus(t *testing.T) {
+	migrator, mock := newMockMigrator(t)
+
+	expectLocked(mock, 1)
+	expectUnlock(mock)
+
+	statuses, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+	assert.Nil(t, statuses[2].AppliedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPending(t *testing.T) {
+	migrator, mock := newMockMigrator(t)
+
+	mock.ExpectQuery(`SELECT to_regclass\('schema_migrations'\) IS NOT NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(int64(1), time.Now()).AddRow(int64(3), time.Now()))
+
+	pending, err := migrator.Pending(context.Background())
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "0002_add_b", pending[0].String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	t.Run("Never migrated", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT to_regclass`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		pending, err := migrator.Pending(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, pending, 3)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
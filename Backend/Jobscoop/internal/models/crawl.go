@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// CrawlTarget is a distinct (company, role) pair some active subscription
+// follows; the crawler searches each one once per run.
+type CrawlTarget struct {
+	CompanyID   int
+	CompanyName string
+	RoleID      int
+	RoleName    string
+}
+
+// CrawlStatus is when one of a user's (company, role) pairs was last
+// refreshed by the crawler, and which sources its latest attempt failed on,
+// if any. LastError is for operators and is not served to users.
+type CrawlStatus struct {
+	Company       string     `json:"company"`
+	Role          string     `json:"role"`
+	LastRefreshed *time.Time `json:"last_refreshed"`
+	LastAttempted *time.Time `json:"-"` // nil until the crawler has tried the pair, whether or not a source answered
+	LastError     string     `json:"-"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// DigestRecipient is a user with subscriptions that send alerts. Since is
+// when they signed up; jobs found before then are never mailed.
+type DigestRecipient struct {
+	UserID   int
+	Name     string
+	Email    string
+	Since    time.Time
+	Timezone string
+	SendHour int
+}
+
+// DigestCutoffs holds, per subscription frequency, the latest first_seen a
+// job may have to be included in a digest sent now. Jobs found after the
+// cutoff wait for the frequency's next send time.
+type DigestCutoffs struct {
+	Instant time.Time
+	Daily   time.Time
+	Weekly  time.Time
+}
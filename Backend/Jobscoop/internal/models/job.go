@@ -0,0 +1,88 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Job is the canonical job posting shared by every source, the jobs table and
+// the /subscriptions/jobs response. The same posting seen again, from any
+// source, shares a fingerprint and is upserted in place.
+type Job struct {
+	ID             int             `json:"id,omitempty"`
+	Fingerprint    string          `json:"fingerprint"`
+	Title          string          `json:"title"`
+	Company        string          `json:"company"`
+	Location       string          `json:"location"`
+	Remote         bool            `json:"remote"`
+	Salary         *SalaryRange    `json:"salary,omitempty"`
+	PostedAt       *time.Time      `json:"posted_at,omitempty"`
+	ValidThrough   *time.Time      `json:"valid_through,omitempty"`   // when the employer stops accepting applications
+	EmploymentType string          `json:"employment_type,omitempty"` // e.g. "Full-time", "FULL_TIME, PART_TIME"
+	URL            string          `json:"url"`                       // canonical link to the posting, preferring the employer's own page
+	ApplyURLs      []string        `json:"apply_urls"`                // every apply link the sources offered
+	Description    string          `json:"description,omitempty"`
+	Source         string          `json:"source,omitempty"` // source that produced this copy of the posting
+	Sources        []string        `json:"sources"`          // every source that has reported the posting
+	Raw            json.RawMessage `json:"raw,omitempty"`
+	FirstSeen      time.Time       `json:"first_seen"`
+	LastSeen       time.Time       `json:"last_seen"`
+}
+
+// SalaryRange is a pay range parsed from a posting; Text keeps the original
+// wording when only part of it could be parsed.
+type SalaryRange struct {
+	Min      float64 `json:"min,omitempty"`
+	Max      float64 `json:"max,omitempty"`
+	Currency string  `json:"currency,omitempty"`
+	Period   string  `json:"period,omitempty"` // "hour", "day", "week", "month" or "year"
+	Text     string  `json:"text,omitempty"`
+}
+
+// Fingerprint identifies a posting across sources by its company, normalized
+// title, location and canonical URL.
+func Fingerprint(company, title, location, rawURL string) string {
+	key := strings.Join([]string{
+		normalizeText(company),
+		normalizeText(title),
+		normalizeText(location),
+		CanonicalURL(rawURL),
+	}, "|")
+
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeText lowercases s, drops punctuation and collapses whitespace so
+// "Sr. Software Engineer " and "sr software engineer" compare equal.
+func normalizeText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// CanonicalURL strips the scheme, "www.", query string, fragment and trailing
+// slash from a posting URL so tracking parameters don't split duplicates.
+func CanonicalURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return ""
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(rawURL)
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	return host + strings.TrimSuffix(u.EscapedPath(), "/")
+}
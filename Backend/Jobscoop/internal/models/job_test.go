@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	base := Fingerprint("Acme", "Sr. Software Engineer", "Austin, TX", "https://www.acme.com/jobs/42?utm_source=linkedin#apply")
+
+	// Case, punctuation, whitespace and tracking parameters don't matter
+	assert.Equal(t, base, Fingerprint("acme ", "sr software  engineer", "austin tx", "http://acme.com/jobs/42/"))
+
+	// A different posting does
+	assert.NotEqual(t, base, Fingerprint("Acme", "Sr. Software Engineer", "Austin, TX", "https://acme.com/jobs/43"))
+	assert.NotEqual(t, base, Fingerprint("Acme", "Software Engineer", "Austin, TX", "https://acme.com/jobs/42"))
+}
+
+func TestCanonicalURL(t *testing.T) {
+	tests := map[string]string{
+		"":                                       "",
+		"https://WWW.Acme.com/Jobs/42/?gh_src=1": "acme.com/Jobs/42",
+		"acme.com/jobs":                          "acme.com/jobs",
+	}
+	for input, expected := range tests {
+		assert.Equal(t, expected, CanonicalURL(input), "CanonicalURL(%q)", input)
+	}
+}
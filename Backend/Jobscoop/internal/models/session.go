@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Session is one login of a user, kept alive by rotating refresh tokens
+// until it expires or is revoked.
+type Session struct {
+	ID         int
+	UserID     int
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
+
+// Active reports whether the session can still be used at now.
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -1,30 +1,74 @@
 package models
 
-import (
-	"JobScoop/internal/db"
-	"log"
+import "time"
+
+// How often a subscription's new jobs are mailed. Instant jobs go out with
+// the next digest run, daily ones at the user's send hour and weekly ones at
+// the send hour on Mondays.
+const (
+	FrequencyInstant = "instant"
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyOff     = "off"
+
+	DefaultFrequency = FrequencyDaily
 )
 
-// CreateResetTokensTable creates the reset_tokens table if it does not exist
-func CreateSubscriptionTable() {
-	query := `
-	CREATE TABLE IF NOT EXISTS subscriptions (
-		id SERIAL PRIMARY KEY,
-		User_Id INT NOT NULL,
-	    Company_Id INT NOT NULL,
-	    Career_site_Ids INT[] NOT NULL,
-	    Role_Ids INT[] NOT NULL,
-	    Active BOOLEAN NOT NULL DEFAULT TRUE,
-	    Interest_Time TIMESTAMP,
-
-		CONSTRAINT fk_user FOREIGN KEY (User_Id) REFERENCES Users(Id) ON DELETE CASCADE,
-	    CONSTRAINT fk_company FOREIGN KEY (Company_Id) REFERENCES Companies(Id) ON DELETE CASCADE,
-		CONSTRAINT unique_user_company UNIQUE (User_Id, Company_Id)
-	);
-	`
-
-	_, err := db.DB.Exec(query)
-	if err != nil {
-		log.Fatalf("Error creating subscriptions table: %v", err)
+// ValidFrequency reports whether frequency is one of the Frequency* values.
+func ValidFrequency(frequency string) bool {
+	switch frequency {
+	case FrequencyInstant, FrequencyDaily, FrequencyWeekly, FrequencyOff:
+		return true
 	}
-}
\ No newline at end of file
+	return false
+}
+
+// Subscription is a user following some of a company's career sites and
+// roles.
+type Subscription struct {
+	ID            int
+	UserID        int
+	CompanyID     int
+	CareerSiteIDs []int
+	RoleIDs       []int
+	Active        bool
+	Frequency     string
+	InterestTime  time.Time // when the user last changed what they follow
+}
+
+// Company is a company users can follow.
+type Company struct {
+	ID   int
+	Name string
+}
+
+// Role is a job title users can follow at companies.
+type Role struct {
+	ID   int
+	Name string
+}
+
+// CareerSite is a careers page of a company.
+type CareerSite struct {
+	ID        int
+	CompanyID int
+	Link      string
+}
+
+// SubscriptionRoleCount is how many of a company's Total subscriptions
+// follow a role.
+type SubscriptionRoleCount struct {
+	Company string
+	Role    string
+	Count   int
+	Total   int
+}
+
+// SubscriptionSummary is a user's subscription to a company with the names
+// of the roles it follows.
+type SubscriptionSummary struct {
+	User         string
+	Company      string
+	InterestTime time.Time
+	RoleNames    []string
+}
@@ -1,24 +1,73 @@
 package models
 
 import (
-	"JobScoop/internal/db"
-	"log"
+	"time"
+
+	// Timezones are validated and applied without relying on the host's
+	// zoneinfo files
+	_ "time/tzdata"
+)
+
+// Defaults for when a user's daily and weekly job digests are sent.
+const (
+	DefaultTimezone = "UTC"
+	DefaultSendHour = 8
 )
 
-// CreateUserTable creates the users table in the database if it doesn't exist.
-func CreateUserTable() {
-	query := `
-	CREATE TABLE IF NOT EXISTS users (
-		id SERIAL PRIMARY KEY,
-		name VARCHAR(100) NOT NULL,
-		email VARCHAR(100) NOT NULL UNIQUE,
-		password VARCHAR(255) NOT NULL,
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-	);
-	`
-
-	_, err := db.DB.Exec(query)
-	if err != nil {
-		log.Fatal("Failed to create users table:", err)
+// User is an account as stored in the users table. PasswordHash is the
+// bcrypt hash of the password and is never sent to clients.
+type User struct {
+	ID           int
+	Name         string
+	Email        string
+	PasswordHash string
+	CreatedAt    time.Time
+	Timezone     string
+	SendHour     int
+	VerifiedAt   time.Time // when the email was verified; zero until then
+
+	// TOTPSecret is the authenticator app secret, set when enrollment
+	// starts. Logins only ask for its codes from TOTPEnabledAt, once the
+	// user confirmed one.
+	TOTPSecret    string
+	TOTPEnabledAt time.Time
+}
+
+// Verified reports whether the user has verified their email.
+func (u User) Verified() bool {
+	return !u.VerifiedAt.IsZero()
+}
+
+// MFAEnabled reports whether logging in takes a code from the user's
+// authenticator app.
+func (u User) MFAEnabled() bool {
+	return !u.TOTPEnabledAt.IsZero()
+}
+
+// ResetToken is the password reset last requested for an email address.
+// The code mailed is stored as its bcrypt CodeHash, cleared once the code is
+// verified. Verifying it grants the right to set a new password once, before
+// GrantExpiresAt, to whoever holds the token hashed as GrantHash.
+type ResetToken struct {
+	Email          string
+	CodeHash       string
+	ExpiresAt      time.Time
+	Attempts       int // codes tried so far
+	GrantHash      string
+	GrantExpiresAt time.Time
+}
+
+// ValidTimezone reports whether name is an IANA timezone such as
+// "Europe/Berlin".
+func ValidTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
 	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// ValidSendHour reports whether hour is an hour of the day.
+func ValidSendHour(hour int) bool {
+	return hour >= 0 && hour <= 23
 }
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// sweepEvery is how many takes a Postgres store makes between deleting
+// unused buckets.
+const sweepEvery = 1000
+
+// Postgres is a Store keeping the buckets in the rate_limits table, shared
+// by every instance using the database.
+type Postgres struct {
+	db    *sql.DB
+	takes atomic.Int64
+}
+
+// NewPostgres returns a store on db.
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, limit Limit, now time.Time) (ok bool, retryAfter time.Duration, err error) {
+	now = now.UTC()
+	if p.takes.Add(1)%sweepEvery == 0 {
+		if _, err := p.db.ExecContext(ctx, `DELETE FROM rate_limits WHERE updated_at < $1`, now.Add(-staleAfter)); err != nil {
+			return false, 0, err
+		}
+	}
+
+	// The row lock serialises concurrent takes from the same bucket
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO rate_limits (key, tokens, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO NOTHING`, key, float64(limit.Count), now); err != nil {
+		return false, 0, err
+	}
+	var b bucket
+	if err := tx.QueryRowContext(ctx, `SELECT tokens, updated_at FROM rate_limits WHERE key = $1 FOR UPDATE`, key).
+		Scan(&b.tokens, &b.updated); err != nil {
+		return false, 0, err
+	}
+	ok, retryAfter = b.take(limit, now)
+	if _, err := tx.ExecContext(ctx, `UPDATE rate_limits SET tokens = $1, updated_at = $2 WHERE key = $3`,
+		b.tokens, b.updated, key); err != nil {
+		return false, 0, err
+	}
+	return ok, retryAfter, tx.Commit()
+}
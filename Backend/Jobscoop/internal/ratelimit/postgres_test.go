@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgres(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	store := NewPostgres(mockDB)
+	limit := Limit{Count: 3, Per: time.Minute}
+	now := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	// The bucket last had half a token 10s ago; with the 0.5 refilled since,
+	// one is taken
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO rate_limits \(key, tokens, updated_at\) VALUES \(\$1, \$2, \$3\)\s+ON CONFLICT \(key\) DO NOTHING`).
+		WithArgs("login:ip:203.0.113.7", float64(3), now).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT tokens, updated_at FROM rate_limits WHERE key = \$1 FOR UPDATE`).
+		WithArgs("login:ip:203.0.113.7").
+		WillReturnRows(sqlmock.NewRows([]string{"tokens", "updated_at"}).AddRow(0.5, now.Add(-10*time.Second)))
+	mock.ExpectExec(`UPDATE rate_limits SET tokens = \$1, updated_at = \$2 WHERE key = \$3`).
+		WithArgs(float64(0), now, "login:ip:203.0.113.7").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ok, retryAfter, err := store.Take(context.Background(), "login:ip:203.0.113.7", limit, now)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Zero(t, retryAfter)
+
+	// Empty now, the next request waits for a token
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO rate_limits`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT tokens, updated_at FROM rate_limits`).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens", "updated_at"}).AddRow(0.0, now))
+	mock.ExpectExec(`UPDATE rate_limits`).WithArgs(float64(0), now, "login:ip:203.0.113.7").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ok, retryAfter, err = store.Take(context.Background(), "login:ip:203.0.113.7", limit, now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 20*time.Second, retryAfter)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
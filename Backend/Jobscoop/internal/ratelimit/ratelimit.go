@@ -0,0 +1,95 @@
+// Package ratelimit throttles callers with token buckets. Each key, such as
+// a client address or an account, has a bucket holding up to Limit.Count
+// tokens, refilled at Count tokens per Limit.Per. Every request takes a
+// token and is refused while the bucket is empty.
+//
+// Buckets live in a Store: Memory for a single instance, or Postgres so
+// instances behind a load balancer share their limits.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// staleAfter is how long a bucket may go unused before a store drops it.
+// Limits must refill within it, since a dropped bucket starts full.
+const staleAfter = 24 * time.Hour
+
+// Limit is the size and refill rate of a bucket: Count requests, refilled
+// over Per. The zero Limit doesn't limit.
+type Limit struct {
+	Count int
+	Per   time.Duration
+}
+
+// Enabled reports whether l limits anything.
+func (l Limit) Enabled() bool {
+	return l.Count > 0 && l.Per > 0
+}
+
+// Store keeps the buckets of every key.
+type Store interface {
+	// Take takes a token from key's bucket at now. When the bucket is
+	// empty it returns false and how long until a token is available.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (ok bool, retryAfter time.Duration, err error)
+}
+
+// bucket is a key's tokens as of updated.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills b from its last update to now and takes a token if there is
+// one.
+func (b *bucket) take(limit Limit, now time.Time) (bool, time.Duration) {
+	rate := float64(limit.Count) / limit.Per.Seconds() // tokens per second
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Count), b.tokens+elapsed*rate)
+	}
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	return false, wait
+}
+
+// Memory is a Store for a single instance.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// NewMemory returns a Memory store with no buckets.
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Drop unused buckets now and then, so callers don't pile up
+	if now.Sub(m.swept) > time.Hour {
+		for key, b := range m.buckets {
+			if now.Sub(b.updated) > staleAfter {
+				delete(m.buckets, key)
+			}
+		}
+		m.swept = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Count), updated: now}
+		m.buckets[key] = b
+	}
+	ok, retryAfter := b.take(limit, now)
+	return ok, retryAfter, nil
+}
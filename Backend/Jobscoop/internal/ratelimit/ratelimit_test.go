@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	store := NewMemory()
+	limit := Limit{Count: 3, Per: time.Minute} // a token every 20s
+	now := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+	take := func(key string, at time.Time) (bool, time.Duration) {
+		ok, retryAfter, err := store.Take(context.Background(), key, limit, at)
+		require.NoError(t, err)
+		return ok, retryAfter
+	}
+
+	// A full bucket allows a burst of Count
+	for i := 0; i < 3; i++ {
+		ok, _ := take("login:ip:203.0.113.7", now)
+		assert.True(t, ok, "request %d", i+1)
+	}
+	ok, retryAfter := take("login:ip:203.0.113.7", now)
+	assert.False(t, ok)
+	assert.Equal(t, 20*time.Second, retryAfter)
+
+	// Other keys have their own bucket
+	ok, _ = take("login:ip:198.51.100.1", now)
+	assert.True(t, ok)
+
+	// Refused requests take nothing, and the bucket refills over time
+	ok, retryAfter = take("login:ip:203.0.113.7", now.Add(15*time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, 5*time.Second, retryAfter)
+	ok, _ = take("login:ip:203.0.113.7", now.Add(20*time.Second))
+	assert.True(t, ok)
+
+	// A bucket never holds more than Count
+	for i := 0; i < 3; i++ {
+		ok, _ := take("login:ip:203.0.113.7", now.Add(time.Hour))
+		assert.True(t, ok)
+	}
+	ok, _ = take("login:ip:203.0.113.7", now.Add(time.Hour))
+	assert.False(t, ok)
+}
+
+func TestMemorySweep(t *testing.T) {
+	store := NewMemory()
+	now := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+	limit := Limit{Count: 1, Per: time.Minute}
+
+	store.Take(context.Background(), "old", limit, now)
+	store.Take(context.Background(), "new", limit, now.Add(staleAfter+2*time.Hour))
+	assert.NotContains(t, store.buckets, "old")
+	assert.Contains(t, store.buckets, "new")
+}
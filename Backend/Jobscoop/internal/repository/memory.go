@@ -0,0 +1,1117 @@
+package repository
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory keeps every repository's records in process memory, with the same
+// uniqueness rules as the database. It is meant for tests: AddJob and
+// RecordCrawl stand in for the crawler, and SetCreatedAt for users who
+// signed up a while ago.
+type Memory struct {
+	mu   sync.Mutex
+	txMu sync.Mutex // held by the transaction in progress
+
+	users         map[int]models.User
+	loginFailures map[memoryLoginKey]memoryLoginFailures
+	totpSteps     map[int]int64
+	recoveryCodes map[string]memoryRecoveryCode // by hash
+	identities    map[[2]string]memoryIdentity  // by provider and subject
+	resetTokens   map[string]models.ResetToken
+	sessions      map[int]models.Session
+	refreshTokens map[string]memoryRefreshToken
+	subscriptions map[int]models.Subscription
+	companies     map[int]models.Company
+	roles         map[int]models.Role
+	careerSites   map[int]models.CareerSite
+	jobs          map[int]models.Job
+	matches       map[[2]int][]int // (company, role) -> job IDs
+	crawls        map[[2]int]models.CrawlStatus
+	digested      map[[2]int]bool // (user, job) pairs mailed in a digest
+	lastID        int
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		users:         map[int]models.User{},
+		loginFailures: map[memoryLoginKey]memoryLoginFailures{},
+		totpSteps:     map[int]int64{},
+		recoveryCodes: map[string]memoryRecoveryCode{},
+		identities:    map[[2]string]memoryIdentity{},
+		resetTokens:   map[string]models.ResetToken{},
+		sessions:      map[int]models.Session{},
+		refreshTokens: map[string]memoryRefreshToken{},
+		subscriptions: map[int]models.Subscription{},
+		companies:     map[int]models.Company{},
+		roles:         map[int]models.Role{},
+		careerSites:   map[int]models.CareerSite{},
+		jobs:          map[int]models.Job{},
+		matches:       map[[2]int][]int{},
+		crawls:        map[[2]int]models.CrawlStatus{},
+		digested:      map[[2]int]bool{},
+	}
+}
+
+// Repositories returns the repositories backed by m. Transactions run one
+// at a time and undo their writes when rolled back; they don't hide their
+// writes from callers outside the transaction.
+func (m *Memory) Repositories() Repositories {
+	repos := m.repositories()
+	repos.withinTx = func(ctx context.Context, fn func(Repositories) error) error {
+		m.txMu.Lock()
+		defer m.txMu.Unlock()
+
+		txRepos := m.repositories()
+		txRepos.withinTx = func(ctx context.Context, fn func(Repositories) error) error {
+			return fn(txRepos)
+		}
+		saved := m.snapshot()
+		err := fn(txRepos)
+		if err != nil {
+			m.restore(saved)
+		}
+		return err
+	}
+	return repos
+}
+
+func (m *Memory) repositories() Repositories {
+	return Repositories{
+		Users:         memoryUsers{m},
+		Sessions:      memorySessions{m},
+		Subscriptions: memorySubscriptions{m},
+		Companies:     memoryCompanies{m},
+		Roles:         memoryRoles{m},
+		CareerSites:   memoryCareerSites{m},
+		Jobs:          memoryJobs{m},
+		Crawls:        memoryCrawls{m},
+		Digests:       memoryDigests{m},
+	}
+}
+
+// snapshot copies the records for restore. Records are replaced rather than
+// modified in place, so copying the maps is enough.
+func (m *Memory) snapshot() *Memory {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &Memory{
+		users:         maps.Clone(m.users),
+		loginFailures: maps.Clone(m.loginFailures),
+		totpSteps:     maps.Clone(m.totpSteps),
+		recoveryCodes: maps.Clone(m.recoveryCodes),
+		identities:    maps.Clone(m.identities),
+		resetTokens:   maps.Clone(m.resetTokens),
+		sessions:      maps.Clone(m.sessions),
+		refreshTokens: maps.Clone(m.refreshTokens),
+		subscriptions: maps.Clone(m.subscriptions),
+		companies:     maps.Clone(m.companies),
+		roles:         maps.Clone(m.roles),
+		careerSites:   maps.Clone(m.careerSites),
+		jobs:          maps.Clone(m.jobs),
+		matches:       maps.Clone(m.matches),
+		crawls:        maps.Clone(m.crawls),
+		digested:      maps.Clone(m.digested),
+		lastID:        m.lastID,
+	}
+}
+
+// restore puts back the records of a snapshot.
+func (m *Memory) restore(saved *Memory) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users, m.resetTokens, m.subscriptions = saved.users, saved.resetTokens, saved.subscriptions
+	m.loginFailures, m.sessions, m.refreshTokens = saved.loginFailures, saved.sessions, saved.refreshTokens
+	m.totpSteps, m.recoveryCodes, m.identities = saved.totpSteps, saved.recoveryCodes, saved.identities
+	m.companies, m.roles, m.careerSites = saved.companies, saved.roles, saved.careerSites
+	m.jobs, m.matches, m.crawls, m.digested = saved.jobs, saved.matches, saved.crawls, saved.digested
+	m.lastID = saved.lastID
+}
+
+// AddJob stores job as found for the company and role, setting its ID if it
+// has none.
+func (m *Memory) AddJob(job models.Job, companyID, roleID int) models.Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job.ID == 0 {
+		job.ID = m.nextID()
+	}
+	m.jobs[job.ID] = job
+	key := [2]int{companyID, roleID}
+	m.matches[key] = append(m.matches[key], job.ID)
+	return job
+}
+
+// RecordCrawl stores that the company and role were crawled just now, when
+// they were last refreshed and the latest error, as the crawler does.
+func (m *Memory) RecordCrawl(companyID, roleID int, refreshedAt *time.Time, lastError string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	m.crawls[[2]int{companyID, roleID}] = models.CrawlStatus{LastRefreshed: refreshedAt, LastAttempted: &now, LastError: lastError}
+}
+
+// SetCreatedAt changes when the user signed up.
+func (m *Memory) SetCreatedAt(userID int, createdAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if user, ok := m.users[userID]; ok {
+		user.CreatedAt = createdAt.UTC()
+		m.users[userID] = user
+	}
+}
+
+// nextID hands out IDs shared by every table, which is enough for tests.
+// Callers hold mu.
+func (m *Memory) nextID() int {
+	m.lastID++
+	return m.lastID
+}
+
+// sortedIDs returns the keys of records in ascending order.
+func sortedIDs[T any](records map[int]T) []int {
+	ids := make([]int, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+type memoryUsers struct{ m *Memory }
+
+func (r memoryUsers) Create(ctx context.Context, user *models.User) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, existing := range r.m.users {
+		if existing.Email == user.Email {
+			return ErrConflict
+		}
+	}
+	user.ID = r.m.nextID()
+	user.CreatedAt = time.Now().UTC()
+	user.Timezone = models.DefaultTimezone
+	user.SendHour = models.DefaultSendHour
+	r.m.users[user.ID] = *user
+	return nil
+}
+
+func (r memoryUsers) GetByID(ctx context.Context, id int) (models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	user, ok := r.m.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r memoryUsers) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, user := range r.m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r memoryUsers) UpdateName(ctx context.Context, id int, name string) error {
+	return r.update(func(user *models.User) bool { return user.ID == id }, func(user *models.User) {
+		user.Name = name
+	})
+}
+
+func (r memoryUsers) UpdatePassword(ctx context.Context, email, passwordHash string) error {
+	return r.update(func(user *models.User) bool { return user.Email == email }, func(user *models.User) {
+		user.PasswordHash = passwordHash
+	})
+}
+
+func (r memoryUsers) UpdateAlertSettings(ctx context.Context, id int, timezone *string, sendHour *int) error {
+	return r.update(func(user *models.User) bool { return user.ID == id }, func(user *models.User) {
+		if timezone != nil {
+			user.Timezone = *timezone
+		}
+		if sendHour != nil {
+			user.SendHour = *sendHour
+		}
+	})
+}
+
+// memoryLoginKey is a user and a client address logging in to it.
+type memoryLoginKey struct {
+	userID int
+	ip     string
+}
+
+type memoryLoginFailures struct {
+	failures    int // failed logins in a row
+	lockedUntil time.Time
+}
+
+func (r memoryUsers) RecordLoginFailure(ctx context.Context, id int, ip string, maxFailures int, lockedUntil time.Time) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.users[id]; !ok {
+		return false, ErrNotFound
+	}
+	key := memoryLoginKey{id, ip}
+	record := r.m.loginFailures[key]
+	record.failures++
+	locked := record.failures >= maxFailures
+	if locked {
+		record = memoryLoginFailures{lockedUntil: lockedUntil}
+	}
+	r.m.loginFailures[key] = record
+	return locked, nil
+}
+
+func (r memoryUsers) ResetLoginFailures(ctx context.Context, id int, ip string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.loginFailures, memoryLoginKey{id, ip})
+	return nil
+}
+
+func (r memoryUsers) LockedUntil(ctx context.Context, id int, ip string) (time.Time, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.loginFailures[memoryLoginKey{id, ip}].lockedUntil, nil
+}
+
+func (r memoryUsers) MarkVerified(ctx context.Context, id int, email string, at time.Time) error {
+	return r.update(func(user *models.User) bool { return user.ID == id && user.Email == email }, func(user *models.User) {
+		if user.VerifiedAt.IsZero() {
+			user.VerifiedAt = at
+		}
+	})
+}
+
+func (r memoryUsers) SetTOTPSecret(ctx context.Context, id int, secret string) error {
+	return r.update(func(user *models.User) bool { return user.ID == id }, func(user *models.User) {
+		user.TOTPSecret, user.TOTPEnabledAt = secret, time.Time{}
+	})
+}
+
+func (r memoryUsers) EnableTOTP(ctx context.Context, id int, at time.Time) error {
+	return r.update(func(user *models.User) bool { return user.ID == id && user.TOTPSecret != "" }, func(user *models.User) {
+		user.TOTPEnabledAt = at
+	})
+}
+
+func (r memoryUsers) DisableTOTP(ctx context.Context, id int) error {
+	err := r.update(func(user *models.User) bool { return user.ID == id }, func(user *models.User) {
+		user.TOTPSecret, user.TOTPEnabledAt = "", time.Time{}
+	})
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.totpSteps, id)
+	return err
+}
+
+func (r memoryUsers) UseTOTPStep(ctx context.Context, id int, step int64) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if last, ok := r.m.totpSteps[id]; ok && last >= step {
+		return false, nil
+	}
+	r.m.totpSteps[id] = step
+	return true, nil
+}
+
+// memoryRecoveryCode is a recovery code, stored by its hash.
+type memoryRecoveryCode struct {
+	userID int
+	usedAt time.Time
+}
+
+func (r memoryUsers) ReplaceRecoveryCodes(ctx context.Context, id int, codeHashes []string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	maps.DeleteFunc(r.m.recoveryCodes, func(_ string, code memoryRecoveryCode) bool { return code.userID == id })
+	for _, hash := range codeHashes {
+		r.m.recoveryCodes[hash] = memoryRecoveryCode{userID: id}
+	}
+	return nil
+}
+
+func (r memoryUsers) UseRecoveryCode(ctx context.Context, id int, codeHash string, at time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	code, ok := r.m.recoveryCodes[codeHash]
+	if !ok || code.userID != id || !code.usedAt.IsZero() {
+		return ErrNotFound
+	}
+	code.usedAt = at
+	r.m.recoveryCodes[codeHash] = code
+	return nil
+}
+
+// memoryIdentity is an identity at a provider, stored by the provider and
+// subject.
+type memoryIdentity struct {
+	userID int
+	email  string
+}
+
+func (r memoryUsers) GetByIdentity(ctx context.Context, provider, subject string) (models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	identity, ok := r.m.identities[[2]string{provider, subject}]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	user, ok := r.m.users[identity.userID]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r memoryUsers) LinkIdentity(ctx context.Context, id int, provider, subject, email string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	key := [2]string{provider, subject}
+	if _, ok := r.m.identities[key]; ok {
+		return ErrConflict
+	}
+	if _, ok := r.m.users[id]; !ok {
+		return ErrNotFound
+	}
+	r.m.identities[key] = memoryIdentity{userID: id, email: email}
+	return nil
+}
+
+// update applies change to the user matching match, returning ErrNotFound if
+// there is none.
+func (r memoryUsers) update(match func(*models.User) bool, change func(*models.User)) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for id, user := range r.m.users {
+		if match(&user) {
+			change(&user)
+			r.m.users[id] = user
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r memoryUsers) SaveResetToken(ctx context.Context, token models.ResetToken) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.resetTokens[token.Email] = token
+	return nil
+}
+
+func (r memoryUsers) GetResetToken(ctx context.Context, email string) (models.ResetToken, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	token, ok := r.m.resetTokens[email]
+	if !ok {
+		return models.ResetToken{}, ErrNotFound
+	}
+	return token, nil
+}
+
+func (r memoryUsers) CountResetAttempt(ctx context.Context, email string) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	token, ok := r.m.resetTokens[email]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	token.Attempts++
+	r.m.resetTokens[email] = token
+	return token.Attempts, nil
+}
+
+func (r memoryUsers) GrantReset(ctx context.Context, email, grantHash string, expiresAt time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	token, ok := r.m.resetTokens[email]
+	if !ok {
+		return ErrNotFound
+	}
+	token.CodeHash, token.GrantHash, token.GrantExpiresAt = "", grantHash, expiresAt
+	r.m.resetTokens[email] = token
+	return nil
+}
+
+func (r memoryUsers) ConsumeResetGrant(ctx context.Context, email, grantHash string, now time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	token, ok := r.m.resetTokens[email]
+	if !ok || token.GrantHash == "" || token.GrantHash != grantHash || !now.Before(token.GrantExpiresAt) {
+		return ErrNotFound
+	}
+	delete(r.m.resetTokens, email)
+	return nil
+}
+
+// memoryRefreshToken is a stored refresh token hash's session and whether
+// it has been rotated.
+type memoryRefreshToken struct {
+	sessionID int
+	rotated   bool
+}
+
+type memorySessions struct{ m *Memory }
+
+func (r memorySessions) Create(ctx context.Context, session *models.Session, tokenHash string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.refreshTokens[tokenHash]; ok {
+		return ErrConflict
+	}
+	session.ID = r.m.nextID()
+	r.m.sessions[session.ID] = *session
+	r.m.refreshTokens[tokenHash] = memoryRefreshToken{sessionID: session.ID}
+	return nil
+}
+
+func (r memorySessions) Get(ctx context.Context, id int) (models.Session, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	session, ok := r.m.sessions[id]
+	if !ok {
+		return models.Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (r memorySessions) Rotate(ctx context.Context, tokenHash, newHash string, now time.Time) (models.Session, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	token, ok := r.m.refreshTokens[tokenHash]
+	if !ok {
+		return models.Session{}, ErrNotFound
+	}
+	session := r.m.sessions[token.sessionID]
+	if token.rotated {
+		return session, ErrTokenReused
+	}
+	if _, ok := r.m.refreshTokens[newHash]; ok {
+		return models.Session{}, ErrConflict
+	}
+
+	r.m.refreshTokens[tokenHash] = memoryRefreshToken{sessionID: session.ID, rotated: true}
+	r.m.refreshTokens[newHash] = memoryRefreshToken{sessionID: session.ID}
+	session.LastUsedAt = now
+	r.m.sessions[session.ID] = session
+	return session, nil
+}
+
+func (r memorySessions) ListActive(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var sessions []models.Session
+	for _, session := range r.m.sessions {
+		if session.UserID == userID && session.Active(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+	return sessions, nil
+}
+
+func (r memorySessions) Revoke(ctx context.Context, id int, now time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	session, ok := r.m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if session.RevokedAt == nil {
+		session.RevokedAt = &now
+		r.m.sessions[id] = session
+	}
+	return nil
+}
+
+func (r memorySessions) RevokeAll(ctx context.Context, userID int, now time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for id, session := range r.m.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			r.m.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+type memorySubscriptions struct{ m *Memory }
+
+// copySubscription keeps callers from changing stored ID slices.
+func copySubscription(sub models.Subscription) models.Subscription {
+	sub.CareerSiteIDs = append([]int{}, sub.CareerSiteIDs...)
+	sub.RoleIDs = append([]int{}, sub.RoleIDs...)
+	return sub
+}
+
+func (r memorySubscriptions) ListByUser(ctx context.Context, userID int) ([]models.Subscription, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var subs []models.Subscription
+	for _, id := range sortedIDs(r.m.subscriptions) {
+		if sub := r.m.subscriptions[id]; sub.UserID == userID {
+			subs = append(subs, copySubscription(sub))
+		}
+	}
+	return subs, nil
+}
+
+func (r memorySubscriptions) Get(ctx context.Context, userID, companyID int) (models.Subscription, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, sub := range r.m.subscriptions {
+		if sub.UserID == userID && sub.CompanyID == companyID {
+			return copySubscription(sub), nil
+		}
+	}
+	return models.Subscription{}, ErrNotFound
+}
+
+func (r memorySubscriptions) GetByID(ctx context.Context, id int) (models.Subscription, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	sub, ok := r.m.subscriptions[id]
+	if !ok {
+		return models.Subscription{}, ErrNotFound
+	}
+	return copySubscription(sub), nil
+}
+
+func (r memorySubscriptions) Create(ctx context.Context, sub *models.Subscription) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, existing := range r.m.subscriptions {
+		if existing.UserID == sub.UserID && existing.CompanyID == sub.CompanyID {
+			return ErrConflict
+		}
+	}
+	sub.ID = r.m.nextID()
+	r.m.subscriptions[sub.ID] = copySubscription(*sub)
+	return nil
+}
+
+func (r memorySubscriptions) Update(ctx context.Context, sub models.Subscription) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	existing, ok := r.m.subscriptions[sub.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	sub.UserID, sub.CompanyID = existing.UserID, existing.CompanyID
+	r.m.subscriptions[sub.ID] = copySubscription(sub)
+	return nil
+}
+
+func (r memorySubscriptions) Delete(ctx context.Context, userID, companyID int) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for id, sub := range r.m.subscriptions {
+		if sub.UserID == userID && sub.CompanyID == companyID {
+			delete(r.m.subscriptions, id)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r memorySubscriptions) DeleteByID(ctx context.Context, id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.subscriptions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.m.subscriptions, id)
+	return nil
+}
+
+func (r memorySubscriptions) RoleCounts(ctx context.Context) ([]models.SubscriptionRoleCount, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	totals := map[int]int{}
+	counts := map[[2]int]int{}
+	for _, sub := range r.m.subscriptions {
+		totals[sub.CompanyID]++
+		for _, roleID := range sub.RoleIDs {
+			counts[[2]int{sub.CompanyID, roleID}]++
+		}
+	}
+
+	var out []models.SubscriptionRoleCount
+	for key, count := range counts {
+		company, okCompany := r.m.companies[key[0]]
+		role, okRole := r.m.roles[key[1]]
+		if !okCompany || !okRole {
+			continue
+		}
+		out = append(out, models.SubscriptionRoleCount{Company: company.Name, Role: role.Name, Count: count, Total: totals[key[0]]})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Company != out[j].Company {
+			return out[i].Company < out[j].Company
+		}
+		return out[i].Role < out[j].Role
+	})
+	return out, nil
+}
+
+func (r memorySubscriptions) Summaries(ctx context.Context) ([]models.SubscriptionSummary, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var out []models.SubscriptionSummary
+	for _, id := range sortedIDs(r.m.subscriptions) {
+		sub := r.m.subscriptions[id]
+		user, okUser := r.m.users[sub.UserID]
+		company, okCompany := r.m.companies[sub.CompanyID]
+		if !okUser || !okCompany {
+			continue
+		}
+		summary := models.SubscriptionSummary{User: user.Name, Company: company.Name, InterestTime: sub.InterestTime}
+		for _, roleID := range sub.RoleIDs {
+			if role, ok := r.m.roles[roleID]; ok {
+				summary.RoleNames = append(summary.RoleNames, role.Name)
+			}
+		}
+		if len(summary.RoleNames) > 0 {
+			out = append(out, summary)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].User != out[j].User {
+			return out[i].User < out[j].User
+		}
+		return out[i].InterestTime.After(out[j].InterestTime)
+	})
+	return out, nil
+}
+
+type memoryCompanies struct{ m *Memory }
+
+func (r memoryCompanies) GetOrCreate(ctx context.Context, name string) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for id, company := range r.m.companies {
+		if company.Name == name {
+			return id, nil
+		}
+	}
+	id := r.m.nextID()
+	r.m.companies[id] = models.Company{ID: id, Name: name}
+	return id, nil
+}
+
+func (r memoryCompanies) GetByID(ctx context.Context, id int) (models.Company, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	company, ok := r.m.companies[id]
+	if !ok {
+		return models.Company{}, ErrNotFound
+	}
+	return company, nil
+}
+
+func (r memoryCompanies) GetByName(ctx context.Context, name string) (models.Company, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, company := range r.m.companies {
+		if company.Name == name {
+			return company, nil
+		}
+	}
+	return models.Company{}, ErrNotFound
+}
+
+func (r memoryCompanies) List(ctx context.Context) ([]models.Company, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var companies []models.Company
+	for _, id := range sortedIDs(r.m.companies) {
+		companies = append(companies, r.m.companies[id])
+	}
+	return companies, nil
+}
+
+type memoryRoles struct{ m *Memory }
+
+func (r memoryRoles) GetOrCreate(ctx context.Context, name string) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for id, role := range r.m.roles {
+		if role.Name == name {
+			return id, nil
+		}
+	}
+	id := r.m.nextID()
+	r.m.roles[id] = models.Role{ID: id, Name: name}
+	return id, nil
+}
+
+func (r memoryRoles) GetByID(ctx context.Context, id int) (models.Role, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	role, ok := r.m.roles[id]
+	if !ok {
+		return models.Role{}, ErrNotFound
+	}
+	return role, nil
+}
+
+func (r memoryRoles) List(ctx context.Context) ([]models.Role, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var roles []models.Role
+	for _, id := range sortedIDs(r.m.roles) {
+		roles = append(roles, r.m.roles[id])
+	}
+	return roles, nil
+}
+
+type memoryCareerSites struct{ m *Memory }
+
+func (r memoryCareerSites) GetOrCreate(ctx context.Context, companyID int, link string) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for id, site := range r.m.careerSites {
+		if site.Link == link {
+			return id, nil
+		}
+	}
+	id := r.m.nextID()
+	r.m.careerSites[id] = models.CareerSite{ID: id, CompanyID: companyID, Link: link}
+	return id, nil
+}
+
+func (r memoryCareerSites) GetByID(ctx context.Context, id int) (models.CareerSite, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	site, ok := r.m.careerSites[id]
+	if !ok {
+		return models.CareerSite{}, ErrNotFound
+	}
+	return site, nil
+}
+
+func (r memoryCareerSites) ListByCompany(ctx context.Context, companyID int) ([]models.CareerSite, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var sites []models.CareerSite
+	for _, id := range sortedIDs(r.m.careerSites) {
+		if site := r.m.careerSites[id]; site.CompanyID == companyID {
+			sites = append(sites, site)
+		}
+	}
+	return sites, nil
+}
+
+func (r memoryCareerSites) ActiveLinks(ctx context.Context, companyName string) ([]string, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	seen := map[string]bool{}
+	var links []string
+	for _, sub := range r.m.subscriptions {
+		if company, ok := r.m.companies[sub.CompanyID]; !ok || company.Name != companyName || !sub.Active {
+			continue
+		}
+		for _, siteID := range sub.CareerSiteIDs {
+			if site, ok := r.m.careerSites[siteID]; ok && !seen[site.Link] {
+				seen[site.Link] = true
+				links = append(links, site.Link)
+			}
+		}
+	}
+	sort.Strings(links)
+	return links, nil
+}
+
+type memoryJobs struct{ m *Memory }
+
+func (r memoryJobs) Upsert(ctx context.Context, job *models.Job) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if job.Fingerprint == "" {
+		job.Fingerprint = models.Fingerprint(job.Company, job.Title, job.Location, job.URL)
+	}
+	if len(job.Sources) == 0 && job.Source != "" {
+		job.Sources = []string{job.Source}
+	}
+	now := time.Now().UTC()
+
+	for _, id := range sortedIDs(r.m.jobs) {
+		existing := r.m.jobs[id]
+		if existing.Fingerprint != job.Fingerprint {
+			continue
+		}
+		existing.LastSeen = now
+		existing.Remote = existing.Remote || job.Remote
+		if existing.Salary == nil {
+			existing.Salary = job.Salary
+		}
+		if existing.PostedAt == nil {
+			existing.PostedAt = job.PostedAt
+		}
+		if job.ValidThrough != nil {
+			existing.ValidThrough = job.ValidThrough
+		}
+		if existing.EmploymentType == "" {
+			existing.EmploymentType = job.EmploymentType
+		}
+		existing.ApplyURLs = union(existing.ApplyURLs, job.ApplyURLs)
+		if existing.Description == "" {
+			existing.Description = job.Description
+		}
+		existing.Sources = union(existing.Sources, job.Sources)
+		if len(job.Raw) > 0 {
+			existing.Raw = job.Raw
+		}
+		r.m.jobs[id] = existing
+		job.ID, job.Sources, job.FirstSeen, job.LastSeen = id, existing.Sources, existing.FirstSeen, existing.LastSeen
+		return nil
+	}
+
+	job.ID = r.m.nextID()
+	job.FirstSeen, job.LastSeen = now, now
+	stored := *job
+	stored.Sources = append([]string{}, job.Sources...)
+	stored.ApplyURLs = append([]string{}, job.ApplyURLs...)
+	r.m.jobs[job.ID] = stored
+	return nil
+}
+
+// union returns the distinct strings of a and b in order.
+func union(a, b []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (r memoryJobs) Link(ctx context.Context, jobID, companyID, roleID int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	key := [2]int{companyID, roleID}
+	for _, id := range r.m.matches[key] {
+		if id == jobID {
+			return nil
+		}
+	}
+	r.m.matches[key] = append(r.m.matches[key], jobID)
+	return nil
+}
+
+func (r memoryJobs) CrawlStatuses(ctx context.Context, userID int) ([]models.CrawlStatus, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var statuses []models.CrawlStatus
+	for _, sub := range r.m.subscriptions {
+		company, ok := r.m.companies[sub.CompanyID]
+		if sub.UserID != userID || !sub.Active || !ok {
+			continue
+		}
+		for _, roleID := range sub.RoleIDs {
+			role, ok := r.m.roles[roleID]
+			if !ok {
+				continue
+			}
+			status := r.m.crawls[[2]int{sub.CompanyID, roleID}]
+			status.Company, status.Role = company.Name, role.Name
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Company != statuses[j].Company {
+			return statuses[i].Company < statuses[j].Company
+		}
+		return statuses[i].Role < statuses[j].Role
+	})
+	return statuses, nil
+}
+
+func (r memoryJobs) ListForUser(ctx context.Context, userID int, now time.Time) ([]models.Job, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	seen := map[int]bool{}
+	var jobs []models.Job
+	for _, sub := range r.m.subscriptions {
+		if sub.UserID != userID || !sub.Active {
+			continue
+		}
+		for _, roleID := range sub.RoleIDs {
+			for _, jobID := range r.m.matches[[2]int{sub.CompanyID, roleID}] {
+				job := r.m.jobs[jobID]
+				if seen[jobID] || (job.ValidThrough != nil && !job.ValidThrough.After(now)) {
+					continue
+				}
+				seen[jobID] = true
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].FirstSeen.Equal(jobs[j].FirstSeen) {
+			return jobs[i].FirstSeen.After(jobs[j].FirstSeen)
+		}
+		return jobs[i].ID > jobs[j].ID
+	})
+	return jobs, nil
+}
+
+type memoryCrawls struct{ m *Memory }
+
+func (r memoryCrawls) Targets(ctx context.Context) ([]models.CrawlTarget, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.targets(false), nil
+}
+
+func (r memoryCrawls) NewTargets(ctx context.Context) ([]models.CrawlTarget, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.targets(true), nil
+}
+
+// targets returns the distinct pairs active subscriptions follow, only
+// those never crawled if onlyNew. Callers hold mu.
+func (r memoryCrawls) targets(onlyNew bool) []models.CrawlTarget {
+	seen := map[[2]int]bool{}
+	var targets []models.CrawlTarget
+	for _, sub := range r.m.subscriptions {
+		company, ok := r.m.companies[sub.CompanyID]
+		if !sub.Active || !ok {
+			continue
+		}
+		for _, roleID := range sub.RoleIDs {
+			key := [2]int{sub.CompanyID, roleID}
+			role, ok := r.m.roles[roleID]
+			if _, crawled := r.m.crawls[key]; !ok || seen[key] || (onlyNew && crawled) {
+				continue
+			}
+			seen[key] = true
+			targets = append(targets, models.CrawlTarget{CompanyID: company.ID, CompanyName: company.Name, RoleID: role.ID, RoleName: role.Name})
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].CompanyID != targets[j].CompanyID {
+			return targets[i].CompanyID < targets[j].CompanyID
+		}
+		return targets[i].RoleID < targets[j].RoleID
+	})
+	return targets
+}
+
+func (r memoryCrawls) Record(ctx context.Context, companyID, roleID int, attemptedAt time.Time, refreshedAt *time.Time, lastError string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	key := [2]int{companyID, roleID}
+	status := r.m.crawls[key]
+	if refreshedAt != nil {
+		status.LastRefreshed = refreshedAt
+	}
+	status.LastAttempted = &attemptedAt
+	status.LastError = lastError
+	r.m.crawls[key] = status
+	return nil
+}
+
+type memoryDigests struct{ m *Memory }
+
+func (r memoryDigests) Recipients(ctx context.Context) ([]models.DigestRecipient, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var recipients []models.DigestRecipient
+	for _, id := range sortedIDs(r.m.users) {
+		user := r.m.users[id]
+		if !user.Verified() {
+			continue
+		}
+		for _, sub := range r.m.subscriptions {
+			if sub.UserID == id && sub.Active && sub.Frequency != models.FrequencyOff {
+				recipients = append(recipients, models.DigestRecipient{UserID: id, Name: user.Name, Email: user.Email,
+					Since: user.CreatedAt.UTC(), Timezone: user.Timezone, SendHour: user.SendHour})
+				break
+			}
+		}
+	}
+	return recipients, nil
+}
+
+func (r memoryDigests) Jobs(ctx context.Context, userID int, since time.Time, cutoffs models.DigestCutoffs) ([]models.Job, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	now := time.Now()
+	seen := map[int]bool{}
+	var jobs []models.Job
+	for _, sub := range r.m.subscriptions {
+		if sub.UserID != userID || !sub.Active {
+			continue
+		}
+		cutoff, ok := map[string]time.Time{
+			models.FrequencyInstant: cutoffs.Instant,
+			models.FrequencyDaily:   cutoffs.Daily,
+			models.FrequencyWeekly:  cutoffs.Weekly,
+		}[sub.Frequency]
+		if !ok {
+			continue
+		}
+		for _, roleID := range sub.RoleIDs {
+			for _, jobID := range r.m.matches[[2]int{sub.CompanyID, roleID}] {
+				job := r.m.jobs[jobID]
+				if seen[jobID] || r.m.digested[[2]int{userID, jobID}] || !job.FirstSeen.After(since) ||
+					job.FirstSeen.After(cutoff) || (job.ValidThrough != nil && !job.ValidThrough.After(now)) {
+					continue
+				}
+				seen[jobID] = true
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		switch {
+		case jobs[i].Company != jobs[j].Company:
+			return jobs[i].Company < jobs[j].Company
+		case !jobs[i].FirstSeen.Equal(jobs[j].FirstSeen):
+			return jobs[i].FirstSeen.After(jobs[j].FirstSeen)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+func (r memoryDigests) Record(ctx context.Context, userID int, jobIDs []int, sentAt time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, id := range jobIDs {
+		r.m.digested[[2]int{userID, id}] = true
+	}
+	return nil
+}
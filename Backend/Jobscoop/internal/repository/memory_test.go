@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryWithinTx(t *testing.T) {
+	repos := NewMemory().Repositories()
+	ctx := context.Background()
+	errStop := errors.New("stop")
+
+	// A failed transaction leaves nothing behind
+	err := repos.WithinTx(ctx, func(tx Repositories) error {
+		if _, err := tx.Companies.GetOrCreate(ctx, "Acme"); err != nil {
+			return err
+		}
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	_, err = repos.Companies.GetByName(ctx, "Acme")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// A successful one keeps its writes
+	var id int
+	require.NoError(t, repos.WithinTx(ctx, func(tx Repositories) error {
+		id, err = tx.Companies.GetOrCreate(ctx, "Acme")
+		return err
+	}))
+	company, err := repos.Companies.GetByName(ctx, "Acme")
+	require.NoError(t, err)
+	assert.Equal(t, id, company.ID)
+}
@@ -0,0 +1,993 @@
+package repository
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Postgres error codes for a duplicate unique key and a missing referenced
+// row.
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// queryer is what the repositories need from *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// NewPostgres returns repositories backed by database.
+func NewPostgres(database *sql.DB) Repositories {
+	repos := postgresRepositories(database)
+	repos.withinTx = func(ctx context.Context, fn func(Repositories) error) error {
+		tx, err := database.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		// Rolling back after a commit does nothing
+		defer tx.Rollback()
+
+		txRepos := postgresRepositories(tx)
+		txRepos.withinTx = func(ctx context.Context, fn func(Repositories) error) error {
+			return fn(txRepos)
+		}
+		if err := fn(txRepos); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	return repos
+}
+
+func postgresRepositories(q queryer) Repositories {
+	return Repositories{
+		Users:         postgresUsers{q},
+		Sessions:      postgresSessions{q},
+		Subscriptions: postgresSubscriptions{q},
+		Companies:     postgresCompanies{q},
+		Roles:         postgresRoles{q},
+		CareerSites:   postgresCareerSites{q},
+		Jobs:          postgresJobs{q},
+		Crawls:        postgresCrawls{q},
+		Digests:       postgresDigests{q},
+	}
+}
+
+// notFound maps sql.ErrNoRows to ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// conflict maps unique key violations to ErrConflict.
+func conflict(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrConflict
+	}
+	return err
+}
+
+type postgresUsers struct{ db queryer }
+
+func (r postgresUsers) Create(ctx context.Context, user *models.User) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO users (name, email, password) VALUES ($1, $2, $3)
+		RETURNING id, created_at, timezone, send_hour`,
+		user.Name, user.Email, user.PasswordHash,
+	).Scan(&user.ID, &user.CreatedAt, &user.Timezone, &user.SendHour)
+	return conflict(err)
+}
+
+func (r postgresUsers) GetByID(ctx context.Context, id int) (models.User, error) {
+	return r.get(ctx, `WHERE id = $1`, id)
+}
+
+func (r postgresUsers) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	return r.get(ctx, `WHERE email = $1`, email)
+}
+
+func (r postgresUsers) GetByIdentity(ctx context.Context, provider, subject string) (models.User, error) {
+	return r.get(ctx, `WHERE id = (SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2)`, provider, subject)
+}
+
+func (r postgresUsers) get(ctx context.Context, where string, args ...interface{}) (models.User, error) {
+	var user models.User
+	var verifiedAt, totpEnabledAt sql.NullTime
+	var totpSecret sql.NullString
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, name, email, password, created_at, timezone, send_hour, verified_at, totp_secret, totp_enabled_at
+		FROM users `+where, args...,
+	).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.Timezone, &user.SendHour,
+		&verifiedAt, &totpSecret, &totpEnabledAt)
+	user.VerifiedAt = verifiedAt.Time
+	user.TOTPSecret, user.TOTPEnabledAt = totpSecret.String, totpEnabledAt.Time
+	return user, notFound(err)
+}
+
+func (r postgresUsers) UpdateName(ctx context.Context, id int, name string) error {
+	return r.update(ctx, `UPDATE users SET name = $1 WHERE id = $2`, name, id)
+}
+
+func (r postgresUsers) UpdatePassword(ctx context.Context, email, passwordHash string) error {
+	return r.update(ctx, `UPDATE users SET password = $1 WHERE email = $2`, passwordHash, email)
+}
+
+func (r postgresUsers) UpdateAlertSettings(ctx context.Context, id int, timezone *string, sendHour *int) error {
+	return r.update(ctx, `
+		UPDATE users
+		SET timezone = COALESCE($1, timezone), send_hour = COALESCE($2, send_hour)
+		WHERE id = $3`, timezone, sendHour, id)
+}
+
+func (r postgresUsers) RecordLoginFailure(ctx context.Context, id int, ip string, maxFailures int, lockedUntil time.Time) (bool, error) {
+	// SET reads the count from before the update, so the failures are
+	// counted and checked in one step however many race
+	var locked bool
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO login_failures (user_id, ip, failures, locked_until)
+		VALUES ($3, $4, CASE WHEN $1::int <= 1 THEN 0 ELSE 1 END, CASE WHEN $1::int <= 1 THEN $2::timestamp END)
+		ON CONFLICT (user_id, ip) DO UPDATE SET
+			failures = CASE WHEN login_failures.failures + 1 >= $1 THEN 0 ELSE login_failures.failures + 1 END,
+			locked_until = CASE WHEN login_failures.failures + 1 >= $1 THEN $2 ELSE login_failures.locked_until END
+		RETURNING failures = 0`, maxFailures, lockedUntil.UTC(), id, ip,
+	).Scan(&locked)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return false, ErrNotFound
+	}
+	return locked, err
+}
+
+func (r postgresUsers) ResetLoginFailures(ctx context.Context, id int, ip string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_failures WHERE user_id = $1 AND ip = $2`, id, ip)
+	return err
+}
+
+func (r postgresUsers) LockedUntil(ctx context.Context, id int, ip string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx, `SELECT locked_until FROM login_failures WHERE user_id = $1 AND ip = $2`, id, ip).
+		Scan(&lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return lockedUntil.Time, err
+}
+
+func (r postgresUsers) MarkVerified(ctx context.Context, id int, email string, at time.Time) error {
+	return r.update(ctx, `
+		UPDATE users SET verified_at = COALESCE(verified_at, $1)
+		WHERE id = $2 AND email = $3`, at.UTC(), id, email)
+}
+
+func (r postgresUsers) SetTOTPSecret(ctx context.Context, id int, secret string) error {
+	return r.update(ctx, `UPDATE users SET totp_secret = $1, totp_enabled_at = NULL WHERE id = $2`, secret, id)
+}
+
+func (r postgresUsers) EnableTOTP(ctx context.Context, id int, at time.Time) error {
+	return r.update(ctx, `
+		UPDATE users SET totp_enabled_at = $1
+		WHERE id = $2 AND totp_secret IS NOT NULL`, at.UTC(), id)
+}
+
+func (r postgresUsers) DisableTOTP(ctx context.Context, id int) error {
+	return r.update(ctx, `
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+		WHERE id = $1`, id)
+}
+
+func (r postgresUsers) UseTOTPStep(ctx context.Context, id int, step int64) (bool, error) {
+	// Comparing and setting in one statement keeps two logins racing with
+	// the same code from both succeeding
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE users SET totp_last_step = $1
+		WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`, step, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r postgresUsers) ReplaceRecoveryCodes(ctx context.Context, id int, codeHashes []string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, id); err != nil {
+		return err
+	}
+	if len(codeHashes) == 0 {
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO recovery_codes (user_id, code_hash)
+		SELECT $1, unnest($2::text[])`, id, pq.Array(codeHashes))
+	return err
+}
+
+func (r postgresUsers) UseRecoveryCode(ctx context.Context, id int, codeHash string, at time.Time) error {
+	return r.update(ctx, `
+		UPDATE recovery_codes SET used_at = $1
+		WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`, at.UTC(), id, codeHash)
+}
+
+func (r postgresUsers) LinkIdentity(ctx context.Context, id int, provider, subject, email string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_identities (provider, subject, user_id, email) VALUES ($1, $2, $3, $4)`,
+		provider, subject, id, email)
+	return conflict(err)
+}
+
+// update runs an UPDATE of one user or their reset, returning ErrNotFound if
+// there was none.
+func (r postgresUsers) update(ctx context.Context, query string, args ...interface{}) error {
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r postgresUsers) SaveResetToken(ctx context.Context, token models.ResetToken) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO reset_tokens (email, code_hash, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (email) DO UPDATE
+		SET code_hash = $2, expires_at = $3, attempts = 0, grant_hash = NULL, grant_expires_at = NULL`,
+		token.Email, token.CodeHash, token.ExpiresAt.UTC())
+	return err
+}
+
+func (r postgresUsers) GetResetToken(ctx context.Context, email string) (models.ResetToken, error) {
+	token := models.ResetToken{Email: email}
+	var grantHash sql.NullString
+	var grantExpiresAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT code_hash, expires_at, attempts, grant_hash, grant_expires_at
+		FROM reset_tokens
+		WHERE email = $1`, email).
+		Scan(&token.CodeHash, &token.ExpiresAt, &token.Attempts, &grantHash, &grantExpiresAt)
+	token.GrantHash, token.GrantExpiresAt = grantHash.String, grantExpiresAt.Time
+	return token, notFound(err)
+}
+
+func (r postgresUsers) CountResetAttempt(ctx context.Context, email string) (int, error) {
+	// Counting before comparing, in one statement, keeps concurrent guesses
+	// from all slipping under the limit
+	var attempts int
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE reset_tokens SET attempts = attempts + 1
+		WHERE email = $1
+		RETURNING attempts`, email).Scan(&attempts)
+	return attempts, notFound(err)
+}
+
+func (r postgresUsers) GrantReset(ctx context.Context, email, grantHash string, expiresAt time.Time) error {
+	return r.update(ctx, `
+		UPDATE reset_tokens SET code_hash = '', grant_hash = $1, grant_expires_at = $2
+		WHERE email = $3`, grantHash, expiresAt.UTC(), email)
+}
+
+func (r postgresUsers) ConsumeResetGrant(ctx context.Context, email, grantHash string, now time.Time) error {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM reset_tokens
+		WHERE email = $1 AND grant_hash = $2 AND grant_expires_at > $3`, email, grantHash, now.UTC())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type postgresSessions struct{ db queryer }
+
+const sessionColumns = `id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (models.Session, error) {
+	var session models.Session
+	var revokedAt sql.NullTime
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &revokedAt)
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return session, err
+}
+
+func (r postgresSessions) Create(ctx context.Context, session *models.Session, tokenHash string) error {
+	// One statement, so a session is never left without its token
+	err := r.db.QueryRowContext(ctx, `
+		WITH session AS (
+			INSERT INTO sessions (user_id, user_agent, ip, created_at, last_used_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id
+		)
+		INSERT INTO refresh_tokens (token_hash, session_id, created_at)
+		SELECT $7, id, $4 FROM session
+		RETURNING session_id`,
+		session.UserID, session.UserAgent, session.IP, session.CreatedAt.UTC(), session.LastUsedAt.UTC(),
+		session.ExpiresAt.UTC(), tokenHash,
+	).Scan(&session.ID)
+	return conflict(err)
+}
+
+func (r postgresSessions) Get(ctx context.Context, id int) (models.Session, error) {
+	session, err := scanSession(r.db.QueryRowContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE id = $1`, id))
+	return session, notFound(err)
+}
+
+func (r postgresSessions) Rotate(ctx context.Context, tokenHash, newHash string, now time.Time) (models.Session, error) {
+	// Marking the token rotated only if it wasn't lets one of two
+	// concurrent refreshes with the same token win
+	var sessionID int
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE refresh_tokens SET rotated_at = $1
+		WHERE token_hash = $2 AND rotated_at IS NULL
+		RETURNING session_id`, now.UTC(), tokenHash,
+	).Scan(&sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if err := r.db.QueryRowContext(ctx, `SELECT session_id FROM refresh_tokens WHERE token_hash = $1`, tokenHash).
+			Scan(&sessionID); err != nil {
+			return models.Session{}, notFound(err)
+		}
+		session, err := r.Get(ctx, sessionID)
+		if err != nil {
+			return models.Session{}, err
+		}
+		return session, ErrTokenReused
+	} else if err != nil {
+		return models.Session{}, err
+	}
+
+	if _, err := r.db.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (token_hash, session_id, created_at) VALUES ($1, $2, $3)`,
+		newHash, sessionID, now.UTC()); err != nil {
+		return models.Session{}, conflict(err)
+	}
+	session, err := scanSession(r.db.QueryRowContext(ctx, `
+		UPDATE sessions SET last_used_at = $1
+		WHERE id = $2
+		RETURNING `+sessionColumns, now.UTC(), sessionID))
+	return session, notFound(err)
+}
+
+func (r postgresSessions) ListActive(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_used_at DESC, id DESC`, userID, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r postgresSessions) Revoke(ctx context.Context, id int, now time.Time) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2`, now.UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r postgresSessions) RevokeAll(ctx context.Context, userID int, now time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`, now.UTC(), userID)
+	return err
+}
+
+type postgresSubscriptions struct{ db queryer }
+
+const subscriptionColumns = `id, user_id, company_id, career_site_ids, role_ids, active, frequency, interest_time`
+
+func scanSubscription(row interface{ Scan(...interface{}) error }) (models.Subscription, error) {
+	var sub models.Subscription
+	var careerSiteIDs, roleIDs []int64
+	var interestTime sql.NullTime
+	err := row.Scan(&sub.ID, &sub.UserID, &sub.CompanyID, pq.Array(&careerSiteIDs), pq.Array(&roleIDs),
+		&sub.Active, &sub.Frequency, &interestTime)
+	sub.CareerSiteIDs = ints(careerSiteIDs)
+	sub.RoleIDs = ints(roleIDs)
+	sub.InterestTime = interestTime.Time
+	return sub, err
+}
+
+func (r postgresSubscriptions) ListByUser(ctx context.Context, userID int) ([]models.Subscription, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions
+		WHERE user_id = $1
+		ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []models.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (r postgresSubscriptions) Get(ctx context.Context, userID, companyID int) (models.Subscription, error) {
+	sub, err := scanSubscription(r.db.QueryRowContext(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions
+		WHERE user_id = $1 AND company_id = $2`, userID, companyID))
+	return sub, notFound(err)
+}
+
+func (r postgresSubscriptions) GetByID(ctx context.Context, id int) (models.Subscription, error) {
+	sub, err := scanSubscription(r.db.QueryRowContext(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions
+		WHERE id = $1`, id))
+	return sub, notFound(err)
+}
+
+func (r postgresSubscriptions) Create(ctx context.Context, sub *models.Subscription) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO subscriptions (user_id, company_id, career_site_ids, role_ids, active, frequency, interest_time)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, company_id) DO NOTHING
+		RETURNING id`,
+		sub.UserID, sub.CompanyID, pq.Array(int64s(sub.CareerSiteIDs)), pq.Array(int64s(sub.RoleIDs)),
+		sub.Active, sub.Frequency, sub.InterestTime.UTC(),
+	).Scan(&sub.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r postgresSubscriptions) Update(ctx context.Context, sub models.Subscription) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE subscriptions
+		SET career_site_ids = $1, role_ids = $2, active = $3, frequency = $4, interest_time = $5
+		WHERE id = $6`,
+		pq.Array(int64s(sub.CareerSiteIDs)), pq.Array(int64s(sub.RoleIDs)), sub.Active, sub.Frequency,
+		sub.InterestTime.UTC(), sub.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r postgresSubscriptions) Delete(ctx context.Context, userID, companyID int) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM subscriptions WHERE user_id = $1 AND company_id = $2`, userID, companyID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r postgresSubscriptions) DeleteByID(ctx context.Context, id int) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r postgresSubscriptions) RoleCounts(ctx context.Context) ([]models.SubscriptionRoleCount, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT c.name, ro.name, COUNT(*), totals.total
+		FROM subscriptions s
+		CROSS JOIN LATERAL unnest(s.role_ids) AS rid(role_id)
+		JOIN companies c ON c.id = s.company_id
+		JOIN roles ro ON ro.id = rid.role_id
+		JOIN (SELECT company_id, COUNT(*) AS total FROM subscriptions GROUP BY company_id) totals
+			ON totals.company_id = s.company_id
+		GROUP BY c.id, c.name, ro.id, ro.name, totals.total
+		ORDER BY c.name, ro.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []models.SubscriptionRoleCount
+	for rows.Next() {
+		var count models.SubscriptionRoleCount
+		if err := rows.Scan(&count.Company, &count.Role, &count.Count, &count.Total); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+func (r postgresSubscriptions) Summaries(ctx context.Context) ([]models.SubscriptionSummary, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.name, c.name, s.interest_time, array_agg(ro.name ORDER BY rid.ord)
+		FROM subscriptions s
+		JOIN users u ON u.id = s.user_id
+		JOIN companies c ON c.id = s.company_id
+		CROSS JOIN LATERAL unnest(s.role_ids) WITH ORDINALITY AS rid(role_id, ord)
+		JOIN roles ro ON ro.id = rid.role_id
+		GROUP BY s.id, u.name, c.name, s.interest_time
+		ORDER BY u.name, s.interest_time DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []models.SubscriptionSummary
+	for rows.Next() {
+		var summary models.SubscriptionSummary
+		var interestTime sql.NullTime
+		if err := rows.Scan(&summary.User, &summary.Company, &interestTime, pq.Array(&summary.RoleNames)); err != nil {
+			return nil, err
+		}
+		summary.InterestTime = interestTime.Time
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+type postgresCompanies struct{ db queryer }
+
+func (r postgresCompanies) GetOrCreate(ctx context.Context, name string) (int, error) {
+	return getOrCreate(ctx, r.db, `INSERT INTO companies (name) VALUES ($1) ON CONFLICT (name) DO NOTHING RETURNING id`,
+		`SELECT id FROM companies WHERE name = $1`, name)
+}
+
+func (r postgresCompanies) GetByID(ctx context.Context, id int) (models.Company, error) {
+	company := models.Company{ID: id}
+	err := r.db.QueryRowContext(ctx, `SELECT name FROM companies WHERE id = $1`, id).Scan(&company.Name)
+	return company, notFound(err)
+}
+
+func (r postgresCompanies) GetByName(ctx context.Context, name string) (models.Company, error) {
+	company := models.Company{Name: name}
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM companies WHERE name = $1`, name).Scan(&company.ID)
+	return company, notFound(err)
+}
+
+func (r postgresCompanies) List(ctx context.Context) ([]models.Company, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name FROM companies ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var companies []models.Company
+	for rows.Next() {
+		var company models.Company
+		if err := rows.Scan(&company.ID, &company.Name); err != nil {
+			return nil, err
+		}
+		companies = append(companies, company)
+	}
+	return companies, rows.Err()
+}
+
+type postgresRoles struct{ db queryer }
+
+func (r postgresRoles) GetOrCreate(ctx context.Context, name string) (int, error) {
+	return getOrCreate(ctx, r.db, `INSERT INTO roles (name) VALUES ($1) ON CONFLICT (name) DO NOTHING RETURNING id`,
+		`SELECT id FROM roles WHERE name = $1`, name)
+}
+
+func (r postgresRoles) GetByID(ctx context.Context, id int) (models.Role, error) {
+	role := models.Role{ID: id}
+	err := r.db.QueryRowContext(ctx, `SELECT name FROM roles WHERE id = $1`, id).Scan(&role.Name)
+	return role, notFound(err)
+}
+
+func (r postgresRoles) List(ctx context.Context) ([]models.Role, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name FROM roles ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+type postgresCareerSites struct{ db queryer }
+
+func (r postgresCareerSites) GetOrCreate(ctx context.Context, companyID int, link string) (int, error) {
+	return getOrCreate(ctx, r.db, `INSERT INTO career_sites (link, company_id) VALUES ($1, $2) ON CONFLICT (link) DO NOTHING RETURNING id`,
+		`SELECT id FROM career_sites WHERE link = $1`, link, companyID)
+}
+
+func (r postgresCareerSites) GetByID(ctx context.Context, id int) (models.CareerSite, error) {
+	site := models.CareerSite{ID: id}
+	err := r.db.QueryRowContext(ctx, `SELECT company_id, link FROM career_sites WHERE id = $1`, id).
+		Scan(&site.CompanyID, &site.Link)
+	return site, notFound(err)
+}
+
+func (r postgresCareerSites) ListByCompany(ctx context.Context, companyID int) ([]models.CareerSite, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, link FROM career_sites WHERE company_id = $1 ORDER BY id`, companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sites []models.CareerSite
+	for rows.Next() {
+		site := models.CareerSite{CompanyID: companyID}
+		if err := rows.Scan(&site.ID, &site.Link); err != nil {
+			return nil, err
+		}
+		sites = append(sites, site)
+	}
+	return sites, rows.Err()
+}
+
+func (r postgresCareerSites) ActiveLinks(ctx context.Context, companyName string) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT cs.link
+		FROM subscriptions s
+		JOIN companies c ON c.id = s.company_id
+		JOIN career_sites cs ON cs.id = ANY(s.career_site_ids)
+		WHERE c.name = $1 AND s.active = TRUE
+		ORDER BY cs.link`, companyName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []string
+	for rows.Next() {
+		var link string
+		if err := rows.Scan(&link); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// getOrCreate inserts a row with insert and args, returning its ID, or the ID
+// lookup selects with args[0] when the row already exists. insert must do
+// nothing on conflict, so concurrent callers neither fail nor abort the
+// transaction they are in.
+func getOrCreate(ctx context.Context, q queryer, insert, lookup string, args ...interface{}) (int, error) {
+	var id int
+	err := q.QueryRowContext(ctx, insert, args...).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Someone else created it; the lookup sees their committed row
+		err = q.QueryRowContext(ctx, lookup, args[0]).Scan(&id)
+	}
+	return id, err
+}
+
+type postgresJobs struct{ db queryer }
+
+func (r postgresJobs) Upsert(ctx context.Context, job *models.Job) error {
+	if job.Fingerprint == "" {
+		job.Fingerprint = models.Fingerprint(job.Company, job.Title, job.Location, job.URL)
+	}
+	if len(job.Sources) == 0 && job.Source != "" {
+		job.Sources = []string{job.Source}
+	}
+	// pq sends nil slices as NULL, which the NOT NULL array columns reject
+	if job.Sources == nil {
+		job.Sources = []string{}
+	}
+	if job.ApplyURLs == nil {
+		job.ApplyURLs = []string{}
+	}
+
+	var salary []byte
+	if job.Salary != nil {
+		var err error
+		if salary, err = json.Marshal(job.Salary); err != nil {
+			return err
+		}
+	}
+	var payload []byte
+	if len(job.Raw) > 0 {
+		payload = job.Raw
+	}
+
+	now := time.Now().UTC()
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO jobs (fingerprint, company, title, location, remote, salary, posted_at, valid_through,
+			employment_type, url, apply_urls, description, sources, payload, first_seen, last_seen)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $15)
+		ON CONFLICT (fingerprint) DO UPDATE SET
+			last_seen = EXCLUDED.last_seen,
+			remote = jobs.remote OR EXCLUDED.remote,
+			salary = COALESCE(jobs.salary, EXCLUDED.salary),
+			posted_at = COALESCE(jobs.posted_at, EXCLUDED.posted_at),
+			valid_through = COALESCE(EXCLUDED.valid_through, jobs.valid_through),
+			employment_type = CASE WHEN jobs.employment_type = '' THEN EXCLUDED.employment_type ELSE jobs.employment_type END,
+			apply_urls = ARRAY(SELECT DISTINCT u FROM unnest(jobs.apply_urls || EXCLUDED.apply_urls) AS u ORDER BY u),
+			description = CASE WHEN jobs.description = '' THEN EXCLUDED.description ELSE jobs.description END,
+			sources = ARRAY(SELECT DISTINCT s FROM unnest(jobs.sources || EXCLUDED.sources) AS s ORDER BY s),
+			payload = COALESCE(EXCLUDED.payload, jobs.payload)
+		RETURNING id, sources, first_seen, last_seen`,
+		job.Fingerprint, job.Company, job.Title, job.Location, job.Remote, salary, job.PostedAt, job.ValidThrough,
+		job.EmploymentType, job.URL, pq.Array(job.ApplyURLs), job.Description, pq.Array(job.Sources), payload, now,
+	).Scan(&job.ID, pq.Array(&job.Sources), &job.FirstSeen, &job.LastSeen)
+}
+
+func (r postgresJobs) Link(ctx context.Context, jobID, companyID, roleID int) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO job_matches (job_id, company_id, role_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, jobID, companyID, roleID)
+	return err
+}
+
+func (r postgresJobs) CrawlStatuses(ctx context.Context, userID int) ([]models.CrawlStatus, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT c.name, ro.name, cs.last_refreshed_at, cs.last_attempted_at, COALESCE(cs.last_error, '')
+		FROM subscriptions s
+		JOIN companies c ON c.id = s.company_id
+		JOIN roles ro ON ro.id = ANY(s.role_ids)
+		LEFT JOIN crawl_state cs ON cs.company_id = s.company_id AND cs.role_id = ro.id
+		WHERE s.user_id = $1 AND s.active = TRUE
+		ORDER BY c.name, ro.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statuses []models.CrawlStatus
+	for rows.Next() {
+		var status models.CrawlStatus
+		var lastRefreshed, lastAttempted sql.NullTime
+		if err := rows.Scan(&status.Company, &status.Role, &lastRefreshed, &lastAttempted, &status.LastError); err != nil {
+			return nil, err
+		}
+		if lastRefreshed.Valid {
+			status.LastRefreshed = &lastRefreshed.Time
+		}
+		if lastAttempted.Valid {
+			status.LastAttempted = &lastAttempted.Time
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, rows.Err()
+}
+
+func (r postgresJobs) ListForUser(ctx context.Context, userID int, now time.Time) ([]models.Job, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT j.id, j.fingerprint, j.title, j.company, j.location, j.remote, j.salary, j.posted_at,
+			j.valid_through, j.employment_type, j.url, j.apply_urls, j.description, j.sources, j.first_seen, j.last_seen
+		FROM subscriptions s
+		JOIN job_matches m ON m.company_id = s.company_id AND m.role_id = ANY(s.role_ids)
+		JOIN jobs j ON j.id = m.job_id
+		WHERE s.user_id = $1 AND s.active = TRUE AND (j.valid_through IS NULL OR j.valid_through > $2)
+		ORDER BY j.first_seen DESC, j.id DESC`, userID, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.Job
+	for rows.Next() {
+		var job models.Job
+		var salary []byte
+		var postedAt, validThrough sql.NullTime
+		if err := rows.Scan(&job.ID, &job.Fingerprint, &job.Title, &job.Company, &job.Location, &job.Remote,
+			&salary, &postedAt, &validThrough, &job.EmploymentType, &job.URL, pq.Array(&job.ApplyURLs),
+			&job.Description, pq.Array(&job.Sources), &job.FirstSeen, &job.LastSeen); err != nil {
+			return nil, err
+		}
+		if len(salary) > 0 {
+			if err := json.Unmarshal(salary, &job.Salary); err != nil {
+				slog.Warn("Error decoding job salary", "job_id", job.ID, "err", err)
+			}
+		}
+		if postedAt.Valid {
+			job.PostedAt = &postedAt.Time
+		}
+		if validThrough.Valid {
+			job.ValidThrough = &validThrough.Time
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+type postgresCrawls struct{ db queryer }
+
+func (r postgresCrawls) Targets(ctx context.Context) ([]models.CrawlTarget, error) {
+	return r.targets(ctx, `
+		SELECT DISTINCT c.id, c.name, ro.id, ro.name
+		FROM subscriptions s
+		JOIN companies c ON c.id = s.company_id
+		JOIN roles ro ON ro.id = ANY(s.role_ids)
+		WHERE s.active = TRUE
+		ORDER BY c.id, ro.id`)
+}
+
+func (r postgresCrawls) NewTargets(ctx context.Context) ([]models.CrawlTarget, error) {
+	return r.targets(ctx, `
+		SELECT DISTINCT c.id, c.name, ro.id, ro.name
+		FROM subscriptions s
+		JOIN companies c ON c.id = s.company_id
+		JOIN roles ro ON ro.id = ANY(s.role_ids)
+		WHERE s.active = TRUE AND NOT EXISTS (
+			SELECT 1 FROM crawl_state cs WHERE cs.company_id = c.id AND cs.role_id = ro.id
+		)
+		ORDER BY c.id, ro.id`)
+}
+
+func (r postgresCrawls) targets(ctx context.Context, query string) ([]models.CrawlTarget, error) {
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []models.CrawlTarget
+	for rows.Next() {
+		var target models.CrawlTarget
+		if err := rows.Scan(&target.CompanyID, &target.CompanyName, &target.RoleID, &target.RoleName); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
+
+func (r postgresCrawls) Record(ctx context.Context, companyID, roleID int, attemptedAt time.Time, refreshedAt *time.Time, lastError string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO crawl_state (company_id, role_id, last_refreshed_at, last_attempted_at, last_error)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (company_id, role_id) DO UPDATE SET
+			last_refreshed_at = COALESCE(EXCLUDED.last_refreshed_at, crawl_state.last_refreshed_at),
+			last_attempted_at = EXCLUDED.last_attempted_at,
+			last_error = EXCLUDED.last_error`,
+		companyID, roleID, refreshedAt, attemptedAt, lastError)
+	return err
+}
+
+type postgresDigests struct{ db queryer }
+
+func (r postgresDigests) Recipients(ctx context.Context) ([]models.DigestRecipient, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.name, u.email, u.created_at, u.timezone, u.send_hour
+		FROM users u
+		WHERE u.verified_at IS NOT NULL AND EXISTS (
+			SELECT 1 FROM subscriptions s
+			WHERE s.user_id = u.id AND s.active = TRUE AND s.frequency <> 'off'
+		)
+		ORDER BY u.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []models.DigestRecipient
+	for rows.Next() {
+		var recipient models.DigestRecipient
+		var createdAt time.Time
+		if err := rows.Scan(&recipient.UserID, &recipient.Name, &recipient.Email, &createdAt,
+			&recipient.Timezone, &recipient.SendHour); err != nil {
+			return nil, err
+		}
+		recipient.Since = createdAt.UTC()
+		recipients = append(recipients, recipient)
+	}
+	return recipients, rows.Err()
+}
+
+func (r postgresDigests) Jobs(ctx context.Context, userID int, since time.Time, cutoffs models.DigestCutoffs) ([]models.Job, error) {
+	now := time.Now().UTC()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT j.id, j.title, j.company, j.location, j.remote, j.salary, j.posted_at, j.url, j.first_seen
+		FROM subscriptions s
+		JOIN job_matches m ON m.company_id = s.company_id AND m.role_id = ANY(s.role_ids)
+		JOIN jobs j ON j.id = m.job_id
+		WHERE s.user_id = $1 AND s.active = TRUE
+			AND j.first_seen > $2
+			AND j.first_seen <= CASE s.frequency WHEN 'instant' THEN $4::timestamp WHEN 'daily' THEN $5::timestamp WHEN 'weekly' THEN $6::timestamp END
+			AND (j.valid_through IS NULL OR j.valid_through > $3)
+			AND NOT EXISTS (SELECT 1 FROM digest_jobs dj WHERE dj.user_id = $1 AND dj.job_id = j.id)
+		ORDER BY j.company, j.first_seen DESC, j.id`,
+		userID, since.UTC(), now, cutoffs.Instant.UTC(), cutoffs.Daily.UTC(), cutoffs.Weekly.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.Job
+	for rows.Next() {
+		var job models.Job
+		var salary []byte
+		var postedAt sql.NullTime
+		if err := rows.Scan(&job.ID, &job.Title, &job.Company, &job.Location, &job.Remote, &salary, &postedAt,
+			&job.URL, &job.FirstSeen); err != nil {
+			return nil, err
+		}
+		if len(salary) > 0 {
+			if err := json.Unmarshal(salary, &job.Salary); err != nil {
+				return nil, err
+			}
+		}
+		if postedAt.Valid {
+			job.PostedAt = &postedAt.Time
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (r postgresDigests) Record(ctx context.Context, userID int, jobIDs []int, sentAt time.Time) error {
+	var digestID int
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO digests (user_id, sent_at, job_count)
+		VALUES ($1, $2, $3)
+		RETURNING id`, userID, sentAt.UTC(), len(jobIDs)).Scan(&digestID); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO digest_jobs (digest_id, user_id, job_id)
+		SELECT $1, $2, unnest($3::int[])
+		ON CONFLICT DO NOTHING`, digestID, userID, pq.Array(int64s(jobIDs)))
+	return err
+}
+
+// int64s converts IDs for pq.Array, which only handles int64 slices.
+func int64s(ids []int) []int64 {
+	out := make([]int64, len(ids))
+	for i, id := range ids {
+		out[i] = int64(id)
+	}
+	return out
+}
+
+func ints(ids []int64) []int {
+	out := make([]int, len(ids))
+	for i, id := range ids {
+		out[i] = int(id)
+	}
+	return out
+}
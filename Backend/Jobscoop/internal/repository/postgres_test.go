@@ -0,0 +1,505 @@
+package repository
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresUsersCreate(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	users := NewPostgres(mockDB).Users
+	createdAt := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`INSERT INTO users \(name, email, password\)`).
+		WithArgs("Test User", "test@example.com", "hash").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "timezone", "send_hour"}).
+			AddRow(3, createdAt, "UTC", 8))
+	user := models.User{Name: "Test User", Email: "test@example.com", PasswordHash: "hash"}
+	require.NoError(t, users.Create(context.Background(), &user))
+	assert.Equal(t, models.User{ID: 3, Name: "Test User", Email: "test@example.com", PasswordHash: "hash",
+		CreatedAt: createdAt, Timezone: "UTC", SendHour: 8}, user)
+
+	// A second signup with the same email conflicts
+	mock.ExpectQuery(`INSERT INTO users`).
+		WillReturnError(&pq.Error{Code: "23505"})
+	assert.ErrorIs(t, users.Create(context.Background(), &user), ErrConflict)
+
+	// Unknown users are reported as not found
+	mock.ExpectQuery(`SELECT id, name, email, password, created_at, timezone, send_hour, verified_at, totp_secret, totp_enabled_at FROM users WHERE email = \$1`).
+		WithArgs("nobody@example.com").
+		WillReturnError(sql.ErrNoRows)
+	_, err = users.GetByEmail(context.Background(), "nobody@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresSubscriptions(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	subscriptions := NewPostgres(mockDB).Subscriptions
+	interest := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`INSERT INTO subscriptions`).
+		WithArgs(1, 2, pq.Array([]int64{5}), pq.Array([]int64{7, 8}), true, "daily", interest).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+	sub := models.Subscription{UserID: 1, CompanyID: 2, CareerSiteIDs: []int{5}, RoleIDs: []int{7, 8},
+		Active: true, Frequency: "daily", InterestTime: interest}
+	require.NoError(t, subscriptions.Create(context.Background(), &sub))
+	assert.Equal(t, 11, sub.ID)
+
+	mock.ExpectQuery(`SELECT id, user_id, company_id, career_site_ids, role_ids, active, frequency, interest_time FROM subscriptions`).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "company_id", "career_site_ids", "role_ids", "active", "frequency", "interest_time"}).
+			AddRow(11, 1, 2, "{5}", "{7,8}", true, "daily", nil))
+	got, err := subscriptions.Get(context.Background(), 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, models.Subscription{ID: 11, UserID: 1, CompanyID: 2, CareerSiteIDs: []int{5}, RoleIDs: []int{7, 8},
+		Active: true, Frequency: "daily"}, got)
+
+	mock.ExpectQuery(`FROM subscriptions`).
+		WithArgs(1, 3).
+		WillReturnError(sql.ErrNoRows)
+	_, err = subscriptions.Get(context.Background(), 1, 3)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	mock.ExpectQuery(`FROM subscriptions\s+WHERE id = \$1`).
+		WithArgs(12).
+		WillReturnError(sql.ErrNoRows)
+	_, err = subscriptions.GetByID(context.Background(), 12)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	mock.ExpectExec(`DELETE FROM subscriptions WHERE id = \$1`).
+		WithArgs(11).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, subscriptions.DeleteByID(context.Background(), 11))
+	mock.ExpectExec(`DELETE FROM subscriptions WHERE id = \$1`).
+		WithArgs(11).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, subscriptions.DeleteByID(context.Background(), 11), ErrNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresGetOrCreate(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	companies := NewPostgres(mockDB).Companies
+
+	// A new company is inserted
+	mock.ExpectQuery(`INSERT INTO companies \(name\) VALUES \(\$1\) ON CONFLICT \(name\) DO NOTHING RETURNING id`).
+		WithArgs("Acme").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	id, err := companies.GetOrCreate(context.Background(), "Acme")
+	require.NoError(t, err)
+	assert.Equal(t, 4, id)
+
+	// An existing one, perhaps inserted concurrently, is looked up instead
+	mock.ExpectQuery(`INSERT INTO companies`).
+		WithArgs("Acme").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT id FROM companies WHERE name = \$1`).
+		WithArgs("Acme").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	id, err = companies.GetOrCreate(context.Background(), "Acme")
+	require.NoError(t, err)
+	assert.Equal(t, 4, id)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresWithinTx(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	repos := NewPostgres(mockDB)
+
+	t.Run("Commits when fn succeeds", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO roles`).WithArgs("Engineer").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectCommit()
+
+		err := repos.WithinTx(context.Background(), func(tx Repositories) error {
+			_, err := tx.Roles.GetOrCreate(context.Background(), "Engineer")
+			return err
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rolls back when fn fails", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO roles`).WithArgs("Engineer").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(`INSERT INTO roles`).WithArgs("Analyst").
+			WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
+
+		err := repos.WithinTx(context.Background(), func(tx Repositories) error {
+			for _, role := range []string{"Engineer", "Analyst"} {
+				if _, err := tx.Roles.GetOrCreate(context.Background(), role); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		assert.ErrorIs(t, err, sql.ErrConnDone)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Nested calls join the transaction", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		err := repos.WithinTx(context.Background(), func(tx Repositories) error {
+			return tx.WithinTx(context.Background(), func(Repositories) error { return nil })
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPostgresSessions(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	sessions := NewPostgres(mockDB).Sessions
+	created := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+	expires := created.Add(30 * 24 * time.Hour)
+	now := created.Add(time.Hour)
+	columns := []string{"id", "user_id", "user_agent", "ip", "created_at", "last_used_at", "expires_at", "revoked_at"}
+
+	mock.ExpectQuery(`WITH session AS \(\s*INSERT INTO sessions`).
+		WithArgs(1, "curl/8.0", "203.0.113.7", created, created, expires, "hash-1").
+		WillReturnRows(sqlmock.NewRows([]string{"session_id"}).AddRow(4))
+	session := models.Session{UserID: 1, UserAgent: "curl/8.0", IP: "203.0.113.7",
+		CreatedAt: created, LastUsedAt: created, ExpiresAt: expires}
+	require.NoError(t, sessions.Create(context.Background(), &session, "hash-1"))
+	assert.Equal(t, 4, session.ID)
+
+	t.Run("Rotates an unused token", func(t *testing.T) {
+		mock.ExpectQuery(`UPDATE refresh_tokens SET rotated_at = \$1\s+WHERE token_hash = \$2 AND rotated_at IS NULL`).
+			WithArgs(now, "hash-1").
+			WillReturnRows(sqlmock.NewRows([]string{"session_id"}).AddRow(4))
+		mock.ExpectExec(`INSERT INTO refresh_tokens`).WithArgs("hash-2", 4, now).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`UPDATE sessions SET last_used_at = \$1`).WithArgs(now, 4).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(4, 1, "curl/8.0", "203.0.113.7", created, now, expires, nil))
+
+		rotated, err := sessions.Rotate(context.Background(), "hash-1", "hash-2", now)
+		require.NoError(t, err)
+		assert.Equal(t, now, rotated.LastUsedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reports a reused token with its session", func(t *testing.T) {
+		mock.ExpectQuery(`UPDATE refresh_tokens SET rotated_at`).WithArgs(now, "hash-1").
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(`SELECT session_id FROM refresh_tokens WHERE token_hash = \$1`).WithArgs("hash-1").
+			WillReturnRows(sqlmock.NewRows([]string{"session_id"}).AddRow(4))
+		mock.ExpectQuery(`SELECT id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at\s+FROM sessions`).
+			WithArgs(4).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(4, 1, "curl/8.0", "203.0.113.7", created, now, expires, nil))
+
+		reused, err := sessions.Rotate(context.Background(), "hash-1", "hash-3", now)
+		assert.ErrorIs(t, err, ErrTokenReused)
+		assert.Equal(t, 4, reused.ID)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Reports an unknown token as not found", func(t *testing.T) {
+		mock.ExpectQuery(`UPDATE refresh_tokens SET rotated_at`).WithArgs(now, "unknown").
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(`SELECT session_id FROM refresh_tokens`).WithArgs("unknown").
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := sessions.Rotate(context.Background(), "unknown", "hash-3", now)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Revoking a missing session is not found", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE sessions SET revoked_at = COALESCE\(revoked_at, \$1\) WHERE id = \$2`).WithArgs(now, 9).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		assert.ErrorIs(t, sessions.Revoke(context.Background(), 9, now), ErrNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPostgresResetTokens(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	users := NewPostgres(mockDB).Users
+	now := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	// A new code starts over, dropping the attempts and grant of the last
+	mock.ExpectExec(`INSERT INTO reset_tokens \(email, code_hash, expires_at\).*attempts = 0, grant_hash = NULL`).
+		WithArgs("test@example.com", "code-hash", now.Add(15*time.Minute)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, users.SaveResetToken(context.Background(),
+		models.ResetToken{Email: "test@example.com", CodeHash: "code-hash", ExpiresAt: now.Add(15 * time.Minute)}))
+
+	mock.ExpectQuery(`UPDATE reset_tokens SET attempts = attempts \+ 1`).WithArgs("test@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"attempts"}).AddRow(2))
+	attempts, err := users.CountResetAttempt(context.Background(), "test@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	mock.ExpectQuery(`SELECT code_hash, expires_at, attempts, grant_hash, grant_expires_at`).WithArgs("test@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"code_hash", "expires_at", "attempts", "grant_hash", "grant_expires_at"}).
+			AddRow("", now.Add(15*time.Minute), 2, "grant-hash", now.Add(10*time.Minute)))
+	token, err := users.GetResetToken(context.Background(), "test@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, models.ResetToken{Email: "test@example.com", ExpiresAt: now.Add(15 * time.Minute), Attempts: 2,
+		GrantHash: "grant-hash", GrantExpiresAt: now.Add(10 * time.Minute)}, token)
+
+	// A grant is used up by the reset; a second use finds nothing
+	mock.ExpectExec(`DELETE FROM reset_tokens\s+WHERE email = \$1 AND grant_hash = \$2 AND grant_expires_at > \$3`).
+		WithArgs("test@example.com", "grant-hash", now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, users.ConsumeResetGrant(context.Background(), "test@example.com", "grant-hash", now))
+	mock.ExpectExec(`DELETE FROM reset_tokens`).
+		WithArgs("test@example.com", "grant-hash", now).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, users.ConsumeResetGrant(context.Background(), "test@example.com", "grant-hash", now), ErrNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRecordLoginFailure(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	users := NewPostgres(mockDB).Users
+	lockedUntil := time.Date(2025, 4, 1, 9, 15, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`INSERT INTO login_failures .* ON CONFLICT \(user_id, ip\) DO UPDATE SET\s+failures = CASE WHEN login_failures.failures \+ 1 >= \$1 THEN 0`).
+		WithArgs(5, lockedUntil, 3, "203.0.113.7").
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	locked, err := users.RecordLoginFailure(context.Background(), 3, "203.0.113.7", 5, lockedUntil)
+	require.NoError(t, err)
+	assert.True(t, locked)
+
+	mock.ExpectQuery(`INSERT INTO login_failures`).WithArgs(5, lockedUntil, 99, "203.0.113.7").
+		WillReturnError(&pq.Error{Code: "23503"})
+	_, err = users.RecordLoginFailure(context.Background(), 99, "203.0.113.7", 5, lockedUntil)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Other addresses aren't locked out
+	mock.ExpectQuery(`SELECT locked_until FROM login_failures WHERE user_id = \$1 AND ip = \$2`).
+		WithArgs(3, "203.0.113.7").
+		WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(lockedUntil))
+	until, err := users.LockedUntil(context.Background(), 3, "203.0.113.7")
+	require.NoError(t, err)
+	assert.Equal(t, lockedUntil, until)
+
+	mock.ExpectQuery(`SELECT locked_until FROM login_failures`).
+		WithArgs(3, "198.51.100.1").
+		WillReturnError(sql.ErrNoRows)
+	until, err = users.LockedUntil(context.Background(), 3, "198.51.100.1")
+	require.NoError(t, err)
+	assert.True(t, until.IsZero())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresMarkVerified(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	users := NewPostgres(mockDB).Users
+	verifiedAt := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(`UPDATE users SET verified_at = COALESCE\(verified_at, \$1\)\s+WHERE id = \$2 AND email = \$3`).
+		WithArgs(verifiedAt, 3, "test@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, users.MarkVerified(context.Background(), 3, "test@example.com", verifiedAt))
+
+	// The link was mailed to an address the user no longer has
+	mock.ExpectExec(`UPDATE users SET verified_at`).
+		WithArgs(verifiedAt, 3, "old@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, users.MarkVerified(context.Background(), 3, "old@example.com", verifiedAt), ErrNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresTOTP(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	users := NewPostgres(mockDB).Users
+	usedAt := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	// A code's step is used once, and never after a later one
+	mock.ExpectExec(`UPDATE users SET totp_last_step = \$1\s+WHERE id = \$2 AND \(totp_last_step IS NULL OR totp_last_step < \$1\)`).
+		WithArgs(int64(1000), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	used, err := users.UseTOTPStep(context.Background(), 3, 1000)
+	require.NoError(t, err)
+	assert.True(t, used)
+
+	mock.ExpectExec(`UPDATE users SET totp_last_step`).
+		WithArgs(int64(1000), 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	used, err = users.UseTOTPStep(context.Background(), 3, 1000)
+	require.NoError(t, err)
+	assert.False(t, used)
+
+	mock.ExpectExec(`DELETE FROM recovery_codes WHERE user_id = \$1`).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec(`INSERT INTO recovery_codes \(user_id, code_hash\)\s+SELECT \$1, unnest\(\$2::text\[\]\)`).
+		WithArgs(3, pq.Array([]string{"hash1", "hash2"})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	require.NoError(t, users.ReplaceRecoveryCodes(context.Background(), 3, []string{"hash1", "hash2"}))
+
+	mock.ExpectExec(`UPDATE recovery_codes SET used_at = \$1\s+WHERE user_id = \$2 AND code_hash = \$3 AND used_at IS NULL`).
+		WithArgs(usedAt, 3, "hash1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, users.UseRecoveryCode(context.Background(), 3, "hash1", usedAt))
+
+	mock.ExpectExec(`UPDATE recovery_codes SET used_at`).
+		WithArgs(usedAt, 3, "hash1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, users.UseRecoveryCode(context.Background(), 3, "hash1", usedAt), ErrNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresIdentities(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	users := NewPostgres(mockDB).Users
+
+	mock.ExpectExec(`INSERT INTO user_identities \(provider, subject, user_id, email\) VALUES \(\$1, \$2, \$3, \$4\)`).
+		WithArgs("google", "sub-1", 3, "test@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, users.LinkIdentity(context.Background(), 3, "google", "sub-1", "test@example.com"))
+
+	// An identity signs in to one account only
+	mock.ExpectExec(`INSERT INTO user_identities`).
+		WithArgs("google", "sub-1", 4, "other@example.com").
+		WillReturnError(&pq.Error{Code: "23505"})
+	assert.ErrorIs(t, users.LinkIdentity(context.Background(), 4, "google", "sub-1", "other@example.com"), ErrConflict)
+
+	mock.ExpectQuery(`SELECT id, name, email, password, .* FROM users WHERE id = \(SELECT user_id FROM user_identities WHERE provider = \$1 AND subject = \$2\)`).
+		WithArgs("google", "sub-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "password", "created_at", "timezone", "send_hour",
+			"verified_at", "totp_secret", "totp_enabled_at"}).
+			AddRow(3, "Test User", "test@example.com", "", time.Time{}, "UTC", 8, nil, nil, nil))
+	user, err := users.GetByIdentity(context.Background(), "google", "sub-1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, user.ID)
+
+	mock.ExpectQuery(`FROM users WHERE id = \(SELECT user_id FROM user_identities`).
+		WithArgs("github", "42").
+		WillReturnError(sql.ErrNoRows)
+	_, err = users.GetByIdentity(context.Background(), "github", "42")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresJobsUpsert(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	jobs := NewPostgres(mockDB).Jobs
+
+	firstSeen := time.Date(2025, 4, 1, 9, 0, 0, 0, time.UTC)
+	lastSeen := time.Date(2025, 4, 2, 9, 0, 0, 0, time.UTC)
+
+	job := &models.Job{
+		Company:  "Acme",
+		Title:    "Software Engineer",
+		Location: "Remote",
+		URL:      "https://acme.com/jobs/42",
+		Remote:   true,
+		Salary:   &models.SalaryRange{Min: 150000, Max: 150000, Currency: "USD", Period: "year", Text: "$150k a year"},
+		Source:   "Indeed",
+		Raw:      json.RawMessage(`{"salary":"$150k a year"}`),
+	}
+	fingerprint := models.Fingerprint(job.Company, job.Title, job.Location, job.URL)
+
+	mock.ExpectQuery(`INSERT INTO jobs .* ON CONFLICT \(fingerprint\) DO UPDATE SET`).
+		WithArgs(fingerprint, "Acme", "Software Engineer", "Remote", true,
+			[]byte(`{"min":150000,"max":150000,"currency":"USD","period":"year","text":"$150k a year"}`),
+			nil, nil, "", "https://acme.com/jobs/42", pq.Array([]string{}), "", pq.Array([]string{"Indeed"}),
+			[]byte(`{"salary":"$150k a year"}`), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "sources", "first_seen", "last_seen"}).
+			AddRow(7, "{Indeed,LinkedIn}", firstSeen, lastSeen))
+
+	require.NoError(t, jobs.Upsert(context.Background(), job))
+	assert.Equal(t, 7, job.ID)
+	assert.Equal(t, fingerprint, job.Fingerprint)
+	assert.Equal(t, []string{"Indeed", "LinkedIn"}, job.Sources)
+	assert.Equal(t, firstSeen, job.FirstSeen)
+	assert.Equal(t, lastSeen, job.LastSeen)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresDigestsRecord(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	repos := NewPostgres(mockDB)
+
+	sentAt := time.Date(2025, 4, 2, 9, 0, 0, 0, time.UTC)
+	expectInserts := func() {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO digests`).
+			WithArgs(1, sentAt, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+		mock.ExpectExec(`INSERT INTO digest_jobs`).
+			WithArgs(5, 1, pq.Array([]int64{10, 11})).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+	}
+	record := func(send func() error) error {
+		return repos.WithinTx(context.Background(), func(tx Repositories) error {
+			if err := tx.Digests.Record(context.Background(), 1, []int{10, 11}, sentAt); err != nil {
+				return err
+			}
+			return send()
+		})
+	}
+
+	t.Run("Committed after sending", func(t *testing.T) {
+		expectInserts()
+		mock.ExpectCommit()
+
+		sent := false
+		assert.NoError(t, record(func() error {
+			sent = true
+			return nil
+		}))
+		assert.True(t, sent)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rolled back when sending fails", func(t *testing.T) {
+		expectInserts()
+		mock.ExpectRollback()
+
+		assert.EqualError(t, record(func() error { return errors.New("smtp down") }), "smtp down")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,255 @@
+// Package repository is how the HTTP handlers, the crawler and the
+// digester read and write users, subscriptions, jobs and what they refer
+// to. Each repository has a Postgres implementation for the server and an
+// in-memory one for tests.
+package repository
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested record doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a record would duplicate a unique key,
+	// such as a second user with the same email.
+	ErrConflict = errors.New("already exists")
+	// ErrTokenReused is returned when a refresh token that was already
+	// rotated is presented again, a sign it was stolen.
+	ErrTokenReused = errors.New("refresh token already used")
+)
+
+// UserRepository stores accounts, their alert settings, password reset
+// codes, second factors and the identities at other providers they sign in
+// with.
+type UserRepository interface {
+	// Create stores a new user, setting its ID, creation time and default
+	// alert settings. It returns ErrConflict if the email is taken.
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id int) (models.User, error)
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	UpdateName(ctx context.Context, id int, name string) error
+	UpdatePassword(ctx context.Context, email, passwordHash string) error
+	// UpdateAlertSettings stores the settings that aren't nil, leaving the
+	// others unchanged.
+	UpdateAlertSettings(ctx context.Context, id int, timezone *string, sendHour *int) error
+	// RecordLoginFailure counts a failed login of the user from the client
+	// address ip. The failure that makes maxFailures in a row from ip locks
+	// the account for ip until lockedUntil and starts the count over; it
+	// returns true.
+	RecordLoginFailure(ctx context.Context, id int, ip string, maxFailures int, lockedUntil time.Time) (bool, error)
+	// ResetLoginFailures starts the count of failed logins from ip over.
+	ResetLoginFailures(ctx context.Context, id int, ip string) error
+	// LockedUntil returns until when logins to the account from ip are
+	// refused, or the zero time if they aren't.
+	LockedUntil(ctx context.Context, id int, ip string) (time.Time, error)
+	// MarkVerified records that the user verified email at at, keeping the
+	// time of an earlier verification. It returns ErrNotFound if the user
+	// doesn't exist or no longer has that email.
+	MarkVerified(ctx context.Context, id int, email string, at time.Time) error
+
+	// SetTOTPSecret starts a TOTP enrollment with secret, replacing one
+	// not yet confirmed.
+	SetTOTPSecret(ctx context.Context, id int, secret string) error
+	// EnableTOTP turns on two-factor login with the user's secret at at.
+	EnableTOTP(ctx context.Context, id int, at time.Time) error
+	// DisableTOTP turns two-factor login off and forgets the secret.
+	DisableTOTP(ctx context.Context, id int) error
+	// UseTOTPStep records a login with the code of step. It returns false
+	// if that step, or a later one, was already used, so each code works
+	// once.
+	UseTOTPStep(ctx context.Context, id int, step int64) (bool, error)
+	// ReplaceRecoveryCodes replaces the user's recovery codes with those
+	// hashed as codeHashes.
+	ReplaceRecoveryCodes(ctx context.Context, id int, codeHashes []string) error
+	// UseRecoveryCode marks the user's unused recovery code hashed as
+	// codeHash as used at at, returning ErrNotFound if there is none.
+	UseRecoveryCode(ctx context.Context, id int, codeHash string, at time.Time) error
+
+	// GetByIdentity returns the user who signs in as subject at the
+	// provider, returning ErrNotFound if no one does.
+	GetByIdentity(ctx context.Context, provider, subject string) (models.User, error)
+	// LinkIdentity lets the user sign in as subject at the provider, which
+	// vouched for email. It returns ErrConflict if the identity is already
+	// linked.
+	LinkIdentity(ctx context.Context, id int, provider, subject, email string) error
+
+	// SaveResetToken replaces any reset previously requested for the email,
+	// with its attempts and grant.
+	SaveResetToken(ctx context.Context, token models.ResetToken) error
+	GetResetToken(ctx context.Context, email string) (models.ResetToken, error)
+	// CountResetAttempt records an attempt at the email's reset code and
+	// returns the attempts made, this one included.
+	CountResetAttempt(ctx context.Context, email string) (int, error)
+	// GrantReset clears the email's reset code, so it can't be used again,
+	// and stores the hash of the grant that replaces it.
+	GrantReset(ctx context.Context, email, grantHash string, expiresAt time.Time) error
+	// ConsumeResetGrant deletes the email's reset if grantHash is its grant
+	// and hasn't expired at now, and returns ErrNotFound otherwise.
+	ConsumeResetGrant(ctx context.Context, email, grantHash string, now time.Time) error
+}
+
+// SessionRepository stores users' login sessions and their refresh tokens,
+// which are only ever handled as hashes.
+type SessionRepository interface {
+	// Create stores a new session, setting its ID, with tokenHash as its
+	// first refresh token.
+	Create(ctx context.Context, session *models.Session, tokenHash string) error
+	Get(ctx context.Context, id int) (models.Session, error)
+	// Rotate replaces the refresh token tokenHash with newHash at now and
+	// returns its session, whatever its state. It returns ErrNotFound for
+	// unknown tokens and, along with the session, ErrTokenReused for tokens
+	// already rotated.
+	Rotate(ctx context.Context, tokenHash, newHash string, now time.Time) (models.Session, error)
+	// ListActive returns the user's sessions active at now, most recently
+	// used first.
+	ListActive(ctx context.Context, userID int, now time.Time) ([]models.Session, error)
+	// Revoke ends the session at now, returning ErrNotFound if there is
+	// none. Revoking a revoked session keeps its first revocation time.
+	Revoke(ctx context.Context, id int, now time.Time) error
+	// RevokeAll ends every active session of the user at now.
+	RevokeAll(ctx context.Context, userID int, now time.Time) error
+}
+
+// SubscriptionRepository stores users' subscriptions; a user has at most one
+// per company.
+type SubscriptionRepository interface {
+	// ListByUser returns the user's subscriptions in the order they were
+	// created.
+	ListByUser(ctx context.Context, userID int) ([]models.Subscription, error)
+	Get(ctx context.Context, userID, companyID int) (models.Subscription, error)
+	GetByID(ctx context.Context, id int) (models.Subscription, error)
+	// Create stores a new subscription and sets its ID. It returns
+	// ErrConflict if the user already follows the company.
+	Create(ctx context.Context, sub *models.Subscription) error
+	// Update overwrites the career sites, roles, active flag, frequency and
+	// interest time of the subscription with sub's ID.
+	Update(ctx context.Context, sub models.Subscription) error
+	// Delete removes the user's subscription to the company, reporting
+	// whether there was one.
+	Delete(ctx context.Context, userID, companyID int) (bool, error)
+	// DeleteByID removes the subscription with the ID, returning ErrNotFound
+	// if there is none.
+	DeleteByID(ctx context.Context, id int) error
+
+	// RoleCounts returns, for every company and role followed, how many of
+	// the company's subscriptions include the role.
+	RoleCounts(ctx context.Context) ([]models.SubscriptionRoleCount, error)
+	// Summaries returns every subscription that follows at least one role,
+	// ordered by user name and most recent interest first.
+	Summaries(ctx context.Context) ([]models.SubscriptionSummary, error)
+}
+
+// CompanyRepository stores the companies users can follow. Names are unique.
+type CompanyRepository interface {
+	GetOrCreate(ctx context.Context, name string) (int, error)
+	GetByID(ctx context.Context, id int) (models.Company, error)
+	GetByName(ctx context.Context, name string) (models.Company, error)
+	List(ctx context.Context) ([]models.Company, error)
+}
+
+// RoleRepository stores the roles users can follow. Names are unique.
+type RoleRepository interface {
+	GetOrCreate(ctx context.Context, name string) (int, error)
+	GetByID(ctx context.Context, id int) (models.Role, error)
+	List(ctx context.Context) ([]models.Role, error)
+}
+
+// CareerSiteRepository stores companies' careers pages. Links are unique.
+type CareerSiteRepository interface {
+	// GetOrCreate returns the ID of the career site with link, creating it
+	// for the company if it doesn't exist yet.
+	GetOrCreate(ctx context.Context, companyID int, link string) (int, error)
+	GetByID(ctx context.Context, id int) (models.CareerSite, error)
+	ListByCompany(ctx context.Context, companyID int) ([]models.CareerSite, error)
+	// ActiveLinks returns the links of the career sites that active
+	// subscriptions to the named company follow, in order.
+	ActiveLinks(ctx context.Context, companyName string) ([]string, error)
+}
+
+// JobRepository stores the jobs the crawler finds and reads them back for
+// users' subscriptions.
+type JobRepository interface {
+	// Upsert inserts the job or, if a job with the same fingerprint exists,
+	// bumps its last_seen, merges its sources and apply links and fills in
+	// any details it was missing. The job's ID, fingerprint, sources and
+	// timestamps are updated from the stored job.
+	Upsert(ctx context.Context, job *models.Job) error
+	// Link records that the job was found for the company and role.
+	Link(ctx context.Context, jobID, companyID, roleID int) error
+	// CrawlStatuses returns how fresh each (company, role) pair of the
+	// user's active subscriptions is, ordered by company and role.
+	CrawlStatuses(ctx context.Context, userID int) ([]models.CrawlStatus, error)
+	// ListForUser returns the jobs found for the user's active subscriptions
+	// that are still open at now, newest first.
+	ListForUser(ctx context.Context, userID int, now time.Time) ([]models.Job, error)
+}
+
+// CrawlRepository stores which (company, role) pairs the crawler searches
+// and how each crawl went.
+type CrawlRepository interface {
+	// Targets returns every distinct pair followed by at least one active
+	// subscription, however many users share it, by company and role ID.
+	Targets(ctx context.Context) ([]models.CrawlTarget, error)
+	// NewTargets returns the Targets never crawled, whether or not a source
+	// answered.
+	NewTargets(ctx context.Context) ([]models.CrawlTarget, error)
+	// Record stores the outcome of crawling a pair. refreshedAt is nil when
+	// every source failed, which keeps the previous refresh time; lastError
+	// is empty when every source succeeded.
+	Record(ctx context.Context, companyID, roleID int, attemptedAt time.Time, refreshedAt *time.Time, lastError string) error
+}
+
+// DigestRepository finds the jobs due to be mailed to users and records
+// the digests sent.
+type DigestRepository interface {
+	// Recipients returns every user with a verified email and at least one
+	// active subscription that isn't turned off, by ID.
+	Recipients(ctx context.Context) ([]models.DigestRecipient, error)
+	// Jobs returns the open jobs matching the user's active subscriptions
+	// that were first seen after since and by the cutoff for the
+	// subscription's frequency, and haven't been mailed to the user yet,
+	// grouped by company.
+	Jobs(ctx context.Context, userID int, since time.Time, cutoffs models.DigestCutoffs) ([]models.Job, error)
+	// Record records that jobIDs were mailed to the user at sentAt, so they
+	// are never mailed again. Record it in the transaction that sends the
+	// digest, so it only sticks if the digest went out.
+	Record(ctx context.Context, userID int, jobIDs []int, sentAt time.Time) error
+}
+
+// Repositories is the set of repositories the handlers and background jobs
+// are built from.
+type Repositories struct {
+	Users         UserRepository
+	Sessions      SessionRepository
+	Subscriptions SubscriptionRepository
+	Companies     CompanyRepository
+	Roles         RoleRepository
+	CareerSites   CareerSiteRepository
+	Jobs          JobRepository
+	Crawls        CrawlRepository
+	Digests       DigestRepository
+
+	withinTx func(ctx context.Context, fn func(Repositories) error) error
+}
+
+// Transactor runs a unit of work atomically.
+type Transactor interface {
+	// WithinTx runs fn with repositories whose reads and writes share one
+	// transaction, committed if fn returns nil and rolled back otherwise.
+	// fn's error is returned as is. Calls made inside fn join the
+	// transaction already open.
+	WithinTx(ctx context.Context, fn func(Repositories) error) error
+}
+
+// WithinTx implements Transactor. Repositories assembled by hand rather
+// than by NewPostgres or Memory run fn without a transaction.
+func (r Repositories) WithinTx(ctx context.Context, fn func(Repositories) error) error {
+	if r.withinTx == nil {
+		return fn(r)
+	}
+	return r.withinTx(ctx, fn)
+}
@@ -0,0 +1,244 @@
+// Package crawler refreshes the stored jobs for every subscribed (company,
+// role) pair on a schedule, so page loads read from the jobs table instead of
+// calling the job boards.
+package crawler
+
+import (
+	"JobScoop/internal/metrics"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
+	"JobScoop/internal/services/jobsource"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often the subscribed pairs are crawled unless
+// configured otherwise.
+const DefaultInterval = 6 * time.Hour
+
+// Crawler periodically searches every source for each distinct subscribed
+// (company, role) pair and stores the matching postings in Repos, one
+// transaction per pair.
+type Crawler struct {
+	Fetcher  *jobsource.Fetcher
+	Repos    repository.Repositories
+	Interval time.Duration
+
+	mu          sync.Mutex
+	cancel      context.CancelFunc
+	done        chan struct{}
+	refresh     chan struct{}
+	startedAt   time.Time
+	lastSuccess time.Time
+}
+
+// Status describes a crawler's schedule for health checks.
+type Status struct {
+	Running     bool
+	StartedAt   time.Time // when the crawler was last started
+	LastSuccess time.Time // when a scheduled crawl last stored every pair; zero if none has
+}
+
+// New returns a crawler storing into repos every interval, or every
+// DefaultInterval when interval is zero.
+func New(fetcher *jobsource.Fetcher, repos repository.Repositories, interval time.Duration) *Crawler {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Crawler{Fetcher: fetcher, Repos: repos, Interval: interval}
+}
+
+// Start crawls immediately and then every Interval until Stop is called.
+// Starting a running crawler does nothing.
+func (c *Crawler) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	c.refresh = make(chan struct{}, 1)
+	c.startedAt = time.Now()
+	go c.loop(ctx, c.done, c.refresh)
+}
+
+// Status reports whether the crawler is running and when it last crawled
+// successfully.
+func (c *Crawler) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Status{Running: c.cancel != nil, StartedAt: c.startedAt, LastSuccess: c.lastSuccess}
+}
+
+// Stop cancels any crawl in progress and waits for it to wind down, giving
+// up when ctx is done.
+func (c *Crawler) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	cancel, done := c.cancel, c.done
+	c.cancel, c.done, c.refresh = nil, nil, nil
+	c.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Refresh asks a running crawler to crawl the pairs it has never tried as
+// soon as it is idle, e.g. when a user follows a new pair. Requests made
+// while one is already pending are dropped.
+func (c *Crawler) Refresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refresh == nil {
+		return
+	}
+	select {
+	case c.refresh <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Crawler) loop(ctx context.Context, done chan<- struct{}, refresh <-chan struct{}) {
+	defer close(done)
+
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	crawl, scheduled := c.RunOnce, true
+	for {
+		err := crawl(ctx)
+		switch {
+		case err == nil && scheduled:
+			c.mu.Lock()
+			c.lastSuccess = time.Now()
+			c.mu.Unlock()
+		case err != nil && ctx.Err() == nil:
+			slog.Error("Crawl failed", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			crawl, scheduled = c.RunOnce, true
+		case <-refresh:
+			crawl, scheduled = c.RunNew, false
+		}
+	}
+}
+
+// RunOnce crawls every active (company, role) pair a single time, storing
+// the matching postings and each pair's refresh outcome. It fails if any
+// pair couldn't be stored.
+func (c *Crawler) RunOnce(ctx context.Context) error {
+	return c.crawl(ctx, c.Repos.Crawls.Targets)
+}
+
+// RunNew crawls the active pairs never crawled before, as RunOnce does.
+func (c *Crawler) RunNew(ctx context.Context) error {
+	return c.crawl(ctx, c.Repos.Crawls.NewTargets)
+}
+
+func (c *Crawler) crawl(ctx context.Context, load func(context.Context) ([]models.CrawlTarget, error)) error {
+	targets, err := load(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading crawl targets: %w", err)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	queries := make([]jobsource.Query, len(targets))
+	for i, target := range targets {
+		queries[i] = jobsource.Query{Company: target.CompanyName, Role: target.RoleName}
+	}
+	results := c.Fetcher.Fetch(ctx, queries)
+
+	// Group the per-source results by the pair they were searched for
+	byQuery := make(map[jobsource.Query][]jobsource.Result)
+	for _, result := range results {
+		query := jobsource.Query{Company: result.Company, Role: result.Role}
+		byQuery[query] = append(byQuery[query], result)
+	}
+
+	stored := 0
+	var errs []error
+	for i, target := range targets {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		n, err := c.storeTarget(ctx, target, byQuery[queries[i]])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error storing %s / %s: %w", target.CompanyName, target.RoleName, err))
+		}
+		stored += n
+	}
+
+	slog.Info("Crawl finished", "pairs", len(targets), "jobs_stored", stored, "pairs_failed", len(errs))
+	return errors.Join(errs...)
+}
+
+// storeTarget saves one pair's postings and records whether any source
+// answered, all or nothing. A pair counts as refreshed when at least one
+// source succeeded. Only the failed sources and how they failed are
+// recorded: upstream errors can embed request URLs and API keys, and the
+// fetcher has already logged them redacted.
+func (c *Crawler) storeTarget(ctx context.Context, target models.CrawlTarget, results []jobsource.Result) (int, error) {
+	now := time.Now().UTC()
+	var refreshedAt *time.Time
+	var failures []string
+	var jobs []models.Job
+
+	for _, result := range results {
+		if result.Err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", result.Source, result.Status))
+			continue
+		}
+		refreshedAt = &now
+		jobs = append(jobs, jobsource.FilterJobs(result.Jobs, target.CompanyName, target.RoleName)...)
+	}
+
+	var stored, deduped int
+	err := c.Repos.WithinTx(ctx, func(repos repository.Repositories) error {
+		stored, deduped = 0, 0
+		for _, job := range jobs {
+			if err := repos.Jobs.Upsert(ctx, &job); err != nil {
+				return err
+			}
+			// A posting merged into an existing row keeps that row's first_seen
+			if job.FirstSeen.Before(job.LastSeen) {
+				deduped++
+			}
+			if err := repos.Jobs.Link(ctx, job.ID, target.CompanyID, target.RoleID); err != nil {
+				return err
+			}
+			stored++
+		}
+		return repos.Crawls.Record(ctx, target.CompanyID, target.RoleID, now, refreshedAt, strings.Join(failures, "; "))
+	})
+	if err != nil {
+		return 0, err
+	}
+	metrics.JobsStored.Add(float64(stored - deduped))
+	metrics.JobsDeduped.Add(float64(deduped))
+	return stored, nil
+}
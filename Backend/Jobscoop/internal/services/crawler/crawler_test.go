@@ -0,0 +1,217 @@
+package crawler
+
+import (
+	"JobScoop/internal/metrics"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
+	"JobScoop/internal/services/jobsource"
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource is a JobSource returning canned postings, counting its searches
+type fakeSource struct {
+	name     string
+	jobs     []models.Job
+	err      error
+	mu       sync.Mutex
+	searches []string
+}
+
+func (f *fakeSource) Name() string { return f.name }
+
+func (f *fakeSource) Search(ctx context.Context, company, role string, opts jobsource.Options) ([]models.Job, error) {
+	f.mu.Lock()
+	f.searches = append(f.searches, company+"/"+role)
+	f.mu.Unlock()
+	return f.jobs, f.err
+}
+
+func (f *fakeSource) searchCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.searches)
+}
+
+// subscribe stores a new user's active subscription to the company for the
+// roles, returning the user's ID
+func subscribe(t *testing.T, repos repository.Repositories, email, company string, roles ...string) int {
+	t.Helper()
+	ctx := context.Background()
+	user := models.User{Name: "Test User", Email: email}
+	require.NoError(t, repos.Users.Create(ctx, &user))
+	companyID, err := repos.Companies.GetOrCreate(ctx, company)
+	require.NoError(t, err)
+
+	sub := models.Subscription{UserID: user.ID, CompanyID: companyID, Active: true, Frequency: models.FrequencyDaily}
+	for _, role := range roles {
+		roleID, err := repos.Roles.GetOrCreate(ctx, role)
+		require.NoError(t, err)
+		sub.RoleIDs = append(sub.RoleIDs, roleID)
+	}
+	require.NoError(t, repos.Subscriptions.Create(ctx, &sub))
+	return user.ID
+}
+
+// failingCrawls fails to record any crawl
+type failingCrawls struct {
+	repository.CrawlRepository
+	err error
+}
+
+func (f failingCrawls) Record(ctx context.Context, companyID, roleID int, attemptedAt time.Time, refreshedAt *time.Time, lastError string) error {
+	return f.err
+}
+
+func TestRunOnce(t *testing.T) {
+	linkedin := &fakeSource{name: "linkedin", jobs: []models.Job{
+		{Title: "Software Engineer", Company: "Acme", Location: "Austin, TX", URL: "https://www.acme.com/jobs/42?utm_source=linkedin", Source: "LinkedIn"},
+		{Title: "Data Scientist", Company: "Acme", Location: "Remote", URL: "https://acme.com/jobs/7", Source: "LinkedIn"},
+		{Title: "Software Engineer", Company: "Globex", URL: "https://globex.com/jobs/1", Source: "LinkedIn"},
+	}}
+	indeed := &fakeSource{name: "indeed", jobs: []models.Job{
+		// The same posting with different tracking params
+		{Title: "Software  Engineer", Company: "acme", Location: "Austin, TX", URL: "https://acme.com/jobs/42/", Source: "Indeed"},
+	}}
+	google := &fakeSource{name: "google", err: errors.New("quota exceeded")}
+
+	registry := jobsource.NewRegistry()
+	registry.Register(linkedin)
+	registry.Register(indeed)
+	registry.Register(google)
+
+	repos := repository.NewMemory().Repositories()
+	userID := subscribe(t, repos, "test@example.com", "Acme", "Software Engineer", "Data Scientist")
+	c := New(&jobsource.Fetcher{Registry: registry}, repos, 0)
+	storedBefore, dedupedBefore := testutil.ToFloat64(metrics.JobsStored), testutil.ToFloat64(metrics.JobsDeduped)
+
+	assert.NoError(t, c.RunOnce(context.Background()))
+
+	// Each pair is searched once per source
+	assert.Equal(t, 2, linkedin.searchCount())
+	assert.Equal(t, 2, indeed.searchCount())
+
+	// Only matching postings are stored, duplicates collapsed into one row
+	jobs, err := repos.Jobs.ListForUser(context.Background(), userID, time.Now())
+	require.NoError(t, err)
+	require.Len(t, jobs, 2, "Duplicate postings should be stored once")
+	sources := map[string][]string{}
+	for _, job := range jobs {
+		sources[job.Title] = job.Sources
+	}
+	assert.Equal(t, map[string][]string{"Software Engineer": {"Indeed", "LinkedIn"}, "Data Scientist": {"LinkedIn"}}, sources)
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.JobsStored)-storedBefore)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.JobsDeduped)-dedupedBefore)
+
+	// A failing source is recorded without holding back the refresh
+	statuses, err := repos.Jobs.CrawlStatuses(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	for _, status := range statuses {
+		assert.NotNil(t, status.LastRefreshed)
+		assert.Equal(t, "google: error", status.LastError)
+	}
+}
+
+func TestRunOnceAllSourcesFail(t *testing.T) {
+	registry := jobsource.NewRegistry()
+	// Upstream errors carry the request URL, API key included
+	registry.Register(&fakeSource{name: "linkedin", err: &url.Error{
+		Op:  "Get",
+		URL: "https://api.scrapingdog.com/linkedinjobs?api_key=secret-key",
+		Err: context.DeadlineExceeded,
+	}})
+
+	repos := repository.NewMemory().Repositories()
+	userID := subscribe(t, repos, "test@example.com", "Acme", "Software Engineer")
+	c := New(&jobsource.Fetcher{Registry: registry}, repos, 0)
+
+	assert.NoError(t, c.RunOnce(context.Background()))
+
+	statuses, err := repos.Jobs.CrawlStatuses(context.Background(), userID)
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Nil(t, statuses[0].LastRefreshed, "A pair no source answered for is not refreshed")
+	assert.NotNil(t, statuses[0].LastAttempted)
+	assert.Equal(t, "linkedin: timeout", statuses[0].LastError)
+	assert.NotContains(t, statuses[0].LastError, "secret-key")
+
+	// It has been tried, so it is no longer new
+	targets, err := repos.Crawls.NewTargets(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, targets)
+}
+
+func TestRunOnceStoreFails(t *testing.T) {
+	registry := jobsource.NewRegistry()
+	registry.Register(&fakeSource{name: "linkedin", jobs: []models.Job{
+		{Title: "Software Engineer", Company: "Acme", URL: "https://acme.com/jobs/42", Source: "LinkedIn"},
+	}})
+
+	store := repository.NewMemory().Repositories()
+	subscribe(t, store, "test@example.com", "Acme", "Software Engineer", "Data Scientist")
+	repos := repository.Repositories{
+		Jobs:   store.Jobs,
+		Crawls: failingCrawls{CrawlRepository: store.Crawls, err: errors.New("connection refused")},
+	}
+	c := New(&jobsource.Fetcher{Registry: registry}, repos, time.Hour)
+
+	err := c.RunOnce(context.Background())
+	assert.ErrorContains(t, err, "Acme / Software Engineer: connection refused")
+	assert.ErrorContains(t, err, "Acme / Data Scientist: connection refused")
+
+	// A crawl that stored nothing doesn't count as a success
+	c.Start()
+	defer c.Stop(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, c.Status().LastSuccess.IsZero())
+}
+
+func TestStartStop(t *testing.T) {
+	source := &fakeSource{name: "linkedin"}
+	registry := jobsource.NewRegistry()
+	registry.Register(source)
+
+	repos := repository.NewMemory().Repositories()
+	subscribe(t, repos, "test@example.com", "Acme", "Software Engineer")
+	c := New(&jobsource.Fetcher{Registry: registry}, repos, time.Hour)
+
+	assert.False(t, c.Status().Running)
+	c.Start()
+	c.Start() // already running
+	assert.True(t, c.Status().Running)
+
+	// Crawls right away, then new pairs on request without waiting for the
+	// interval
+	assert.Eventually(t, func() bool { return source.searchCount() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return !c.Status().LastSuccess.IsZero() }, time.Second, 5*time.Millisecond)
+	subscribe(t, repos, "other@example.com", "Globex", "Software Engineer")
+	c.Refresh()
+	assert.Eventually(t, func() bool { return source.searchCount() == 2 }, time.Second, 5*time.Millisecond)
+	source.mu.Lock()
+	assert.Equal(t, "Globex/Software Engineer", source.searches[1], "Pairs already crawled wait for the schedule")
+	source.mu.Unlock()
+
+	// Nothing is searched when every pair has been tried
+	c.Refresh()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 2, source.searchCount())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, c.Stop(ctx))
+	assert.NoError(t, c.Stop(ctx), "Stopping a stopped crawler is a no-op")
+	assert.False(t, c.Status().Running)
+
+	c.Refresh() // ignored once stopped
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 2, source.searchCount())
+}
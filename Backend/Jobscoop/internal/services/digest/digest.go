@@ -0,0 +1,305 @@
+// Package digest emails each user the jobs found for their subscriptions
+// since their last digest.
+package digest
+
+import (
+	"JobScoop/internal/metrics"
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
+	"JobScoop/internal/services/mail"
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// DefaultInterval is how often the digester checks for due digests unless
+// configured otherwise. It bounds how late an instant alert or a
+// digest at the user's send hour can be.
+const DefaultInterval = 15 * time.Minute
+
+//go:embed templates/digest.html templates/digest.txt
+var templateFS embed.FS
+
+var templateFuncs = map[string]interface{}{"salary": formatSalary}
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("digest.html").Funcs(templateFuncs).ParseFS(templateFS, "templates/digest.html"))
+	textTemplate = texttemplate.Must(texttemplate.New("digest.txt").Funcs(templateFuncs).ParseFS(templateFS, "templates/digest.txt"))
+)
+
+// Digester periodically mails every user with active subscriptions the jobs
+// found for them that are due according to each subscription's frequency
+// and the user's timezone and send hour.
+type Digester struct {
+	Repos    repository.Repositories
+	Sender   mail.Sender
+	Interval time.Duration
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New returns a digester mailing the jobs in repos through sender that
+// checks for due digests every interval, or every DefaultInterval when
+// interval is zero.
+func New(repos repository.Repositories, sender mail.Sender, interval time.Duration) *Digester {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Digester{Repos: repos, Sender: sender, Interval: interval}
+}
+
+// Start sends digests immediately and then every Interval until Stop is
+// called. Starting a running digester does nothing.
+func (d *Digester) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.done = make(chan struct{})
+	go d.loop(ctx, d.done)
+}
+
+// Running reports whether the digester has been started and not stopped.
+func (d *Digester) Running() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel != nil
+}
+
+// Stop stops the digester after the digest being sent, if any, giving up
+// waiting when ctx is done.
+func (d *Digester) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	cancel, done := d.cancel, d.done
+	d.cancel, d.done = nil, nil
+	d.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Digester) loop(ctx context.Context, done chan<- struct{}) {
+	defer close(done)
+
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Sending digests failed", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce sends a digest to every user with jobs due and returns how many
+// were sent. A failure for one user is logged and doesn't stop the rest.
+func (d *Digester) RunOnce(ctx context.Context) (int, error) {
+	recipients, err := d.Repos.Digests.Recipients(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error loading digest recipients: %w", err)
+	}
+
+	sent := 0
+	for _, recipient := range recipients {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+
+		ok, err := d.send(ctx, recipient, time.Now())
+		if err != nil {
+			slog.Error("Error sending digest", "user_id", recipient.UserID, "err", err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// send mails the recipient's jobs due at now, reporting false when there
+// were none. The digest is recorded in the transaction it is sent in, so
+// it is only recorded if sending succeeds and a job recorded for the user
+// is never sent again.
+func (d *Digester) send(ctx context.Context, recipient models.DigestRecipient, now time.Time) (bool, error) {
+	cutoffs := Cutoffs(now, recipient.Timezone, recipient.SendHour)
+	jobs, err := d.Repos.Digests.Jobs(ctx, recipient.UserID, recipient.Since, cutoffs)
+	if err != nil {
+		return false, err
+	}
+	if len(jobs) == 0 {
+		return false, nil
+	}
+
+	msg, err := Render(recipient, jobs)
+	if err != nil {
+		return false, err
+	}
+
+	jobIDs := make([]int, len(jobs))
+	for i, job := range jobs {
+		jobIDs[i] = job.ID
+	}
+	err = d.Repos.WithinTx(ctx, func(repos repository.Repositories) error {
+		if err := repos.Digests.Record(ctx, recipient.UserID, jobIDs, now.UTC()); err != nil {
+			return err
+		}
+		err := d.Sender.Send(msg)
+		metrics.ObserveEmail(metrics.EmailDigest, err)
+		return err
+	})
+	return err == nil, err
+}
+
+// Cutoffs returns, for a user in timezone who wants digests at sendHour,
+// the latest first_seen of jobs due at now for each frequency: instant jobs
+// are always due, daily ones once the send hour has passed and weekly ones
+// once it has passed on a Monday. An unknown timezone falls back to UTC.
+func Cutoffs(now time.Time, timezone string, sendHour int) models.DigestCutoffs {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "" {
+		loc = time.UTC
+	}
+	if !models.ValidSendHour(sendHour) {
+		sendHour = models.DefaultSendHour
+	}
+
+	local := now.In(loc)
+	daily := time.Date(local.Year(), local.Month(), local.Day(), sendHour, 0, 0, 0, loc)
+	if daily.After(local) {
+		daily = daily.AddDate(0, 0, -1)
+	}
+	weekly := daily
+	for weekly.Weekday() != time.Monday {
+		weekly = weekly.AddDate(0, 0, -1)
+	}
+
+	return models.DigestCutoffs{Instant: now.UTC(), Daily: daily.UTC(), Weekly: weekly.UTC()}
+}
+
+type companyJobs struct {
+	Company string
+	Jobs    []models.Job
+}
+
+type digestData struct {
+	Name      string
+	Count     int
+	Companies []companyJobs
+}
+
+// Render builds the digest email for jobs, grouped by company in the order
+// given.
+func Render(recipient models.DigestRecipient, jobs []models.Job) (mail.Message, error) {
+	data := digestData{Name: recipient.Name, Count: len(jobs)}
+	for _, job := range jobs {
+		if n := len(data.Companies); n == 0 || data.Companies[n-1].Company != job.Company {
+			data.Companies = append(data.Companies, companyJobs{Company: job.Company})
+		}
+		last := &data.Companies[len(data.Companies)-1]
+		last.Jobs = append(last.Jobs, job)
+	}
+
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return mail.Message{}, err
+	}
+	if err := htmlTemplate.Execute(&html, data); err != nil {
+		return mail.Message{}, err
+	}
+
+	return mail.Message{
+		To:      recipient.Email,
+		Subject: subject(data),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+func subject(data digestData) string {
+	if len(data.Companies) == 1 {
+		if data.Count == 1 {
+			return "1 new job at " + data.Companies[0].Company
+		}
+		return fmt.Sprintf("%d new jobs at %s", data.Count, data.Companies[0].Company)
+	}
+	return fmt.Sprintf("%d new jobs at %d companies you follow", data.Count, len(data.Companies))
+}
+
+// formatSalary renders a job's salary as "$120,000–$150,000 a year",
+// falling back to the posting's own wording.
+func formatSalary(job models.Job) string {
+	salary := job.Salary
+	if salary == nil {
+		return ""
+	}
+	if salary.Min == 0 && salary.Max == 0 {
+		return salary.Text
+	}
+
+	symbol := map[string]string{"USD": "$", "EUR": "€", "GBP": "£"}[salary.Currency]
+	amount := func(v float64) string {
+		if symbol == "" && salary.Currency != "" {
+			return groupThousands(v) + " " + salary.Currency
+		}
+		return symbol + groupThousands(v)
+	}
+
+	formatted := amount(salary.Min)
+	if salary.Max > salary.Min {
+		formatted += "–" + amount(salary.Max)
+	}
+	switch salary.Period {
+	case "":
+	case "hour":
+		formatted += " an hour"
+	default:
+		formatted += " a " + salary.Period
+	}
+	return formatted
+}
+
+// groupThousands formats 120000 as "120,000"
+func groupThousands(v float64) string {
+	digits := strconv.FormatFloat(v, 'f', -1, 64)
+	whole, fraction, _ := strings.Cut(digits, ".")
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	if fraction != "" {
+		return whole + "." + fraction
+	}
+	return whole
+}
@@ -0,0 +1,208 @@
+package digest
+
+import (
+	"JobScoop/internal/models"
+	"JobScoop/internal/repository"
+	"JobScoop/internal/services/mail"
+	"JobScoop/internal/services/mail/mailtest"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingSender struct{}
+
+func (failingSender) Send(msg mail.Message) error { return errors.New("connection refused") }
+
+// addRecipient stores a verified user who signed up at signup
+func addRecipient(t *testing.T, store *repository.Memory, name, email string, signup time.Time) int {
+	t.Helper()
+	users := store.Repositories().Users
+	user := models.User{Name: name, Email: email}
+	require.NoError(t, users.Create(context.Background(), &user))
+	require.NoError(t, users.MarkVerified(context.Background(), user.ID, email, signup))
+	store.SetCreatedAt(user.ID, signup)
+	return user.ID
+}
+
+// follow subscribes the user to a role at the company with the given
+// frequency and returns the company's and role's IDs
+func follow(t *testing.T, store *repository.Memory, userID int, company, role, frequency string) (int, int) {
+	t.Helper()
+	ctx := context.Background()
+	repos := store.Repositories()
+	companyID, err := repos.Companies.GetOrCreate(ctx, company)
+	require.NoError(t, err)
+	roleID, err := repos.Roles.GetOrCreate(ctx, role)
+	require.NoError(t, err)
+	require.NoError(t, repos.Subscriptions.Create(ctx, &models.Subscription{UserID: userID, CompanyID: companyID,
+		RoleIDs: []int{roleID}, Active: true, Frequency: frequency}))
+	return companyID, roleID
+}
+
+// newTestStore stores Ada, who has three daily jobs due at two companies,
+// and Grace, who has none
+func newTestStore(t *testing.T) (*repository.Memory, int) {
+	t.Helper()
+	store := repository.NewMemory()
+	signup := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	seen := signup.Add(48 * time.Hour)
+
+	ada := addRecipient(t, store, "Ada", "ada@example.com", signup)
+	grace := addRecipient(t, store, "Grace", "grace@example.com", signup)
+	follow(t, store, grace, "Initech", "Engineer", models.FrequencyDaily)
+
+	acme, engineer := follow(t, store, ada, "Acme", "Engineer", models.FrequencyDaily)
+	store.AddJob(models.Job{Title: "Backend Engineer", Company: "Acme", Location: "Berlin", URL: "https://acme.com/jobs/10", FirstSeen: seen,
+		Salary: &models.SalaryRange{Min: 120000, Max: 150000, Currency: "USD", Period: "year"}}, acme, engineer)
+	store.AddJob(models.Job{Title: "Frontend Engineer", Company: "Acme", Remote: true, URL: "https://acme.com/jobs/11", FirstSeen: seen}, acme, engineer)
+	globex, engineer := follow(t, store, ada, "Globex", "Engineer", models.FrequencyDaily)
+	store.AddJob(models.Job{Title: "Data Engineer", Company: "Globex", Location: "Paris", URL: "https://globex.com/jobs/20", FirstSeen: seen}, globex, engineer)
+	return store, ada
+}
+
+// textPart returns the decoded subject and text/plain body of a received message
+func textPart(t *testing.T, data string) (string, string) {
+	t.Helper()
+	msg, err := netmail.ReadMessage(strings.NewReader(data))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	part, err := reader.NextPart()
+	require.NoError(t, err)
+	body, err := io.ReadAll(part)
+	require.NoError(t, err)
+	return subject, string(body)
+}
+
+func TestRunOnce(t *testing.T) {
+	server := mailtest.NewServer(t)
+	store, _ := newTestStore(t)
+	d := New(store.Repositories(), mail.NewSMTPSender(server.Config()), 0)
+
+	sent, err := d.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent, "only the user with new jobs gets a digest")
+
+	messages := server.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, []string{"ada@example.com"}, messages[0].To)
+
+	subject, body := textPart(t, messages[0].Data)
+	assert.Equal(t, "3 new jobs at 2 companies you follow", subject)
+	assert.Contains(t, body, "Hi Ada,")
+	assert.Contains(t, body, "- Backend Engineer (Berlin), $120,000–$150,000 a year")
+	assert.Contains(t, body, "- Frontend Engineer (remote)")
+	assert.Less(t, strings.Index(body, "Acme"), strings.Index(body, "Globex"))
+	assert.Contains(t, messages[0].Data, "text/html")
+
+	t.Run("nothing is mailed twice", func(t *testing.T) {
+		sent, err := d.RunOnce(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, sent)
+		assert.Len(t, server.Messages(), 1)
+	})
+}
+
+func TestRunOnceSendFailure(t *testing.T) {
+	store, ada := newTestStore(t)
+	d := New(store.Repositories(), failingSender{}, 0)
+
+	sent, err := d.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	due, err := store.Repositories().Digests.Jobs(context.Background(), ada, time.Time{}, Cutoffs(time.Now(), "UTC", 8))
+	require.NoError(t, err)
+	assert.Len(t, due, 3, "a failed send must not be recorded")
+
+	// The jobs go out once the mail server is reachable again
+	server := mailtest.NewServer(t)
+	d.Sender = mail.NewSMTPSender(server.Config())
+	sent, err = d.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Len(t, server.Messages(), 1)
+}
+
+func TestRunOnceFrequencies(t *testing.T) {
+	server := mailtest.NewServer(t)
+	now := time.Now()
+	store := repository.NewMemory()
+	ada := addRecipient(t, store, "Ada", "ada@example.com", now.AddDate(0, 0, -7))
+	for _, job := range []struct {
+		title, company, frequency string
+		firstSeen                 time.Time
+	}{
+		{"Instant Job", "Acme", models.FrequencyInstant, now.Add(-time.Minute)},
+		{"Daily Job", "Globex", models.FrequencyDaily, now.Add(-time.Minute)},
+		{"Muted Job", "Initech", models.FrequencyOff, now.Add(-72 * time.Hour)},
+	} {
+		companyID, roleID := follow(t, store, ada, job.company, "Engineer", job.frequency)
+		store.AddJob(models.Job{Title: job.title, Company: job.company, FirstSeen: job.firstSeen}, companyID, roleID)
+	}
+	d := New(store.Repositories(), mail.NewSMTPSender(server.Config()), 0)
+
+	sent, err := d.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	messages := server.Messages()
+	require.Len(t, messages, 1)
+	subject, body := textPart(t, messages[0].Data)
+	assert.Equal(t, "1 new job at Acme", subject)
+	assert.NotContains(t, body, "Daily Job", "daily jobs wait for the next send hour")
+	assert.NotContains(t, body, "Muted Job")
+}
+
+func TestCutoffs(t *testing.T) {
+	// Wednesday 2025-04-16, 14:30 in New York
+	now := time.Date(2025, 4, 16, 18, 30, 0, 0, time.UTC)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	cutoffs := Cutoffs(now, "America/New_York", 9)
+	assert.Equal(t, now, cutoffs.Instant)
+	assert.Equal(t, time.Date(2025, 4, 16, 9, 0, 0, 0, newYork).UTC(), cutoffs.Daily)
+	assert.Equal(t, time.Date(2025, 4, 14, 9, 0, 0, 0, newYork).UTC(), cutoffs.Weekly)
+
+	// Before the send hour the previous day's slot still applies
+	cutoffs = Cutoffs(now, "America/New_York", 20)
+	assert.Equal(t, time.Date(2025, 4, 15, 20, 0, 0, 0, newYork).UTC(), cutoffs.Daily)
+	assert.Equal(t, time.Date(2025, 4, 14, 20, 0, 0, 0, newYork).UTC(), cutoffs.Weekly)
+
+	// Unknown timezones and hours fall back to UTC at the default hour
+	cutoffs = Cutoffs(now, "Mars/Olympus", 42)
+	assert.Equal(t, time.Date(2025, 4, 16, models.DefaultSendHour, 0, 0, 0, time.UTC), cutoffs.Daily)
+}
+
+func TestFormatSalary(t *testing.T) {
+	tests := []struct {
+		name   string
+		salary *models.SalaryRange
+		want   string
+	}{
+		{"none", nil, ""},
+		{"range", &models.SalaryRange{Min: 120000, Max: 150000, Currency: "USD", Period: "year"}, "$120,000–$150,000 a year"},
+		{"single", &models.SalaryRange{Min: 45.5, Max: 45.5, Currency: "GBP", Period: "hour"}, "£45.5 an hour"},
+		{"other currency", &models.SalaryRange{Min: 60000, Max: 70000, Currency: "CHF"}, "60,000 CHF–70,000 CHF"},
+		{"text only", &models.SalaryRange{Text: "Competitive"}, "Competitive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatSalary(models.Job{Salary: tt.salary}))
+		})
+	}
+}
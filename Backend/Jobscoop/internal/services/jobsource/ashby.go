@@ -0,0 +1,74 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ashbyJob is a single posting from the Ashby job board API
+type ashbyJob struct {
+	Title            string `json:"title"`
+	Location         string `json:"location"`
+	IsRemote         bool   `json:"isRemote"`
+	IsListed         *bool  `json:"isListed"`
+	PublishedAt      string `json:"publishedAt"`
+	JobURL           string `json:"jobUrl"`
+	ApplyURL         string `json:"applyUrl"`
+	DescriptionPlain string `json:"descriptionPlain"`
+	Compensation     *struct {
+		CompensationTierSummary             string `json:"compensationTierSummary"`
+		ScrapeableCompensationSalarySummary string `json:"scrapeableCompensationSalarySummary"`
+	} `json:"compensation"`
+}
+
+func (s *CareerSites) fetchAshby(ctx context.Context, board Board) ([]models.Job, error) {
+	endpoint := s.AshbyAPI + "/" + url.PathEscape(board.Token) + "?includeCompensation=true"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Jobs []json.RawMessage `json:"jobs"`
+	}
+	if err := s.getJSON(req, &response); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var jobs []models.Job
+	for _, raw := range response.Jobs {
+		var posting ashbyJob
+		if err := json.Unmarshal(raw, &posting); err != nil || posting.Title == "" {
+			continue
+		}
+		// Unlisted postings are only reachable by direct link
+		if posting.IsListed != nil && !*posting.IsListed {
+			continue
+		}
+
+		job := models.Job{
+			Title:       posting.Title,
+			Location:    posting.Location,
+			Remote:      posting.IsRemote || isRemote(posting.Location),
+			PostedAt:    parsePostedAt(posting.PublishedAt, now),
+			URL:         posting.JobURL,
+			ApplyURLs:   appendURL(appendURL(nil, posting.ApplyURL), posting.JobURL),
+			Description: posting.DescriptionPlain,
+			Source:      "Ashby",
+			Raw:         raw,
+		}
+		if posting.Compensation != nil {
+			job.Salary = parseSalary(firstNonEmpty(
+				posting.Compensation.ScrapeableCompensationSalarySummary,
+				posting.Compensation.CompensationTierSummary,
+			))
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
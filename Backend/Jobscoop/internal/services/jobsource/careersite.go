@@ -0,0 +1,238 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Applicant tracking systems whose public job boards CareerSites can read.
+const (
+	ATSGreenhouse = "greenhouse"
+	ATSLever      = "lever"
+	ATSAshby      = "ashby"
+	ATSWorkday    = "workday"
+
+	// CareerPage marks any other career site link, read for the schema.org
+	// JobPosting blocks embedded in the page.
+	CareerPage = "page"
+)
+
+const (
+	GreenhouseBoardsAPI = "https://boards-api.greenhouse.io/v1/boards"
+	LeverPostingsAPI    = "https://api.lever.co/v0/postings"
+	AshbyJobBoardAPI    = "https://api.ashbyhq.com/posting-api/job-board"
+)
+
+// DefaultBoardCacheTTL is how long a fetched board is reused, so the roles
+// of one company crawled together share a single request per board.
+const DefaultBoardCacheTTL = 5 * time.Minute
+
+// Board is a career site link recognized as a public ATS job board.
+type Board struct {
+	ATS   string
+	Token string // board token, Lever/Ashby company handle or Workday tenant
+	Host  string // Workday host, e.g. "acme.wd5.myworkdayjobs.com"
+	Site  string // Workday career site, e.g. "External"
+}
+
+var workdayLocale = regexp.MustCompile(`^[a-z]{2}-[A-Z]{2}$`)
+
+// ParseBoard recognizes Greenhouse, Lever, Ashby and Workday career site
+// links such as "https://boards.greenhouse.io/acme" or
+// "https://acme.wd5.myworkdayjobs.com/en-US/External". It reports false for
+// any other link.
+func ParseBoard(link string) (Board, bool) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" {
+		return Board{}, false
+	}
+	host := strings.ToLower(u.Hostname())
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	first := ""
+	if len(segments) > 0 {
+		first = segments[0]
+	}
+
+	switch {
+	case host == "boards.greenhouse.io" || host == "job-boards.greenhouse.io":
+		// The embedded board names its token in ?for=
+		if first == "embed" {
+			first = u.Query().Get("for")
+		}
+		if first != "" {
+			return Board{ATS: ATSGreenhouse, Token: first}, true
+		}
+	case host == "jobs.lever.co":
+		if first != "" {
+			return Board{ATS: ATSLever, Token: first}, true
+		}
+	case host == "jobs.ashbyhq.com":
+		if first != "" {
+			return Board{ATS: ATSAshby, Token: first}, true
+		}
+	case strings.HasSuffix(host, ".myworkdayjobs.com"):
+		if len(segments) > 0 && workdayLocale.MatchString(segments[0]) {
+			segments = segments[1:]
+		}
+		if len(segments) > 0 {
+			tenant := strings.SplitN(host, ".", 2)[0]
+			return Board{ATS: ATSWorkday, Token: tenant, Host: host, Site: segments[0]}, true
+		}
+	}
+	return Board{}, false
+}
+
+// CareerSiteLinks returns the career site links followed for a company.
+type CareerSiteLinks func(ctx context.Context, company string) ([]string, error)
+
+// CareerSites reads postings straight from the public job boards of the
+// career sites users follow, instead of searching through ScrapingDog.
+// Links on hosts it doesn't recognize are read for schema.org JobPosting
+// markup instead.
+type CareerSites struct {
+	Links         CareerSiteLinks
+	Client        *http.Client
+	GreenhouseAPI string
+	LeverAPI      string
+	AshbyAPI      string
+	WorkdayAPI    string // overrides "https://<workday host>" when set, for tests
+	CacheTTL      time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedBoard
+}
+
+type cachedBoard struct {
+	jobs      []models.Job
+	fetchedAt time.Time
+}
+
+func NewCareerSites(links CareerSiteLinks) *CareerSites {
+	return &CareerSites{
+		Links:         links,
+		GreenhouseAPI: GreenhouseBoardsAPI,
+		LeverAPI:      LeverPostingsAPI,
+		AshbyAPI:      AshbyJobBoardAPI,
+		CacheTTL:      DefaultBoardCacheTTL,
+	}
+}
+
+func (s *CareerSites) Name() string { return "careers" }
+
+// Search returns the postings of every recognized board followed for the
+// company. It fails only when every board failed.
+func (s *CareerSites) Search(ctx context.Context, company, role string, opts Options) ([]models.Job, error) {
+	links, err := s.Links(ctx, company)
+	if err != nil {
+		return nil, fmt.Errorf("error loading career sites: %w", err)
+	}
+
+	var jobs []models.Job
+	var errs []error
+	fetched := 0
+	for _, link := range links {
+		board, ok := ParseBoard(link)
+		if !ok {
+			board = Board{ATS: CareerPage, Token: link}
+		}
+
+		boardJobs, err := s.fetchBoard(ctx, board, role)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s board %q: %w", board.ATS, board.Token, err))
+			continue
+		}
+		fetched++
+		for _, job := range boardJobs {
+			// Boards rarely repeat the company's name on each posting
+			if job.Company == "" {
+				job.Company = company
+			}
+			jobs = append(jobs, job)
+		}
+	}
+
+	if fetched == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		slog.Warn("Career site search partly failed", "company", company, "err", err)
+	}
+	return jobs, nil
+}
+
+// fetchBoard returns the board's postings, reusing a recent fetch. Workday
+// boards are searched per role, so their cache entries are too.
+func (s *CareerSites) fetchBoard(ctx context.Context, board Board, role string) ([]models.Job, error) {
+	key := board.ATS + ":" + board.Host + ":" + board.Token
+	if board.ATS == ATSWorkday {
+		key += ":" + board.Site + ":" + strings.ToLower(role)
+	}
+
+	s.mu.Lock()
+	cached, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < s.CacheTTL {
+		return cached.jobs, nil
+	}
+
+	var jobs []models.Job
+	var err error
+	switch board.ATS {
+	case ATSGreenhouse:
+		jobs, err = s.fetchGreenhouse(ctx, board)
+	case ATSLever:
+		jobs, err = s.fetchLever(ctx, board)
+	case ATSAshby:
+		jobs, err = s.fetchAshby(ctx, board)
+	case ATSWorkday:
+		jobs, err = s.fetchWorkday(ctx, board, role)
+	case CareerPage:
+		jobs, err = s.fetchJSONLD(ctx, board.Token)
+	default:
+		err = fmt.Errorf("unsupported job board %q", board.ATS)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.cache == nil {
+		s.cache = make(map[string]cachedBoard)
+	}
+	s.cache[key] = cachedBoard{jobs: jobs, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return jobs, nil
+}
+
+// getJSON sends req and decodes a 200 response's JSON body into v.
+func (s *CareerSites) getJSON(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient(s.Client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error parsing JSON response: %w", err)
+	}
+	return nil
+}
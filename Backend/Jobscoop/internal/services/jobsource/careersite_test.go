@@ -0,0 +1,222 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBoard(t *testing.T) {
+	tests := []struct {
+		link     string
+		expected Board
+		ok       bool
+	}{
+		{"https://boards.greenhouse.io/acme", Board{ATS: ATSGreenhouse, Token: "acme"}, true},
+		{"https://job-boards.greenhouse.io/acme/jobs/4012345", Board{ATS: ATSGreenhouse, Token: "acme"}, true},
+		{"https://boards.greenhouse.io/embed/job_board?for=acme", Board{ATS: ATSGreenhouse, Token: "acme"}, true},
+		{"https://jobs.lever.co/globex/", Board{ATS: ATSLever, Token: "globex"}, true},
+		{"https://jobs.ashbyhq.com/initech", Board{ATS: ATSAshby, Token: "initech"}, true},
+		{"https://umbrella.wd5.myworkdayjobs.com/en-US/External", Board{ATS: ATSWorkday, Token: "umbrella", Host: "umbrella.wd5.myworkdayjobs.com", Site: "External"}, true},
+		{"https://umbrella.wd1.myworkdayjobs.com/Careers/job/Seattle/Engineer_R-1", Board{ATS: ATSWorkday, Token: "umbrella", Host: "umbrella.wd1.myworkdayjobs.com", Site: "Careers"}, true},
+		{"https://jobs.lever.co/", Board{}, false},
+		{"https://careers.acme.com/jobs", Board{}, false},
+		{"not a url", Board{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			board, ok := ParseBoard(tt.link)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, board)
+		})
+	}
+}
+
+// fixtureServer serves the recorded board responses in testdata, counting
+// the requests made for each path
+func fixtureServer(t *testing.T) (*httptest.Server, func(path string) int) {
+	fixtures := map[string]string{
+		"/greenhouse/acme/jobs":                    "greenhouse_jobs.json",
+		"/lever/globex":                            "lever_postings.json",
+		"/ashby/initech":                           "ashby_job_board.json",
+		"/workday/wday/cxs/umbrella/External/jobs": "workday_jobs.json",
+		"/careers/hooli":                           "career_page.html",
+	}
+
+	var mu sync.Mutex
+	hits := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+
+		name, ok := fixtures[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/workday/wday/cxs/umbrella/External/jobs" {
+			var search struct {
+				SearchText string `json:"searchText"`
+			}
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&search))
+			assert.Equal(t, "Software Engineer", search.SearchText)
+		}
+
+		body, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Errorf("Could not read fixture %s: %v", name, err)
+			return
+		}
+		if filepath.Ext(name) == ".html" {
+			w.Header().Set("Content-Type", "text/html")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Write(body)
+	}))
+
+	return server, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[path]
+	}
+}
+
+func newTestCareerSites(serverURL string, links map[string][]string) *CareerSites {
+	sites := NewCareerSites(func(ctx context.Context, company string) ([]string, error) { return links[company], nil })
+	sites.GreenhouseAPI = serverURL + "/greenhouse"
+	sites.LeverAPI = serverURL + "/lever"
+	sites.AshbyAPI = serverURL + "/ashby"
+	sites.WorkdayAPI = serverURL + "/workday"
+	return sites
+}
+
+func TestCareerSitesSearch(t *testing.T) {
+	server, hits := fixtureServer(t)
+	defer server.Close()
+
+	sites := newTestCareerSites(server.URL, map[string][]string{
+		"Acme":     {"https://boards.greenhouse.io/acme"},
+		"Globex":   {"https://jobs.lever.co/globex"},
+		"Initech":  {"https://jobs.ashbyhq.com/initech"},
+		"Umbrella": {"https://umbrella.wd5.myworkdayjobs.com/en-US/External"},
+		"Hooli":    {server.URL + "/careers/hooli"},
+		"Missing":  {"https://jobs.lever.co/missing", server.URL + "/careers/missing"},
+	})
+	ctx := context.Background()
+
+	t.Run("greenhouse", func(t *testing.T) {
+		jobs, err := sites.Search(ctx, "Acme", "Software Engineer", DefaultOptions())
+		assert.NoError(t, err)
+		if assert.Len(t, jobs, 2) {
+			job := jobs[0]
+			assert.Equal(t, "Senior Software Engineer, Platform", job.Title)
+			assert.Equal(t, "Acme", job.Company)
+			assert.Equal(t, "Austin, TX", job.Location)
+			assert.Equal(t, "https://boards.greenhouse.io/acme/jobs/4012345", job.URL)
+			assert.Equal(t, "Build the platform that powers Acme.", job.Description)
+			assert.Equal(t, "Greenhouse", job.Source)
+			if assert.NotNil(t, job.PostedAt) {
+				assert.Equal(t, time.Date(2025, 3, 10, 13, 30, 0, 0, time.UTC), *job.PostedAt)
+			}
+			assert.True(t, jobs[1].Remote)
+		}
+	})
+
+	t.Run("lever", func(t *testing.T) {
+		jobs, err := sites.Search(ctx, "Globex", "Software Engineer", DefaultOptions())
+		assert.NoError(t, err)
+		if assert.Len(t, jobs, 2) {
+			job := jobs[0]
+			assert.Equal(t, "Backend Software Engineer", job.Title)
+			assert.Equal(t, "Globex", job.Company)
+			assert.Equal(t, "https://jobs.lever.co/globex/5a2c3d4e-1111-2222-3333-444455556666", job.URL)
+			assert.Equal(t, &models.SalaryRange{Min: 140000, Max: 180000, Currency: "USD", Period: "year"}, job.Salary)
+			assert.Equal(t, time.UnixMilli(1741600800000).UTC(), *job.PostedAt)
+			assert.False(t, job.Remote)
+			assert.True(t, jobs[1].Remote)
+		}
+	})
+
+	t.Run("ashby", func(t *testing.T) {
+		jobs, err := sites.Search(ctx, "Initech", "Software Engineer", DefaultOptions())
+		assert.NoError(t, err)
+		// The unlisted posting is left out
+		if assert.Len(t, jobs, 1) {
+			job := jobs[0]
+			assert.Equal(t, "Software Engineer, Infrastructure", job.Title)
+			assert.True(t, job.Remote)
+			assert.Equal(t, float64(150000), job.Salary.Min)
+			assert.Equal(t, float64(190000), job.Salary.Max)
+			assert.Equal(t, []string{
+				"https://jobs.ashbyhq.com/initech/0b1c2d3e-aaaa-bbbb-cccc-ddddeeeeffff/application",
+				"https://jobs.ashbyhq.com/initech/0b1c2d3e-aaaa-bbbb-cccc-ddddeeeeffff",
+			}, job.ApplyURLs)
+		}
+	})
+
+	t.Run("workday", func(t *testing.T) {
+		jobs, err := sites.Search(ctx, "Umbrella", "Software Engineer", DefaultOptions())
+		assert.NoError(t, err)
+		if assert.Len(t, jobs, 2) {
+			assert.Equal(t, "https://umbrella.wd5.myworkdayjobs.com/External/job/Seattle-WA/Software-Engineer-II_R-20451", jobs[0].URL)
+			assert.Equal(t, "Umbrella", jobs[0].Company)
+			assert.NotNil(t, jobs[0].PostedAt)
+			assert.False(t, jobs[0].Remote)
+			assert.True(t, jobs[1].Remote)
+		}
+	})
+
+	t.Run("every board failing is an error", func(t *testing.T) {
+		_, err := sites.Search(ctx, "Missing", "Software Engineer", DefaultOptions())
+		assert.Error(t, err)
+	})
+
+	t.Run("career page with JSON-LD", func(t *testing.T) {
+		jobs, err := sites.Search(ctx, "Hooli", "Software Engineer", DefaultOptions())
+		assert.NoError(t, err)
+		// The expired internship is left out
+		if assert.Len(t, jobs, 2) {
+			sre := jobs[0]
+			assert.Equal(t, "Site Reliability Engineer", sre.Title)
+			assert.Equal(t, "Hooli", sre.Company)
+			assert.Equal(t, "Palo Alto, CA, US / Seattle, WA, US", sre.Location)
+			assert.Equal(t, "https://hooli.example/careers/sre", sre.URL)
+			assert.Equal(t, "Keep Hooli up.", sre.Description)
+			assert.Equal(t, "FULL_TIME, CONTRACTOR", sre.EmploymentType)
+			assert.Equal(t, &models.SalaryRange{Min: 160000, Max: 210000, Currency: "USD", Period: "year"}, sre.Salary)
+			assert.Equal(t, time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC), *sre.PostedAt)
+			assert.Equal(t, time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC), *sre.ValidThrough)
+			assert.Equal(t, "Career Site", sre.Source)
+
+			support := jobs[1]
+			assert.True(t, support.Remote)
+			assert.Equal(t, server.URL+"/careers/hooli", support.URL, "The page stands in for a missing url")
+			assert.Equal(t, &models.SalaryRange{Min: 40, Max: 40, Currency: "USD", Period: "hour"}, support.Salary)
+		}
+	})
+
+	t.Run("company without career sites", func(t *testing.T) {
+		jobs, err := sites.Search(ctx, "Vandelay", "Software Engineer", DefaultOptions())
+		assert.NoError(t, err)
+		assert.Empty(t, jobs)
+	})
+
+	t.Run("boards are cached across roles", func(t *testing.T) {
+		_, err := sites.Search(ctx, "Acme", "Product Manager", DefaultOptions())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, hits("/greenhouse/acme/jobs"))
+	})
+}
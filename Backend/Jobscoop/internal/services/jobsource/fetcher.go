@@ -0,0 +1,151 @@
+package jobsource
+
+import (
+	"JobScoop/config"
+	"JobScoop/internal/metrics"
+	"JobScoop/internal/models"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultConcurrency = 8
+	DefaultTimeout     = 10 * time.Second
+)
+
+// Status reports how a single source search ended.
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusTimeout Status = "timeout"
+	StatusError   Status = "error"
+)
+
+// Query is one company/role pair to search every enabled source for.
+type Query struct {
+	Company string
+	Role    string
+}
+
+// Result is the outcome of searching one source for one query. Err is kept
+// out of the JSON because upstream errors can embed request URLs and API keys.
+type Result struct {
+	Source  string       `json:"source"`
+	Company string       `json:"company"`
+	Role    string       `json:"role"`
+	Status  Status       `json:"status"`
+	Count   int          `json:"count"`
+	Jobs    []models.Job `json:"-"`
+	Err     error        `json:"-"`
+}
+
+// Fetcher fans queries out across the enabled sources of a registry with a
+// bounded number of searches in flight, each under its own deadline.
+type Fetcher struct {
+	Registry    *Registry
+	Options     Options
+	Concurrency int                      // maximum searches in flight; DefaultConcurrency when zero
+	Timeout     time.Duration            // per-search deadline; DefaultTimeout when zero
+	Timeouts    map[string]time.Duration // per-source overrides of Timeout
+}
+
+// NewDefaultFetcher wraps registry with the concurrency and timeouts in cfg.
+func NewDefaultFetcher(registry *Registry, cfg config.Jobs) *Fetcher {
+	fetcher := &Fetcher{
+		Registry:    registry,
+		Options:     DefaultOptions(),
+		Concurrency: cfg.FetchConcurrency,
+		Timeout:     cfg.SourceTimeout,
+		Timeouts:    make(map[string]time.Duration),
+	}
+	for name, timeout := range cfg.SourceTimeouts {
+		if _, ok := registry.Get(name); !ok {
+			slog.Warn("Ignoring the timeout of unknown job source", "source", name)
+			continue
+		}
+		fetcher.Timeouts[name] = timeout
+	}
+	return fetcher
+}
+
+func (f *Fetcher) timeout(source string) time.Duration {
+	if d, ok := f.Timeouts[source]; ok {
+		return d
+	}
+	if f.Timeout > 0 {
+		return f.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (f *Fetcher) concurrency() int {
+	if f.Concurrency > 0 {
+		return f.Concurrency
+	}
+	return DefaultConcurrency
+}
+
+// Fetch searches every enabled source for every query and returns one Result
+// per (query, source) pair, ordered by query and then by source. A slow or
+// failing source only affects its own results. Cancelling ctx stops the
+// searches that are still running.
+func (f *Fetcher) Fetch(ctx context.Context, queries []Query) []Result {
+	sources := f.Registry.Enabled()
+	results := make([]Result, len(queries)*len(sources))
+
+	sem := make(chan struct{}, f.concurrency())
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		for j, source := range sources {
+			wg.Add(1)
+			go func(result *Result, query Query, source JobSource) {
+				defer wg.Done()
+
+				*result = Result{Source: source.Name(), Company: query.Company, Role: query.Role}
+
+				select {
+				case sem <- struct{}{}:
+					defer func() { <-sem }()
+				case <-ctx.Done():
+					result.Status, result.Err = statusOf(ctx.Err()), ctx.Err()
+					return
+				}
+
+				searchCtx, cancel := context.WithTimeout(ctx, f.timeout(source.Name()))
+				defer cancel()
+
+				start := time.Now()
+				jobs, err := source.Search(searchCtx, query.Company, query.Role, f.Options)
+				elapsed := time.Since(start)
+				if err == nil && searchCtx.Err() != nil {
+					err = searchCtx.Err()
+				}
+				if err != nil {
+					result.Status, result.Err = statusOf(err), err
+					metrics.ObserveFetch(source.Name(), string(result.Status), elapsed, 0, err)
+					slog.Warn("Job source failed", "source", source.Name(), "company", query.Company, "role", query.Role, "err", err)
+					return
+				}
+
+				result.Status = StatusOK
+				result.Jobs = jobs
+				result.Count = len(jobs)
+				metrics.ObserveFetch(source.Name(), string(StatusOK), elapsed, len(jobs), nil)
+			}(&results[i*len(sources)+j], query, source)
+		}
+	}
+	wg.Wait()
+
+	return results
+}
+
+func statusOf(err error) Status {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return StatusTimeout
+	}
+	return StatusError
+}
@@ -0,0 +1,134 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const ScrapingDogGoogleJobsAPI = "https://api.scrapingdog.com/google_jobs"
+
+// GoogleJobs searches Google Jobs through ScrapingDog.
+type GoogleJobs struct {
+	APIKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewGoogleJobs(apiKey string) *GoogleJobs {
+	return &GoogleJobs{APIKey: apiKey, BaseURL: ScrapingDogGoogleJobsAPI}
+}
+
+func (s *GoogleJobs) Name() string { return "google" }
+
+type googleApplyLink struct {
+	Title string `json:"title"`
+	Link  string `json:"link"`
+}
+
+// googleJob is a single entry of jobs_results in the ScrapingDog Google Jobs response
+type googleJob struct {
+	Title              string            `json:"title"`
+	CompanyName        string            `json:"company_name"`
+	Location           string            `json:"location"`
+	Description        string            `json:"description"`
+	URL                string            `json:"url"`
+	ApplyLinks         []googleApplyLink `json:"apply_links"`
+	ApplyOptions       []googleApplyLink `json:"apply_options"`
+	Extensions         []interface{}     `json:"extensions"`
+	DetectedExtensions struct {
+		PostedAt     string `json:"posted_at"`
+		Salary       string `json:"salary"`
+		WorkFromHome bool   `json:"work_from_home"`
+	} `json:"detected_extensions"`
+}
+
+func (s *GoogleJobs) Search(ctx context.Context, company, role string, opts Options) ([]models.Job, error) {
+	params := url.Values{}
+	params.Add("api_key", s.APIKey)
+	params.Add("query", fmt.Sprintf("%s AND %s", company, role))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient(s.Client).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to Google Jobs API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read the response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	// Parse the JSON response
+	var apiResponse struct {
+		JobsResults []json.RawMessage `json:"jobs_results"`
+	}
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, fmt.Errorf("error parsing JSON response: %w", err)
+	}
+
+	now := time.Now()
+	var jobs []models.Job
+	for _, raw := range apiResponse.JobsResults {
+		var posting googleJob
+		if err := json.Unmarshal(raw, &posting); err != nil || posting.Title == "" {
+			continue
+		}
+		jobs = append(jobs, mapGoogleJob(posting, raw, now))
+	}
+	return jobs, nil
+}
+
+func mapGoogleJob(posting googleJob, raw json.RawMessage, now time.Time) models.Job {
+	var applyURLs []string
+	for _, link := range append(posting.ApplyLinks, posting.ApplyOptions...) {
+		applyURLs = appendURL(applyURLs, link.Link)
+	}
+	applyURLs = appendURL(applyURLs, posting.URL)
+
+	// Older responses only carry the posting age and salary in extensions
+	var extensions []string
+	for _, extension := range posting.Extensions {
+		if text, ok := extension.(string); ok {
+			extensions = append(extensions, text)
+		}
+	}
+	postedAt := parsePostedAt(posting.DetectedExtensions.PostedAt, now)
+	salaryText := posting.DetectedExtensions.Salary
+	for _, extension := range extensions {
+		if postedAt == nil {
+			postedAt = parsePostedAt(extension, now)
+		}
+		if salaryText == "" && strings.ContainsAny(extension, "$€£") {
+			salaryText = extension
+		}
+	}
+
+	job := models.Job{
+		Title:       posting.Title,
+		Company:     posting.CompanyName,
+		Location:    posting.Location,
+		Remote:      posting.DetectedExtensions.WorkFromHome || isRemote(append([]string{posting.Location}, extensions...)...),
+		Salary:      parseSalary(salaryText),
+		PostedAt:    postedAt,
+		ApplyURLs:   applyURLs,
+		Description: posting.Description,
+		Source:      "Google Jobs",
+		Raw:         raw,
+	}
+	if len(applyURLs) > 0 {
+		job.URL = applyURLs[0]
+	}
+	return job
+}
@@ -0,0 +1,61 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// greenhouseJob is a single posting from the Greenhouse job board API
+type greenhouseJob struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	AbsoluteURL string `json:"absolute_url"`
+	CompanyName string `json:"company_name"`
+	Location    struct {
+		Name string `json:"name"`
+	} `json:"location"`
+	FirstPublished string `json:"first_published"`
+	UpdatedAt      string `json:"updated_at"`
+	Content        string `json:"content"`
+}
+
+func (s *CareerSites) fetchGreenhouse(ctx context.Context, board Board) ([]models.Job, error) {
+	endpoint := s.GreenhouseAPI + "/" + url.PathEscape(board.Token) + "/jobs?content=true"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Jobs []json.RawMessage `json:"jobs"`
+	}
+	if err := s.getJSON(req, &response); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var jobs []models.Job
+	for _, raw := range response.Jobs {
+		var posting greenhouseJob
+		if err := json.Unmarshal(raw, &posting); err != nil || posting.Title == "" {
+			continue
+		}
+		jobs = append(jobs, models.Job{
+			Title:       posting.Title,
+			Company:     posting.CompanyName,
+			Location:    posting.Location.Name,
+			Remote:      isRemote(posting.Location.Name),
+			PostedAt:    parsePostedAt(firstNonEmpty(posting.FirstPublished, posting.UpdatedAt), now),
+			URL:         posting.AbsoluteURL,
+			ApplyURLs:   appendURL(nil, posting.AbsoluteURL),
+			Description: plainText(posting.Content),
+			Source:      "Greenhouse",
+			Raw:         raw,
+		})
+	}
+	return jobs, nil
+}
@@ -0,0 +1,122 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const ScrapingDogIndeedAPI = "https://api.scrapingdog.com/indeed"
+
+// Indeed scrapes Indeed search results through ScrapingDog.
+type Indeed struct {
+	APIKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewIndeed(apiKey string) *Indeed {
+	return &Indeed{APIKey: apiKey, BaseURL: ScrapingDogIndeedAPI}
+}
+
+func (s *Indeed) Name() string { return "indeed" }
+
+// indeedJob is a single posting in the ScrapingDog Indeed response
+type indeedJob struct {
+	Title          string   `json:"title"`
+	CompanyName    string   `json:"company_name"`
+	Location       string   `json:"location"`
+	Description    string   `json:"description"`
+	URL            string   `json:"url"`
+	ApplyLink      string   `json:"apply_link,omitempty"`
+	Salary         string   `json:"salary,omitempty"`
+	JobType        string   `json:"job_type,omitempty"`
+	DatePosted     string   `json:"date_posted,omitempty"`
+	Skills         []string `json:"skills,omitempty"`
+	RequiredExp    string   `json:"required_exp,omitempty"`
+	RequiredDegree string   `json:"required_degree,omitempty"`
+	SourceType     string   `json:"source_type"`
+}
+
+// Generate an Indeed URL with the given job role and company
+func generateIndeedURL(jobRole, company, location string) string {
+	baseURL := "https://www.indeed.com/jobs"
+
+	// Construct query parameters
+	queryParams := url.Values{}
+	queryParams.Set("q", fmt.Sprintf("%s AND %s", jobRole, company))
+	queryParams.Set("l", location)
+
+	// Encode and return the full URL
+	return fmt.Sprintf("%s?%s", baseURL, queryParams.Encode())
+}
+
+func (s *Indeed) Search(ctx context.Context, company, role string, opts Options) ([]models.Job, error) {
+	params := url.Values{}
+	params.Add("api_key", s.APIKey)
+	params.Add("url", generateIndeedURL(role, company, opts.Location))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient(s.Client).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to Indeed API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Read the response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Indeed API response body: %v", err)
+	}
+
+	// Check if status is OK
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get valid response from Indeed API, status code: %d", resp.StatusCode)
+	}
+
+	// The response is an array mixing job objects with a trailing metadata
+	// object; keep only the entries that look like jobs.
+	var result []json.RawMessage
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Indeed API JSON response: %v", err)
+	}
+
+	now := time.Now()
+	var jobs []models.Job
+	for _, raw := range result {
+		var posting indeedJob
+		if err := json.Unmarshal(raw, &posting); err == nil && posting.Title != "" {
+			jobs = append(jobs, mapIndeedJob(posting, raw, now))
+		}
+	}
+
+	return jobs, nil
+}
+
+// mapIndeedJob maps an Indeed posting onto the canonical job, preferring the
+// employer's apply link over the Indeed listing as the posting's URL
+func mapIndeedJob(posting indeedJob, raw json.RawMessage, now time.Time) models.Job {
+	applyURLs := appendURL(appendURL(nil, posting.ApplyLink), posting.URL)
+	return models.Job{
+		Title:          posting.Title,
+		Company:        posting.CompanyName,
+		Location:       posting.Location,
+		Remote:         isRemote(posting.Location, posting.JobType),
+		Salary:         parseSalary(posting.Salary),
+		PostedAt:       parsePostedAt(posting.DatePosted, now),
+		EmploymentType: posting.JobType,
+		URL:            firstNonEmpty(posting.ApplyLink, posting.URL),
+		ApplyURLs:      applyURLs,
+		Description:    posting.Description,
+		Source:         "Indeed",
+		Raw:            raw,
+	}
+}
@@ -0,0 +1,139 @@
+package jobsource
+
+import (
+	"JobScoop/config"
+	"JobScoop/internal/models"
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// JobSource searches one upstream job board for postings of a role at a company.
+type JobSource interface {
+	// Name is the stable identifier used to enable or disable the source.
+	Name() string
+	// Search returns normalized jobs for the company and role.
+	Search(ctx context.Context, company, role string, opts Options) ([]models.Job, error)
+}
+
+// Options tunes a search; sources ignore the fields that don't apply to them.
+type Options struct {
+	GeoID    string // LinkedIn geographic ID
+	Page     string // LinkedIn result page
+	SortBy   string // LinkedIn recency window, e.g. "week"
+	Location string // Indeed location filter
+}
+
+// DefaultOptions returns the options the jobs endpoint has always searched with.
+func DefaultOptions() Options {
+	return Options{
+		GeoID:    "103644278", // United States
+		Page:     "1",
+		SortBy:   "week",
+		Location: "United States",
+	}
+}
+
+// Registry holds the available job sources and which of them are enabled.
+type Registry struct {
+	mu       sync.RWMutex
+	sources  map[string]JobSource
+	order    []string
+	disabled map[string]bool
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		sources:  make(map[string]JobSource),
+		disabled: make(map[string]bool),
+	}
+}
+
+// NewDefaultRegistry registers the ScrapingDog-backed LinkedIn, Google Jobs and
+// Indeed sources and the career sites subscriptions follow, which links
+// looks up. cfg.Sources optionally limits which ones are enabled, e.g.
+// "linkedin" and "careers"; when empty every source is enabled.
+func NewDefaultRegistry(cfg config.Jobs, links CareerSiteLinks) *Registry {
+	apiKey := cfg.ScrapingDogAPIKey
+
+	registry := NewRegistry()
+	registry.Register(NewLinkedIn(apiKey))
+	registry.Register(NewGoogleJobs(apiKey))
+	registry.Register(NewIndeed(apiKey))
+	registry.Register(NewCareerSites(links))
+
+	if len(cfg.Sources) > 0 {
+		registry.SetEnabled(cfg.Sources)
+	}
+	return registry
+}
+
+// Register adds a source, enabled, replacing any source with the same name.
+func (r *Registry) Register(source JobSource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := source.Name()
+	if _, exists := r.sources[name]; !exists {
+		r.order = append(r.order, name)
+	}
+	r.sources[name] = source
+	delete(r.disabled, name)
+}
+
+// SetEnabled enables exactly the named sources and disables the rest.
+func (r *Registry) SetEnabled(names []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := r.sources[name]; !ok {
+			slog.Warn("Ignoring unknown job source", "source", name)
+			continue
+		}
+		wanted[name] = true
+	}
+
+	for _, name := range r.order {
+		r.disabled[name] = !wanted[name]
+	}
+}
+
+// Get returns the named source whether or not it is enabled.
+func (r *Registry) Get(name string) (JobSource, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	source, ok := r.sources[name]
+	return source, ok
+}
+
+// Enabled returns the enabled sources in registration order.
+func (r *Registry) Enabled() []JobSource {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var enabled []JobSource
+	for _, name := range r.order {
+		if !r.disabled[name] {
+			enabled = append(enabled, r.sources[name])
+		}
+	}
+	return enabled
+}
+
+// httpClient returns client, or http.DefaultClient when it is nil.
+func httpClient(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	return http.DefaultClient
+}
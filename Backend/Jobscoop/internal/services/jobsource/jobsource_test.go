@@ -0,0 +1,239 @@
+package jobsource
+
+import (
+	"JobScoop/config"
+	"JobScoop/internal/models"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubSource struct{ name string }
+
+func (s *stubSource) Name() string { return s.name }
+
+func (s *stubSource) Search(ctx context.Context, company, role string, opts Options) ([]models.Job, error) {
+	return nil, nil
+}
+
+func sourceNames(sources []JobSource) []string {
+	var names []string
+	for _, source := range sources {
+		names = append(names, source.Name())
+	}
+	return names
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&stubSource{name: "linkedin"})
+	registry.Register(&stubSource{name: "google"})
+	registry.Register(&stubSource{name: "indeed"})
+
+	// Every source starts enabled, in registration order
+	assert.Equal(t, []string{"linkedin", "google", "indeed"}, sourceNames(registry.Enabled()))
+
+	// Only the configured sources stay enabled; unknown names are ignored
+	registry.SetEnabled([]string{" Indeed", "linkedin", "monster"})
+	assert.Equal(t, []string{"linkedin", "indeed"}, sourceNames(registry.Enabled()))
+
+	// Disabled sources can still be looked up by name
+	_, ok := registry.Get("google")
+	assert.True(t, ok)
+
+	// Re-registering a source enables it again without duplicating it
+	registry.Register(&stubSource{name: "google"})
+	assert.Equal(t, []string{"linkedin", "google", "indeed"}, sourceNames(registry.Enabled()))
+}
+
+func TestNewDefaultRegistry(t *testing.T) {
+	registry := NewDefaultRegistry(config.Jobs{Sources: []string{"google"}}, nil)
+
+	assert.Equal(t, []string{"google"}, sourceNames(registry.Enabled()))
+	for _, name := range []string{"linkedin", "google", "indeed", "careers"} {
+		_, ok := registry.Get(name)
+		assert.True(t, ok, "Expected %s to be registered", name)
+	}
+}
+
+func TestNewDefaultFetcher(t *testing.T) {
+	registry := NewDefaultRegistry(config.Jobs{}, nil)
+	fetcher := NewDefaultFetcher(registry, config.Jobs{
+		FetchConcurrency: 2,
+		SourceTimeout:    5 * time.Second,
+		SourceTimeouts:   map[string]time.Duration{"indeed": 20 * time.Second, "monster": time.Second},
+	})
+
+	assert.Equal(t, 2, fetcher.concurrency())
+	assert.Equal(t, 5*time.Second, fetcher.timeout("linkedin"))
+	assert.Equal(t, 20*time.Second, fetcher.timeout("indeed"))
+
+	// Unknown sources are ignored, and unset limits fall back to the defaults
+	assert.NotContains(t, fetcher.Timeouts, "monster")
+	fetcher = NewDefaultFetcher(registry, config.Jobs{})
+	assert.Equal(t, DefaultConcurrency, fetcher.concurrency())
+	assert.Equal(t, DefaultTimeout, fetcher.timeout("indeed"))
+}
+
+func TestSourcesSearch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-key", r.URL.Query().Get("api_key"))
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/linkedinjobs":
+			assert.Equal(t, "Software Engineer AND Acme", r.URL.Query().Get("field"))
+			w.Write([]byte(`[{"job_position": "Software Engineer", "company_name": "Acme", "job_location": "Remote", "job_link": "https://linkedin.com/jobs/1", "job_posting_date": "2025-03-20"}]`))
+		case "/google_jobs":
+			assert.Equal(t, "Acme AND Software Engineer", r.URL.Query().Get("query"))
+			w.Write([]byte(`{"jobs_results": [{"title": "Software Engineer", "company_name": "Acme", "location": "Austin, TX", "url": "https://google.com/jobs/1", "apply_links": [{"link": "https://acme.com/apply"}], "extensions": ["3 days ago", "$120K–$150K a year"]}]}`))
+		case "/indeed":
+			assert.Contains(t, r.URL.Query().Get("url"), "indeed.com/jobs")
+			w.Write([]byte(`[{"title": "Software Engineer", "company_name": "Acme", "url": "https://indeed.com/viewjob?jk=1", "apply_link": "https://acme.com/careers/1", "salary": "$150k a year"}, {"total_jobs": 1, "status": "ok"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	sources := []JobSource{
+		&LinkedIn{APIKey: "test-key", BaseURL: server.URL + "/linkedinjobs"},
+		&GoogleJobs{APIKey: "test-key", BaseURL: server.URL + "/google_jobs"},
+		&Indeed{APIKey: "test-key", BaseURL: server.URL + "/indeed"},
+	}
+	expected := map[string]struct {
+		source string
+		url    string
+		remote bool
+		salary *models.SalaryRange
+	}{
+		"linkedin": {source: "LinkedIn", url: "https://linkedin.com/jobs/1", remote: true},
+		"google":   {source: "Google Jobs", url: "https://acme.com/apply", salary: &models.SalaryRange{Min: 120000, Max: 150000, Currency: "USD", Period: "year", Text: "$120K–$150K a year"}},
+		"indeed":   {source: "Indeed", url: "https://acme.com/careers/1", salary: &models.SalaryRange{Min: 150000, Max: 150000, Currency: "USD", Period: "year", Text: "$150k a year"}},
+	}
+
+	for _, source := range sources {
+		t.Run(source.Name(), func(t *testing.T) {
+			jobs, err := source.Search(context.Background(), "Acme", "Software Engineer", DefaultOptions())
+			assert.NoError(t, err)
+			if assert.Len(t, jobs, 1) {
+				want := expected[source.Name()]
+				assert.Equal(t, "Acme", jobs[0].Company)
+				assert.Equal(t, "Software Engineer", jobs[0].Title)
+				assert.Equal(t, want.source, jobs[0].Source)
+				assert.Equal(t, want.url, jobs[0].URL)
+				assert.Equal(t, want.remote, jobs[0].Remote)
+				assert.Equal(t, want.salary, jobs[0].Salary)
+				assert.NotEmpty(t, jobs[0].Raw)
+				if source.Name() != "indeed" {
+					assert.NotNil(t, jobs[0].PostedAt)
+				}
+			}
+		})
+	}
+
+	t.Run("indeed error status", func(t *testing.T) {
+		indeed := &Indeed{APIKey: "test-key", BaseURL: server.URL + "/missing"}
+		_, err := indeed.Search(context.Background(), "Acme", "Software Engineer", DefaultOptions())
+		assert.Error(t, err)
+	})
+}
+
+// funcSource adapts a function to the JobSource interface
+type funcSource struct {
+	name   string
+	search func(ctx context.Context) ([]models.Job, error)
+}
+
+func (s *funcSource) Name() string { return s.name }
+
+func (s *funcSource) Search(ctx context.Context, company, role string, opts Options) ([]models.Job, error) {
+	return s.search(ctx)
+}
+
+func TestFetcherFetch(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&funcSource{name: "fast", search: func(ctx context.Context) ([]models.Job, error) {
+		return []models.Job{{Title: "Software Engineer"}}, nil
+	}})
+	registry.Register(&funcSource{name: "hung", search: func(ctx context.Context) ([]models.Job, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}})
+	registry.Register(&funcSource{name: "broken", search: func(ctx context.Context) ([]models.Job, error) {
+		return nil, errors.New("bad gateway")
+	}})
+
+	fetcher := &Fetcher{
+		Registry: registry,
+		Timeout:  time.Second,
+		Timeouts: map[string]time.Duration{"hung": 20 * time.Millisecond},
+	}
+
+	start := time.Now()
+	results := fetcher.Fetch(context.Background(), []Query{
+		{Company: "Acme", Role: "Software Engineer"},
+		{Company: "Globex", Role: "Data Scientist"},
+	})
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "hung source should be cut off by its own deadline")
+
+	if assert.Len(t, results, 6) {
+		for i, query := range []string{"Acme", "Globex"} {
+			assert.Equal(t, Result{Source: "fast", Company: query, Role: results[i*3].Role, Status: StatusOK, Count: 1, Jobs: results[i*3].Jobs}, results[i*3])
+			assert.Equal(t, StatusTimeout, results[i*3+1].Status)
+			assert.Equal(t, StatusError, results[i*3+2].Status)
+			assert.Error(t, results[i*3+2].Err)
+		}
+	}
+}
+
+func TestFetcherBoundsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+
+	registry := NewRegistry()
+	registry.Register(&funcSource{name: "slow", search: func(ctx context.Context) ([]models.Job, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return nil, nil
+	}})
+
+	queries := make([]Query, 20)
+	results := (&Fetcher{Registry: registry, Concurrency: 3}).Fetch(context.Background(), queries)
+
+	assert.Len(t, results, 20)
+	assert.LessOrEqual(t, peak, 3)
+}
+
+func TestFetcherCancelledContext(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&funcSource{name: "hung", search: func(ctx context.Context) ([]models.Job, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := (&Fetcher{Registry: registry}).Fetch(ctx, []Query{{Company: "Acme", Role: "Engineer"}})
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, StatusError, results[0].Status)
+		assert.ErrorIs(t, results[0].Err, context.Canceled)
+	}
+}
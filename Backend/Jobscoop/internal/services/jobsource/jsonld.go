@@ -0,0 +1,285 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxCareerPageSize caps how much of a career page is read looking for
+// JobPosting blocks.
+const maxCareerPageSize = 5 << 20
+
+// ldJSONScript matches the <script type="application/ld+json"> blocks pages
+// use to describe themselves with schema.org types.
+var ldJSONScript = regexp.MustCompile(`(?is)<script[^>]*type\s*=\s*["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+
+// jsonLDPosting is a schema.org JobPosting. Most properties may be a single
+// value or a list, a plain string or a nested object, so they are decoded
+// lazily.
+type jsonLDPosting struct {
+	Type               json.RawMessage `json:"@type"`
+	Title              string          `json:"title"`
+	Description        string          `json:"description"`
+	DatePosted         string          `json:"datePosted"`
+	ValidThrough       string          `json:"validThrough"`
+	EmploymentType     json.RawMessage `json:"employmentType"`
+	URL                string          `json:"url"`
+	HiringOrganization json.RawMessage `json:"hiringOrganization"`
+	JobLocation        json.RawMessage `json:"jobLocation"`
+	JobLocationType    string          `json:"jobLocationType"`
+	BaseSalary         json.RawMessage `json:"baseSalary"`
+}
+
+type jsonLDPlace struct {
+	Address json.RawMessage `json:"address"`
+}
+
+type jsonLDAddress struct {
+	AddressLocality string          `json:"addressLocality"`
+	AddressRegion   string          `json:"addressRegion"`
+	AddressCountry  json.RawMessage `json:"addressCountry"`
+}
+
+type jsonLDSalary struct {
+	Currency string          `json:"currency"`
+	Value    json.RawMessage `json:"value"`
+}
+
+type jsonLDQuantity struct {
+	Value    *float64 `json:"value"`
+	MinValue *float64 `json:"minValue"`
+	MaxValue *float64 `json:"maxValue"`
+	UnitText string   `json:"unitText"`
+}
+
+// fetchJSONLD reads the schema.org JobPosting blocks of a career page that
+// isn't a known job board.
+func (s *CareerSites) fetchJSONLD(ctx context.Context, link string) ([]models.Job, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html")
+	resp, err := httpClient(s.Client).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxCareerPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading career page: %w", err)
+	}
+
+	return extractJobPostings(string(page), link, time.Now()), nil
+}
+
+// extractJobPostings maps every JobPosting found in the page's JSON-LD
+// blocks, whether top level, in a list or inside an @graph. Postings past
+// their validThrough date are dropped; pageURL stands in for a missing url.
+func extractJobPostings(page, pageURL string, now time.Time) []models.Job {
+	var jobs []models.Job
+	for _, match := range ldJSONScript.FindAllStringSubmatch(page, -1) {
+		var nodes []json.RawMessage
+		collectJSONLDNodes(json.RawMessage(strings.TrimSpace(match[1])), &nodes)
+
+		for _, raw := range nodes {
+			var posting jsonLDPosting
+			if err := json.Unmarshal(raw, &posting); err != nil || !hasJSONLDType(posting.Type, "JobPosting") {
+				continue
+			}
+			job, ok := mapJSONLDPosting(posting, raw, pageURL, now)
+			if ok {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	return jobs
+}
+
+// collectJSONLDNodes flattens lists and @graph containers into nodes.
+func collectJSONLDNodes(raw json.RawMessage, nodes *[]json.RawMessage) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		for _, item := range list {
+			collectJSONLDNodes(item, nodes)
+		}
+		return
+	}
+
+	var container struct {
+		Graph []json.RawMessage `json:"@graph"`
+	}
+	if err := json.Unmarshal(raw, &container); err != nil {
+		return
+	}
+	if len(container.Graph) > 0 {
+		for _, item := range container.Graph {
+			collectJSONLDNodes(item, nodes)
+		}
+		return
+	}
+	*nodes = append(*nodes, raw)
+}
+
+func mapJSONLDPosting(posting jsonLDPosting, raw json.RawMessage, pageURL string, now time.Time) (models.Job, bool) {
+	title := strings.TrimSpace(html.UnescapeString(posting.Title))
+	if title == "" {
+		return models.Job{}, false
+	}
+	validThrough := parsePostedAt(posting.ValidThrough, now)
+	if validThrough != nil && validThrough.Before(now) {
+		return models.Job{}, false
+	}
+
+	location := jsonLDLocation(posting.JobLocation)
+	link := firstNonEmpty(posting.URL, pageURL)
+	return models.Job{
+		Title:          title,
+		Company:        jsonLDName(posting.HiringOrganization),
+		Location:       location,
+		Remote:         strings.EqualFold(posting.JobLocationType, "TELECOMMUTE") || isRemote(location),
+		Salary:         jsonLDSalaryRange(posting.BaseSalary),
+		PostedAt:       parsePostedAt(posting.DatePosted, now),
+		ValidThrough:   validThrough,
+		EmploymentType: strings.Join(jsonLDStrings(posting.EmploymentType), ", "),
+		URL:            link,
+		ApplyURLs:      appendURL(nil, link),
+		Description:    plainText(posting.Description),
+		Source:         "Career Site",
+		Raw:            raw,
+	}, true
+}
+
+// jsonLDStrings reads a property holding a string or a list of strings.
+func jsonLDStrings(raw json.RawMessage) []string {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		if single == "" {
+			return nil
+		}
+		return []string{single}
+	}
+	var list []string
+	json.Unmarshal(raw, &list)
+	return list
+}
+
+func hasJSONLDType(raw json.RawMessage, want string) bool {
+	for _, t := range jsonLDStrings(raw) {
+		if t == want || strings.HasSuffix(t, "/"+want) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonLDName reads a property holding a name or an object with a name.
+func jsonLDName(raw json.RawMessage) string {
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return strings.TrimSpace(name)
+	}
+	var thing struct {
+		Name string `json:"name"`
+	}
+	json.Unmarshal(raw, &thing)
+	return strings.TrimSpace(thing.Name)
+}
+
+// jsonLDLocation formats one or more Places as "Locality, Region, Country",
+// joining several with " / ".
+func jsonLDLocation(raw json.RawMessage) string {
+	var places []jsonLDPlace
+	if err := json.Unmarshal(raw, &places); err != nil {
+		var place jsonLDPlace
+		if err := json.Unmarshal(raw, &place); err != nil {
+			return ""
+		}
+		places = []jsonLDPlace{place}
+	}
+
+	var locations []string
+	for _, place := range places {
+		var address jsonLDAddress
+		if err := json.Unmarshal(place.Address, &address); err != nil {
+			// Some pages give the address as plain text
+			if text := jsonLDName(place.Address); text != "" {
+				locations = append(locations, text)
+			}
+			continue
+		}
+
+		var parts []string
+		for _, part := range []string{address.AddressLocality, address.AddressRegion, jsonLDName(address.AddressCountry)} {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		if len(parts) > 0 {
+			locations = append(locations, strings.Join(parts, ", "))
+		}
+	}
+	return strings.Join(locations, " / ")
+}
+
+// jsonLDSalaryRange reads a MonetaryAmount whose value is a number or a
+// QuantitativeValue with a single value or a min/max range.
+func jsonLDSalaryRange(raw json.RawMessage) *models.SalaryRange {
+	if len(raw) == 0 {
+		return nil
+	}
+	var amount jsonLDSalary
+	if err := json.Unmarshal(raw, &amount); err != nil {
+		return nil
+	}
+
+	var quantity jsonLDQuantity
+	var number float64
+	if err := json.Unmarshal(amount.Value, &number); err == nil {
+		quantity.Value = &number
+	} else if err := json.Unmarshal(amount.Value, &quantity); err != nil {
+		return nil
+	}
+
+	salary := &models.SalaryRange{Currency: strings.ToUpper(amount.Currency)}
+	switch {
+	case quantity.MinValue != nil || quantity.MaxValue != nil:
+		if quantity.MinValue != nil {
+			salary.Min = *quantity.MinValue
+		}
+		salary.Max = salary.Min
+		if quantity.MaxValue != nil {
+			salary.Max = *quantity.MaxValue
+		}
+	case quantity.Value != nil:
+		salary.Min, salary.Max = *quantity.Value, *quantity.Value
+	default:
+		return nil
+	}
+
+	switch strings.ToUpper(quantity.UnitText) {
+	case "HOUR":
+		salary.Period = "hour"
+	case "DAY":
+		salary.Period = "day"
+	case "WEEK":
+		salary.Period = "week"
+	case "MONTH":
+		salary.Period = "month"
+	case "YEAR":
+		salary.Period = "year"
+	}
+	return salary
+}
@@ -0,0 +1,89 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// leverPosting is a single posting from the Lever postings API
+type leverPosting struct {
+	ID         string `json:"id"`
+	Text       string `json:"text"`
+	HostedURL  string `json:"hostedUrl"`
+	ApplyURL   string `json:"applyUrl"`
+	CreatedAt  int64  `json:"createdAt"` // milliseconds since the epoch
+	Categories struct {
+		Location   string `json:"location"`
+		Commitment string `json:"commitment"`
+	} `json:"categories"`
+	WorkplaceType    string `json:"workplaceType"`
+	DescriptionPlain string `json:"descriptionPlain"`
+	SalaryRange      *struct {
+		Min      float64 `json:"min"`
+		Max      float64 `json:"max"`
+		Currency string  `json:"currency"`
+		Interval string  `json:"interval"` // e.g. "per-year-salary", "per-hour-wage"
+	} `json:"salaryRange"`
+}
+
+func (s *CareerSites) fetchLever(ctx context.Context, board Board) ([]models.Job, error) {
+	endpoint := s.LeverAPI + "/" + url.PathEscape(board.Token) + "?mode=json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response []json.RawMessage
+	if err := s.getJSON(req, &response); err != nil {
+		return nil, err
+	}
+
+	var jobs []models.Job
+	for _, raw := range response {
+		var posting leverPosting
+		if err := json.Unmarshal(raw, &posting); err != nil || posting.Text == "" {
+			continue
+		}
+
+		job := models.Job{
+			Title:          posting.Text,
+			Location:       posting.Categories.Location,
+			Remote:         posting.WorkplaceType == "remote" || isRemote(posting.Categories.Location),
+			EmploymentType: posting.Categories.Commitment,
+			URL:            posting.HostedURL,
+			ApplyURLs:      appendURL(appendURL(nil, posting.ApplyURL), posting.HostedURL),
+			Description:    posting.DescriptionPlain,
+			Source:         "Lever",
+			Raw:            raw,
+		}
+		if posting.CreatedAt > 0 {
+			postedAt := time.UnixMilli(posting.CreatedAt).UTC()
+			job.PostedAt = &postedAt
+		}
+		if posting.SalaryRange != nil {
+			job.Salary = &models.SalaryRange{
+				Min:      posting.SalaryRange.Min,
+				Max:      posting.SalaryRange.Max,
+				Currency: posting.SalaryRange.Currency,
+				Period:   leverSalaryPeriod(posting.SalaryRange.Interval),
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// leverSalaryPeriod maps Lever's "per-<period>-<salary|wage>" intervals
+func leverSalaryPeriod(interval string) string {
+	for _, period := range []string{"hour", "day", "week", "month", "year"} {
+		if strings.Contains(interval, "per-"+period) {
+			return period
+		}
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const ScrapingDogLinkedInAPI = "http://api.scrapingdog.com/linkedinjobs"
+
+// LinkedIn searches LinkedIn job listings through ScrapingDog.
+type LinkedIn struct {
+	APIKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewLinkedIn(apiKey string) *LinkedIn {
+	return &LinkedIn{APIKey: apiKey, BaseURL: ScrapingDogLinkedInAPI}
+}
+
+func (s *LinkedIn) Name() string { return "linkedin" }
+
+// linkedInJob is a single posting in the ScrapingDog LinkedIn response
+type linkedInJob struct {
+	JobPosition    string `json:"job_position"`
+	JobLink        string `json:"job_link"`
+	CompanyName    string `json:"company_name"`
+	JobLocation    string `json:"job_location"`
+	Location       string `json:"location"`
+	JobPostingDate string `json:"job_posting_date"`
+}
+
+func (s *LinkedIn) Search(ctx context.Context, company, role string, opts Options) ([]models.Job, error) {
+	params := url.Values{}
+	params.Add("api_key", s.APIKey)
+	params.Add("field", role+" AND "+company)
+	params.Add("geoid", opts.GeoID)
+	params.Add("page", opts.Page)
+	params.Add("sort_by", opts.SortBy)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient(s.Client).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to LinkedIn jobs API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	// LinkedIn returns an array; keep each element's raw JSON alongside the mapped job
+	var apiResponse []json.RawMessage
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, fmt.Errorf("error parsing JSON response: %w", err)
+	}
+
+	now := time.Now()
+	var jobs []models.Job
+	for _, raw := range apiResponse {
+		var posting linkedInJob
+		if err := json.Unmarshal(raw, &posting); err != nil || posting.JobPosition == "" {
+			continue
+		}
+		jobs = append(jobs, mapLinkedInJob(posting, raw, now))
+	}
+	return jobs, nil
+}
+
+func mapLinkedInJob(posting linkedInJob, raw json.RawMessage, now time.Time) models.Job {
+	location := firstNonEmpty(posting.JobLocation, posting.Location)
+	return models.Job{
+		Title:     posting.JobPosition,
+		Company:   posting.CompanyName,
+		Location:  location,
+		Remote:    isRemote(location, posting.JobPosition),
+		PostedAt:  parsePostedAt(posting.JobPostingDate, now),
+		URL:       posting.JobLink,
+		ApplyURLs: appendURL(nil, posting.JobLink),
+		Source:    "LinkedIn",
+		Raw:       raw,
+	}
+}
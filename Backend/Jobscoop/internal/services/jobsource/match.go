@@ -0,0 +1,64 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"strings"
+)
+
+// FilterJobs keeps the jobs whose company and title match the subscription
+func FilterJobs(allJobs []models.Job, company string, jobRole string) []models.Job {
+	var filteredJobs []models.Job
+	for _, job := range allJobs {
+		// Skip postings missing the fields we match on
+		if job.Company == "" || job.Title == "" {
+			continue
+		}
+
+		// Check if company matches
+		companyMatches := strings.EqualFold(job.Company, company) ||
+			strings.Contains(strings.ToLower(job.Company), strings.ToLower(company)) ||
+			strings.Contains(strings.ToLower(company), strings.ToLower(job.Company))
+
+		// Check if job role matches
+		// Split role into words and check if all words appear in the job title
+		roleWords := strings.Fields(strings.ToLower(jobRole))
+		roleMatches := true
+
+		for _, word := range roleWords {
+			// Skip common words that might be too generic
+			if len(word) <= 2 || isCommonWord(word) {
+				continue
+			}
+
+			if !strings.Contains(strings.ToLower(job.Title), word) {
+				roleMatches = false
+				break
+			}
+		}
+
+		// Add to filtered results if both company and role match
+		if companyMatches && roleMatches {
+			filteredJobs = append(filteredJobs, job)
+		}
+	}
+
+	return filteredJobs
+}
+
+// Helper function to identify common words that shouldn't be used for matching
+func isCommonWord(word string) bool {
+	commonWords := map[string]bool{
+		"and": true,
+		"or":  true,
+		"the": true,
+		"for": true,
+		"in":  true,
+		"at":  true,
+		"of":  true,
+		"to":  true,
+		"a":   true,
+		"an":  true,
+	}
+
+	return commonWords[word]
+}
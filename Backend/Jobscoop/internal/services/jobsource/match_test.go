@@ -0,0 +1,37 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCommonWord(t *testing.T) {
+	commonWords := []string{"and", "or", "the", "for", "in", "at", "of", "to", "a", "an"}
+	nonCommonWords := []string{"job", "developer", "engineer", "senior", "software"}
+
+	for _, word := range commonWords {
+		assert.True(t, isCommonWord(word), "Expected %s to be identified as common word", word)
+	}
+
+	for _, word := range nonCommonWords {
+		assert.False(t, isCommonWord(word), "Expected %s to be identified as non-common word", word)
+	}
+}
+func TestFilterJobs(t *testing.T) {
+	jobs := []models.Job{
+		{Title: "Software Engineer", Company: "Mock Company"},
+		{Title: "Senior Software Engineer", Company: "Mock Company Inc."},
+		{Title: "Data Scientist", Company: "Mock Company"},
+		{Title: "Software Engineer", Company: "Different Company"},
+		{Title: "", Company: "Mock Company"},
+	}
+
+	filtered := FilterJobs(jobs, "Mock Company", "Software Engineer")
+
+	if assert.Len(t, filtered, 2) {
+		assert.Equal(t, "Software Engineer", filtered[0].Title)
+		assert.Equal(t, "Senior Software Engineer", filtered[1].Title)
+	}
+}
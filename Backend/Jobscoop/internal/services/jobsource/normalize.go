@@ -0,0 +1,176 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The helpers below turn the free-text fields the scraped boards return into
+// the typed fields of models.Job.
+
+var (
+	htmlTag      = regexp.MustCompile(`<[^>]*>`)
+	salaryAmount = regexp.MustCompile(`(\d[\d,]*(?:\.\d+)?)\s*([kK])?`)
+	relativeAge  = regexp.MustCompile(`(\d+)\+?\s*(minute|hour|day|week|month)s?\s+ago`)
+)
+
+var salaryPeriods = []struct {
+	keywords []string
+	period   string
+}{
+	{[]string{"an hour", "per hour", "/hr", "/hour", "hourly"}, "hour"},
+	{[]string{"a day", "per day", "/day", "daily"}, "day"},
+	{[]string{"a week", "per week", "/week", "weekly"}, "week"},
+	{[]string{"a month", "per month", "/month", "/mo", "monthly"}, "month"},
+	{[]string{"a year", "per year", "/yr", "/year", "annually", "yearly", "per annum"}, "year"},
+}
+
+// parseSalary reads ranges such as "$120,000 - $150,000 a year" or
+// "$45–60K a year". It returns nil for empty text and keeps the original
+// wording in Text so nothing is lost when parsing is partial.
+func parseSalary(text string) *models.SalaryRange {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+
+	salary := &models.SalaryRange{Text: text}
+	lower := strings.ToLower(text)
+
+	var amounts []float64
+	thousands := false
+	for _, match := range salaryAmount.FindAllStringSubmatch(text, 2) {
+		amount, err := strconv.ParseFloat(strings.ReplaceAll(match[1], ",", ""), 64)
+		if err != nil {
+			continue
+		}
+		if match[2] != "" {
+			amount *= 1000
+			thousands = true
+		}
+		amounts = append(amounts, amount)
+	}
+	if len(amounts) > 0 {
+		salary.Min, salary.Max = amounts[0], amounts[0]
+	}
+	if len(amounts) > 1 {
+		salary.Max = amounts[1]
+		// "45–60K" puts the suffix on the upper bound only
+		if thousands && salary.Min < 1000 {
+			salary.Min *= 1000
+		}
+	}
+
+	switch {
+	case strings.Contains(text, "$"):
+		salary.Currency = "USD"
+	case strings.Contains(text, "€"):
+		salary.Currency = "EUR"
+	case strings.Contains(text, "£"):
+		salary.Currency = "GBP"
+	}
+
+	for _, candidate := range salaryPeriods {
+		for _, keyword := range candidate.keywords {
+			if strings.Contains(lower, keyword) {
+				salary.Period = candidate.period
+				return salary
+			}
+		}
+	}
+	return salary
+}
+
+// parsePostedAt understands absolute dates ("2025-03-20", RFC 3339) and the
+// relative ages job boards show ("3 days ago", "Just posted", "Today").
+func parsePostedAt(text string, now time.Time) *time.Time {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02", "January 2, 2006", "Jan 2, 2006"} {
+		if t, err := time.Parse(layout, text); err == nil {
+			t = t.UTC()
+			return &t
+		}
+	}
+	text = strings.ToLower(text)
+
+	if strings.Contains(text, "just posted") || strings.Contains(text, "today") || strings.Contains(text, "just now") {
+		t := now.UTC()
+		return &t
+	}
+	if strings.Contains(text, "yesterday") {
+		t := now.UTC().AddDate(0, 0, -1)
+		return &t
+	}
+
+	match := relativeAge.FindStringSubmatch(text)
+	if match == nil {
+		return nil
+	}
+	n, _ := strconv.Atoi(match[1])
+	var t time.Time
+	switch match[2] {
+	case "minute":
+		t = now.Add(-time.Duration(n) * time.Minute)
+	case "hour":
+		t = now.Add(-time.Duration(n) * time.Hour)
+	case "day":
+		t = now.AddDate(0, 0, -n)
+	case "week":
+		t = now.AddDate(0, 0, -7*n)
+	case "month":
+		t = now.AddDate(0, -n, 0)
+	}
+	t = t.UTC()
+	return &t
+}
+
+// isRemote reports whether any of the fields describe remote work.
+func isRemote(fields ...string) bool {
+	for _, field := range fields {
+		lower := strings.ToLower(field)
+		if strings.Contains(lower, "remote") || strings.Contains(lower, "work from home") {
+			return true
+		}
+	}
+	return false
+}
+
+// appendURL appends link to urls unless it is empty or already present.
+func appendURL(urls []string, link string) []string {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return urls
+	}
+	for _, existing := range urls {
+		if existing == link {
+			return urls
+		}
+	}
+	return append(urls, link)
+}
+
+// firstNonEmpty returns the first value that isn't blank.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// plainText turns an HTML description, possibly entity-escaped as Greenhouse
+// sends it, into whitespace-collapsed text.
+func plainText(description string) string {
+	text := html.UnescapeString(description)
+	text = htmlTag.ReplaceAllString(text, " ")
+	return strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+}
@@ -0,0 +1,55 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSalary(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected *models.SalaryRange
+	}{
+		{"", nil},
+		{"$120,000 - $150,000 a year", &models.SalaryRange{Min: 120000, Max: 150000, Currency: "USD", Period: "year", Text: "$120,000 - $150,000 a year"}},
+		{"45–60K per year", &models.SalaryRange{Min: 45000, Max: 60000, Period: "year", Text: "45–60K per year"}},
+		{"£30 an hour", &models.SalaryRange{Min: 30, Max: 30, Currency: "GBP", Period: "hour", Text: "£30 an hour"}},
+		{"Competitive", &models.SalaryRange{Text: "Competitive"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parseSalary(tt.text))
+		})
+	}
+}
+
+func TestParsePostedAt(t *testing.T) {
+	now := time.Date(2025, 3, 20, 12, 0, 0, 0, time.UTC)
+	date := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		text     string
+		expected *time.Time
+	}{
+		{"", nil},
+		{"2025-03-01T09:30:00-04:00", date(time.Date(2025, 3, 1, 13, 30, 0, 0, time.UTC))},
+		{"2025-03-01", date(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))},
+		{"March 1, 2025", date(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))},
+		{"Just posted", date(now)},
+		{"Yesterday", date(now.AddDate(0, 0, -1))},
+		{"3 days ago", date(now.AddDate(0, 0, -3))},
+		{"30+ days ago", date(now.AddDate(0, 0, -30))},
+		{"5 hours ago", date(now.Add(-5 * time.Hour))},
+		{"Full-time", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parsePostedAt(tt.text, now))
+		})
+	}
+}
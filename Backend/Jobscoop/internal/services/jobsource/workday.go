@@ -0,0 +1,89 @@
+package jobsource
+
+import (
+	"JobScoop/internal/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	workdayPageSize = 20
+	workdayMaxPages = 5
+)
+
+// workdayPosting is a single search result from a Workday career site
+type workdayPosting struct {
+	Title         string `json:"title"`
+	ExternalPath  string `json:"externalPath"`
+	LocationsText string `json:"locationsText"`
+	PostedOn      string `json:"postedOn"` // e.g. "Posted 3 Days Ago"
+	RemoteType    string `json:"remoteType"`
+}
+
+// fetchWorkday searches the site for the role; Workday has no endpoint
+// listing a whole board, only a paged search.
+func (s *CareerSites) fetchWorkday(ctx context.Context, board Board, role string) ([]models.Job, error) {
+	base := "https://" + board.Host
+	if s.WorkdayAPI != "" {
+		base = s.WorkdayAPI
+	}
+	endpoint := base + "/wday/cxs/" + url.PathEscape(board.Token) + "/" + url.PathEscape(board.Site) + "/jobs"
+	siteURL := "https://" + board.Host + "/" + board.Site
+
+	now := time.Now()
+	var jobs []models.Job
+	for page := 0; page < workdayMaxPages; page++ {
+		body, err := json.Marshal(map[string]interface{}{
+			"appliedFacets": map[string]interface{}{},
+			"limit":         workdayPageSize,
+			"offset":        page * workdayPageSize,
+			"searchText":    role,
+		})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		var response struct {
+			Total       int               `json:"total"`
+			JobPostings []json.RawMessage `json:"jobPostings"`
+		}
+		if err := s.getJSON(req, &response); err != nil {
+			return nil, err
+		}
+
+		for _, raw := range response.JobPostings {
+			var posting workdayPosting
+			if err := json.Unmarshal(raw, &posting); err != nil || posting.Title == "" {
+				continue
+			}
+			link := ""
+			if posting.ExternalPath != "" {
+				link = siteURL + posting.ExternalPath
+			}
+			jobs = append(jobs, models.Job{
+				Title:     posting.Title,
+				Location:  posting.LocationsText,
+				Remote:    isRemote(posting.RemoteType, posting.LocationsText),
+				PostedAt:  parsePostedAt(posting.PostedOn, now),
+				URL:       link,
+				ApplyURLs: appendURL(nil, link),
+				Source:    "Workday",
+				Raw:       raw,
+			})
+		}
+
+		if len(response.JobPostings) < workdayPageSize || (page+1)*workdayPageSize >= response.Total {
+			break
+		}
+	}
+	return jobs, nil
+}
@@ -0,0 +1,136 @@
+// Package mail sends the app's outbound email through the configured SMTP
+// server.
+package mail
+
+import (
+	"JobScoop/config"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Config holds the SMTP settings. From defaults to User.
+type Config struct {
+	Host string
+	Port string
+	User string
+	Pass string
+	From string
+}
+
+// ConfigFrom returns the SMTP settings in cfg.
+func ConfigFrom(cfg config.SMTP) Config {
+	smtpConfig := Config{Host: cfg.Host, Port: cfg.Port, User: cfg.User, Pass: cfg.Pass, From: cfg.From}
+	if smtpConfig.From == "" {
+		smtpConfig.From = smtpConfig.User
+	}
+	return smtpConfig
+}
+
+// Message is an email with a plain-text body and an optional HTML
+// alternative.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Sender delivers messages.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// SMTPSender delivers messages through an SMTP server.
+type SMTPSender struct {
+	Config Config
+}
+
+func NewSMTPSender(config Config) *SMTPSender {
+	return &SMTPSender{Config: config}
+}
+
+// Send delivers msg, authenticating with PLAIN auth when a user is set.
+func (s *SMTPSender) Send(msg Message) error {
+	if s.Config.Host == "" || s.Config.Port == "" {
+		return errors.New("mail: SMTP_HOST and SMTP_PORT must be set")
+	}
+
+	var auth smtp.Auth
+	if s.Config.User != "" {
+		auth = smtp.PlainAuth("", s.Config.User, s.Config.Pass, s.Config.Host)
+	}
+
+	body, err := Build(s.Config.From, msg)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Config.Host+":"+s.Config.Port, auth, s.Config.From, []string{msg.To}, body)
+}
+
+// Build renders msg as a MIME message: text/plain alone, or
+// multipart/alternative when it has an HTML body.
+func Build(from string, msg Message) ([]byte, error) {
+	if strings.ContainsAny(msg.To+msg.Subject+from, "\r\n") {
+		return nil, errors.New("mail: header values must not contain newlines")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	boundary, err := newBoundary()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, part.body); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, body string) error {
+	w := quotedprintable.NewWriter(buf)
+	if _, err := w.Write([]byte(body)); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func newBoundary() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "jobscoop-" + hex.EncodeToString(b), nil
+}
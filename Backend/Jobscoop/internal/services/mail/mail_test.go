@@ -0,0 +1,73 @@
+package mail_test
+
+import (
+	"JobScoop/internal/services/mail"
+	"JobScoop/internal/services/mail/mailtest"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMTPSenderSend(t *testing.T) {
+	server := mailtest.NewServer(t)
+	sender := mail.NewSMTPSender(server.Config())
+
+	err := sender.Send(mail.Message{
+		To:      "jane@example.com",
+		Subject: "3 new jobs at Acme",
+		Text:    "Software Engineer\nhttps://acme.com/jobs/42\n",
+		HTML:    "<p><a href=\"https://acme.com/jobs/42\">Software Engineer</a></p>",
+	})
+	assert.NoError(t, err)
+
+	messages := server.WaitForMessages(1, time.Second)
+	if !assert.Len(t, messages, 1) {
+		return
+	}
+	assert.Equal(t, "alerts@jobscoop.test", messages[0].From)
+	assert.Equal(t, []string{"jane@example.com"}, messages[0].To)
+
+	msg, err := netmail.ReadMessage(strings.NewReader(messages[0].Data))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "3 new jobs at Acme", msg.Header.Get("Subject"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		body, _ := io.ReadAll(part)
+		bodies = append(bodies, part.Header.Get("Content-Type")+"|"+string(body))
+	}
+	assert.Equal(t, []string{
+		"text/plain; charset=utf-8|Software Engineer\r\nhttps://acme.com/jobs/42\r\n",
+		"text/html; charset=utf-8|<p><a href=\"https://acme.com/jobs/42\">Software Engineer</a></p>",
+	}, bodies)
+}
+
+func TestBuildRejectsHeaderInjection(t *testing.T) {
+	_, err := mail.Build("alerts@jobscoop.test", mail.Message{To: "jane@example.com\r\nBcc: eve@example.com", Text: "hi"})
+	assert.Error(t, err)
+}
+
+func TestSMTPSenderRequiresServer(t *testing.T) {
+	err := mail.NewSMTPSender(mail.Config{}).Send(mail.Message{To: "jane@example.com", Text: "hi"})
+	assert.Error(t, err)
+}
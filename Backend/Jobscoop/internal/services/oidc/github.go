@@ -0,0 +1,125 @@
+package oidc
+
+import (
+	"JobScoop/config"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GitHub's endpoints.
+const (
+	GitHubAuthURL  = "https://github.com/login/oauth/authorize"
+	GitHubTokenURL = "https://github.com/login/oauth/access_token"
+	GitHubAPIURL   = "https://api.github.com"
+)
+
+// GitHubScopes are requested from GitHub unless others are configured;
+// user:email is needed to read the account's verified emails.
+var GitHubScopes = []string{"read:user", "user:email"}
+
+// GitHub signs users in with their GitHub accounts through an OAuth2 app.
+// GitHub issues no ID tokens, so the identity is read from its API with
+// the access token the code is redeemed for.
+type GitHub struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string // GitHubScopes when empty
+	AuthorizeURL string
+	TokenURL     string
+	APIURL       string
+	Client       *http.Client
+}
+
+// NewGitHub returns the GitHub OAuth2 app cfg configures, at github.com
+// unless cfg overrides its endpoints.
+func NewGitHub(cfg config.OIDCProvider, client *http.Client) *GitHub {
+	p := &GitHub{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		Scopes:       cfg.Scopes,
+		AuthorizeURL: cfg.AuthURL,
+		TokenURL:     cfg.TokenURL,
+		APIURL:       cfg.APIURL,
+		Client:       client,
+	}
+	if p.AuthorizeURL == "" {
+		p.AuthorizeURL = GitHubAuthURL
+	}
+	if p.TokenURL == "" {
+		p.TokenURL = GitHubTokenURL
+	}
+	if p.APIURL == "" {
+		p.APIURL = GitHubAPIURL
+	}
+	return p
+}
+
+// AuthURL returns GitHub's authorization page. GitHub has no use for the
+// nonce; the state and PKCE challenge protect the sign-in.
+func (p *GitHub) AuthURL(ctx context.Context, auth Auth, redirectURI string) (string, error) {
+	return withQuery(p.AuthorizeURL, url.Values{
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {scopes(p.Scopes, GitHubScopes)},
+		"state":                 {auth.State},
+		"code_challenge":        {auth.Challenge()},
+		"code_challenge_method": {"S256"},
+	})
+}
+
+// Exchange redeems the code and reads the account and its primary email
+// from the API.
+func (p *GitHub) Exchange(ctx context.Context, code string, auth Auth, redirectURI string) (Identity, error) {
+	form := url.Values{
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {auth.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	tokens, err := redeem(p.Client, req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("oidc: redeeming the code from GitHub: %w", err)
+	}
+
+	api := strings.TrimSuffix(p.APIURL, "/")
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, p.Client, api+"/user", tokens.AccessToken, &user); err != nil {
+		return Identity{}, fmt.Errorf("oidc: reading the GitHub user: %w", err)
+	}
+	if user.ID == 0 {
+		return Identity{}, errors.New("oidc: the GitHub user has no ID")
+	}
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.Client, api+"/user/emails", tokens.AccessToken, &emails); err != nil {
+		return Identity{}, fmt.Errorf("oidc: reading the GitHub user's emails: %w", err)
+	}
+
+	identity := Identity{Subject: strconv.FormatInt(user.ID, 10), Name: user.Name}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email, identity.EmailVerified = email.Email, email.Verified
+		}
+	}
+	return identity, nil
+}
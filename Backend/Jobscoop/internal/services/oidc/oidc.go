@@ -0,0 +1,183 @@
+// Package oidc signs users in with their accounts at OpenID Connect
+// providers, such as Google or a company's identity provider, and at
+// GitHub, whose OAuth2 apps don't speak OpenID Connect. Both use the
+// authorization code flow with PKCE.
+package oidc
+
+import (
+	"JobScoop/config"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds each request to a provider.
+const DefaultTimeout = 10 * time.Second
+
+// defaultClient makes the requests of providers without a Client.
+var defaultClient = &http.Client{Timeout: DefaultTimeout}
+
+// Identity is the account at a provider a user signed in as.
+type Identity struct {
+	Subject       string // the provider's stable ID for the account
+	Email         string
+	EmailVerified bool // whether the provider vouches that the account owns Email
+	Name          string
+}
+
+// Provider sends users to sign in and tells who they signed in as.
+type Provider interface {
+	// AuthURL returns where to send the user to sign in, after which the
+	// provider redirects to redirectURI with a code and auth's state.
+	AuthURL(ctx context.Context, auth Auth, redirectURI string) (string, error)
+	// Exchange redeems the code the provider redirected with for the
+	// identity that signed in, checking it was issued for auth.
+	Exchange(ctx context.Context, code string, auth Auth, redirectURI string) (Identity, error)
+}
+
+// New returns the provider cfg configures, making its requests with
+// client, or with a client that gives up after DefaultTimeout when nil.
+func New(cfg config.OIDCProvider, client *http.Client) Provider {
+	if cfg.Type == "github" {
+		return NewGitHub(cfg, client)
+	}
+	return NewOpenID(cfg, client)
+}
+
+// Auth holds the secrets tying the redirect back from a provider to the
+// sign-in that started it: the state the provider echoes, the nonce it signs
+// into the ID token and the PKCE verifier the code can only be redeemed
+// with.
+type Auth struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewAuth returns random secrets for a new sign-in.
+func NewAuth() (Auth, error) {
+	var secrets [3]string
+	for i := range secrets {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return Auth{}, err
+		}
+		secrets[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return Auth{State: secrets[0], Nonce: secrets[1], Verifier: secrets[2]}, nil
+}
+
+// Challenge returns the S256 PKCE challenge of the verifier, which the
+// provider checks the verifier against when the code is redeemed.
+func (a Auth) Challenge() string {
+	sum := sha256.Sum256([]byte(a.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// withQuery adds params to the query of endpoint, keeping any it has.
+func withQuery(endpoint string, params url.Values) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// tokenResponse is a token endpoint's answer. Errors are described by
+// Error, which GitHub sends with a 200 status.
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// redeem posts a request for tokens, built by the caller, to a token
+// endpoint.
+func redeem(client *http.Client, req *http.Request) (tokenResponse, error) {
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient(client).Do(req)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var tokens tokenResponse
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return tokenResponse{}, fmt.Errorf("error reading the token response: %w", err)
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil && resp.StatusCode == http.StatusOK {
+		return tokenResponse{}, fmt.Errorf("error parsing the token response: %w", err)
+	}
+	if tokens.Error != "" {
+		return tokenResponse{}, fmt.Errorf("code refused: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return tokenResponse{}, fmt.Errorf("unexpected status code %d from the token endpoint", resp.StatusCode)
+	}
+	if tokens.AccessToken == "" {
+		return tokenResponse{}, errors.New("no access token in the token response")
+	}
+	return tokens, nil
+}
+
+// getJSON fetches endpoint into v, authorized by accessToken unless it is
+// empty.
+func getJSON(ctx context.Context, client *http.Client, endpoint, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := httpClient(client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, endpoint)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error parsing JSON response: %w", err)
+	}
+	return nil
+}
+
+func httpClient(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	return defaultClient
+}
+
+// scopes returns the configured scopes, or defaults when there are none.
+func scopes(configured, defaults []string) string {
+	if len(configured) == 0 {
+		configured = defaults
+	}
+	return strings.Join(configured, " ")
+}
@@ -0,0 +1,177 @@
+package oidc_test
+
+import (
+	"JobScoop/config"
+	"JobScoop/internal/services/oidc"
+	"JobScoop/internal/services/oidc/oidctest"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURI = "http://localhost:3000/oidc/callback"
+
+// signIn runs a sign-in at the server up to the redirect back, returning
+// its secrets and the code.
+func signIn(t *testing.T, server *oidctest.Server, provider oidc.Provider) (oidc.Auth, string) {
+	t.Helper()
+	auth, err := oidc.NewAuth()
+	require.NoError(t, err)
+	authURL, err := provider.AuthURL(context.Background(), auth, redirectURI)
+	require.NoError(t, err)
+	query := server.Authorize(t, authURL)
+	require.Empty(t, query.Get("error"))
+	require.Equal(t, auth.State, query.Get("state"))
+	return auth, query.Get("code")
+}
+
+func TestOpenID(t *testing.T) {
+	server := oidctest.NewServer(t)
+	identity := oidc.Identity{Subject: "sub-1", Email: "test@example.com", EmailVerified: true, Name: "Test User"}
+	server.SignIn(identity)
+	provider := oidc.New(server.Config(), nil)
+
+	auth, code := signIn(t, server, provider)
+	got, err := provider.Exchange(context.Background(), code, auth, redirectURI)
+	require.NoError(t, err)
+	assert.Equal(t, identity, got)
+
+	// Codes are redeemed once
+	_, err = provider.Exchange(context.Background(), code, auth, redirectURI)
+	assert.ErrorContains(t, err, "invalid_grant")
+
+	// Signing keys are fetched again once the provider rotates them
+	server.RotateKey(t)
+	auth, code = signIn(t, server, provider)
+	_, err = provider.Exchange(context.Background(), code, auth, redirectURI)
+	assert.NoError(t, err)
+}
+
+func TestOpenIDRefusals(t *testing.T) {
+	server := oidctest.NewServer(t)
+	server.SignIn(oidc.Identity{Subject: "sub-1", Email: "test@example.com", EmailVerified: true})
+	provider := oidc.New(server.Config(), nil)
+
+	t.Run("Wrong verifier", func(t *testing.T) {
+		auth, code := signIn(t, server, provider)
+		auth.Verifier = "intercepted"
+		_, err := provider.Exchange(context.Background(), code, auth, redirectURI)
+		assert.ErrorContains(t, err, "invalid_grant")
+	})
+
+	t.Run("Wrong nonce", func(t *testing.T) {
+		auth, code := signIn(t, server, provider)
+		auth.Nonce = "another sign-in"
+		_, err := provider.Exchange(context.Background(), code, auth, redirectURI)
+		assert.ErrorContains(t, err, "issued for another sign-in")
+	})
+
+	for name, test := range map[string]struct {
+		change func(jwt.MapClaims)
+		err    string
+	}{
+		"Other audience": {func(c jwt.MapClaims) { c["aud"] = "another-app" }, "issued to another client"},
+		"Other issuer":   {func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, `issued by "https://evil.example.com"`},
+		"Expired":        {func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "expired"},
+		"No expiry":      {func(c jwt.MapClaims) { delete(c, "exp") }, "expired"},
+		"Not valid yet":  {func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }, "not valid yet"},
+		"Other party": {func(c jwt.MapClaims) {
+			c["aud"], c["azp"] = []string{"jobscoop", "another-app"}, "another-app"
+		}, "issued to another client"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server.IDTokenClaims = test.change
+			defer func() { server.IDTokenClaims = nil }()
+			auth, code := signIn(t, server, provider)
+			_, err := provider.Exchange(context.Background(), code, auth, redirectURI)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+
+	t.Run("Wrong secret", func(t *testing.T) {
+		cfg := server.Config()
+		cfg.ClientSecret = "guessed"
+		provider := oidc.New(cfg, nil)
+		auth, code := signIn(t, server, provider)
+		_, err := provider.Exchange(context.Background(), code, auth, redirectURI)
+		assert.ErrorContains(t, err, "invalid_client")
+	})
+
+	t.Run("Other issuer's discovery document", func(t *testing.T) {
+		cfg := server.Config()
+		cfg.Issuer = server.URL + "/"
+		_, err := oidc.New(cfg, nil).AuthURL(context.Background(), oidc.Auth{}, redirectURI)
+		assert.ErrorContains(t, err, "is for issuer")
+	})
+}
+
+func TestGitHub(t *testing.T) {
+	auth, err := oidc.NewAuth()
+	require.NoError(t, err)
+
+	api := http.NewServeMux()
+	api.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		// GitHub answers refused codes with a 200
+		if r.PostFormValue("code") != "good-code" || r.PostFormValue("client_secret") != "secret" ||
+			r.PostFormValue("code_verifier") != auth.Verifier {
+			json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gho_token", "token_type": "bearer"})
+	})
+	api.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gho_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 42, "login": "octocat", "name": ""})
+	})
+	api.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"email": "old@example.com", "primary": false, "verified": true},
+			{"email": "octocat@example.com", "primary": true, "verified": true},
+		})
+	})
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	provider := oidc.New(config.OIDCProvider{
+		Type: "github", ClientID: "id", ClientSecret: "secret",
+		AuthURL: "https://github.test/login/oauth/authorize", TokenURL: server.URL + "/login/oauth/access_token", APIURL: server.URL,
+	}, nil)
+
+	authURL, err := provider.AuthURL(context.Background(), auth, redirectURI)
+	require.NoError(t, err)
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "github.test", u.Host)
+	assert.Equal(t, url.Values{
+		"client_id":             {"id"},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"read:user user:email"},
+		"state":                 {auth.State},
+		"code_challenge":        {auth.Challenge()},
+		"code_challenge_method": {"S256"},
+	}, u.Query())
+
+	identity, err := provider.Exchange(context.Background(), "good-code", auth, redirectURI)
+	require.NoError(t, err)
+	assert.Equal(t, oidc.Identity{Subject: "42", Email: "octocat@example.com", EmailVerified: true, Name: "octocat"}, identity)
+
+	_, err = provider.Exchange(context.Background(), "used-code", auth, redirectURI)
+	assert.ErrorContains(t, err, "bad_verification_code")
+}
+
+func TestChallenge(t *testing.T) {
+	// RFC 7636, appendix B
+	auth := oidc.Auth{Verifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"}
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", auth.Challenge())
+}
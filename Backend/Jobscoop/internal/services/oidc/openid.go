@@ -0,0 +1,296 @@
+package oidc
+
+import (
+	"JobScoop/config"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DefaultScopes are requested from OpenID Connect providers unless others
+// are configured.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// clockSkew is how far the provider's clock may be off when checking when
+// an ID token was issued and expires.
+const clockSkew = time.Minute
+
+// signingMethods are the algorithms ID tokens may be signed with. Tokens
+// signed with a shared secret, or not at all, are refused.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// OpenID is an OpenID Connect provider, whose endpoints and signing keys
+// are found through its issuer's discovery document. Both are cached; the
+// keys are fetched again when a token is signed with a new one.
+type OpenID struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string // DefaultScopes when empty
+	Client       *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     map[string]crypto.PublicKey // by key ID
+}
+
+// metadata is the part of a discovery document used.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOpenID returns the OpenID Connect provider cfg configures.
+func NewOpenID(cfg config.OIDCProvider, client *http.Client) *OpenID {
+	return &OpenID{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		Scopes:       cfg.Scopes,
+		Client:       client,
+	}
+}
+
+func (p *OpenID) AuthURL(ctx context.Context, auth Auth, redirectURI string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return withQuery(m.AuthorizationEndpoint, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {scopes(p.Scopes, DefaultScopes)},
+		"state":                 {auth.State},
+		"nonce":                 {auth.Nonce},
+		"code_challenge":        {auth.Challenge()},
+		"code_challenge_method": {"S256"},
+	})
+}
+
+// Exchange redeems the code and reads the identity from the ID token, whose
+// signature, issuer, audience, expiry and nonce are checked.
+func (p *OpenID) Exchange(ctx context.Context, code string, auth Auth, redirectURI string) (Identity, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {auth.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	// client_secret_basic, with the credentials form encoded first
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	tokens, err := redeem(p.Client, req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("oidc: redeeming the code from %s: %w", p.Issuer, err)
+	}
+	if tokens.IDToken == "" {
+		return Identity{}, fmt.Errorf("oidc: %s sent no ID token", p.Issuer)
+	}
+
+	claims, err := p.verify(ctx, m, tokens.IDToken, auth.Nonce)
+	if err != nil {
+		return Identity{}, fmt.Errorf("oidc: ID token from %s: %w", p.Issuer, err)
+	}
+	return Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// idTokenClaims are the claims read from an ID token.
+type idTokenClaims struct {
+	Nonce           string    `json:"nonce"`
+	Email           string    `json:"email"`
+	EmailVerified   claimBool `json:"email_verified"`
+	Name            string    `json:"name"`
+	AuthorizedParty string    `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// claimBool reads a boolean claim some providers send as a string.
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*b = value == true || value == "true"
+	return nil
+}
+
+// verify checks an ID token was signed by the provider for this client and
+// sign-in, and returns its claims.
+func (p *OpenID) verify(ctx context.Context, m metadata, idToken, nonce string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(signingMethods), jwt.WithoutClaimsValidation())
+	_, err := parser.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, m, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	switch {
+	case !claims.VerifyIssuer(m.Issuer, true):
+		return nil, fmt.Errorf("issued by %q", claims.Issuer)
+	case !claims.VerifyAudience(p.ClientID, true):
+		return nil, errors.New("issued to another client")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID:
+		return nil, errors.New("issued to another client")
+	case claims.ExpiresAt == nil || !claims.VerifyExpiresAt(now.Add(-clockSkew), true):
+		return nil, errors.New("expired")
+	case !claims.VerifyNotBefore(now.Add(clockSkew), false) || !claims.VerifyIssuedAt(now.Add(clockSkew), false):
+		return nil, errors.New("not valid yet")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, errors.New("issued for another sign-in")
+	case claims.Subject == "":
+		return nil, errors.New("no subject")
+	}
+	return claims, nil
+}
+
+// discover fetches the issuer's discovery document the first time it is
+// needed.
+func (p *OpenID) discover(ctx context.Context) (metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	var m metadata
+	endpoint := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, p.Client, endpoint, "", &m); err != nil {
+		return metadata{}, fmt.Errorf("oidc: discovering %s: %w", p.Issuer, err)
+	}
+	// A document naming another issuer could vouch for tokens it didn't sign
+	if m.Issuer != p.Issuer {
+		return metadata{}, fmt.Errorf("oidc: the discovery document of %s is for issuer %q", p.Issuer, m.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return metadata{}, fmt.Errorf("oidc: the discovery document of %s is missing endpoints", p.Issuer)
+	}
+	p.metadata = &m
+	return m, nil
+}
+
+// key returns the provider's signing key with the ID kid, or its only key
+// when kid is empty. The keys are fetched again when kid is unknown, as
+// providers rotate them; ID tokens come straight from the provider, so an
+// unknown kid can't be used to make it fetch them over and over.
+func (p *OpenID) key(ctx context.Context, m metadata, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, p.Client, m.JWKSURI, "", &set); err != nil {
+		return nil, fmt.Errorf("fetching the signing keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	p.keys = keys
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a key already fetched. Callers hold mu.
+func (p *OpenID) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// jwk is a public key of a JSON Web Key Set.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := decodeInt(k.N)
+		e, err2 := decodeInt(k.E)
+		if err := errors.Join(err1, err2); err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("malformed RSA key %q", k.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		x, err1 := decodeInt(k.X)
+		y, err2 := decodeInt(k.Y)
+		if err := errors.Join(err1, err2); err != nil || !ok || !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("malformed EC key %q", k.Kid)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeInt decodes a big-endian, base64url encoded integer.
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("malformed integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -1,51 +1,118 @@
 package main
 
 import (
+	"JobScoop/config"
 	"JobScoop/internal/db" // Import the db package
-	"JobScoop/internal/models"
+	"JobScoop/internal/handlers"
+	"JobScoop/internal/health"
+	"JobScoop/internal/logging"
+	"JobScoop/internal/metrics"
+	"JobScoop/internal/migrate"
+	"JobScoop/internal/ratelimit"
+	"JobScoop/internal/repository"
+	"JobScoop/internal/services/crawler"
+	"JobScoop/internal/services/digest"
+	"JobScoop/internal/services/jobsource"
+	"JobScoop/internal/services/mail"
+	"JobScoop/migrations"
 	"JobScoop/routes" // Import the routes package (where you define your routes)
 	"context"
-	"fmt"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 )
 
 func main() {
+	configPath := flag.String("config", "", "YAML or JSON config file (default $CONFIG_FILE)")
+	flag.Parse()
+
+	// Load the settings; the environment overrides the config file
+	cfg, err := config.Load(*configPath)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Log structured records at the configured level; the standard logger
+	// writes through the same handler
+	slog.SetDefault(logging.New(os.Stderr, cfg.Log))
+
 	// Initialize the DB connection
-	db.ConnectDB()
+	if err := db.ConnectDB(cfg.Database); err != nil {
+		fatal("Error connecting to the database", err)
+	}
 	defer func() {
 		if db.DB != nil {
 			db.DB.Close()
-			fmt.Println("Database connection closed successfully.")
+			slog.Info("Database connection closed")
 		}
 	}()
+	if err := metrics.RegisterDB(db.DB, cfg.Database.Name); err != nil {
+		fatal("Error registering the database metrics", err)
+	}
+
+	// Bring the schema up to date; the migration lock keeps concurrent
+	// instances from applying the same migration twice
+	migrator, err := migrate.New(db.DB, migrations.FS)
+	if err != nil {
+		fatal("Error loading migrations", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		fatal("Error applying migrations", err)
+	}
+
+	repos := repository.NewPostgres(db.DB)
 
-	// Create tables
-	models.CreateUserTable()
-	models.CreateResetTokensTable()
-	models.CreateCompanyTable()
-	models.CreateCareerSiteTable()
-	models.CreateRoleTable()
-	models.CreateSubscriptionTable()
+	// Crawl the job boards in the background; GetAllJobs serves what it stores
+	registry := jobsource.NewDefaultRegistry(cfg.Jobs, repos.CareerSites.ActiveLinks)
+	jobCrawler := crawler.New(jobsource.NewDefaultFetcher(registry, cfg.Jobs), repos, cfg.Crawler.Interval)
+	jobCrawler.Start()
+
+	// Email users the new jobs matching their subscriptions
+	mailer := mail.NewSMTPSender(mail.ConfigFrom(cfg.SMTP))
+	digester := digest.New(repos, mailer, cfg.Digest.Interval)
+	digester.Start()
+
+	// Ready once the database is reachable and migrated and the background
+	// jobs are running and crawling
+	maxCrawlAge := cfg.Crawler.MaxAge
+	if maxCrawlAge <= 0 {
+		maxCrawlAge = 2 * jobCrawler.Interval
+	}
+	checker := health.New()
+	checker.Add("database", health.Database(db.DB))
+	checker.Add("migrations", health.Migrations(migrator))
+	checker.Add("crawler", health.Crawl(jobCrawler.Status, maxCrawlAge))
+	checker.Add("digester", health.Running(digester.Running))
+
+	// Rate limits are kept in this process unless instances must share them
+	var limits ratelimit.Store = ratelimit.NewMemory()
+	if cfg.RateLimit.Store == "postgres" {
+		limits = ratelimit.NewPostgres(db.DB)
+	}
 
 	// Register your routes
-	router := routes.RegisterRoutes()
+	router := routes.RegisterRoutes(cfg, handlers.New(cfg, repos, mailer, jobCrawler), checker, limits)
 
 	// Start the server in a separate goroutine
-	port := "8080"
+	port := strconv.Itoa(cfg.Server.Port)
 	server := &http.Server{
 		Addr:    ":" + port,
 		Handler: router,
 	}
 
 	go func() {
-		fmt.Println("Server running on port", port)
+		slog.Info("Server running", "port", port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Could not listen on port %s: %v\n", port, err)
+			fatal("Could not listen", err, "port", port)
 		}
 	}()
 
@@ -53,15 +120,33 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
-	fmt.Println("\nShutting down server...")
+	slog.Info("Shutting down server")
+
+	// Fail readiness first so load balancers stop routing here while the
+	// requests already sent are still served
+	checker.Shutdown()
+	time.Sleep(cfg.Server.ShutdownDelay)
 
 	// Create a context with timeout to ensure cleanup
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal("Server forced to shutdown", err)
 	}
 
-	fmt.Println("Server exiting")
+	if err := jobCrawler.Stop(ctx); err != nil {
+		slog.Error("Crawler did not stop cleanly", "err", err)
+	}
+	if err := digester.Stop(ctx); err != nil {
+		slog.Error("Digester did not stop cleanly", "err", err)
+	}
+
+	slog.Info("Server exiting")
+}
+
+// fatal logs msg with err and exits.
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append([]any{"err", err}, args...)...)
+	os.Exit(1)
 }
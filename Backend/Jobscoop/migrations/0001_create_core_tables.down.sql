@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS career_sites;
+DROP TABLE IF EXISTS companies;
+DROP TABLE IF EXISTS reset_tokens;
+DROP TABLE IF EXISTS users;
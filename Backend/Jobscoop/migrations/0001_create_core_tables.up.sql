@@ -0,0 +1,46 @@
+-- Users, password reset tokens and subscriptions to companies' roles. Uses
+-- IF NOT EXISTS so databases created before migrations existed adopt it.
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	email VARCHAR(100) NOT NULL UNIQUE,
+	password VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS reset_tokens (
+	id SERIAL PRIMARY KEY,
+	email TEXT NOT NULL UNIQUE,
+	token TEXT NOT NULL UNIQUE,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS companies (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS career_sites (
+	id SERIAL PRIMARY KEY,
+	company_id INT NOT NULL,
+	link TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL,
+	company_id INT NOT NULL,
+	career_site_ids INT[] NOT NULL,
+	role_ids INT[] NOT NULL,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	interest_time TIMESTAMP,
+
+	CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	CONSTRAINT fk_company FOREIGN KEY (company_id) REFERENCES companies(id) ON DELETE CASCADE,
+	CONSTRAINT unique_user_company UNIQUE (user_id, company_id)
+);
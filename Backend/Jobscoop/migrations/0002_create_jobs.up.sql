@@ -0,0 +1,24 @@
+-- Jobs found by the crawler, de-duplicated across sources by fingerprint.
+CREATE TABLE IF NOT EXISTS jobs (
+	id SERIAL PRIMARY KEY,
+	fingerprint TEXT NOT NULL UNIQUE,
+	company TEXT NOT NULL,
+	title TEXT NOT NULL,
+	location TEXT NOT NULL DEFAULT '',
+	remote BOOLEAN NOT NULL DEFAULT FALSE,
+	salary JSONB,
+	posted_at TIMESTAMP,
+	valid_through TIMESTAMP,
+	employment_type TEXT NOT NULL DEFAULT '',
+	url TEXT NOT NULL DEFAULT '',
+	apply_urls TEXT[] NOT NULL DEFAULT '{}',
+	description TEXT NOT NULL DEFAULT '',
+	sources TEXT[] NOT NULL DEFAULT '{}',
+	payload JSONB,
+	first_seen TIMESTAMP NOT NULL,
+	last_seen TIMESTAMP NOT NULL
+);
+
+-- Jobs tables created before career sites were read lack these
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS valid_through TIMESTAMP;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS employment_type TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS crawl_state;
+DROP TABLE IF EXISTS job_matches;
@@ -0,0 +1,17 @@
+-- job_matches links stored jobs to the (company, role) pairs they were found
+-- for; crawl_state records when each pair was last refreshed.
+CREATE TABLE IF NOT EXISTS job_matches (
+	job_id INT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+	company_id INT NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+	role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+	PRIMARY KEY (job_id, company_id, role_id)
+);
+
+CREATE TABLE IF NOT EXISTS crawl_state (
+	company_id INT NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+	role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+	last_refreshed_at TIMESTAMP,
+	last_attempted_at TIMESTAMP NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (company_id, role_id)
+);
@@ -0,0 +1,15 @@
+-- digests has one row per email sent; digest_jobs records every job a user
+-- has been mailed about so no job is mailed twice.
+CREATE TABLE IF NOT EXISTS digests (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	sent_at TIMESTAMP NOT NULL,
+	job_count INT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS digest_jobs (
+	digest_id INT NOT NULL REFERENCES digests(id) ON DELETE CASCADE,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	job_id INT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+	PRIMARY KEY (user_id, job_id)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS send_hour;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS frequency;
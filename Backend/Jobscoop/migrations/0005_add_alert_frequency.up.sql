@@ -0,0 +1,7 @@
+-- How often each subscription's jobs are mailed, and when in the user's day.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS frequency TEXT NOT NULL DEFAULT 'daily'
+	CHECK (frequency IN ('instant', 'daily', 'weekly', 'off'));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'UTC';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS send_hour INT NOT NULL DEFAULT 8
+	CHECK (send_hour BETWEEN 0 AND 23);
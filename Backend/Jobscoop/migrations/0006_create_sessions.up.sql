@@ -0,0 +1,22 @@
+-- sessions has one row per login, with the user agent and address it was
+-- made from. Each session's refresh tokens are stored as SHA-256 hashes; a
+-- token is marked rotated, never deleted, when used so a replay is recognised.
+CREATE TABLE IF NOT EXISTS sessions (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	last_used_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token_hash TEXT PRIMARY KEY,
+	session_id INT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	rotated_at TIMESTAMP
+);
@@ -0,0 +1,6 @@
+DELETE FROM reset_tokens;
+ALTER TABLE reset_tokens DROP COLUMN IF EXISTS grant_expires_at;
+ALTER TABLE reset_tokens DROP COLUMN IF EXISTS grant_hash;
+ALTER TABLE reset_tokens DROP COLUMN IF EXISTS attempts;
+ALTER TABLE reset_tokens RENAME COLUMN code_hash TO token;
+ALTER TABLE reset_tokens ADD CONSTRAINT reset_tokens_token_key UNIQUE (token);
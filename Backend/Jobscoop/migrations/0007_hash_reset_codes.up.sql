@@ -0,0 +1,13 @@
+-- Reset codes were stored in plaintext; the outstanding ones are dropped and
+-- must be requested again.
+DELETE FROM reset_tokens;
+
+-- Codes are stored as bcrypt hashes, which differ for equal codes.
+ALTER TABLE reset_tokens DROP CONSTRAINT IF EXISTS reset_tokens_token_key;
+ALTER TABLE reset_tokens RENAME COLUMN token TO code_hash;
+
+-- Codes tried, and the single-use grant a verified code is exchanged
+-- for, stored hashed.
+ALTER TABLE reset_tokens ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE reset_tokens ADD COLUMN IF NOT EXISTS grant_hash TEXT;
+ALTER TABLE reset_tokens ADD COLUMN IF NOT EXISTS grant_expires_at TIMESTAMP;
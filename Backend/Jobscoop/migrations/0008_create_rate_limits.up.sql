@@ -0,0 +1,20 @@
+-- rate_limits holds the token buckets shared by the server's instances, one
+-- row per limited key such as "login:ip:203.0.113.7".
+CREATE TABLE IF NOT EXISTS rate_limits (
+	key TEXT PRIMARY KEY,
+	tokens DOUBLE PRECISION NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+-- Consecutive failed logins to an account from one client address, and
+-- until when too many of them lock the account for that address. Counting
+-- per address keeps anyone who knows an email from locking its owner out.
+-- Wrong two-factor codes are counted under the address "*", for every
+-- address at once.
+CREATE TABLE IF NOT EXISTS login_failures (
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	ip TEXT NOT NULL,
+	failures INT NOT NULL DEFAULT 0,
+	locked_until TIMESTAMP,
+	PRIMARY KEY (user_id, ip)
+);
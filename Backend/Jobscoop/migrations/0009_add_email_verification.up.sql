@@ -0,0 +1,6 @@
+-- When the user proved they own their email by following the link mailed to
+-- it. Job digests are only sent to verified addresses.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP;
+
+-- Accounts created before verification existed keep getting their digests
+UPDATE users SET verified_at = created_at WHERE verified_at IS NULL;
@@ -0,0 +1,17 @@
+-- Two-factor login with an authenticator app. The secret is set when
+-- enrollment starts and only used once totp_enabled_at is set, after the
+-- user confirmed a code. totp_last_step is the time step of the last code
+-- used, so each code logs in once.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;
+
+-- Single-use codes that stand in for the app when it is lost, stored as
+-- SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL UNIQUE,
+	used_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);
@@ -0,0 +1,13 @@
+-- Accounts at OpenID Connect and OAuth2 providers that sign users in, by
+-- the provider's name in the config and its stable ID for the account.
+-- email is the address the provider vouched for when the identity was
+-- linked.
+CREATE TABLE IF NOT EXISTS user_identities (
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	email TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (provider, subject)
+);
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
@@ -0,0 +1,11 @@
+// Package migrations holds the numbered SQL migrations that build the
+// database schema. Each version has a NNNN_name.up.sql file and a matching
+// .down.sql file that reverts it; internal/migrate applies them.
+package migrations
+
+import "embed"
+
+// FS holds every migration file.
+//
+//go:embed *.sql
+var FS embed.FS
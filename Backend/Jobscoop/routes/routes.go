@@ -1,62 +1,178 @@
 package routes
 
 import (
-	jobs "JobScoop/internal/handlers"
-	subscription "JobScoop/internal/handlers"
-	user "JobScoop/internal/handlers"
+	"JobScoop/config"
+	"JobScoop/internal/apierror"
+	"JobScoop/internal/handlers"
+	"JobScoop/internal/health"
+	"JobScoop/internal/metrics"
 	"JobScoop/internal/middleware"
+	"JobScoop/internal/ratelimit"
+	"log/slog"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
-func RegisterRoutes() *mux.Router {
+// RegisterRoutes returns the API's handler, serving requests with h and
+// taking the allowed origins, trusted proxies, token secret and rate limits
+// from cfg. The rate limits are counted in limits. checker answers the
+// /healthz and /readyz probes. Every request is tagged with an ID, access
+// logged to the default logger and counted in the metrics served at
+// /metrics.
+func RegisterRoutes(cfg *config.Config, h *handlers.Handlers, checker *health.Checker, limits ratelimit.Store) http.Handler {
 	router := mux.NewRouter()
-	router.Use(middleware.CORS)
-	router.HandleFunc("/signup", user.SignupHandler).Methods(http.MethodPost)
-	router.HandleFunc("/signup", user.SignupHandler).Methods(http.MethodOptions)
+	router.NotFoundHandler = middleware.Metrics(apierror.Handler(apierror.New(http.StatusNotFound, apierror.CodeNotFound, "No such endpoint")))
+	router.MethodNotAllowedHandler = middleware.Metrics(apierror.Handler(apierror.New(http.StatusMethodNotAllowed, apierror.CodeMethodNotAllowed, "Method not allowed")))
+	router.Use(middleware.Metrics)
+	router.Use(middleware.CORS(cfg.Server.CORSOrigins))
+
+	// Prometheus scrapes the metrics in its text format
+	router.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+
+	// Deployment probes
+	router.HandleFunc("/healthz", checker.Live).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", checker.Ready).Methods(http.MethodGet)
+
+	// The routes open to anyone are rate limited per client and per account,
+	// the account being found by account; by default the body's email
+	limitedBy := func(name string, limit config.RouteLimit, account middleware.KeyFunc, handler http.HandlerFunc) http.Handler {
+		byIP := middleware.RateLimit(limits, name+":ip", rateLimit(limit.IP), middleware.ClientIP)
+		byAccount := middleware.RateLimit(limits, name+":account", rateLimit(limit.Account), account)
+		return byIP(byAccount(handler))
+	}
+	limited := func(name string, limit config.RouteLimit, handler http.HandlerFunc) http.Handler {
+		return limitedBy(name, limit, middleware.AccountKey, handler)
+	}
+	rates := cfg.RateLimit
+
+	router.Handle("/signup", limited("signup", rates.Signup, h.Users.SignupHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/signup", h.Users.SignupHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/login", user.LoginHandler).Methods(http.MethodPost)
-	router.HandleFunc("/login", user.LoginHandler).Methods(http.MethodOptions)
+	router.Handle("/login", limited("login", rates.Login, h.Users.LoginHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/login", h.Users.LoginHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/forgot-password", user.ForgotPasswordHandler).Methods(http.MethodPost)
-	router.HandleFunc("/forgot-password", user.ForgotPasswordHandler).Methods(http.MethodOptions)
+	// A challenge works from any address, so codes are limited per user of
+	// the challenge
+	byChallenge := middleware.ChallengeKey(h.Users.ParseMFAChallenge)
+	router.Handle("/login/mfa", limitedBy("login_mfa", rates.LoginMFA, byChallenge, h.Users.LoginMFAHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/login/mfa", h.Users.LoginMFAHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/verify-code", user.VerifyCodeHandler).Methods(http.MethodPost)
-	router.HandleFunc("/verify-code", user.VerifyCodeHandler).Methods(http.MethodOptions)
+	router.Handle("/forgot-password", limited("forgot_password", rates.ForgotPassword, h.Users.ForgotPasswordHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/forgot-password", h.Users.ForgotPasswordHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/reset-password", user.ResetPasswordHandler).Methods(http.MethodPut)
-	router.HandleFunc("/reset-password", user.ResetPasswordHandler).Methods(http.MethodOptions)
+	router.Handle("/verify-code", limited("verify_code", rates.VerifyCode, h.Users.VerifyCodeHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/verify-code", h.Users.VerifyCodeHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/save-subscriptions", subscription.SaveSubscriptionsHandler).Methods(http.MethodPost)
-	router.HandleFunc("/save-subscriptions", subscription.SaveSubscriptionsHandler).Methods(http.MethodOptions)
+	router.Handle("/reset-password", limited("reset_password", rates.ResetPassword, h.Users.ResetPasswordHandler)).Methods(http.MethodPut)
+	router.HandleFunc("/reset-password", h.Users.ResetPasswordHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/fetch-user-subscriptions", subscription.FetchUserSubscriptionsHandler).Methods(http.MethodPost)
-	router.HandleFunc("/fetch-user-subscriptions", subscription.FetchUserSubscriptionsHandler).Methods(http.MethodOptions)
+	router.Handle("/refresh", limited("refresh", rates.Refresh, h.Sessions.RefreshHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/refresh", h.Sessions.RefreshHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/update-subscriptions", subscription.UpdateSubscriptionsHandler).Methods(http.MethodPut)
-	router.HandleFunc("/update-subscriptions", subscription.UpdateSubscriptionsHandler).Methods(http.MethodOptions)
+	router.Handle("/verify-email", limited("verify_email", rates.VerifyEmail, h.Users.VerifyEmailHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/verify-email", h.Users.VerifyEmailHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/delete-subscriptions", subscription.DeleteSubscriptionsHandler).Methods(http.MethodPost)
-	router.HandleFunc("/delete-subscriptions", subscription.DeleteSubscriptionsHandler).Methods(http.MethodOptions)
+	// Signing in through OpenID Connect and OAuth2 providers
+	router.HandleFunc("/oidc/providers", h.Users.OIDCProvidersHandler).Methods(http.MethodGet)
+	router.HandleFunc("/oidc/providers", h.Users.OIDCProvidersHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/fetch-all-subscriptions", subscription.FetchAllSubscriptionsHandler).Methods(http.MethodGet)
-	router.HandleFunc("/fetch-all-subscriptions", subscription.FetchAllSubscriptionsHandler).Methods(http.MethodOptions)
+	router.Handle("/oidc/{provider:[a-z0-9_]+}/start", limited("oidc", rates.OIDC, h.Users.OIDCStartHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/oidc/{provider:[a-z0-9_]+}/start", h.Users.OIDCStartHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/get-user", user.GetUser).Methods(http.MethodPost)
-	router.HandleFunc("/get-user", user.GetUser).Methods(http.MethodOptions)
+	router.Handle("/oidc/{provider:[a-z0-9_]+}/callback", limited("oidc", rates.OIDC, h.Users.OIDCCallbackHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/oidc/{provider:[a-z0-9_]+}/callback", h.Users.OIDCCallbackHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/update-user", user.UpdateUser).Methods(http.MethodPut)
-	router.HandleFunc("/update-user", user.UpdateUser).Methods(http.MethodOptions)
+	// User-scoped routes identify the caller by the bearer token, whose
+	// session must not have been revoked
+	authed := router.NewRoute().Subrouter()
+	authed.Use(middleware.Authenticate(cfg.Auth.JWTSecret, h.Tokens.SessionActive))
 
-	router.HandleFunc("/subscriptions/jobs", jobs.GetAllJobs).Methods(http.MethodPost)
-	router.HandleFunc("/subscriptions/jobs", jobs.GetAllJobs).Methods(http.MethodOptions)
+	authed.HandleFunc("/logout", h.Sessions.LogoutHandler).Methods(http.MethodPost)
+	router.HandleFunc("/logout", h.Sessions.LogoutHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/fetch-subscription-frequencies", subscription.FetchSubscriptionFrequenciesHandler).Methods(http.MethodGet)
-	router.HandleFunc("/fetch-subscription-frequencies", subscription.FetchSubscriptionFrequenciesHandler).Methods(http.MethodOptions)
+	// Verification emails are limited per signed-in user rather than per
+	// email in the body
+	resend := rates.ResendVerification
+	authed.Handle("/v1/me/verification-email",
+		middleware.RateLimit(limits, "resend_verification:ip", rateLimit(resend.IP), middleware.ClientIP)(
+			middleware.RateLimit(limits, "resend_verification:account", rateLimit(resend.Account), middleware.UserKey)(
+				http.HandlerFunc(h.Users.ResendVerificationHandler)))).Methods(http.MethodPost)
+	router.HandleFunc("/v1/me/verification-email", h.Users.ResendVerificationHandler).Methods(http.MethodOptions)
 
-	router.HandleFunc("/fetch-all-user-subscriptions", subscription.FetchAllUserSubscriptionsHandler).Methods(http.MethodGet)
-	router.HandleFunc("/fetch-all-user-subscriptions", subscription.FetchAllUserSubscriptionsHandler).Methods(http.MethodOptions)
+	// Two-factor login
+	authed.HandleFunc("/v1/me/mfa/totp", h.Users.EnrollTOTP).Methods(http.MethodPost)
+	authed.HandleFunc("/v1/me/mfa/totp", h.Users.DisableTOTP).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/me/mfa/totp", h.Users.EnrollTOTP).Methods(http.MethodOptions)
 
-	return router
+	authed.HandleFunc("/v1/me/mfa/totp/confirm", h.Users.ConfirmTOTP).Methods(http.MethodPost)
+	router.HandleFunc("/v1/me/mfa/totp/confirm", h.Users.ConfirmTOTP).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/v1/me/mfa/recovery-codes", h.Users.RegenerateRecoveryCodes).Methods(http.MethodPost)
+	router.HandleFunc("/v1/me/mfa/recovery-codes", h.Users.RegenerateRecoveryCodes).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/v1/me/sessions", h.Sessions.ListSessions).Methods(http.MethodGet)
+	authed.HandleFunc("/v1/me/sessions", h.Sessions.RevokeAllSessions).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/me/sessions", h.Sessions.ListSessions).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/v1/me/sessions/{id:[0-9]+}", h.Sessions.RevokeSession).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/me/sessions/{id:[0-9]+}", h.Sessions.RevokeSession).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/v1/me/subscriptions", h.Subscriptions.ListSubscriptions).Methods(http.MethodGet)
+	authed.HandleFunc("/v1/me/subscriptions", h.Subscriptions.CreateSubscription).Methods(http.MethodPost)
+	router.HandleFunc("/v1/me/subscriptions", h.Subscriptions.ListSubscriptions).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/v1/me/subscriptions/{id:[0-9]+}", h.Subscriptions.GetSubscription).Methods(http.MethodGet)
+	authed.HandleFunc("/v1/me/subscriptions/{id:[0-9]+}", h.Subscriptions.PatchSubscription).Methods(http.MethodPatch)
+	authed.HandleFunc("/v1/me/subscriptions/{id:[0-9]+}", h.Subscriptions.DeleteSubscription).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/me/subscriptions/{id:[0-9]+}", h.Subscriptions.GetSubscription).Methods(http.MethodOptions)
+
+	// Deprecated aliases of /v1/me/subscriptions, kept for existing clients
+	authed.HandleFunc("/save-subscriptions", deprecated(h.Subscriptions.SaveSubscriptionsHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/save-subscriptions", h.Subscriptions.SaveSubscriptionsHandler).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/fetch-user-subscriptions", deprecated(h.Subscriptions.FetchUserSubscriptionsHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/fetch-user-subscriptions", h.Subscriptions.FetchUserSubscriptionsHandler).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/update-subscriptions", deprecated(h.Subscriptions.UpdateSubscriptionsHandler)).Methods(http.MethodPut)
+	router.HandleFunc("/update-subscriptions", h.Subscriptions.UpdateSubscriptionsHandler).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/delete-subscriptions", deprecated(h.Subscriptions.DeleteSubscriptionsHandler)).Methods(http.MethodPost)
+	router.HandleFunc("/delete-subscriptions", h.Subscriptions.DeleteSubscriptionsHandler).Methods(http.MethodOptions)
+
+	// The catalog and the trends across users are for signed-in users only
+	authed.HandleFunc("/fetch-all-subscriptions", h.Subscriptions.FetchAllSubscriptionsHandler).Methods(http.MethodGet)
+	router.HandleFunc("/fetch-all-subscriptions", h.Subscriptions.FetchAllSubscriptionsHandler).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/get-user", h.Users.GetUser).Methods(http.MethodPost)
+	router.HandleFunc("/get-user", h.Users.GetUser).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/update-user", h.Users.UpdateUser).Methods(http.MethodPut)
+	router.HandleFunc("/update-user", h.Users.UpdateUser).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/subscriptions/jobs", h.Jobs.GetAllJobs).Methods(http.MethodPost)
+	router.HandleFunc("/subscriptions/jobs", h.Jobs.GetAllJobs).Methods(http.MethodOptions)
+
+	router.HandleFunc("/fetch-subscription-frequencies", h.Subscriptions.FetchSubscriptionFrequenciesHandler).Methods(http.MethodGet)
+	router.HandleFunc("/fetch-subscription-frequencies", h.Subscriptions.FetchSubscriptionFrequenciesHandler).Methods(http.MethodOptions)
+
+	authed.HandleFunc("/fetch-all-user-subscriptions", h.Subscriptions.FetchAllUserSubscriptionsHandler).Methods(http.MethodGet)
+	router.HandleFunc("/fetch-all-user-subscriptions", h.Subscriptions.FetchAllUserSubscriptionsHandler).Methods(http.MethodOptions)
+
+	return middleware.TrustedProxies(cfg.Server.TrustedProxies)(middleware.RequestID(middleware.AccessLog(slog.Default())(router)))
+}
+
+// rateLimit converts a configured rate to a bucket's limit.
+func rateLimit(rate config.Rate) ratelimit.Limit {
+	return ratelimit.Limit{Count: rate.Count, Per: rate.Per}
+}
+
+// deprecated marks the responses of a route superseded by
+// /v1/me/subscriptions, pointing clients at its successor.
+func deprecated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", `</v1/me/subscriptions>; rel="successor-version"`)
+		handler(w, r)
+	}
 }
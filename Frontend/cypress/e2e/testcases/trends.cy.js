@@ -206,7 +206,7 @@ describe('Trends Page Tests', () => {
               // Set up successful intercepts for retry
               cy.intercept('GET', '**/fetch-all-user-subscriptions', {
                 statusCode: 200,
-                body: [{ date: '2023-07-15T00:00:00.000Z', company: 'Google', roleNames: ['Software Engineer'], user: 'user1' }]
+                body: [{ date: '2023-07-15T00:00:00.000Z', company: 'Google', roleNames: ['Software Engineer'] }]
               }).as('retrySubscriptions')
               
               cy.intercept('GET', '**/fetch-subscription-frequencies', {
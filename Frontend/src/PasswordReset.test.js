@@ -312,7 +312,7 @@ describe('PasswordReset Component', () => {
     
     axios.post.mockResolvedValueOnce({
       status: 200,
-      data: { message: 'Code verified successfully' }
+      data: { message: 'Verification successful', resetToken: 'reset-token', expiresIn: 600 }
     });
     
     await userEvent.click(screen.getByRole('button'));
@@ -335,7 +335,8 @@ describe('PasswordReset Component', () => {
     await waitFor(() => {
       expect(axios.put).toHaveBeenCalledWith('http://localhost:8080/reset-password', {
         email: 'test@example.com',
-        new_password: 'Password123!'
+        new_password: 'Password123!',
+        reset_token: 'reset-token'
       });
       expect(mockedNavigate).toHaveBeenCalledWith('/login');
     }, { timeout: 5000 });
@@ -23,6 +23,7 @@ import {
   Alert
 } from '@mui/material';
 import axios from 'axios';
+import { API_URL } from './contexts/AuthContext';
 import {
   Edit as EditIcon,
   Home as HomeIcon,
@@ -87,7 +88,7 @@ function Profile() {
     try {
       let user = JSON.parse(localStorage.getItem('user'))
       let payload = { email: user.username }
-      const response = await axios.post('http://localhost:8080/fetch-user-subscriptions', payload);
+      const response = await axios.post(`${API_URL}/fetch-user-subscriptions`, payload);
 
       if (response.status == 200) {
         // setloading(false);
@@ -111,7 +112,7 @@ function Profile() {
     try {
       let user = JSON.parse(localStorage.getItem('user'))
       let payload = { email: user.username }
-      const response = await axios.post('http://localhost:8080/get-user', payload);
+      const response = await axios.post(`${API_URL}/get-user`, payload);
 
       if (response.status == 200) {
         // setloading(false);
@@ -149,7 +150,7 @@ function Profile() {
   const handleNameChange =async () => {
     setUser({ ...user, name: newName });
     try {
-      await axios.put("http://localhost:8080/update-user", { "email": user.email, "name": newName });
+      await axios.put(`${API_URL}/update-user`, { "email": user.email, "name": newName });
       setalertmsg({ "open": true, "msg": "Name Change Succesfull", "type": "success" })
     } catch (error) {
       setalertmsg({ "open": true, "msg": "Name Change Failed", "type": "error" })
@@ -4,6 +4,7 @@ import SignUp from '../login/signup';
 import Home from '../landing';
 import ProtectedRoute from './protectedRoutes';
 import PasswordReset from '../login/PasswordReset';
+import VerifyEmail from '../login/VerifyEmail';
 import { Navigate } from "react-router-dom";
 import Layout from '../Layout';
 import Trends from '../Trends';
@@ -36,6 +37,11 @@ const router = createBrowserRouter([
         element: <PasswordReset></PasswordReset>,
         errorElement: <div>ERROR 404: NOT FOUND</div>
       },
+      {
+        path: '/verify-email',
+        element: <VerifyEmail></VerifyEmail>,
+        errorElement: <div>ERROR 404: NOT FOUND</div>
+      },
       {
         path: '/subscribe',
         element: <ProtectedRoute> <Subscribe></Subscribe></ProtectedRoute>,
@@ -101,7 +101,6 @@ const Trends = () => {
         dateSubscribed: item.date.substring(0, 10), // Extract YYYY-MM-DD from date
         company: item.company,
         role: item.roleNames[0], // Taking the first role for simplicity
-        userId: item.user,
         // We can add more roles if needed later
         roles: item.roleNames
       }));
@@ -32,26 +32,22 @@ const mockSubscriptionData = [
   {
     date: '2023-07-15T00:00:00.000Z',
     company: 'Google',
-    roleNames: ['Software Engineer'],
-    user: 'user1'
+    roleNames: ['Software Engineer']
   },
   {
     date: '2023-07-20T00:00:00.000Z',
     company: 'Amazon',
-    roleNames: ['Data Scientist'],
-    user: 'user2'
+    roleNames: ['Data Scientist']
   },
   {
     date: '2023-08-05T00:00:00.000Z',
     company: 'Microsoft',
-    roleNames: ['Product Manager'],
-    user: 'user3'
+    roleNames: ['Product Manager']
   },
   {
     date: '2023-08-10T00:00:00.000Z',
     company: 'Google',
-    roleNames: ['UX Designer'],
-    user: 'user4'
+    roleNames: ['UX Designer']
   }
 ];
 
@@ -1,6 +1,21 @@
 import React, { createContext, useState, useEffect } from "react";
 // import { useNavigate} from 'react-router-dom';
 import { jwtDecode } from "jwt-decode";
+import axios from "axios";
+
+// The backend's address. Requests to it carry the signed-in user's token.
+export const API_URL = "http://localhost:8080";
+
+// Attach the token login stored to every request to the backend, whose
+// user-scoped routes answer 401 without it. It is read on each request, so
+// requests made before AuthProvider's effects run carry it too.
+axios.interceptors.request.use((config) => {
+  const token = localStorage.getItem("token");
+  if (token && config.url && config.url.startsWith(API_URL)) {
+    config.headers.Authorization = `Bearer ${token}`;
+  }
+  return config;
+});
 
 // Create Context
 export const AuthContext = createContext();
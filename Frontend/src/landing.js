@@ -20,6 +20,7 @@ import FormControl from '@mui/material/FormControl';
 import Select from '@mui/material/Select';
 import { useTheme } from '@mui/material/styles';
 import axios from 'axios';
+import { API_URL } from './contexts/AuthContext';
 
 
 // Company Color Palette
@@ -191,7 +192,7 @@ const LandingPage = () => {
             let user = JSON.parse(localStorage.getItem('user'))
             let payload = { "email": user.username }
             console.log("payload")
-            let res = await axios.post("http://localhost:8080/subscriptions/jobs", payload);
+            let res = await axios.post(`${API_URL}/subscriptions/jobs`, payload);
             console.log("Jobs", res)
             if (res.data.jobs == null) {
                 setjobsData([])
@@ -11,6 +11,7 @@ function PasswordReset() {
     const [activeStep, setActiveStep] = useState(0);
     const [email, setEmail] = useState("");
     const [code, setCode] = useState("");
+    const [resetToken, setResetToken] = useState("");
     const [newPassword, setNewPassword] = useState("");
     const [confirmPassword, setConfirmPassword] = useState("");
     const [error, setError] = useState(false);
@@ -64,7 +65,8 @@ function PasswordReset() {
         } else if (activeStep === 1) {
             // Verify code
             try {
-                await axios.post("http://localhost:8080/verify-code", { "email":email, "token":code });
+                const response = await axios.post("http://localhost:8080/verify-code", { "email":email, "token":code });
+                setResetToken(response.data.resetToken);
                 setActiveStep(2);
             } catch (error) {
                 setErrorMessage("Invalid verification code.");
@@ -80,7 +82,7 @@ function PasswordReset() {
                 return;
             }
             try {
-                await axios.put("http://localhost:8080/reset-password", { "email":email, "new_password":newPassword });
+                await axios.put("http://localhost:8080/reset-password", { "email":email, "new_password":newPassword, "reset_token":resetToken });
                 navigate("/login");
             } catch (error) {
                 setErrorMessage("Failed to reset password.");
@@ -0,0 +1,60 @@
+import React, { useState, useEffect } from "react";
+import { Card, CardContent, Typography, Button, CircularProgress } from "@mui/material";
+import { useNavigate, useSearchParams } from "react-router-dom";
+import axios from "axios";
+import "./login.css";
+
+// Opened from the link in the verification email; posts its token back to
+// the server.
+function VerifyEmail() {
+    const [searchParams] = useSearchParams();
+    const [status, setStatus] = useState("verifying");
+    const [message, setMessage] = useState("");
+
+    const navigate = useNavigate();
+
+    useEffect(() => {
+        const token = searchParams.get("token");
+        if (!token) {
+            setStatus("failed");
+            setMessage("This verification link is incomplete.");
+            return;
+        }
+        axios.post("http://localhost:8080/verify-email", { "token": token })
+            .then(() => setStatus("verified"))
+            .catch((error) => {
+                setStatus("failed");
+                setMessage(error.response?.data?.error?.message || "Could not verify your email.");
+            });
+    }, [searchParams]);
+
+    return (
+        <div className="bg-image d-flex justify-content-center align-items-center vh-100 bg-secondary p-4">
+            <Card className="card-container row shadow-lg rounded" style={{ backgroundColor: "rgba(255, 255, 255, 0.8)", backdropFilter: "blur(7px)" }}>
+                <CardContent style={{ marginTop: '40px' }} className="text-center">
+                    <Typography variant="h4" className="font-serif text-center fw-bold mb-4">
+                        Verify Email
+                    </Typography>
+
+                    {status === "verifying" && <CircularProgress />}
+                    {status === "verified" && (
+                        <Typography>Your email is verified. Job alerts will now be sent to it.</Typography>
+                    )}
+                    {status === "failed" && <Typography color="error">{message}</Typography>}
+
+                    <Button
+                        variant="contained"
+                        fullWidth
+                        className="btn btn-success py-2 mt-4"
+                        onClick={() => navigate("/login")}
+                        disabled={status === "verifying"}
+                    >
+                        Go to Login
+                    </Button>
+                </CardContent>
+            </Card>
+        </div>
+    );
+}
+
+export default VerifyEmail;
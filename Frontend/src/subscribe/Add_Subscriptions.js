@@ -1,5 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import axios from 'axios';
+import { API_URL } from '../contexts/AuthContext';
 import { cloneDeep } from 'lodash';
 import {
     Button,
@@ -228,7 +229,7 @@ function AddSubscriptions() {
     const saveSubscriptions = async (subscribePayload) => {
         try {
             setLoading(true);
-            const response = await axios.post('http://localhost:8080/save-subscriptions', subscribePayload);
+            const response = await axios.post(`${API_URL}/save-subscriptions`, subscribePayload);
             return response;
         } catch (error) {
             console.error('Error saving subscriptions:', error);
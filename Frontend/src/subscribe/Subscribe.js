@@ -11,6 +11,7 @@ import SearchIcon from '@mui/icons-material/Search';
 import { cloneDeep } from "lodash";
 import _ from "lodash";
 import axios from 'axios';
+import { API_URL } from '../contexts/AuthContext';
 import { useNavigate } from 'react-router-dom';
 import "./Subscribe.css";
 
@@ -181,7 +182,7 @@ function Subscribe() {
 
     const UpdateSubscriptions = async (subscribePayload) => {
         try {
-            const response = await axios.put('http://localhost:8080/update-subscriptions', subscribePayload);
+            const response = await axios.put(`${API_URL}/update-subscriptions`, subscribePayload);
             return response
         } catch (error) {
             console.error('Error fetching data:', error);
@@ -206,7 +207,7 @@ function Subscribe() {
         }
 
         try {
-            const response = await axios.post('http://localhost:8080/delete-subscriptions', payload);
+            const response = await axios.post(`${API_URL}/delete-subscriptions`, payload);
             setsnackAlert({
                 open: true,
                 severity: 'success',
@@ -270,7 +271,7 @@ function Subscribe() {
         try {
             let user = JSON.parse(localStorage.getItem('user'))
             let payload = { email: user.username }
-            const response = await axios.post('http://localhost:8080/fetch-user-subscriptions', payload);
+            const response = await axios.post(`${API_URL}/fetch-user-subscriptions`, payload);
 
             if (response.status == 200) {
                 // Initialize with an empty array if subscriptions is null or undefined